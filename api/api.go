@@ -0,0 +1,107 @@
+// Package api calls the HTTP API of the relay server: session setup, user info and settings
+// recommended by the server. All calls share the authorization by the user key, the user agent
+// set in common.UserAgent, retries and mapping of failures to the exported errors.
+package api
+
+import (
+	"context"
+	"eiproxy/common"
+	"eiproxy/protocol"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Client calls the API of the server authorized by the user key.
+type Client struct {
+	ServerURL url.URL
+	UserKey   protocol.UserKey
+	// Limit of each call including retries, only the context limits it if zero.
+	Timeout time.Duration
+	// Pinned key of the server, see common.ApiRequestOptions.Fingerprint.
+	Fingerprint string
+}
+
+// ConnectRequest describes the session requested by Connect.
+type ConnectRequest struct {
+	ClientVersion string
+	// One of simultaneous sessions with the key, see protocol.ConnectSlotParam. Zero asks for
+	// the only session.
+	Slot         int
+	Capabilities []protocol.Capability
+}
+
+// Connect opens a session on the server. The response is returned with protocol.ConnectionCode
+// errors as well, as it may tell when to retry.
+func (c Client) Connect(ctx context.Context, req ConnectRequest) (protocol.ConnectionResponse, error) {
+	var resp protocol.ConnectionResponse
+
+	q := url.Values{}
+	q.Add("proto", protocol.Version)
+	q.Add("client", req.ClientVersion)
+	if req.Slot > 0 {
+		q.Add(protocol.ConnectSlotParam, strconv.Itoa(req.Slot))
+	}
+	if len(req.Capabilities) > 0 {
+		q.Add("caps", protocol.FormatCapabilities(req.Capabilities))
+	}
+	if err := c.request(ctx, http.MethodPost, "api/connect", q, &resp); err != nil {
+		return resp, err
+	}
+
+	if resp.ErrorCode != nil {
+		return resp, ClassifyError(fmt.Errorf("server returned error: %w", *resp.ErrorCode))
+	}
+	if resp.ErrorMessage != nil {
+		return resp, fmt.Errorf("server returned error: %v", *resp.ErrorMessage)
+	}
+	if resp.Port == nil || resp.Token == nil {
+		return resp, fmt.Errorf("server returned invalid response: %v", resp)
+	}
+	return resp, nil
+}
+
+// Disconnect closes the session of the slot on the server, e.g. the one left by a client which
+// has crashed, so the slot doesn't wait for the session timeout.
+func (c Client) Disconnect(ctx context.Context, slot int) error {
+	q := url.Values{}
+	if slot > 0 {
+		q.Add(protocol.ConnectSlotParam, strconv.Itoa(slot))
+	}
+	return c.request(ctx, http.MethodPost, "api/disconnect", q, nil)
+}
+
+// GetUser returns the user the key belongs to.
+func (c Client) GetUser(ctx context.Context) (protocol.UserResponse, error) {
+	var resp protocol.UserResponse
+	err := c.request(ctx, http.MethodGet, "api/user", nil, &resp)
+	return resp, err
+}
+
+// ServerConfig returns settings recommended by the server.
+func (c Client) ServerConfig(ctx context.Context) (protocol.ServerConfig, error) {
+	var resp protocol.ServerConfig
+	err := c.request(ctx, http.MethodGet, "api/config", nil, &resp)
+	return resp, err
+}
+
+// request makes the call within Client.Timeout. GET requests are retried on transient errors,
+// others might have taken effect on the server.
+func (c Client) request(ctx context.Context, method, path string, query url.Values, response any) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	u := c.ServerURL.JoinPath(path)
+	u.RawQuery = query.Encode()
+
+	opts := common.ApiRequestOptions{AuthKey: c.UserKey.String(), Fingerprint: c.Fingerprint}
+	if method == http.MethodGet {
+		opts.Retry = common.DefaultApiRetry
+	}
+	return ClassifyError(common.MakeApiRequestWithOptions(ctx, method, u.String(), nil, response, opts))
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"eiproxy/proxytest"
+	"errors"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, srv *proxytest.Server, key protocol.UserKey) Client {
+	t.Helper()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Client{ServerURL: *u, UserKey: key, Timeout: 5 * time.Second}
+}
+
+func TestClientErrors(t *testing.T) {
+	key, err := protocol.NewUserKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := protocol.NewUserKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		key        protocol.UserKey
+		keyExpired bool
+		wantErr    error
+	}{
+		{name: "authorized", key: key},
+		{name: "unknown key", key: other, wantErr: ErrUnauthorized},
+		{name: "expired key", key: key, keyExpired: true, wantErr: protocol.ErrorCodeKeyExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := proxytest.NewServer()
+			defer srv.Close()
+			srv.Key = key.String()
+			srv.KeyExpired = tt.keyExpired
+			srv.User = protocol.UserResponse{Email: "tester@example.com"}
+			c := newTestClient(t, srv, tt.key)
+
+			user, err := c.GetUser(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetUser() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && user.Email != "tester@example.com" {
+				t.Errorf("GetUser() returned %+v", user)
+			}
+			if _, err = c.Connect(context.Background(), ConnectRequest{}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Connect() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("Connect() = %v, want it to be classified as %v", err, ErrUnauthorized)
+			}
+		})
+	}
+}
+
+func TestClientConnect(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	c := newTestClient(t, srv, protocol.UserKey{})
+
+	caps := []protocol.Capability{protocol.CapabilityPing, protocol.CapabilityEncryption}
+	resp, err := c.Connect(context.Background(), ConnectRequest{ClientVersion: "test", Capabilities: caps})
+	if err != nil {
+		t.Fatalf("Connect() = %v", err)
+	}
+	if len(resp.Capabilities) != 1 || resp.Capabilities[0] != protocol.CapabilityPing {
+		t.Errorf("Connect() granted %v, want only %v", resp.Capabilities, protocol.CapabilityPing)
+	}
+	if got := srv.RequestedCapabilities(); len(got) != len(caps) {
+		t.Errorf("server got capabilities %v, want %v", got, caps)
+	}
+
+	if err = c.Disconnect(context.Background(), 0); err != nil {
+		t.Fatalf("Disconnect() = %v", err)
+	}
+	if err = srv.Send(netip.MustParseAddrPort("10.0.0.1:1000"), []byte("x")); err == nil {
+		t.Errorf("session is open after Disconnect")
+	}
+}
+
+func TestClientServerConfig(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	c := newTestClient(t, srv, protocol.UserKey{})
+
+	if _, err := c.ServerConfig(context.Background()); !errors.Is(err, protocol.ErrorCodeNotFound) {
+		t.Errorf("ServerConfig() without config = %v, want %v", err, protocol.ErrorCodeNotFound)
+	}
+
+	batch := 5
+	srv.Config = &protocol.ServerConfig{BatchWindowMs: &batch}
+	cfg, err := c.ServerConfig(context.Background())
+	if err != nil {
+		t.Fatalf("ServerConfig() = %v", err)
+	}
+	if cfg.BatchWindowMs == nil || *cfg.BatchWindowMs != batch {
+		t.Errorf("ServerConfig() = %+v, want batch window %d", cfg, batch)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"eiproxy/common"
+	"eiproxy/protocol"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Errors returned by Client wrap one of these, so callers can tell failure classes apart with
+// errors.Is.
+var (
+	// Server rejected the access key.
+	ErrUnauthorized = errors.New("access key is unauthorized")
+	// Server has no free slots.
+	ErrServerFull = errors.New("server is full")
+	// Server doesn't support this client version.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// Server is temporarily unavailable.
+	ErrMaintenance = errors.New("server is under maintenance")
+	// Server is unreachable or stopped responding.
+	ErrNetwork = errors.New("network error")
+)
+
+// ClassifyError wraps err with the matching exported error. Errors which don't fall into any
+// class and already classified ones are returned as is.
+func ClassifyError(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	for _, known := range []error{
+		ErrUnauthorized, ErrServerFull, ErrVersionMismatch, ErrMaintenance, ErrNetwork,
+	} {
+		if errors.Is(err, known) {
+			return err
+		}
+	}
+
+	var class error
+	var httpErr common.HttpError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, protocol.ErrorCodeUnauthorized), errors.Is(err, protocol.ErrorCodeKeyExpired):
+		class = ErrUnauthorized
+	case errors.Is(err, protocol.ErrorCodeMaintenance):
+		class = ErrMaintenance
+	case errors.As(err, &httpErr):
+		switch httpErr {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			class = ErrUnauthorized
+		case http.StatusServiceUnavailable:
+			class = ErrMaintenance
+		}
+	case errors.Is(err, protocol.ConnectionCodeServerFull):
+		class = ErrServerFull
+	case errors.Is(err, protocol.ConnectionCodeVersionMismatch):
+		class = ErrVersionMismatch
+	case errors.As(err, &netErr):
+		class = ErrNetwork
+	}
+	if class == nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", class, err)
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+)
+
+// HostPort is a host name or IP address with a port, e.g. "vps.gipat.ru:28004". It's
+// (un)marshaled as a string, so it's validated when config is loaded.
+type HostPort struct {
+	Host string
+	Port uint16
+}
+
+func ParseHostPort(s string) (HostPort, error) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return HostPort{}, fmt.Errorf("invalid address %q: %w", s, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 || host == "" {
+		return HostPort{}, fmt.Errorf("invalid address %q", s)
+	}
+	return HostPort{Host: host, Port: uint16(port)}, nil
+}
+
+func MustParseHostPort(s string) HostPort {
+	h, err := ParseHostPort(s)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+func (h HostPort) IsZero() bool {
+	return h == HostPort{}
+}
+
+func (h HostPort) String() string {
+	if h.IsZero() {
+		return ""
+	}
+	return net.JoinHostPort(h.Host, strconv.Itoa(int(h.Port)))
+}
+
+// AddrPort returns the address if host is an IP address.
+func (h HostPort) AddrPort() (netip.AddrPort, bool) {
+	ip, err := netip.ParseAddr(h.Host)
+	if err != nil {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(ip, h.Port), true
+}
+
+func (h HostPort) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *HostPort) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*h = HostPort{}
+		return nil
+	}
+	parsed, err := ParseHostPort(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// URL is an absolute http(s) URL, which is (un)marshaled as a string.
+type URL struct {
+	url.URL
+}
+
+func ParseURL(s string) (URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return URL{}, fmt.Errorf("invalid url %q: %w", s, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return URL{}, fmt.Errorf("invalid url %q: must be absolute http(s) url", s)
+	}
+	return URL{*u}, nil
+}
+
+func MustParseURL(s string) URL {
+	u, err := ParseURL(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func (u URL) IsZero() bool {
+	return u.Host == ""
+}
+
+func (u URL) String() string {
+	if u.IsZero() {
+		return ""
+	}
+	return u.URL.String()
+}
+
+func (u URL) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+func (u *URL) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*u = URL{}
+		return nil
+	}
+	parsed, err := ParseURL(string(text))
+	if err != nil {
+		return err
+	}
+	*u = parsed
+	return nil
+}
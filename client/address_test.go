@@ -0,0 +1,102 @@
+package client
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+)
+
+func TestParseHostPort(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    HostPort
+		wantErr bool
+	}{
+		{"vps.gipat.ru:28004", HostPort{"vps.gipat.ru", 28004}, false},
+		{"1.2.3.4:80", HostPort{"1.2.3.4", 80}, false},
+		{"[::1]:80", HostPort{"::1", 80}, false},
+		{"vps.gipat.ru", HostPort{}, true},
+		{":80", HostPort{}, true},
+		{"host:0", HostPort{}, true},
+		{"host:70000", HostPort{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseHostPort(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHostPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHostPort() = %v, want %v", got, tt.want)
+			}
+			if err == nil && got.String() != tt.s {
+				t.Errorf("String() = %q, want %q", got.String(), tt.s)
+			}
+		})
+	}
+}
+
+func TestHostPortAddrPort(t *testing.T) {
+	if addr, ok := MustParseHostPort("1.2.3.4:80").AddrPort(); !ok ||
+		addr != netip.MustParseAddrPort("1.2.3.4:80") {
+		t.Errorf("AddrPort() = %v, %v", addr, ok)
+	}
+	if _, ok := MustParseHostPort("example.com:80").AddrPort(); ok {
+		t.Errorf("AddrPort() ok = true for host name")
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		s       string
+		wantErr bool
+	}{
+		{"https://ei.koteyur.dev/proxy", false},
+		{"http://localhost:8080", false},
+		{"localhost:8080", true},
+		{"ftp://example.com", true},
+		{"/relative", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseURL(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.s {
+				t.Errorf("String() = %q, want %q", got.String(), tt.s)
+			}
+		})
+	}
+}
+
+func TestConfigJSONCompatibility(t *testing.T) {
+	data := []byte(`{"MasterAddr": "vps.gipat.ru:28004", "ServerURL": "https://ei.koteyur.dev/proxy"}`)
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if cfg.MasterAddr != (HostPort{"vps.gipat.ru", 28004}) {
+		t.Errorf("MasterAddr = %v", cfg.MasterAddr)
+	}
+	if cfg.ServerURL.Host != "ei.koteyur.dev" || cfg.ServerURL.Path != "/proxy" {
+		t.Errorf("ServerURL = %v", cfg.ServerURL)
+	}
+
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var fields map[string]any
+	if err = json.Unmarshal(out, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["MasterAddr"] != "vps.gipat.ru:28004" || fields["ServerURL"] != "https://ei.koteyur.dev/proxy" {
+		t.Errorf("Marshal() = %s", out)
+	}
+
+	if err := json.Unmarshal([]byte(`{"MasterAddr": "no-port"}`), &cfg); err == nil {
+		t.Errorf("Unmarshal() with invalid address error = nil")
+	}
+}
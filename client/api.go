@@ -2,56 +2,75 @@ package client
 
 import (
 	"context"
-	"eiproxy/common"
+	"eiproxy/api"
 	"eiproxy/protocol"
-	"fmt"
-	"net/http"
-	"net/url"
+	"slices"
 )
 
-func (c *client) connect(ctx context.Context) (port int, token protocol.Token, err error) {
-	u, err := url.Parse(c.cfg.ServerURL)
-	if err != nil {
-		return 0, protocol.Token{}, fmt.Errorf("failed to parse url: %w", err)
+// api returns the API client of the server within Config.Timeouts.HTTPSeconds per call.
+func (c *client) api() api.Client {
+	return api.Client{
+		ServerURL:   c.cfg.ServerURL.URL,
+		UserKey:     c.cfg.UserKey,
+		Timeout:     c.cfg.Timeouts.HTTP(),
+		Fingerprint: c.cfg.ServerFingerprint,
 	}
+}
 
-	u = u.JoinPath("api/connect")
+func (c *client) connect(ctx context.Context) (protocol.ConnectionResponse, error) {
+	return c.api().Connect(ctx, api.ConnectRequest{
+		ClientVersion: ClientVer,
+		Slot:          c.slot,
+		Capabilities:  c.wantedCapabilities(),
+	})
+}
 
-	q := u.Query()
-	q.Add("proto", protocol.Version)
-	q.Add("client", ClientVer)
-	u.RawQuery = q.Encode()
+// fetchServerConfig fetches settings recommended by the server.
+func (c *client) fetchServerConfig(ctx context.Context) (protocol.ServerConfig, error) {
+	return c.api().ServerConfig(ctx)
+}
 
-	var connResp protocol.ConnectionResponse
+// batchWindowMs returns the batch window set by the user or recommended by the server.
+func (c *client) batchWindowMs() int {
+	if c.cfg.BatchWindowMs == 0 && c.serverCfg.BatchWindowMs != nil {
+		return *c.serverCfg.BatchWindowMs
+	}
+	return c.cfg.BatchWindowMs
+}
 
-	err = common.MakeApiRequestWithContext(
-		ctx, http.MethodPost, u.String(), c.cfg.UserKey.String(), nil, &connResp)
-	if err != nil {
-		return 0, protocol.Token{}, err
+func (c *client) wantedCapabilities() []protocol.Capability {
+	caps := []protocol.Capability{
+		protocol.CapabilityAddrV2, protocol.CapabilityResume, protocol.CapabilityPing,
+		protocol.CapabilitySignedToken, protocol.CapabilityMaintenance,
+		protocol.CapabilitySessionSummary, protocol.CapabilityDisconnectReason,
 	}
 
-	if connResp.ErrorCode != nil {
-		return 0, protocol.Token{}, fmt.Errorf("server returned error: %v", *connResp.ErrorCode)
+	if c.cfg.Encrypt {
+		caps = append(caps, protocol.CapabilityEncryption)
 	}
-	if connResp.ErrorMessage != nil {
-		return 0, protocol.Token{}, fmt.Errorf("server returned error: %v", *connResp.ErrorMessage)
+	if c.cfg.Obfuscate {
+		caps = append(caps, protocol.CapabilityObfuscation)
 	}
-	if connResp.Port == nil || connResp.Token == nil {
-		return 0, protocol.Token{}, fmt.Errorf("server returned invalid response: %v", connResp)
+	if c.cfg.Checksum {
+		caps = append(caps, protocol.CapabilityChecksum)
 	}
-
-	return *connResp.Port, *connResp.Token, nil
+	if c.cfg.Compress {
+		caps = append(caps, protocol.CapabilityCompression)
+	}
+	if c.batchWindowMs() > 0 {
+		caps = append(caps, protocol.CapabilityBatch)
+	}
+	if len(c.cfg.TCPPorts) > 0 {
+		caps = append(caps, protocol.CapabilityTCP)
+	}
+	for _, recommended := range c.serverCfg.RecommendedCapabilities {
+		if !slices.Contains(caps, recommended) {
+			caps = append(caps, recommended)
+		}
+	}
+	return caps
 }
 
 func (c *client) GetUser(ctx context.Context) (protocol.UserResponse, error) {
-	var response protocol.UserResponse
-
-	reqURL, err := url.JoinPath(c.cfg.ServerURL, "api/user")
-	if err != nil {
-		return response, fmt.Errorf("failed to build request url: %w", err)
-	}
-
-	err = common.MakeApiRequestWithContext(
-		ctx, http.MethodGet, reqURL, c.cfg.UserKey.String(), nil, &response)
-	return response, err
+	return c.api().GetUser(ctx)
 }
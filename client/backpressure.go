@@ -0,0 +1,140 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// BackpressurePolicy tells what to do with a packet when an internal data channel is full.
+type BackpressurePolicy string
+
+const (
+	// Drop the packet which doesn't fit. It's the default.
+	BackpressureDropNewest BackpressurePolicy = "drop-newest"
+	// Drop the oldest queued packet to make room, so the fresher game state gets through.
+	BackpressureDropOldest BackpressurePolicy = "drop-oldest"
+	// Wait for room in the channel for a short while, then drop the packet. It slows down the
+	// game socket reader instead of losing packets during short bursts.
+	BackpressureBlock BackpressurePolicy = "block"
+)
+
+// Backpressure controls handling of packets the client can't relay as fast as they come.
+type Backpressure struct {
+	Policy BackpressurePolicy `json:",omitempty"`
+	// How long BackpressureBlock waits for room in the channel. Default 20.
+	BlockTimeoutMs int `json:",omitempty"`
+	// EventDropWarning is emitted when more packets than this are dropped within a minute
+	// because channels are full. Default 100, negative disables the warning.
+	WarnThreshold int `json:",omitempty"`
+}
+
+const (
+	defaultBlockTimeout      = 20 * time.Millisecond
+	maxBlockTimeoutMs        = 1000
+	defaultDropWarnThreshold = 100
+	dropWarningWindow        = time.Minute
+)
+
+func (b Backpressure) validate() error {
+	switch b.Policy {
+	case "", BackpressureDropNewest, BackpressureDropOldest, BackpressureBlock:
+	default:
+		return fmt.Errorf("unknown backpressure policy %q", b.Policy)
+	}
+	if b.BlockTimeoutMs < 0 || b.BlockTimeoutMs > maxBlockTimeoutMs {
+		return fmt.Errorf("invalid Backpressure.BlockTimeoutMs %d, it must be between 0 and %d",
+			b.BlockTimeoutMs, maxBlockTimeoutMs)
+	}
+	return nil
+}
+
+func (b Backpressure) blockTimeout() time.Duration {
+	if b.BlockTimeoutMs == 0 {
+		return defaultBlockTimeout
+	}
+	return time.Duration(b.BlockTimeoutMs) * time.Millisecond
+}
+
+func (b Backpressure) warnThreshold() int {
+	if b.WarnThreshold == 0 {
+		return defaultDropWarnThreshold
+	}
+	return b.WarnThreshold
+}
+
+// enqueue sends data of a packet of p to ch following the backpressure policy and reports
+// whether it has been queued. Dropped data is released and recorded; channels are per peer, so
+// evicted packets are recorded against p as well.
+func (c *client) enqueue(ch chan []byte, data []byte, p *peer, dir DropDirection, size int) bool {
+	select {
+	case ch <- data:
+		return true
+	default:
+	}
+
+	switch c.cfg.Backpressure.Policy {
+	case BackpressureDropOldest:
+		select {
+		case old := <-ch:
+			c.recordDrop(p, dir, len(old), DropReasonChannelFull)
+			putPacketBuf(old)
+		default:
+		}
+		select {
+		case ch <- data:
+			return true
+		default:
+		}
+	case BackpressureBlock:
+		timer := time.NewTimer(c.cfg.Backpressure.blockTimeout())
+		defer timer.Stop()
+		select {
+		case ch <- data:
+			return true
+		case <-timer.C:
+		}
+	}
+
+	putPacketBuf(data)
+	c.recordDrop(p, dir, size, DropReasonChannelFull)
+	return false
+}
+
+// dropAlarm counts packets dropped because of full channels to warn once per window when
+// there are too many of them.
+type dropAlarm struct {
+	mut         sync.Mutex
+	windowStart time.Time
+	count       int
+	warned      bool
+}
+
+// add counts a drop and reports whether threshold has just been exceeded in the window.
+func (a *dropAlarm) add(now time.Time, threshold int) (count int, exceeded bool) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	if now.Sub(a.windowStart) > dropWarningWindow {
+		a.windowStart, a.count, a.warned = now, 0, false
+	}
+	a.count++
+	if threshold < 0 || a.warned || a.count <= threshold {
+		return a.count, false
+	}
+	a.warned = true
+	return a.count, true
+}
+
+// checkDropRate emits EventDropWarning when too many packets are dropped because of full
+// channels.
+func (c *client) checkDropRate() {
+	count, exceeded := c.dropAlarm.add(time.Now(), c.cfg.Backpressure.warnThreshold())
+	if !exceeded {
+		return
+	}
+	message := fmt.Sprintf("%d packets dropped within %v because the client can't keep up with "+
+		"the traffic, players might lag", count, dropWarningWindow)
+	log.Printf("Warning: %s", message)
+	c.events.emit(Event{Type: EventDropWarning, Message: message})
+}
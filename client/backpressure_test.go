@@ -0,0 +1,83 @@
+package client
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestEnqueue(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     BackpressurePolicy
+		wantQueued bool
+		wantFirst  string
+	}{
+		{name: "drop newest", policy: BackpressureDropNewest, wantQueued: false, wantFirst: "old"},
+		{name: "drop oldest", policy: BackpressureDropOldest, wantQueued: true, wantFirst: "new"},
+		{name: "block", policy: BackpressureBlock, wantQueued: false, wantFirst: "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(Config{Backpressure: Backpressure{Policy: tt.policy, BlockTimeoutMs: 10}})
+			p := newPeer(netip.MustParseAddrPort("1.2.3.4:5678"), netip.Addr{})
+			ch := make(chan []byte, 1)
+			ch <- []byte("old")
+
+			if got := c.enqueue(ch, []byte("new"), p, DropFromServer, 3); got != tt.wantQueued {
+				t.Errorf("enqueue() = %v, want %v", got, tt.wantQueued)
+			}
+			if got := string(<-ch); got != tt.wantFirst {
+				t.Errorf("queued packet = %q, want %q", got, tt.wantFirst)
+			}
+			s := c.Stats()
+			if s.Dropped != 1 || s.DroppedFromServer != 1 || s.DroppedToServer != 0 {
+				t.Errorf("dropped = %d (to server %d, from server %d), want 1 from server",
+					s.Dropped, s.DroppedToServer, s.DroppedFromServer)
+			}
+		})
+	}
+}
+
+func TestEnqueueBlockWaitsForRoom(t *testing.T) {
+	c := newClient(Config{Backpressure: Backpressure{Policy: BackpressureBlock, BlockTimeoutMs: 1000}})
+	ch := make(chan []byte, 1)
+	ch <- []byte("old")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-ch
+	}()
+	if !c.enqueue(ch, []byte("new"), nil, DropToServer, 3) {
+		t.Errorf("enqueue() = false, want true")
+	}
+}
+
+func TestDropWarning(t *testing.T) {
+	c := newClient(Config{Backpressure: Backpressure{WarnThreshold: 2}})
+	warnings := make(chan Event, 10)
+	c.Subscribe(func(e Event) {
+		if e.Type == EventDropWarning {
+			warnings <- e
+		}
+	})
+
+	for i := 0; i < 5; i++ {
+		c.recordDrop(nil, DropToServer, 10, DropReasonChannelFull)
+	}
+	// Other drops don't count.
+	c.recordDrop(nil, DropFromServer, 10, DropReasonMalformed)
+
+	select {
+	case e := <-warnings:
+		if e.Message == "" {
+			t.Errorf("warning has no message")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no drop warning")
+	}
+	select {
+	case <-warnings:
+		t.Errorf("warned twice within the window")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"time"
+)
+
+// collectBatch waits up to the batch window for more data frames to send along with first
+// and returns the datagram to write. A frame which can't join the batch is returned as next to
+// be written after it, nextControl tells whether it's a control message. closed is set if
+// dataToServerCh has been closed meanwhile. Frames already queued are taken right away, see
+// nextToServer.
+func (c *client) collectBatch(ctx context.Context, first []byte) (datagram, next []byte, nextControl, closed bool) {
+	timer := time.NewTimer(c.batchWindow)
+	defer timer.Stop()
+
+	frames := [][]byte{first}
+	size := 1 + protocol.BatchFrameOverhead + len(first)
+collect:
+	for {
+		data, control, ok := c.nextToServer()
+		if ok && data == nil {
+			select {
+			case <-ctx.Done():
+				break collect
+			case <-timer.C:
+				break collect
+			case data, ok = <-c.dataToServerCh:
+				control = true
+			case <-c.upstream.ready:
+				continue
+			}
+		}
+		if !ok {
+			closed = true
+			break collect
+		}
+		if control || size+protocol.BatchFrameOverhead+len(data) > protocol.MaxBatchSize {
+			next, nextControl = data, control
+			break collect
+		}
+		frames = append(frames, data)
+		size += protocol.BatchFrameOverhead + len(data)
+	}
+
+	if len(frames) == 1 {
+		return first, next, nextControl, closed
+	}
+	datagram = append(getPacketBuf(), byte(protocol.ProxyClientRequestTypeBatch))
+	for _, frame := range frames {
+		datagram = protocol.AppendBatchFrame(datagram, frame)
+		putPacketBuf(frame)
+	}
+	return datagram, next, nextControl, closed
+}
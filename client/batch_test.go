@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"eiproxy/protocol"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestCollectBatch(t *testing.T) {
+	frame := func(b byte) []byte { return []byte{4, 10, 0, 0, 1, 0x10, 0x27, b} }
+	keepAlive := []byte{byte(protocol.ProxyClientRequestTypeKeepAlive)}
+	// Plain token which happens to start with an address family.
+	token := []byte{4, 10, 0, 0, 1, 0x10}
+	large := append(frame(0), make([]byte, protocol.MaxBatchSize)...)
+
+	tests := []struct {
+		name            string
+		queued          [][]byte
+		control         [][]byte
+		wantFrames      [][]byte // nil if first frame is sent as is
+		wantNext        []byte
+		wantNextControl bool
+	}{
+		{"alone", nil, nil, nil, nil, false},
+		{"batched", [][]byte{frame(2), frame(3)}, nil, [][]byte{frame(1), frame(2), frame(3)}, nil, false},
+		{"control message", [][]byte{frame(2)}, [][]byte{keepAlive}, nil, keepAlive, true},
+		{"token", nil, [][]byte{token}, nil, token, true},
+		{"too large", [][]byte{large}, nil, nil, large, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &client{
+				dataToServerCh: make(chan []byte, 10),
+				upstream:       newUpstream(),
+				addrFormat:     protocol.AddrFormatV2,
+				batchWindow:    20 * time.Millisecond,
+			}
+			p := newPeer(netip.MustParseAddrPort("10.0.0.1:10000"), netip.Addr{})
+			for _, data := range tt.queued {
+				c.sendToServer(p, data, len(data))
+			}
+			for _, data := range tt.control {
+				c.dataToServerCh <- data
+			}
+
+			datagram, next, nextControl, closed := c.collectBatch(context.Background(), frame(1))
+			if closed {
+				t.Errorf("collectBatch() closed = true")
+			}
+			if !bytes.Equal(next, tt.wantNext) || nextControl != tt.wantNextControl {
+				t.Errorf("collectBatch() next = %x, %v, want %x, %v", next, nextControl, tt.wantNext, tt.wantNextControl)
+			}
+			if tt.wantFrames == nil {
+				if !bytes.Equal(datagram, frame(1)) {
+					t.Errorf("collectBatch() = %x, want the first frame", datagram)
+				}
+				return
+			}
+			if datagram[0] != byte(protocol.ProxyClientRequestTypeBatch) {
+				t.Fatalf("collectBatch() = %x, want a batch", datagram)
+			}
+			frames, err := protocol.SplitBatch(datagram)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frames) != len(tt.wantFrames) {
+				t.Fatalf("batch has %d frames, want %d", len(frames), len(tt.wantFrames))
+			}
+			for i := range frames {
+				if !bytes.Equal(frames[i], tt.wantFrames[i]) {
+					t.Errorf("frame %d = %x, want %x", i, frames[i], tt.wantFrames[i])
+				}
+			}
+		})
+	}
+}
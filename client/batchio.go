@@ -0,0 +1,30 @@
+package client
+
+// maxIOBatch is the number of datagrams read or written with one system call.
+const maxIOBatch = 32
+
+// batchIO reads and writes several datagrams of a connected socket per system call, which
+// saves syscall overhead when many players are connected. It's created by newBatchIO.
+type batchIO interface {
+	// writeBatch writes datagrams and returns how many of them were written.
+	writeBatch(datagrams [][]byte) (int, error)
+	// readBatch waits for at least one datagram and reads up to len(bufs) of them, setting
+	// their sizes. It returns the number of datagrams read.
+	readBatch(bufs [][]byte, sizes []int) (int, error)
+}
+
+// drainQueued appends frames already queued for the server, up to maxIOBatch, so they are
+// written with one system call. closed is set if dataToServerCh has been closed.
+func (c *client) drainQueued(frames [][]byte) (_ [][]byte, closed bool) {
+	for len(frames) < maxIOBatch {
+		data, _, ok := c.nextToServer()
+		if !ok {
+			return frames, true
+		}
+		if data == nil {
+			return frames, false
+		}
+		frames = append(frames, data)
+	}
+	return frames, false
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+package client
+
+import (
+	"net"
+
+	xipv4 "golang.org/x/net/ipv4"
+)
+
+// mmsgIO reads and writes datagrams with recvmmsg(2) and sendmmsg(2). The batch calls of
+// x/net/ipv4 don't depend on the address family, so it serves IPv6 sockets as well. The
+// package is renamed, as ipv4 is taken by the address type.
+type mmsgIO struct {
+	conn *xipv4.PacketConn
+	// Reader and writer run concurrently, so each one has its own messages.
+	readMsgs, writeMsgs []xipv4.Message
+}
+
+// newBatchIO returns batched I/O for UDP sockets or nil if conn is something else, e.g. a
+// TURN relay.
+func newBatchIO(conn net.Conn) batchIO {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+	return &mmsgIO{
+		conn:      xipv4.NewPacketConn(udpConn),
+		readMsgs:  newMessages(maxIOBatch),
+		writeMsgs: newMessages(maxIOBatch),
+	}
+}
+
+func newMessages(n int) []xipv4.Message {
+	msgs := make([]xipv4.Message, n)
+	for i := range msgs {
+		msgs[i].Buffers = make([][]byte, 1)
+	}
+	return msgs
+}
+
+func prepareMessages(msgs []xipv4.Message, bufs [][]byte) []xipv4.Message {
+	if len(bufs) < len(msgs) {
+		msgs = msgs[:len(bufs)]
+	}
+	for i := range msgs {
+		msgs[i].Buffers[0] = bufs[i]
+		msgs[i].N = 0
+	}
+	return msgs
+}
+
+func (m *mmsgIO) writeBatch(datagrams [][]byte) (int, error) {
+	return m.conn.WriteBatch(prepareMessages(m.writeMsgs, datagrams), 0)
+}
+
+func (m *mmsgIO) readBatch(bufs [][]byte, sizes []int) (int, error) {
+	msgs := prepareMessages(m.readMsgs, bufs)
+	n, err := m.conn.ReadBatch(msgs, 0)
+	if err != nil {
+		return 0, err
+	}
+	for i, msg := range msgs[:n] {
+		sizes[i] = msg.N
+	}
+	return n, nil
+}
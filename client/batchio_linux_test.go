@@ -0,0 +1,73 @@
+//go:build linux
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMmsgIO(t *testing.T) {
+	server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := net.DialUDP("udp4", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	io := newBatchIO(client)
+	if io == nil {
+		t.Fatal("newBatchIO() = nil for UDP connection")
+	}
+	datagrams := [][]byte{{1}, {2, 2}, {3, 3, 3}}
+	n, err := io.writeBatch(datagrams)
+	if err != nil || n != len(datagrams) {
+		t.Fatalf("writeBatch() = %d, %v", n, err)
+	}
+
+	// Echo datagrams back, so they are read in one batch.
+	var buf [16]byte
+	for range datagrams {
+		n, addr, err := server.ReadFromUDP(buf[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.WriteToUDP(buf[:n], addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	bufs := make([][]byte, maxIOBatch)
+	for i := range bufs {
+		bufs[i] = make([]byte, 16)
+	}
+	sizes := make([]int, maxIOBatch)
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	n, err = io.readBatch(bufs, sizes)
+	if err != nil {
+		t.Fatalf("readBatch() error = %v", err)
+	}
+	if n != len(datagrams) {
+		t.Fatalf("readBatch() = %d, want %d", n, len(datagrams))
+	}
+	for i, want := range datagrams {
+		if got := bufs[i][:sizes[i]]; !bytes.Equal(got, want) {
+			t.Errorf("datagram %d = %x, want %x", i, got, want)
+		}
+	}
+
+	// Read deadline is respected.
+	client.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err = io.readBatch(bufs, sizes); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("readBatch() error = %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+}
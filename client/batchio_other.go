@@ -0,0 +1,10 @@
+//go:build !linux
+
+package client
+
+import "net"
+
+// newBatchIO returns nil, so datagrams are read and written one by one.
+func newBatchIO(net.Conn) batchIO {
+	return nil
+}
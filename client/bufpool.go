@@ -0,0 +1,32 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"sync"
+)
+
+// packetBufSize fits any datagram read by the client together with encoded peer address.
+const packetBufSize = 2048 + protocol.MaxAddrSize
+
+// packetPool reuses packet buffers passed between proxy reader, workers and writer to reduce
+// GC pressure at high packet rates. Buffers are released once they are written out.
+var packetPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, packetBufSize)
+		return &buf
+	},
+}
+
+func getPacketBuf() []byte {
+	return (*packetPool.Get().(*[]byte))[:0]
+}
+
+// putPacketBuf returns buffer to the pool. Small buffers, e.g. control messages, are ignored,
+// so any data sent through the channels can be released.
+func putPacketBuf(buf []byte) {
+	if cap(buf) < packetBufSize {
+		return
+	}
+	buf = buf[:0]
+	packetPool.Put(&buf)
+}
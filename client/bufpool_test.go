@@ -0,0 +1,38 @@
+package client
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPacketPool(t *testing.T) {
+	buf := append(getPacketBuf(), 1, 2, 3)
+	if cap(buf) < packetBufSize {
+		t.Fatalf("getPacketBuf() cap = %d, want at least %d", cap(buf), packetBufSize)
+	}
+	putPacketBuf(buf)
+	if got := getPacketBuf(); len(got) != 0 || cap(got) < packetBufSize {
+		t.Errorf("getPacketBuf() = len %d, cap %d", len(got), cap(got))
+	}
+
+	// Control messages aren't pooled.
+	putPacketBuf([]byte{'k'})
+	putPacketBuf(nil)
+}
+
+func BenchmarkWriteFrame(b *testing.B) {
+	conn := &proxyConn{Conn: discardConn{}, codecs: []frameCodec{checksumCodec{}}, traffic: &trafficCounters{}}
+	payload := make([]byte, 500)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data := append(getPacketBuf(), payload...)
+		if err := conn.writeFrame(data); err != nil {
+			b.Fatal(err)
+		}
+		putPacketBuf(data)
+	}
+}
+
+type discardConn struct{ net.Conn }
+
+func (discardConn) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultCaptureSnapLen = 256
+
+// pcapng block types and options, see https://www.ietf.org/archive/id/draft-tuexen-opsawg-pcapng-05.html.
+const (
+	pcapngSectionHeader   = 0x0A0D0D0A
+	pcapngInterfaceDesc   = 0x00000001
+	pcapngEnhancedPacket  = 0x00000006
+	pcapngByteOrderMagic  = 0x1A2B3C4D
+	pcapngLinkTypeRaw     = 101 // raw IPv4/IPv6 packets
+	pcapngOptEndOfOpt     = 0
+	pcapngOptComment      = 1
+	captureUDPHeaderSize  = 8
+	captureIPv4HeaderSize = 20
+	captureIPv6HeaderSize = 40
+)
+
+// captureWriter writes relayed game packets to a pcapng file, which can be opened in Wireshark.
+// Packets are written as UDP datagrams between the real peer address and the game, and each
+// one has a comment with the local address the peer is mapped to.
+type captureWriter struct {
+	mut     sync.Mutex
+	f       *os.File
+	snapLen int
+}
+
+func newCaptureWriter(path string, snapLen int) (*captureWriter, error) {
+	if snapLen <= 0 {
+		snapLen = defaultCaptureSnapLen
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create capture file: %w", err)
+	}
+
+	// Section header with unspecified section length.
+	shb := binary.LittleEndian.AppendUint32(nil, pcapngByteOrderMagic)
+	shb = binary.LittleEndian.AppendUint16(shb, 1) // major version
+	shb = binary.LittleEndian.AppendUint16(shb, 0) // minor version
+	shb = binary.LittleEndian.AppendUint64(shb, 0xFFFFFFFFFFFFFFFF)
+	data := appendPcapngBlock(nil, pcapngSectionHeader, shb)
+
+	// Single interface with microsecond timestamps (default resolution).
+	idb := binary.LittleEndian.AppendUint16(nil, pcapngLinkTypeRaw)
+	idb = binary.LittleEndian.AppendUint16(idb, 0) // reserved
+	idb = binary.LittleEndian.AppendUint32(idb, uint32(snapLen+captureIPv6HeaderSize+captureUDPHeaderSize))
+	data = appendPcapngBlock(data, pcapngInterfaceDesc, idb)
+
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write capture file: %w", err)
+	}
+	return &captureWriter{f: f, snapLen: snapLen}, nil
+}
+
+// write records a packet exchanged between peer and the game. It's a no-op for nil writer,
+// so capture can be disabled.
+func (w *captureWriter) write(p *peer, gameAddr netip.AddrPort, toGame bool, payload []byte) {
+	if w == nil {
+		return
+	}
+
+	src, dst := p.currentAddr(), gameAddr
+	direction := "to game"
+	if !toGame {
+		src, dst = dst, src
+		direction = "from game"
+	}
+	if src.Addr().Is4() != dst.Addr().Is4() {
+		// Show IPv4 game address as IPv4-mapped one next to IPv6 peers.
+		src = netip.AddrPortFrom(netip.AddrFrom16(src.Addr().As16()), src.Port())
+		dst = netip.AddrPortFrom(netip.AddrFrom16(dst.Addr().As16()), dst.Port())
+	}
+
+	comment := fmt.Sprintf("peer %v %s", p.currentAddr(), direction)
+	if p.isMaster {
+		comment = fmt.Sprintf("master %v %s", p.addr, direction)
+	} else if p.localIP.IsValid() {
+		comment = fmt.Sprintf("peer %v (local %v) %s", p.currentAddr(), p.localIP, direction)
+	}
+
+	captured := payload
+	if len(captured) > w.snapLen {
+		captured = captured[:w.snapLen]
+	}
+	packet := appendUDPPacket(nil, src, dst, len(payload), captured)
+	origLen := len(packet) - len(captured) + len(payload)
+
+	ts := uint64(time.Now().UnixMicro())
+	epb := binary.LittleEndian.AppendUint32(nil, 0) // interface id
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts>>32))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(packet)))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(origLen))
+	epb = appendPadded(epb, packet)
+	epb = binary.LittleEndian.AppendUint16(epb, pcapngOptComment)
+	epb = binary.LittleEndian.AppendUint16(epb, uint16(len(comment)))
+	epb = appendPadded(epb, []byte(comment))
+	epb = binary.LittleEndian.AppendUint32(epb, pcapngOptEndOfOpt)
+
+	w.mut.Lock()
+	defer w.mut.Unlock()
+	_, _ = w.f.Write(appendPcapngBlock(nil, pcapngEnhancedPacket, epb))
+}
+
+func (w *captureWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.f.Close()
+}
+
+func appendPcapngBlock(buf []byte, blockType uint32, body []byte) []byte {
+	totalLen := uint32(12 + len(body))
+	buf = binary.LittleEndian.AppendUint32(buf, blockType)
+	buf = binary.LittleEndian.AppendUint32(buf, totalLen)
+	buf = append(buf, body...)
+	return binary.LittleEndian.AppendUint32(buf, totalLen)
+}
+
+// appendPadded appends data padded with zeros to 4 bytes boundary.
+func appendPadded(buf, data []byte) []byte {
+	buf = append(buf, data...)
+	for i := len(data); i%4 != 0; i++ {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+// appendUDPPacket appends IP and UDP headers for payload of payloadLen bytes followed by
+// (possibly truncated) captured payload. UDP checksum isn't calculated.
+func appendUDPPacket(buf []byte, src, dst netip.AddrPort, payloadLen int, captured []byte) []byte {
+	const protoUDP = 17
+	udpLen := captureUDPHeaderSize + payloadLen
+
+	if src.Addr().Is4() {
+		start := len(buf)
+		buf = append(buf, 0x45, 0) // version 4, header length 5 words
+		buf = binary.BigEndian.AppendUint16(buf, uint16(captureIPv4HeaderSize+udpLen))
+		buf = append(buf, 0, 0, 0, 0) // id, flags, fragment offset
+		buf = append(buf, 64, protoUDP, 0, 0)
+		srcIP, dstIP := src.Addr().As4(), dst.Addr().As4()
+		buf = append(buf, srcIP[:]...)
+		buf = append(buf, dstIP[:]...)
+		binary.BigEndian.PutUint16(buf[start+10:], ipv4Checksum(buf[start:]))
+	} else {
+		buf = append(buf, 0x60, 0, 0, 0) // version 6
+		buf = binary.BigEndian.AppendUint16(buf, uint16(udpLen))
+		buf = append(buf, protoUDP, 64)
+		srcIP, dstIP := src.Addr().As16(), dst.Addr().As16()
+		buf = append(buf, srcIP[:]...)
+		buf = append(buf, dstIP[:]...)
+	}
+
+	buf = binary.BigEndian.AppendUint16(buf, src.Port())
+	buf = binary.BigEndian.AppendUint16(buf, dst.Port())
+	buf = binary.BigEndian.AppendUint16(buf, uint16(udpLen))
+	buf = append(buf, 0, 0) // no checksum
+	return append(buf, captured...)
+}
+
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xFFFF {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return ^uint16(sum)
+}
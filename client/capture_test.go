@@ -0,0 +1,81 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaptureWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.pcapng")
+	w, err := newCaptureWriter(path, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameAddr := netip.MustParseAddrPort("127.0.0.1:8888")
+	p := newPeer(netip.MustParseAddrPort("1.2.3.4:5678"), netip.MustParseAddr("127.0.0.2"))
+	w.write(p, gameAddr, true, []byte("hello"))
+	w.write(p, gameAddr, false, []byte("hi"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []uint32
+	var packets [][]byte
+	var comments []string
+	for len(data) > 0 {
+		blockType := binary.LittleEndian.Uint32(data)
+		blockLen := binary.LittleEndian.Uint32(data[4:])
+		if blockLen%4 != 0 || int(blockLen) > len(data) ||
+			binary.LittleEndian.Uint32(data[blockLen-4:]) != blockLen {
+			t.Fatalf("invalid block length %d", blockLen)
+		}
+		types = append(types, blockType)
+		if blockType == pcapngEnhancedPacket {
+			capLen := binary.LittleEndian.Uint32(data[20:])
+			packets = append(packets, data[28:28+capLen])
+			opts := data[28+(capLen+3)/4*4:]
+			if code := binary.LittleEndian.Uint16(opts); code == pcapngOptComment {
+				comments = append(comments, string(opts[4:4+binary.LittleEndian.Uint16(opts[2:])]))
+			}
+		}
+		data = data[blockLen:]
+	}
+
+	wantTypes := []uint32{pcapngSectionHeader, pcapngInterfaceDesc, pcapngEnhancedPacket, pcapngEnhancedPacket}
+	if len(types) != len(wantTypes) {
+		t.Fatalf("block types = %x, want %x", types, wantTypes)
+	}
+
+	// Payload is truncated to snap length, but IP and UDP headers keep the original length.
+	to := packets[0]
+	if !bytes.Equal(to[12:16], []byte{1, 2, 3, 4}) || !bytes.Equal(to[16:20], []byte{127, 0, 0, 1}) {
+		t.Errorf("packet to game addresses = %v -> %v", to[12:16], to[16:20])
+	}
+	if got := binary.BigEndian.Uint16(to[2:]); got != 20+8+5 {
+		t.Errorf("IP total length = %d, want %d", got, 20+8+5)
+	}
+	if ipv4Checksum(to[:20]) != 0 {
+		t.Errorf("invalid IP header checksum")
+	}
+	if got := string(to[28:]); got != "hell" {
+		t.Errorf("captured payload = %q, want %q", got, "hell")
+	}
+	if from := packets[1]; binary.BigEndian.Uint16(from[20:]) != 8888 || string(from[28:]) != "hi" {
+		t.Errorf("packet from game = %v", from)
+	}
+
+	if len(comments) != 2 || !strings.Contains(comments[0], "local 127.0.0.2") ||
+		!strings.Contains(comments[1], "from game") {
+		t.Errorf("comments = %q", comments)
+	}
+}
@@ -7,47 +7,205 @@ import (
 	"fmt"
 	"log"
 	"net"
-	"net/url"
+	"net/netip"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const ClientVer = "0.3.1"
 
 type client struct {
-	mut   sync.Mutex
-	cfg   Config
-	ready chan struct{}
-
-	dataToServerCh     chan []byte
-	remoteAddrToDataCh map[addrPortV4]chan []byte
-	remoteIPToLocalIP  map[ipv4]ipv4
-	nextLocalIP        ipv4
-	masterAddr         *net.UDPAddr
-	serverIP           *net.IPAddr
-	token              protocol.Token
-	port               int
+	mut      sync.Mutex
+	cfg      Config
+	ready    chan struct{}
+	stopped  chan struct{} // closed when Run returns
+	stopErr  error         // error Run has returned, set before stopped is closed
+	stopOnce sync.Once
+	lifecycle
+
+	dataToServerCh    chan []byte // control messages, data frames are queued in upstream
+	upstream          *upstream
+	peers             map[netip.AddrPort]*peer
+	remoteIPToLocalIP map[netip.Addr]ipv4
+	virtualIPs        *virtualIPRange // set on the first run
+	peerLastSeen      map[netip.Addr]time.Time
+	peerMapDirty      chan struct{}
+	masterAddr        *net.UDPAddr
+	gameAddr          *net.UDPAddr
+	localMasterAddr   string
+	serverIP          *net.IPAddr
+	token             protocol.Token
+	port              int
+	batchWindow       time.Duration // zero if data frames aren't batched
+	codecs            []frameCodec
+	addrFormat        protocol.AddrFormat
+	tcpAddr           string // server address for TCP streams, empty if they aren't relayed
+	events            eventBus
+	names             nameCache
+	traffic           trafficCounters
+	drops             *dropLog
+	capture           *captureWriter
+	audit             *deadlineAudit
+	quality           qualityMonitor
+	metrics           clientMetrics
+	session           protocol.ConnectionResponse
+	serverCfg         protocol.ServerConfig // fetched on connect if Config.BootstrapFromServer is set
+	resumed           bool
+	slot              int // index of the session among sessions of the same key
+	inheritedConn     net.Conn
+	proxyConn         *proxyConn // current connection to the proxy server
+	state             atomic.Int32
+	dropAlarm         dropAlarm
+	rateLimiter       *rateLimiter         // shared by sessions of multiClient
+	maintenance       protocol.Maintenance // last announced by the server, used by the main loop reader
+
+	// Settings which can be changed by Reconfigure, liveCfg is the last config applied.
+	liveCfg           Config
+	waitForSlot       atomic.Bool
+	adaptiveKeepAlive atomic.Bool
 }
 
 type Client interface {
-	Run(ctx context.Context) error
-	GetProxyAddr(timeout time.Duration) string
+	// Run runs the client until ctx is cancelled or an unrecoverable error happens.
+	// Returned status tells why the client has stopped.
+	Run(ctx context.Context) (ExitStatus, error)
+	// Start runs the client in background until Stop is called or an unrecoverable error
+	// happens. Calling it again has no effect, a stopped client returns ErrStopped.
+	Start() error
+	// Stop stops the client started by Start and waits until it stops or ctx is done. It may be
+	// called several times, called before Start it prevents the client from starting.
+	Stop(ctx context.Context) error
+	// Wait waits until the client stops and returns what Run would have returned.
+	Wait() (ExitStatus, error)
+	// ProxyAddr waits until the proxy address is assigned and returns it. It returns ctx error
+	// if ctx is done first and an error wrapping ErrStopped and the error of Run if the client
+	// stops first.
+	ProxyAddr(ctx context.Context) (netip.AddrPort, error)
+	// GetProxyAddr waits until the proxy address is assigned and returns it. It returns zero
+	// address on timeout.
+	//
+	// Deprecated: Use ProxyAddr, which tells a stopped client from a slow one.
+	GetProxyAddr(timeout time.Duration) netip.AddrPort
 	GetUser(ctx context.Context) (protocol.UserResponse, error)
+
+	// Subscribe registers handler for client events and returns a function to unsubscribe.
+	// Handlers are called sequentially from a separate goroutine, which exits after the
+	// StateStopped event once Run returns.
+	Subscribe(handler EventHandler) (unsubscribe func())
+	// State returns the current lifecycle state.
+	State() State
+
+	// Stats returns current traffic counters.
+	Stats() Stats
+
+	// Peers returns currently connected remote peers sorted by address.
+	Peers() []PeerStats
+
+	// DropLog returns recently dropped packets, oldest first. It's empty unless
+	// Config.DropLogSize is set.
+	DropLog() []DropRecord
 }
 
 func New(cfg Config) Client {
-	return &client{
-		cfg:                cfg,
-		dataToServerCh:     make(chan []byte, dataChanSize),
-		remoteIPToLocalIP:  make(map[ipv4]ipv4),
-		remoteAddrToDataCh: make(map[addrPortV4]chan []byte, dataChanSize),
-		ready:              make(chan struct{}),
+	if len(cfg.Games) > 0 {
+		return newMultiClient(cfg)
+	}
+	return newClient(cfg)
+}
+
+func newClient(cfg Config) *client {
+	c := &client{
+		cfg:               cfg,
+		dataToServerCh:    make(chan []byte, dataChanSize),
+		upstream:          newUpstream(),
+		remoteIPToLocalIP: make(map[netip.Addr]ipv4),
+		peerLastSeen:      make(map[netip.Addr]time.Time),
+		peerMapDirty:      make(chan struct{}, 1),
+		peers:             make(map[netip.AddrPort]*peer),
+		ready:             make(chan struct{}),
+		stopped:           make(chan struct{}),
+		names:             nameCache{resolver: newNameResolver(cfg)},
+		drops:             newDropLog(cfg.DropLogSize),
+		metrics:           newClientMetrics(cfg.Metrics),
+		rateLimiter:       newRateLimiter(cfg.RateLimit),
+		inheritedConn:     cfg.InheritedConn,
 	}
+	c.liveCfg = cfg
+	c.waitForSlot.Store(cfg.WaitForSlot)
+	c.adaptiveKeepAlive.Store(cfg.AdaptiveKeepAlive)
+	c.lifecycle.run = c.Run
+	return c
 }
 
-func (c *client) Run(ctx context.Context) error {
-	// TODO: Handle better some specific cases where we shouldn't retry at all.
+func (c *client) Run(ctx context.Context) (ExitStatus, error) {
+	if err := c.cfg.Timeouts.validate(); err != nil {
+		return exitStatusFromError(err), err
+	}
+	if err := c.cfg.Backpressure.validate(); err != nil {
+		return exitStatusFromError(err), err
+	}
+	if err := c.cfg.RateLimit.validate(); err != nil {
+		return exitStatusFromError(err), err
+	}
+	if c.cfg.CaptureFile != "" {
+		capture, err := newCaptureWriter(c.cfg.CaptureFile, c.cfg.CaptureSnapLen)
+		if err != nil {
+			log.Printf("Packet capture is disabled: %v", err)
+		} else {
+			log.Printf("Capturing packets to %s", c.cfg.CaptureFile)
+			c.capture = capture
+			defer capture.Close()
+		}
+	}
+	if c.cfg.DeadlineAuditFile != "" {
+		c.audit = newDeadlineAudit()
+		defer func() {
+			if err := c.audit.dump(c.cfg.DeadlineAuditFile); err != nil {
+				log.Printf("Failed to dump deadline audit: %v", err)
+			} else {
+				log.Printf("Deadline audit is written to %s", c.cfg.DeadlineAuditFile)
+			}
+		}()
+	}
+	if c.cfg.MetricsAddr != "" {
+		go func() {
+			err := serveMetrics(ctx, c.cfg.MetricsAddr, c)
+			log.Printf("Metrics server stopped: %v", err)
+		}()
+	}
+
+	if c.cfg.PeerMapFile != "" {
+		saverCtx, cancel := context.WithCancel(ctx)
+		saverDone := make(chan struct{})
+		go func() {
+			defer close(saverDone)
+			c.runPeerMapSaver(saverCtx)
+		}()
+		defer func() {
+			cancel()
+			<-saverDone
+		}()
+	}
+
+	err := classifyError(c.runWithRetries(ctx))
+	if err != nil {
+		c.events.emit(Event{Type: EventError, Err: err})
+	}
+	c.setState(StateStopped, err)
+	c.markStopped(err)
+	// Nothing is emitted after the client has stopped, so the dispatch goroutine can go.
+	c.events.close()
+
+	status := exitStatusFromError(err)
+	log.Printf("Client stopped: %v", status)
+	return status, err
+}
+
+func (c *client) runWithRetries(ctx context.Context) error {
+	policy := c.cfg.RetryPolicy.withDefaults()
 	lastSuccRun := time.Time{}
 	attempt := 0
 	for {
@@ -57,6 +215,19 @@ func (c *client) Run(ctx context.Context) error {
 		if err == nil || errors.Is(err, context.Canceled) {
 			return nil
 		}
+		c.clearSession()
+		if errors.Is(err, errSessionResumeFailed) {
+			log.Printf("Saved session is no longer valid, requesting a new one")
+			continue
+		}
+		if errors.Is(err, errServerDisconnected) {
+			// Server has closed the session on purpose, so there is no point to retry.
+			return err
+		}
+		if exitStatusFromError(err).Reason == ExitAuthFailure {
+			// Key won't become valid by itself.
+			return err
+		}
 
 		select {
 		case <-ctx.Done():
@@ -71,35 +242,104 @@ func (c *client) Run(ctx context.Context) error {
 		default:
 		}
 
-		if lastSuccRun.IsZero() {
+		if lastSuccRun.IsZero() && !policy.RetryOnFirstFailure {
 			return err
 		}
 
 		attempt++
-		if attempt > 5 {
+		if policy.exhausted(attempt) {
 			return err
 		}
 
 		// Wait before next run.
-		delay := time.Duration(1<<attempt) * time.Second
+		c.traffic.reconnects.Add(1)
+		c.metrics.reconnects.Add(1)
+		c.setState(StateReconnecting, err)
+		delay := policy.delay(attempt)
 		log.Printf("Attempt %d failed, waiting %v before next run", attempt, delay)
-		time.Sleep(delay)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
 	}
 }
 
 func (c *client) RunWithoutRetries(ctx context.Context) error {
-	serverURL, err := url.Parse(c.cfg.ServerURL)
-	if err != nil {
-		return fmt.Errorf("failed to parse server url: %w", err)
+	serverURL := c.cfg.ServerURL
+
+	masterAddrStr := c.cfg.MasterAddr.String()
+	c.serverCfg = protocol.ServerConfig{}
+	if c.cfg.BootstrapFromServer {
+		serverCfg, err := c.fetchServerConfig(ctx)
+		if err != nil {
+			log.Printf("Failed to fetch settings from the server, using own ones: %v", err)
+		} else {
+			c.serverCfg = serverCfg
+			if serverCfg.MasterAddr != nil && *serverCfg.MasterAddr != masterAddrStr {
+				log.Printf("Server sets master server address %s", *serverCfg.MasterAddr)
+				masterAddrStr = *serverCfg.MasterAddr
+			}
+			if len(serverCfg.RecommendedCapabilities) > 0 {
+				log.Printf("Server recommends capabilities: %s",
+					protocol.FormatCapabilities(serverCfg.RecommendedCapabilities))
+			}
+		}
 	}
 
-	log.Printf("Resolving master server address %s", c.cfg.MasterAddr)
-	masterAddr, err := net.ResolveUDPAddr("udp4", c.cfg.MasterAddr)
+	log.Printf("Resolving master server address %s", masterAddrStr)
+	masterAddr, err := net.ResolveUDPAddr("udp4", masterAddrStr)
 	if err != nil {
 		return fmt.Errorf("failed to resolve master address: %w", err)
 	}
 	c.masterAddr = masterAddr
 
+	gameAddr := c.cfg.GameAddr.String()
+	if gameAddr == "" {
+		gameAddr = defaultGameAddr
+	}
+	c.gameAddr, err = net.ResolveUDPAddr("udp4", gameAddr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve game address: %w", err)
+	}
+	// Address is picked once, so the game keeps working with it after reconnects.
+	if c.localMasterAddr == "" {
+		localMasterAddr := c.cfg.LocalMasterAddr.String()
+		if localMasterAddr == "" {
+			localMasterAddr = DefaultLocalMasterAddr
+		}
+		c.localMasterAddr, err = PickLocalMasterAddr(localMasterAddr)
+		if err != nil {
+			return fmt.Errorf("failed to pick local master proxy address: %w", err)
+		}
+		if c.localMasterAddr != localMasterAddr {
+			log.Printf("Local master proxy address %s is busy, using %s instead. Point the game to it",
+				localMasterAddr, c.localMasterAddr)
+		}
+	}
+	// Range is set up once too, so peers keep their local IPs after reconnects.
+	if c.virtualIPs == nil {
+		localAddrs, err := localInterfaceAddrs()
+		if err != nil {
+			log.Printf("Virtual IPs might collide with local interfaces: %v", err)
+		}
+		for _, addr := range []string{c.gameAddr.IP.String(), c.localMasterAddr} {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			if ip, err := netip.ParseAddr(host); err == nil {
+				localAddrs = append(localAddrs, ip)
+			}
+		}
+		c.virtualIPs, err = newVirtualIPRange(c.cfg.VirtualIPRange, localAddrs)
+		if err != nil {
+			return fmt.Errorf("invalid virtual IP range: %w", err)
+		}
+		c.loadPeerMap()
+	}
+
+	c.setState(StateResolving, nil)
 	log.Printf("Resolving server address %s", serverURL.Hostname())
 	serverIP, err := net.ResolveIPAddr("ip4", serverURL.Hostname())
 	if err != nil {
@@ -107,16 +347,95 @@ func (c *client) RunWithoutRetries(ctx context.Context) error {
 	}
 	c.serverIP = serverIP
 
-	log.Printf("Connecting to server %#v", c.cfg.ServerURL)
-	port, token, err := c.connect(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	connResp, resumed := c.loadSession()
+	if resumed {
+		log.Printf("Resuming saved session")
+	} else {
+		c.setState(StateConnecting, nil)
+		log.Printf("Connecting to server %#v", c.cfg.ServerURL)
+		connResp, err = c.connectOrWaitForSlot(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+		c.saveSession(connResp)
 	}
+	if connResp.KeepAliveInterval == nil {
+		connResp.KeepAliveInterval = c.serverCfg.KeepAliveInterval
+	}
+	c.session = connResp
+	c.resumed = resumed
+	port := *connResp.Port
 	log.Printf("Connection established. Port: %d", port)
-	c.token = token
+	c.token = *connResp.Token
 	c.port = port
+	if keepAlive, timeout := connResp.Liveness(); keepAlive != protocol.DefaultKeepAliveInterval ||
+		timeout != protocol.DefaultSessionTimeout {
+		log.Printf("Server liveness settings: keep alive every %v, timeout %v", keepAlive, timeout)
+	}
+	for _, message := range connResp.Deprecations {
+		log.Printf("Server deprecation warning: %s", message)
+		c.events.emit(Event{Type: EventDeprecationWarning, Message: message})
+	}
+
+	c.codecs = nil
+	if connResp.HasCapability(protocol.CapabilityCompression) {
+		log.Printf("Frame compression enabled")
+		c.codecs = append(c.codecs, compressionCodec{})
+	} else if c.cfg.Compress {
+		log.Printf("Server doesn't support frame compression, continuing without it")
+	}
+	if connResp.HasCapability(protocol.CapabilityChecksum) {
+		log.Printf("Frame checksums enabled")
+		c.codecs = append(c.codecs, checksumCodec{})
+	} else if c.cfg.Checksum {
+		log.Printf("Server doesn't support frame checksums, continuing without them")
+	}
+	if connResp.HasCapability(protocol.CapabilityEncryption) {
+		seal, open, err := protocol.NewSessionCiphers(connResp.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("failed to set up encryption: %w", err)
+		}
+		log.Printf("Traffic encryption enabled")
+		c.codecs = append(c.codecs, encryptionCodec{seal: seal, open: open})
+	} else if c.cfg.Encrypt {
+		log.Printf("Server doesn't support traffic encryption, continuing without it")
+	}
+	if connResp.HasCapability(protocol.CapabilityObfuscation) {
+		log.Printf("Traffic obfuscation enabled")
+		c.codecs = append(c.codecs, obfuscationCodec{protocol.NewObfuscator(c.token)})
+	} else if c.cfg.Obfuscate {
+		log.Printf("Server doesn't support traffic obfuscation, continuing without it")
+	}
+
+	c.addrFormat = protocol.AddrFormatV1
+	if connResp.HasCapability(protocol.CapabilityAddrV2) {
+		c.addrFormat = protocol.AddrFormatV2
+	}
+
+	c.batchWindow = 0
+	if connResp.HasCapability(protocol.CapabilityBatch) && c.addrFormat == protocol.AddrFormatV2 &&
+		c.batchWindowMs() > 0 {
+		c.batchWindow = time.Duration(c.batchWindowMs()) * time.Millisecond
+		log.Printf("Packet batching enabled, window %v", c.batchWindow)
+	} else if c.batchWindowMs() > 0 {
+		log.Printf("Server doesn't support packet batching, continuing without it")
+	}
+
+	c.tcpAddr = ""
+	if connResp.HasCapability(protocol.CapabilityTCP) && len(c.cfg.TCPPorts) > 0 &&
+		connResp.HasCapability(protocol.CapabilityEncryption) {
+		// Streams bypass the session codecs, so they would carry the token in the clear.
+		log.Printf("TCP relay isn't encrypted, continuing without it")
+	} else if connResp.HasCapability(protocol.CapabilityTCP) && connResp.TCPPort != nil &&
+		c.addrFormat == protocol.AddrFormatV2 {
+		c.tcpAddr = net.JoinHostPort(serverURL.Hostname(), strconv.Itoa(*connResp.TCPPort))
+		log.Printf("TCP relay enabled for ports %v", c.cfg.TCPPorts)
+	} else if len(c.cfg.TCPPorts) > 0 {
+		log.Printf("Server doesn't support TCP relay, continuing without it")
+	}
 	defer func() { c.ready = make(chan struct{}) }()
 	close(c.ready)
+	c.setState(StateHandshaking, nil)
 
 	var wg sync.WaitGroup
 	defer wg.Wait()
@@ -135,12 +454,14 @@ func (c *client) RunWithoutRetries(ctx context.Context) error {
 			log.Printf("%s: stopped: %v", prefix, err)
 			err = ignoreCancelledOrClosed(err)
 			if err != nil {
-				err = fmt.Errorf("%s: %v", strings.ToLower(prefix), err)
+				err = fmt.Errorf("%s: %w", strings.ToLower(prefix), err)
 			}
 		}()
 	}
 
-	run(func() error { return runMasterTCPProxy(ctx, c.cfg.MasterAddr) }, "Master proxy")
+	run(func() error {
+		return runMasterTCPProxy(ctx, c.localMasterAddr, c.masterAddr.String())
+	}, "Master proxy")
 	run(func() error {
 		return c.runProxyClient(ctx, fmt.Sprintf("%s:%d", serverURL.Hostname(), port))
 	}, "Proxy main loop")
@@ -149,11 +470,96 @@ func (c *client) RunWithoutRetries(ctx context.Context) error {
 	return context.Cause(ctx)
 }
 
-func (c *client) GetProxyAddr(timeout time.Duration) string {
+// connectOrWaitForSlot connects to the server. If the server is full and WaitForSlot is set,
+// it keeps retrying with the delay suggested by the server.
+func (c *client) connectOrWaitForSlot(ctx context.Context) (protocol.ConnectionResponse, error) {
+	const (
+		defaultWait = 30 * time.Second
+		minWait     = 5 * time.Second
+		maxWait     = 2 * time.Minute
+	)
+
+	for {
+		connResp, err := c.connect(ctx)
+		if err == nil || !c.waitForSlot.Load() || !errors.Is(err, protocol.ConnectionCodeServerFull) {
+			return connResp, err
+		}
+
+		wait := defaultWait
+		if connResp.RetryAfter != nil {
+			wait = time.Duration(*connResp.RetryAfter) * time.Second
+		}
+		if wait < minWait {
+			wait = minWait
+		} else if wait > maxWait {
+			wait = maxWait
+		}
+
+		load := "unknown load"
+		if connResp.Occupancy != nil && connResp.Capacity != nil {
+			load = fmt.Sprintf("%d/%d sessions", *connResp.Occupancy, *connResp.Capacity)
+		}
+		log.Printf("Server is full (%s), waiting %v for a slot", load, wait)
+
+		select {
+		case <-ctx.Done():
+			return connResp, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *client) Subscribe(handler EventHandler) func() {
+	return c.events.subscribe(handler)
+}
+
+func (c *client) State() State {
+	return State(c.state.Load())
+}
+
+func (c *client) setState(state State, err error) {
+	c.state.Store(int32(state))
+	c.events.emit(Event{Type: EventStateChanged, State: state, Err: err})
+}
+
+// markStopped wakes up ProxyAddr callers once Run has returned err.
+func (c *client) markStopped(err error) {
+	c.stopOnce.Do(func() {
+		c.stopErr = err
+		close(c.stopped)
+	})
+}
+
+func (c *client) ProxyAddr(ctx context.Context) (netip.AddrPort, error) {
+	ready := c.ready
+	// Assigned address wins over a done ctx, so callers may peek with an expired one.
 	select {
-	case <-c.ready:
-		return fmt.Sprintf("%s:%d", c.serverIP.IP, c.port)
-	case <-time.After(timeout):
-		return ""
+	case <-ready:
+		return c.proxyAddr(), nil
+	default:
 	}
+
+	select {
+	case <-ready:
+		return c.proxyAddr(), nil
+	case <-c.stopped:
+		if c.stopErr != nil {
+			return netip.AddrPort{}, fmt.Errorf("%w: %w", ErrStopped, c.stopErr)
+		}
+		return netip.AddrPort{}, ErrStopped
+	case <-ctx.Done():
+		return netip.AddrPort{}, ctx.Err()
+	}
+}
+
+func (c *client) proxyAddr() netip.AddrPort {
+	ip, _ := netip.AddrFromSlice(c.serverIP.IP)
+	return netip.AddrPortFrom(ip.Unmap(), uint16(c.port))
+}
+
+func (c *client) GetProxyAddr(timeout time.Duration) netip.AddrPort {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addr, _ := c.ProxyAddr(ctx)
+	return addr
 }
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"errors"
+	"net"
+	"time"
+)
+
+// frameCodec transforms datagrams exchanged with the proxy server.
+type frameCodec interface {
+	encode(buf, frame []byte) []byte
+	decode(buf, data []byte) ([]byte, error)
+}
+
+type obfuscationCodec struct {
+	obfs *protocol.Obfuscator
+}
+
+func (c obfuscationCodec) encode(buf, frame []byte) []byte {
+	return c.obfs.Obfuscate(buf, frame)
+}
+
+func (c obfuscationCodec) decode(buf, data []byte) ([]byte, error) {
+	return c.obfs.Deobfuscate(buf, data)
+}
+
+// encryptionCodec seals frames sent to the server and opens frames received from it.
+type encryptionCodec struct {
+	seal *protocol.Cipher
+	open *protocol.Cipher
+}
+
+func (c encryptionCodec) encode(buf, frame []byte) []byte {
+	return c.seal.Seal(buf, frame)
+}
+
+func (c encryptionCodec) decode(buf, data []byte) ([]byte, error) {
+	return c.open.Open(buf, data)
+}
+
+// checksumCodec adds CRC to frames to detect corrupted datagrams.
+type checksumCodec struct{}
+
+func (checksumCodec) encode(buf, frame []byte) []byte {
+	return protocol.AppendChecksum(buf, frame)
+}
+
+func (checksumCodec) decode(_, data []byte) ([]byte, error) {
+	return protocol.VerifyChecksum(data)
+}
+
+// compressionCodec compresses larger frames. It goes first, as encoded frames don't compress.
+type compressionCodec struct{}
+
+func (compressionCodec) encode(buf, frame []byte) []byte {
+	return protocol.AppendCompressed(buf, frame)
+}
+
+func (compressionCodec) decode(buf, data []byte) ([]byte, error) {
+	return protocol.Decompress(buf, data)
+}
+
+// proxyConn is a connection to the proxy server, which applies negotiated codecs to frames.
+type proxyConn struct {
+	net.Conn
+	codecs  []frameCodec
+	traffic *trafficCounters
+	metrics *clientMetrics // optional
+	audit   *deadlineAudit // optional
+
+	handshakeTimeout time.Duration // default if zero
+
+	// Batched socket I/O, nil if the platform or connection doesn't support it. Datagrams read
+	// in one batch are kept in readBufs and returned one by one.
+	io       batchIO
+	readBufs [][]byte
+	sizes    []int
+	next     int
+	received int
+}
+
+// encode applies codecs to frame. Returned pooled buffer, if any, must be released after the
+// datagram is written.
+func (c *proxyConn) encode(frame []byte) (datagram, pooled []byte) {
+	// Intermediate frames are encoded into pooled buffers, previous one is released once
+	// the next codec is applied.
+	for _, codec := range c.codecs {
+		encoded := codec.encode(getPacketBuf(), frame)
+		putPacketBuf(pooled)
+		frame, pooled = encoded, encoded
+	}
+	return frame, pooled
+}
+
+func (c *proxyConn) addSent(n int) {
+	c.traffic.addSent(n)
+	if c.metrics != nil {
+		c.metrics.bytesSent.Add(float64(n))
+		c.metrics.packetsSent.Add(1)
+	}
+}
+
+func (c *proxyConn) writeFrame(frame []byte) error {
+	datagram, pooled := c.encode(frame)
+	defer putPacketBuf(pooled)
+
+	n, err := c.Write(datagram)
+	if err == nil {
+		c.addSent(n)
+	}
+	return err
+}
+
+// writeFrames writes frames with as few system calls as batched I/O allows.
+func (c *proxyConn) writeFrames(frames [][]byte) error {
+	if c.io == nil || len(frames) == 1 {
+		for _, frame := range frames {
+			if err := c.writeFrame(frame); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	datagrams := make([][]byte, len(frames))
+	pooled := make([][]byte, len(frames))
+	defer func() {
+		for _, buf := range pooled {
+			putPacketBuf(buf)
+		}
+	}()
+	for i, frame := range frames {
+		datagrams[i], pooled[i] = c.encode(frame)
+	}
+	for len(datagrams) > 0 {
+		n, err := c.io.writeBatch(datagrams)
+		if err != nil {
+			return err
+		}
+		for _, datagram := range datagrams[:n] {
+			c.addSent(len(datagram))
+		}
+		datagrams = datagrams[n:]
+	}
+	return nil
+}
+
+// readDatagram reads a datagram into buf. With batched I/O it returns the next datagram of the
+// last batch instead, which stays valid until the next call.
+func (c *proxyConn) readDatagram(buf []byte) ([]byte, error) {
+	if c.io == nil {
+		n, err := c.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	if c.next == c.received {
+		if c.readBufs == nil {
+			c.readBufs = make([][]byte, maxIOBatch)
+			for i := range c.readBufs {
+				c.readBufs[i] = make([]byte, len(buf))
+			}
+			c.sizes = make([]int, maxIOBatch)
+		}
+		n, err := c.io.readBatch(c.readBufs, c.sizes)
+		if err != nil {
+			return nil, err
+		}
+		c.next, c.received = 0, n
+	}
+	data := c.readBufs[c.next][:c.sizes[c.next]]
+	c.next++
+	return data, nil
+}
+
+// readFrame reads a datagram and returns decoded frame, which may reuse buf and is valid until
+// the next call.
+func (c *proxyConn) readFrame(buf []byte) ([]byte, error) {
+	frame, err := c.readDatagram(buf)
+	if err != nil {
+		return nil, err
+	}
+	c.traffic.addReceived(len(frame))
+	if c.metrics != nil {
+		c.metrics.bytesReceived.Add(float64(len(frame)))
+		c.metrics.packetsReceived.Add(1)
+	}
+	for i := len(c.codecs) - 1; i >= 0; i-- {
+		frame, err = c.codecs[i].decode(frame[:0:0], frame)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return frame, nil
+}
+
+func isFrameDecodeError(err error) bool {
+	return errors.Is(err, protocol.ErrInvalidObfuscatedData) ||
+		errors.Is(err, protocol.ErrInvalidEncryptedData) ||
+		errors.Is(err, protocol.ErrChecksumMismatch) ||
+		errors.Is(err, protocol.ErrInvalidCompressedData)
+}
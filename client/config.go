@@ -1,14 +1,114 @@
 package client
 
-import "eiproxy/protocol"
+import (
+	"eiproxy/common"
+	"eiproxy/protocol"
+	"net"
+)
 
 type Config struct {
-	MasterAddr string
-	ServerURL  string
+	MasterAddr HostPort
+	ServerURL  URL
 	UserKey    protocol.UserKey
-}
 
-var DefaultConfig = Config{
-	MasterAddr: "vps.gipat.ru:28004",
-	ServerURL:  "http://localhost:8080",
+	// Hex SHA-256 of the public key of ServerURL's certificate. If set, the server is trusted
+	// only with this key, e.g. a self-hosted relay with a self-signed certificate.
+	ServerFingerprint string `json:",omitempty"`
+
+	// Ask server to obfuscate tunnel traffic to defeat naive DPI throttling.
+	Obfuscate bool `json:",omitempty"`
+
+	// Ask server to encrypt tunnel traffic, including the session token.
+	Encrypt bool `json:",omitempty"`
+
+	// Ask server to add checksums to frames, so corrupted datagrams are detected and dropped.
+	Checksum bool `json:",omitempty"`
+
+	// Ask server to compress larger frames, which saves bandwidth on slow uplinks.
+	Compress bool `json:",omitempty"`
+
+	// Coalesce game packets sent within this many milliseconds into one datagram, if the
+	// server supports it. It halves per-datagram overhead at the cost of a little latency.
+	BatchWindowMs int `json:",omitempty"`
+
+	// Fetch master server address, keep alive interval and recommended settings from the
+	// server's /api/config on every connect, so the operator can change them centrally. Own
+	// settings are used if the server doesn't provide them.
+	BootstrapFromServer bool `json:",omitempty"`
+
+	// Send keep alives less often if the NAT in front of the client keeps idle bindings long
+	// enough. The interval is probed at session start, up to a quarter of the session timeout.
+	AdaptiveKeepAlive bool `json:",omitempty"`
+
+	// Keep retrying politely while the server is full instead of failing.
+	WaitForSlot bool `json:",omitempty"`
+
+	// Sources of friendly peer names, tried in order: NameResolver, roster file, community
+	// API and reverse DNS.
+	NameResolver NameResolver `json:"-"`
+	RosterPath   string       `json:",omitempty"`
+	NameAPIURL   string       `json:",omitempty"`
+	ReverseDNS   bool         `json:",omitempty"`
+
+	// Relay the tunnel via this TURN server if the proxy server isn't reachable directly.
+	TURN *TURNConfig `json:",omitempty"`
+
+	// Serve Prometheus metrics on this address (e.g. "127.0.0.1:9100") if set.
+	MetricsAddr string `json:",omitempty"`
+	// Report client events to embedder's telemetry as they happen.
+	Metrics common.Metrics `json:"-"`
+
+	// Keep records of this many last dropped packets to investigate lag spikes.
+	DropLogSize int `json:",omitempty"`
+
+	// Write relayed game packets to this pcapng file for debugging. Only first CaptureSnapLen
+	// bytes (256 by default) of each packet are written.
+	CaptureFile    string `json:",omitempty"`
+	CaptureSnapLen int    `json:",omitempty"`
+
+	// Record socket deadlines, their expiries and read/write latencies in the data path and
+	// write the report to this file on exit. It helps to tune timeouts.
+	DeadlineAuditFile string `json:",omitempty"`
+
+	// Persist session to this file, so the client restarted shortly after stop resumes it and
+	// keeps the same proxy address. The session isn't closed on stop when it's set. Encrypted
+	// sessions aren't persisted, as the new process can't continue their nonces.
+	StateFile string `json:",omitempty"`
+
+	// Socket connected to the proxy server passed by the previous process on upgrade. It's used
+	// instead of dialing for the first connection, if it's connected to the same server.
+	InheritedConn net.Conn `json:"-"`
+
+	// Local game server and the address of the master server proxy the game is pointed to.
+	// Set them to run sessions for several game instances, e.g. on other LAN machines or
+	// ports. Default to 127.0.0.1:8888 and 127.0.0.1:28004.
+	GameAddr        HostPort
+	LocalMasterAddr HostPort
+
+	// Loopback range in CIDR notation the game sees remote peers at, each remote IP gets its
+	// own address. Addresses of local interfaces are skipped. Defaults to 127.0.0.0/8.
+	VirtualIPRange string `json:",omitempty"`
+	// Remember virtual IPs of remote IPs in this file, so players are seen at the same
+	// addresses after restarts and the in-game address book stays valid.
+	PeerMapFile string `json:",omitempty"`
+
+	// Additional game servers relayed by the same process. Each one gets its own proxy port.
+	Games []GameEndpoint `json:",omitempty"`
+
+	// Game TCP ports tunneled to peers, if the server supports it. Streams opened by the game
+	// to peer's local IP are relayed to the same port of the peer and the other way around.
+	TCPPorts []int `json:",omitempty"`
+
+	// Reconnection policy. Defaults to 5 attempts after a successful run.
+	RetryPolicy RetryPolicy
+
+	// Timeouts of network operations, e.g. for slow or flaky links.
+	Timeouts Timeouts
+
+	// Handling of packets when internal channels are full. By default the packet which doesn't
+	// fit is dropped.
+	Backpressure Backpressure
+
+	// Caps of game traffic to save bandwidth, no limits by default.
+	RateLimit RateLimit
 }
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Sites of the data path where socket deadlines are audited.
+const (
+	auditHandshakeRead  = "handshake read"
+	auditHandshakeWrite = "handshake write"
+	auditMainLoopRead   = "main-loop read"
+	auditMainLoopWrite  = "main-loop write"
+	auditWorkerRead     = "worker read"
+	auditWorkerWrite    = "worker write"
+)
+
+// Upper bounds of latency histogram buckets, the last bucket holds everything above.
+var auditLatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// deadlineAudit records socket deadlines set in the data path, how often they expire and how
+// long reads and writes take, to tune hardcoded timeouts with real world data.
+type deadlineAudit struct {
+	mut     sync.Mutex
+	started time.Time
+	sites   map[string]*auditSite
+}
+
+type auditSite struct {
+	sets       int
+	minTimeout time.Duration
+	maxTimeout time.Duration
+	expired    int
+	ops        int
+	maxLatency time.Duration
+	buckets    []int // counts per auditLatencyBuckets plus overflow
+}
+
+func newDeadlineAudit() *deadlineAudit {
+	return &deadlineAudit{started: time.Now(), sites: make(map[string]*auditSite)}
+}
+
+func (a *deadlineAudit) site(name string) *auditSite {
+	s, ok := a.sites[name]
+	if !ok {
+		s = &auditSite{buckets: make([]int, len(auditLatencyBuckets)+1)}
+		a.sites[name] = s
+	}
+	return s
+}
+
+// set records deadline set timeout from now, zero timeout means no deadline. It's a no-op for
+// nil audit, so audit can be disabled.
+func (a *deadlineAudit) set(name string, timeout time.Duration) {
+	if a == nil {
+		return
+	}
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	s := a.site(name)
+	if s.sets == 0 || timeout < s.minTimeout {
+		s.minTimeout = timeout
+	}
+	if timeout > s.maxTimeout {
+		s.maxTimeout = timeout
+	}
+	s.sets++
+}
+
+// done records read or write started at start, which has finished with err.
+func (a *deadlineAudit) done(name string, start time.Time, err error) {
+	if a == nil {
+		return
+	}
+	latency := time.Since(start)
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	s := a.site(name)
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			s.expired++
+		}
+		return
+	}
+	s.ops++
+	if latency > s.maxLatency {
+		s.maxLatency = latency
+	}
+	i := sort.Search(len(auditLatencyBuckets), func(i int) bool { return latency <= auditLatencyBuckets[i] })
+	s.buckets[i]++
+}
+
+// quantile returns upper bound of the bucket q-th quantile of latencies falls into.
+func (s *auditSite) quantile(q float64) time.Duration {
+	rank := int(q*float64(s.ops) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	seen := 0
+	for i, n := range s.buckets {
+		seen += n
+		if seen >= rank {
+			if i < len(auditLatencyBuckets) {
+				return auditLatencyBuckets[i]
+			}
+			break
+		}
+	}
+	return s.maxLatency
+}
+
+// writeReport writes a human readable report with a summary line and a latency histogram
+// per site.
+func (a *deadlineAudit) writeReport(w io.Writer) error {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	names := make([]string, 0, len(a.sites))
+	for name := range a.sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Deadline audit for %v\n\n", time.Since(a.started).Round(time.Second))
+	fmt.Fprintf(tw, "site\tsets\ttimeout\texpired\tops\tp50\tp99\tmax\n")
+	for _, name := range names {
+		s := a.sites[name]
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%d\t%s\t%s\t%v\n", name, s.sets, formatTimeoutRange(s),
+			s.expired, s.ops, formatQuantile(s, 0.5), formatQuantile(s, 0.99), s.maxLatency)
+	}
+
+	for _, name := range names {
+		s := a.sites[name]
+		if s.ops == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "\n%s latency:\n", name)
+		for i, n := range s.buckets {
+			if n == 0 {
+				continue
+			}
+			bound := "+Inf"
+			if i < len(auditLatencyBuckets) {
+				bound = auditLatencyBuckets[i].String()
+			}
+			fmt.Fprintf(tw, "  <= %s\t%d\t%.1f%%\n", bound, n, 100*float64(n)/float64(s.ops))
+		}
+	}
+	return tw.Flush()
+}
+
+func formatTimeoutRange(s *auditSite) string {
+	switch {
+	case s.sets == 0:
+		return "-"
+	case s.maxTimeout == 0:
+		return "none"
+	case s.minTimeout == s.maxTimeout:
+		return s.maxTimeout.String()
+	}
+	return fmt.Sprintf("%v..%v", s.minTimeout, s.maxTimeout)
+}
+
+func formatQuantile(s *auditSite, q float64) string {
+	if s.ops == 0 {
+		return "-"
+	}
+	return s.quantile(q).String()
+}
+
+// dump writes the report to the file at path.
+func (a *deadlineAudit) dump(path string) error {
+	if a == nil {
+		return nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create deadline audit file: %w", err)
+	}
+	err = a.writeReport(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write deadline audit file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadlineAudit(t *testing.T) {
+	a := newDeadlineAudit()
+	a.set(auditWorkerRead, 30*time.Second)
+	a.set(auditWorkerRead, 10*time.Second)
+	a.done(auditWorkerRead, time.Now(), nil)
+	a.done(auditWorkerRead, time.Now(), fmt.Errorf("read: %w", os.ErrDeadlineExceeded))
+	a.done(auditWorkerRead, time.Now(), os.ErrClosed)
+	a.set(auditMainLoopWrite, 0)
+
+	s := a.sites[auditWorkerRead]
+	if s.sets != 2 || s.expired != 1 || s.ops != 1 {
+		t.Errorf("sets, expired, ops = %d, %d, %d, want 2, 1, 1", s.sets, s.expired, s.ops)
+	}
+	if got := formatTimeoutRange(s); got != "10s..30s" {
+		t.Errorf("formatTimeoutRange() = %q, want %q", got, "10s..30s")
+	}
+
+	var report strings.Builder
+	if err := a.writeReport(&report); err != nil {
+		t.Fatalf("writeReport() failed: %v", err)
+	}
+	for _, want := range []string{"main-loop write  1     none", "worker read latency:"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report doesn't contain %q:\n%s", want, report.String())
+		}
+	}
+}
+
+func TestAuditSiteQuantile(t *testing.T) {
+	const ms = time.Millisecond
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		q         float64
+		want      time.Duration
+	}{
+		{"single", []time.Duration{5 * ms}, 0.5, 10 * ms},
+		{"median", []time.Duration{ms / 2, ms / 2, 20 * ms}, 0.5, ms},
+		{"tail", []time.Duration{ms / 2, ms / 2, 20 * ms}, 0.99, 50 * ms},
+		{"above buckets", []time.Duration{time.Minute}, 0.99, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newDeadlineAudit()
+			for _, latency := range tt.latencies {
+				a.done(auditWorkerRead, time.Now().Add(-latency), nil)
+			}
+			if got := a.sites[auditWorkerRead].quantile(tt.q); got < tt.want || got > tt.want+ms {
+				t.Errorf("quantile(%v) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// Defaults shared by CLI and GUI.
+const (
+	DefaultServerURL  = "https://ei.koteyur.dev/proxy"
+	DefaultMasterAddr = "vps.gipat.ru:28004"
+)
+
+// EnvVar selects environment-specific overlay applied on top of defaults, e.g. "dev".
+const EnvVar = "EIPROXY_ENV"
+
+var envOverlays = map[string]Config{
+	// Local server started from source.
+	"dev": {ServerURL: MustParseURL("http://localhost:8080")},
+}
+
+// DefaultConfig returns default config with overlay for the current environment.
+func DefaultConfig() Config {
+	cfg := Config{
+		MasterAddr: MustParseHostPort(DefaultMasterAddr),
+		ServerURL:  MustParseURL(DefaultServerURL),
+	}
+
+	overlay := envOverlays[os.Getenv(EnvVar)]
+	if !overlay.MasterAddr.IsZero() {
+		cfg.MasterAddr = overlay.MasterAddr
+	}
+	if !overlay.ServerURL.IsZero() {
+		cfg.ServerURL = overlay.ServerURL
+	}
+	return cfg
+}
+
+// UserAgent returns user agent identifying the client to the server, e.g.
+// "eiproxy-gui/0.3.1 (windows; amd64; proto 1.0)". Frontend tells how the client is run: "gui"
+// or the command line mode, e.g. "client" or "host".
+func UserAgent(frontend string) string {
+	return fmt.Sprintf("eiproxy-%s/%s (%s; %s; proto %s)",
+		frontend, ClientVer, runtime.GOOS, runtime.GOARCH, protocol.Version)
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"runtime"
+	"testing"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	tests := []struct {
+		env           string
+		wantServerURL string
+	}{
+		{"", DefaultServerURL},
+		{"unknown", DefaultServerURL},
+		{"dev", "http://localhost:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv(EnvVar, tt.env)
+			cfg := DefaultConfig()
+			if cfg.ServerURL.String() != tt.wantServerURL {
+				t.Errorf("ServerURL = %q, want %q", cfg.ServerURL, tt.wantServerURL)
+			}
+			if cfg.MasterAddr.String() != DefaultMasterAddr {
+				t.Errorf("MasterAddr = %q, want %q", cfg.MasterAddr, DefaultMasterAddr)
+			}
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	want := "eiproxy-cli/" + ClientVer + " (" + runtime.GOOS + "; " + runtime.GOARCH + "; proto " +
+		protocol.Version + ")"
+	if got := UserAgent("cli"); got != want {
+		t.Errorf("UserAgent() = %q, want %q", got, want)
+	}
+}
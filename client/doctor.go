@@ -0,0 +1,260 @@
+package client
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultSTUNServers are asked for the public address to detect the NAT type.
+var DefaultSTUNServers = []string{"stun.l.google.com:19302", "stun.cloudflare.com:3478"}
+
+const (
+	stunBindingRequest    = 0x0001
+	stunBindingResponse   = 0x0101
+	stunAttrXORMappedAddr = 0x0020
+
+	diagnosticTimeout = 5 * time.Second
+)
+
+type DiagnosticStatus int
+
+const (
+	DiagnosticOK DiagnosticStatus = iota
+	DiagnosticWarning
+	DiagnosticFailed
+	DiagnosticSkipped
+)
+
+func (s DiagnosticStatus) String() string {
+	switch s {
+	case DiagnosticOK:
+		return "ok"
+	case DiagnosticWarning:
+		return "warning"
+	case DiagnosticFailed:
+		return "failed"
+	case DiagnosticSkipped:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// DiagnosticResult is the outcome of one check of Diagnose.
+type DiagnosticResult struct {
+	Check   string
+	Status  DiagnosticStatus
+	Details string
+}
+
+// Diagnose checks everything the client needs to host a game with cfg: name resolution, the
+// API, UDP path to the proxy port, NAT type and local ports. Each result is reported as soon
+// as it's known. The check of the proxy port opens a short session, so it fails while another
+// client is connected with the same key.
+func Diagnose(ctx context.Context, cfg Config, stunServers []string, report func(DiagnosticResult)) {
+	serverIP := diagnoseResolve(ctx, "Server address", cfg.ServerURL.Hostname(), report)
+	diagnoseResolve(ctx, "Master server address", cfg.MasterAddr.Host, report)
+
+	// Optional features might need codecs, which aren't set up here, and the direct path to
+	// the server is checked rather than a relay.
+	cfg = Config{ServerURL: cfg.ServerURL, MasterAddr: cfg.MasterAddr, UserKey: cfg.UserKey}
+	c := newClient(cfg)
+
+	apiCtx, cancel := context.WithTimeout(ctx, 2*diagnosticTimeout)
+	defer cancel()
+	if user, err := c.GetUser(apiCtx); err != nil {
+		report(DiagnosticResult{"API", DiagnosticFailed, err.Error()})
+	} else {
+		report(DiagnosticResult{"API", DiagnosticOK, fmt.Sprintf("key of %s, reserved port %d", user.Email, user.Port)})
+	}
+
+	if serverIP == nil {
+		report(DiagnosticResult{"Proxy port", DiagnosticSkipped, "server address isn't resolved"})
+	} else {
+		report(c.diagnoseProxyPort(ctx, serverIP))
+	}
+
+	report(diagnoseNAT(ctx, stunServers))
+
+	report(diagnoseLocalPort("Local master server port", DefaultLocalMasterAddr, DiagnosticWarning,
+		"in use by another program, another free port will be used"))
+	// Game server listens on the port while hosting.
+	report(diagnoseLocalPort("Game server port", defaultGameAddr, DiagnosticOK,
+		"in use, probably by the game server"))
+}
+
+func diagnoseResolve(ctx context.Context, check, host string, report func(DiagnosticResult)) net.IP {
+	if host == "" {
+		report(DiagnosticResult{check, DiagnosticFailed, "not set"})
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, diagnosticTimeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		report(DiagnosticResult{check, DiagnosticFailed, fmt.Sprintf("%s: %v", host, err)})
+		return nil
+	}
+	report(DiagnosticResult{check, DiagnosticOK, fmt.Sprintf("%s -> %v", host, ips[0])})
+	return ips[0]
+}
+
+// diagnoseProxyPort opens a session and checks that the proxy port answers the token.
+func (c *client) diagnoseProxyPort(ctx context.Context, serverIP net.IP) DiagnosticResult {
+	const check = "Proxy port"
+	connResp, err := c.connect(ctx)
+	if err != nil {
+		if errors.Is(err, protocol.ConnectionCodeAlreadyConnected) {
+			return DiagnosticResult{check, DiagnosticSkipped, "another client is connected with the key"}
+		}
+		return DiagnosticResult{check, DiagnosticFailed, fmt.Sprintf("failed to connect: %v", err)}
+	}
+	c.session = connResp
+	c.token = *connResp.Token
+
+	addr := net.JoinHostPort(serverIP.String(), strconv.Itoa(*connResp.Port))
+	ctx, cancel := context.WithTimeout(ctx, diagnosticTimeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := c.dialProxy(ctx, addr, func(conn *proxyConn) error { return sendToken(conn, c.tokenRequest()) })
+	if err != nil {
+		return DiagnosticResult{check, DiagnosticFailed,
+			fmt.Sprintf("%s doesn't answer, UDP might be blocked: %v", addr, err)}
+	}
+	rtt := time.Since(start)
+	closeDiagnosticSession(conn)
+	return DiagnosticResult{check, DiagnosticOK, fmt.Sprintf("%s answered in %v", addr, rtt.Round(time.Millisecond))}
+}
+
+// closeDiagnosticSession closes the session right away instead of letting it time out.
+func closeDiagnosticSession(conn *proxyConn) {
+	defer conn.Close()
+	var buf [64]byte
+	for retry := 0; retry < 3; retry++ {
+		if _, err := conn.Conn.Write([]byte{byte(protocol.ProxyClientRequestTypeDisconnect)}); err != nil {
+			return
+		}
+		_ = conn.Conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		for {
+			n, err := conn.Conn.Read(buf[:])
+			if err != nil {
+				break
+			}
+			if n > 0 && protocol.ProxyServerResponseType(buf[0]) == protocol.ProxyServerResponseTypeDisconnect {
+				return
+			}
+		}
+	}
+}
+
+// diagnoseNAT asks STUN servers for the public address from the same socket. NAT which maps
+// the socket to different addresses for different servers is symmetric.
+func diagnoseNAT(ctx context.Context, stunServers []string) DiagnosticResult {
+	const check = "NAT type"
+	if len(stunServers) == 0 {
+		return DiagnosticResult{check, DiagnosticSkipped, "no STUN servers"}
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return DiagnosticResult{check, DiagnosticFailed, err.Error()}
+	}
+	defer conn.Close()
+
+	var mapped []netip.AddrPort
+	var lastErr error
+	for _, server := range stunServers {
+		addr, err := stunBinding(ctx, conn, server)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		mapped = append(mapped, addr)
+	}
+	switch {
+	case len(mapped) == 0:
+		return DiagnosticResult{check, DiagnosticWarning, fmt.Sprintf("STUN servers don't answer: %v", lastErr)}
+	case len(mapped) == 1:
+		return DiagnosticResult{check, DiagnosticOK, fmt.Sprintf("public address %v, type is unknown", mapped[0])}
+	}
+	for _, addr := range mapped[1:] {
+		if addr != mapped[0] {
+			// Relaying works through it, unlike direct connections.
+			return DiagnosticResult{check, DiagnosticOK, fmt.Sprintf("symmetric, public addresses %v", mapped)}
+		}
+	}
+	localPort := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+	if localAddrs, err := localInterfaceAddrs(); err == nil && mapped[0].Port() == localPort {
+		for _, ip := range localAddrs {
+			if ip.Unmap() == mapped[0].Addr() {
+				return DiagnosticResult{check, DiagnosticOK, fmt.Sprintf("no NAT, public address %v", mapped[0].Addr())}
+			}
+		}
+	}
+	return DiagnosticResult{check, DiagnosticOK, fmt.Sprintf("cone, public address %v", mapped[0])}
+}
+
+// stunBinding returns the public address of conn seen by the STUN server.
+func stunBinding(ctx context.Context, conn *net.UDPConn, server string) (netip.AddrPort, error) {
+	ctx, cancel := context.WithTimeout(ctx, diagnosticTimeout)
+	defer cancel()
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		return netip.AddrPort{}, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	addr := netip.AddrPortFrom(ips[0].Unmap(), uint16(portNum))
+
+	req := newSTUNMessage(stunBindingRequest)
+	deadline, _ := ctx.Deadline()
+	var buf [1024]byte
+	for time.Now().Before(deadline) {
+		if _, err := conn.WriteToUDPAddrPort(req.encode(nil), addr); err != nil {
+			return netip.AddrPort{}, err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		for {
+			n, from, err := conn.ReadFromUDPAddrPort(buf[:])
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				break // retransmit
+			}
+			if err != nil {
+				return netip.AddrPort{}, err
+			}
+			resp, err := decodeSTUNMessage(buf[:n])
+			if err != nil || resp.tid != req.tid || from.Addr().Unmap() != addr.Addr() ||
+				resp.typ != stunBindingResponse {
+				continue
+			}
+			value, ok := resp.get(stunAttrXORMappedAddr)
+			if !ok {
+				return netip.AddrPort{}, fmt.Errorf("%s: no mapped address in response", server)
+			}
+			return decodeXORAddr(value, resp.tid)
+		}
+	}
+	return netip.AddrPort{}, fmt.Errorf("%s didn't respond", server)
+}
+
+// diagnoseLocalPort checks whether the local UDP port is free.
+func diagnoseLocalPort(check, addr string, inUseStatus DiagnosticStatus, inUse string) DiagnosticResult {
+	conn, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return DiagnosticResult{check, inUseStatus, fmt.Sprintf("%s is %s", addr, inUse)}
+	}
+	conn.Close()
+	return DiagnosticResult{check, DiagnosticOK, fmt.Sprintf("%s is free", addr)}
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"eiproxy/proxytest"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.User = protocol.UserResponse{Email: "host@example.com", Port: 7000}
+	serverURL, err := ParseURL(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{ServerURL: serverURL, MasterAddr: HostPort{Host: "127.0.0.1", Port: 28004}}
+
+	results := map[string]DiagnosticResult{}
+	Diagnose(context.Background(), cfg, nil, func(r DiagnosticResult) { results[r.Check] = r })
+
+	for check, want := range map[string]DiagnosticStatus{
+		"Server address":        DiagnosticOK,
+		"Master server address": DiagnosticOK,
+		"API":                   DiagnosticOK,
+		"Proxy port":            DiagnosticOK,
+		"NAT type":              DiagnosticSkipped,
+	} {
+		if got := results[check]; got.Status != want {
+			t.Errorf("%s = %v (%s), want %v", check, got.Status, got.Details, want)
+		}
+	}
+	if srv.Disconnects() != 1 {
+		t.Errorf("server saw %d disconnects, want 1", srv.Disconnects())
+	}
+}
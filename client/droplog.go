@@ -0,0 +1,116 @@
+package client
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+type DropDirection string
+
+const (
+	DropToServer   DropDirection = "to-server"
+	DropFromServer DropDirection = "from-server"
+)
+
+type DropReason string
+
+const (
+	DropReasonChannelFull DropReason = "channel-full"
+	DropReasonMalformed   DropReason = "malformed"
+	DropReasonCorrupted   DropReason = "corrupted"
+	// Packet exceeded Config.RateLimit.
+	DropReasonRateLimited DropReason = "rate-limited"
+)
+
+// DropRecord describes a single dropped packet.
+type DropRecord struct {
+	Time      time.Time
+	Direction DropDirection
+	Peer      netip.AddrPort // zero if peer is unknown
+	Size      int
+	Reason    DropReason
+}
+
+// dropLog keeps the most recent drop records in a fixed size ring buffer.
+type dropLog struct {
+	mut     sync.Mutex
+	records []DropRecord
+	next    int
+	full    bool
+}
+
+func newDropLog(size int) *dropLog {
+	if size <= 0 {
+		return nil
+	}
+	return &dropLog{records: make([]DropRecord, size)}
+}
+
+// add records a drop. It's a no-op for nil log, so drop log can be disabled.
+func (l *dropLog) add(r DropRecord) {
+	if l == nil {
+		return
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	l.records[l.next] = r
+	l.next++
+	if l.next == len(l.records) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// list returns records from oldest to newest.
+func (l *dropLog) list() []DropRecord {
+	if l == nil {
+		return nil
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	if !l.full {
+		return append([]DropRecord(nil), l.records[:l.next]...)
+	}
+	records := make([]DropRecord, 0, len(l.records))
+	records = append(records, l.records[l.next:]...)
+	return append(records, l.records[:l.next]...)
+}
+
+// recordDrop counts dropped packet and adds it to the drop log. p may be nil if peer is unknown.
+func (c *client) recordDrop(p *peer, dir DropDirection, size int, reason DropReason) {
+	c.traffic.dropped.Add(1)
+	c.metrics.dropped.Add(1)
+	if reason == DropReasonChannelFull {
+		if dir == DropToServer {
+			c.traffic.droppedToServer.Add(1)
+		} else {
+			c.traffic.droppedFromServer.Add(1)
+		}
+		c.checkDropRate()
+	}
+	if reason == DropReasonRateLimited {
+		c.traffic.rateLimited.Add(1)
+	}
+	r := DropRecord{Time: time.Now(), Direction: dir, Size: size, Reason: reason}
+	if p != nil {
+		p.traffic.dropped.Add(1)
+		r.Peer = p.currentAddr()
+	}
+	c.drops.add(r)
+}
+
+// recordMalformed records a frame from the proxy server which couldn't be decoded.
+func (c *client) recordMalformed(size int) {
+	c.traffic.malformed.Add(1)
+	c.metrics.malformed.Add(1)
+	c.recordDrop(nil, DropFromServer, size, DropReasonMalformed)
+}
+
+func (c *client) DropLog() []DropRecord {
+	return c.drops.list()
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestDropLog(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		sizes []int
+		want  []int
+	}{
+		{"disabled", 0, []int{1, 2}, nil},
+		{"partial", 3, []int{1, 2}, []int{1, 2}},
+		{"exact", 3, []int{1, 2, 3}, []int{1, 2, 3}},
+		{"wrapped", 3, []int{1, 2, 3, 4, 5}, []int{3, 4, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newDropLog(tt.size)
+			for _, size := range tt.sizes {
+				l.add(DropRecord{Size: size})
+			}
+
+			records := l.list()
+			if len(records) != len(tt.want) {
+				t.Fatalf("list() returned %d records, want %d", len(records), len(tt.want))
+			}
+			for i, r := range records {
+				if r.Size != tt.want[i] {
+					t.Errorf("list()[%d].Size = %d, want %d", i, r.Size, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordMalformed(t *testing.T) {
+	c := &client{drops: newDropLog(2), metrics: newClientMetrics(nil)}
+	c.recordMalformed(5)
+
+	s := c.Stats()
+	if s.Malformed != 1 || s.Dropped != 1 {
+		t.Errorf("Stats() malformed = %d, dropped = %d, want 1, 1", s.Malformed, s.Dropped)
+	}
+	records := c.DropLog()
+	if len(records) != 1 || records[0].Reason != DropReasonMalformed || records[0].Size != 5 {
+		t.Errorf("DropLog() = %+v, want one malformed record", records)
+	}
+}
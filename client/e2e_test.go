@@ -0,0 +1,449 @@
+package client
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"eiproxy/proxytest"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type runResult struct {
+	status ExitStatus
+	err    error
+}
+
+// startTestClient runs the client against srv with a fake game listening on the returned
+// connection. configure, if set, adjusts the client config.
+func startTestClient(t *testing.T, srv *proxytest.Server, configure func(*Config)) (
+	game *net.UDPConn, c Client, stop context.CancelFunc, done <-chan runResult,
+) {
+	t.Helper()
+	game, cfg := newTestConfig(t, srv)
+	if configure != nil {
+		configure(&cfg)
+	}
+	c = New(cfg)
+	stop, done = runTestClient(t, c)
+	return game, c, stop, done
+}
+
+// newTestConfig returns config of the client connecting to srv for the fake game.
+func newTestConfig(t *testing.T, srv *proxytest.Server) (*net.UDPConn, Config) {
+	t.Helper()
+	game, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { game.Close() })
+
+	serverURL, err := ParseURL(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		ServerURL:       serverURL,
+		MasterAddr:      HostPort{Host: "127.0.0.1", Port: 28004},
+		GameAddr:        HostPort{Host: "127.0.0.1", Port: uint16(game.LocalAddr().(*net.UDPAddr).Port)},
+		LocalMasterAddr: HostPort{Host: "127.0.0.1", Port: 0},
+	}
+	return game, cfg
+}
+
+// runTestClient runs c in background until the returned function is called.
+func runTestClient(t *testing.T, c Client) (stop context.CancelFunc, done <-chan runResult) {
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan runResult, 1)
+	go func() {
+		status, err := c.Run(ctx)
+		results <- runResult{status, err}
+	}()
+	t.Cleanup(cancel)
+	return cancel, results
+}
+
+func waitRun(t *testing.T, done <-chan runResult, timeout time.Duration) runResult {
+	t.Helper()
+	select {
+	case r := <-done:
+		return r
+	case <-time.After(timeout):
+		t.Fatal("client hasn't stopped")
+		return runResult{}
+	}
+}
+
+func TestEndToEndRelay(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	game, _, stop, done := startTestClient(t, srv, nil)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	peer := netip.MustParseAddrPort("10.0.0.5:1234")
+	if err := srv.Send(peer, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	game.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var buf [64]byte
+	n, from, err := game.ReadFromUDP(buf[:])
+	if err != nil {
+		t.Fatalf("game hasn't received the packet: %v", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Errorf("game received %q, want %q", buf[:n], "hello")
+	}
+
+	// Game replies to the local address of the peer.
+	if _, err := game.WriteToUDP([]byte("world"), from); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-srv.Packets():
+		if p.Peer != peer || string(p.Data) != "world" {
+			t.Errorf("server received %q for %v, want %q for %v", p.Data, p.Peer, "world", peer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server hasn't received the reply")
+	}
+
+	stop()
+	r := waitRun(t, done, 5*time.Second)
+	if r.err != nil || r.status.Reason != ExitUserStopped {
+		t.Errorf("Run() = %v, %v, want %v", r.status, r.err, ExitUserStopped)
+	}
+	if srv.Disconnects() != 1 {
+		t.Errorf("server saw %d disconnects, want 1", srv.Disconnects())
+	}
+}
+
+func TestEndToEndStates(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	_, cfg := newTestConfig(t, srv)
+	c := New(cfg)
+	states := make(chan State, 20)
+	c.Subscribe(func(e Event) {
+		if e.Type == EventStateChanged {
+			states <- e.State
+		}
+	})
+	stop, done := runTestClient(t, c)
+
+	want := []State{StateResolving, StateConnecting, StateHandshaking, StateConnected}
+	for _, s := range want {
+		select {
+		case got := <-states:
+			if got != s {
+				t.Fatalf("state changed to %v, want %v", got, s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("state hasn't changed to %v", s)
+		}
+	}
+	if got := c.State(); got != StateConnected {
+		t.Errorf("State() = %v, want %v", got, StateConnected)
+	}
+
+	stop()
+	waitRun(t, done, 5*time.Second)
+	for _, s := range []State{StateStopping, StateStopped} {
+		select {
+		case got := <-states:
+			if got != s {
+				t.Fatalf("state changed to %v, want %v", got, s)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("state hasn't changed to %v", s)
+		}
+	}
+	if got := c.State(); got != StateStopped {
+		t.Errorf("State() = %v, want %v", got, StateStopped)
+	}
+}
+
+func TestEndToEndKeepAliveTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for session timeout")
+	}
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.KeepAliveInterval, srv.SessionTimeout = 1, 3
+	_, _, _, done := startTestClient(t, srv, nil)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SetSilent(true)
+
+	r := waitRun(t, done, 10*time.Second)
+	if !errors.Is(r.err, ErrNetwork) || r.status.Reason != ExitNetworkLost {
+		t.Errorf("Run() = %v, %v, want %v", r.status, r.err, ErrNetwork)
+	}
+}
+
+func TestEndToEndServerDisconnect(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	_, _, _, done := startTestClient(t, srv, nil)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.Disconnect()
+	r := waitRun(t, done, 5*time.Second)
+	if r.status.Reason != ExitServerDisconnect || r.status.ServerReason != protocol.DisconnectReasonUnknown {
+		t.Errorf("Run() = %v, %v, want %v", r.status, r.err, ExitServerDisconnect)
+	}
+}
+
+func TestEndToEndServerDisconnectReason(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.Capabilities = append(proxytest.DefaultCapabilities, protocol.CapabilitySessionSummary,
+		protocol.CapabilityDisconnectReason)
+	_, _, _, done := startTestClient(t, srv, nil)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.DisconnectWithReason(protocol.DisconnectReasonKicked)
+	r := waitRun(t, done, 5*time.Second)
+	if r.status.Reason != ExitServerDisconnect || r.status.ServerReason != protocol.DisconnectReasonKicked {
+		t.Errorf("Run() = %+v, %v, want %v with reason %v", r.status, r.err, ExitServerDisconnect,
+			protocol.DisconnectReasonKicked)
+	}
+	if !errors.Is(r.err, errServerDisconnected) {
+		t.Errorf("Run() error = %v, want %v", r.err, errServerDisconnected)
+	}
+}
+
+func TestEndToEndUnauthorized(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	key, err := protocol.NewUserKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Key = key.String()
+
+	other, err := protocol.NewUserKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, done := startTestClient(t, srv, func(cfg *Config) { cfg.UserKey = other })
+	r := waitRun(t, done, 5*time.Second)
+	if !errors.Is(r.err, ErrUnauthorized) || r.status.Reason != ExitAuthFailure {
+		t.Errorf("Run() = %v, %v, want %v", r.status, r.err, ErrUnauthorized)
+	}
+}
+
+func TestEndToEndKeyExpired(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.KeyExpired = true
+
+	_, cfg := newTestConfig(t, srv)
+	_, err := New(cfg).GetUser(context.Background())
+	if !errors.Is(err, protocol.ErrorCodeKeyExpired) || !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("GetUser() = %v, want %v and %v", err, protocol.ErrorCodeKeyExpired, ErrUnauthorized)
+	}
+}
+
+func TestEndToEndProxyAddr(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	key, err := protocol.NewUserKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Key = key.String()
+
+	_, cfg := newTestConfig(t, srv)
+	cfg.UserKey = key
+	c := New(cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.ProxyAddr(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ProxyAddr() before Run = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	stop, done := runTestClient(t, c)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if addr, err := c.ProxyAddr(ctx); err != nil || !addr.IsValid() {
+		t.Errorf("ProxyAddr() = %v, %v, want assigned address", addr, err)
+	}
+	stop()
+	waitRun(t, done, 5*time.Second)
+
+	// Stopped client reports why it has stopped.
+	other, err := protocol.NewUserKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, c, _, done = startTestClient(t, srv, func(cfg *Config) { cfg.UserKey = other })
+	_, err = c.ProxyAddr(ctx)
+	if !errors.Is(err, ErrStopped) || !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("ProxyAddr() of stopped client = %v, want %v and %v", err, ErrStopped, ErrUnauthorized)
+	}
+	waitRun(t, done, 5*time.Second)
+}
+
+func TestEndToEndBootstrapFromServer(t *testing.T) {
+	recommended := []protocol.Capability{protocol.CapabilityCompression}
+	tests := []struct {
+		name   string
+		config *protocol.ServerConfig
+		want   bool // whether recommended capabilities are requested
+	}{
+		{"recommended", &protocol.ServerConfig{RecommendedCapabilities: recommended}, true},
+		{"not provided", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := proxytest.NewServer()
+			defer srv.Close()
+			srv.Config = tt.config
+			_, _, _, _ = startTestClient(t, srv, func(cfg *Config) { cfg.BootstrapFromServer = true })
+			if err := srv.WaitForClient(5 * time.Second); err != nil {
+				t.Fatal(err)
+			}
+
+			requested := protocol.ConnectionResponse{Capabilities: srv.RequestedCapabilities()}
+			if got := requested.HasCapability(protocol.CapabilityCompression); got != tt.want {
+				t.Errorf("compression requested = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndToEndMaintenance(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.Capabilities = append(proxytest.DefaultCapabilities, protocol.CapabilityMaintenance)
+	_, cfg := newTestConfig(t, srv)
+	c := New(cfg)
+	events := make(chan Event, 10)
+	c.Subscribe(func(e Event) {
+		if e.Type == EventMaintenance {
+			events <- e
+		}
+	})
+	runTestClient(t, c)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	scheduled := protocol.Maintenance{Start: time.Unix(1700000000, 0), Duration: time.Hour, Message: "upgrade"}
+	// The repeated announcement must be reported once.
+	for _, m := range []protocol.Maintenance{scheduled, scheduled, {}} {
+		if err := srv.AnnounceMaintenance(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []protocol.Maintenance{scheduled, {}} {
+		select {
+		case e := <-events:
+			if !e.Maintenance.Start.Equal(want.Start) || e.Maintenance.Duration != want.Duration ||
+				e.Message != want.Message {
+				t.Errorf("got maintenance %+v, want %+v", e.Maintenance, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("maintenance %+v hasn't been reported", want)
+		}
+	}
+}
+
+func TestEndToEndSessionSummary(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.Capabilities = append(proxytest.DefaultCapabilities, protocol.CapabilitySessionSummary)
+	_, cfg := newTestConfig(t, srv)
+	c := New(cfg)
+	summaries := make(chan protocol.SessionSummary, 1)
+	c.Subscribe(func(e Event) {
+		if e.Type == EventSessionSummary {
+			summaries <- e.Summary
+		}
+	})
+	stop, done := runTestClient(t, c)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Send(netip.MustParseAddrPort("10.0.0.1:1000"), []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	stop()
+	waitRun(t, done, 5*time.Second)
+	select {
+	case s := <-summaries:
+		if s.PeakPeers != 1 || s.BytesRelayed != 5 {
+			t.Errorf("got summary %+v, want 1 peer and 5 bytes", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session summary hasn't been reported")
+	}
+}
+
+func TestEndToEndRestartEncrypted(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.Capabilities = append([]protocol.Capability{protocol.CapabilityResume, protocol.CapabilityEncryption},
+		proxytest.DefaultCapabilities...)
+	game, cfg := newTestConfig(t, srv)
+	cfg.Encrypt = true
+	cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+	// The second client would resume the session saved by the first one, sealing datagrams
+	// with the same key from the first nonce again.
+	peer := netip.MustParseAddrPort("10.0.0.5:1234")
+	for run := 0; run < 2; run++ {
+		c := New(cfg)
+		stop, done := runTestClient(t, c)
+		// A resumed session doesn't authenticate with the token again, so wait for the state.
+		deadline := time.Now().Add(5 * time.Second)
+		for c.State() != StateConnected && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := srv.Send(peer, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		game.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var buf [64]byte
+		_, from, err := game.ReadFromUDP(buf[:])
+		if err != nil {
+			t.Fatalf("run %d: game hasn't received the packet: %v", run, err)
+		}
+		if _, err := game.WriteToUDP([]byte("world"), from); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-srv.Packets():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("run %d: server hasn't received the reply, %d datagrams had reused nonces",
+				run, srv.Replayed())
+		}
+
+		stop()
+		waitRun(t, done, 5*time.Second)
+		if data, err := os.ReadFile(cfg.StateFile); err == nil && strings.Contains(string(data), "encryption_key") {
+			t.Errorf("run %d: session key is saved to the state file", run)
+		}
+	}
+	if n := srv.Replayed(); n != 0 {
+		t.Errorf("server rejected %d datagrams with reused nonces", n)
+	}
+	if n := srv.Disconnects(); n != 2 {
+		t.Errorf("server saw %d disconnects, want each encrypted session closed", n)
+	}
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"log"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// State is a stage of the client lifecycle, changes are reported with EventStateChanged. A run
+// goes Resolving -> Connecting -> Handshaking -> Connected, then Stopping -> Stopped. After a
+// failure the client is Reconnecting and starts over from Resolving, or goes straight back to
+// Connected when the session is resumed.
+type State int
+
+const (
+	StateStopped      State = iota
+	StateResolving          // resolving the server address
+	StateConnecting         // requesting a session from the API
+	StateHandshaking        // sending the token to the proxy port
+	StateConnected          // proxy address is assigned and the tunnel is up
+	StateReconnecting       // waiting before the next attempt or resuming the session
+	StateStopping           // closing the session
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStopped:
+		return "stopped"
+	case StateResolving:
+		return "resolving"
+	case StateConnecting:
+		return "connecting"
+	case StateHandshaking:
+		return "handshaking"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateStopping:
+		return "stopping"
+	default:
+		return "unknown"
+	}
+}
+
+type EventType int
+
+const (
+	EventStateChanged EventType = iota
+	EventPeerConnected
+	EventPeerDisconnected
+	EventError
+	EventDeprecationWarning
+	EventDropWarning
+	EventMaintenance
+	EventSessionSummary
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventStateChanged:
+		return "state changed"
+	case EventPeerConnected:
+		return "peer connected"
+	case EventPeerDisconnected:
+		return "peer disconnected"
+	case EventError:
+		return "error"
+	case EventDeprecationWarning:
+		return "deprecation warning"
+	case EventDropWarning:
+		return "drop warning"
+	case EventMaintenance:
+		return "maintenance"
+	case EventSessionSummary:
+		return "session summary"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a change in client lifecycle. Only fields relevant to the event type are set.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	State State // EventStateChanged
+
+	Peer     netip.AddrPort // EventPeerConnected, EventPeerDisconnected
+	PeerName string         // friendly name of the peer, if known
+	LocalIP  netip.Addr     // virtual local IP assigned to the peer
+
+	Err error // EventError, or EventStateChanged to StateStopped/StateReconnecting
+
+	Message string // EventDeprecationWarning, EventDropWarning, EventMaintenance
+
+	// EventMaintenance, the one cancelling the previous announcement has zero Start.
+	Maintenance protocol.Maintenance
+
+	Summary protocol.SessionSummary // EventSessionSummary
+}
+
+type EventHandler func(Event)
+
+const eventQueueSize = 100
+
+// eventBus delivers events to subscribers in order on a separate goroutine, so slow handlers
+// don't block the data path. The goroutine exits once the bus is closed.
+type eventBus struct {
+	mut      sync.Mutex
+	handlers map[int]EventHandler
+	nextID   int
+	queue    chan Event
+	done     chan struct{} // closed when dispatch exits
+	closed   bool
+}
+
+func (b *eventBus) subscribe(h EventHandler) func() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.closed {
+		return func() {}
+	}
+	if b.queue == nil {
+		b.handlers = make(map[int]EventHandler)
+		b.queue = make(chan Event, eventQueueSize)
+		b.done = make(chan struct{})
+		go b.dispatch()
+	}
+
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = h
+
+	return func() {
+		b.mut.Lock()
+		defer b.mut.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+func (b *eventBus) emit(e Event) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.closed || len(b.handlers) == 0 {
+		return
+	}
+
+	e.Time = time.Now()
+	select {
+	case b.queue <- e:
+	default:
+		log.Printf("Event queue is full, dropping %v event", e.Type)
+	}
+}
+
+// close stops the bus. Events queued before are still delivered, later ones are dropped.
+func (b *eventBus) close() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	if b.queue != nil {
+		close(b.queue)
+	}
+}
+
+func (b *eventBus) dispatch() {
+	defer close(b.done)
+	for e := range b.queue {
+		b.mut.Lock()
+		handlers := make([]EventHandler, 0, len(b.handlers))
+		for _, h := range b.handlers {
+			handlers = append(handlers, h)
+		}
+		b.mut.Unlock()
+
+		for _, h := range handlers {
+			h(e)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	var bus eventBus
+
+	// Events without subscribers are dropped.
+	bus.emit(Event{Type: EventError})
+
+	received := make(chan Event, 10)
+	unsubscribe := bus.subscribe(func(e Event) { received <- e })
+
+	bus.emit(Event{Type: EventStateChanged, State: StateConnecting})
+	bus.emit(Event{Type: EventStateChanged, State: StateConnected})
+
+	for _, want := range []State{StateConnecting, StateConnected} {
+		select {
+		case e := <-received:
+			if e.Type != EventStateChanged || e.State != want {
+				t.Errorf("got event %v/%v, want %v/%v", e.Type, e.State, EventStateChanged, want)
+			}
+			if e.Time.IsZero() {
+				t.Errorf("event time is not set")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event wasn't delivered")
+		}
+	}
+
+	unsubscribe()
+	bus.emit(Event{Type: EventError})
+	select {
+	case e := <-received:
+		t.Errorf("got event %v after unsubscribe", e.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEventBusClose(t *testing.T) {
+	var bus eventBus
+	received := make(chan Event, 10)
+	bus.subscribe(func(e Event) { received <- e })
+
+	bus.emit(Event{Type: EventStateChanged, State: StateStopped})
+	bus.close()
+	bus.emit(Event{Type: EventError})
+	bus.close()
+
+	select {
+	case <-bus.done:
+	case <-time.After(time.Second):
+		t.Fatalf("dispatch goroutine hasn't exited")
+	}
+	if len(received) != 1 {
+		t.Fatalf("got %d events, want the one emitted before close", len(received))
+	}
+	if e := <-received; e.State != StateStopped {
+		t.Errorf("got event %v/%v, want %v/%v", e.Type, e.State, EventStateChanged, StateStopped)
+	}
+
+	// Subscribing to the closed bus doesn't start dispatch again.
+	bus.subscribe(func(e Event) { received <- e })()
+	bus.emit(Event{Type: EventError})
+	if len(received) != 0 {
+		t.Errorf("got event after close")
+	}
+}
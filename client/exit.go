@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"eiproxy/api"
+	"eiproxy/protocol"
+	"errors"
+	"fmt"
+)
+
+var (
+	errServerDisconnected  = errors.New("server disconnected")
+	errServerNotResponding = errors.New("server stopped responding")
+)
+
+// disconnectError is errServerDisconnected with the reason the server has sent.
+type disconnectError struct {
+	reason protocol.DisconnectReason
+}
+
+func (e disconnectError) Error() string {
+	return fmt.Sprintf("%v: %v", errServerDisconnected, e.reason)
+}
+
+func (e disconnectError) Unwrap() error {
+	return errServerDisconnected
+}
+
+// Errors returned by Run and GetUser wrap one of these, so embedders can tell failure classes
+// apart with errors.Is.
+var (
+	// Server rejected the access key.
+	ErrUnauthorized = api.ErrUnauthorized
+	// Server has no free slots.
+	ErrServerFull = api.ErrServerFull
+	// Server doesn't support this client version.
+	ErrVersionMismatch = api.ErrVersionMismatch
+	// Server is temporarily unavailable.
+	ErrMaintenance = api.ErrMaintenance
+	// Server is unreachable or stopped responding.
+	ErrNetwork = api.ErrNetwork
+)
+
+// ErrStopped is returned by ProxyAddr if the client has stopped before the proxy address was
+// assigned. The error also wraps the one returned by Run, if any.
+var ErrStopped = errors.New("client stopped")
+
+// classifyError is api.ClassifyError which also treats the silence of the tunnel as
+// a network error.
+func classifyError(err error) error {
+	if errors.Is(err, errServerNotResponding) && !errors.Is(err, ErrNetwork) {
+		return fmt.Errorf("%w: %w", ErrNetwork, err)
+	}
+	return api.ClassifyError(err)
+}
+
+// ExitReason tells why Run has returned, so UI can choose a proper reaction without
+// matching error strings.
+type ExitReason int
+
+const (
+	// Context was cancelled, e.g. user pressed Stop.
+	ExitUserStopped ExitReason = iota
+	// Server closed the session.
+	ExitServerDisconnect
+	// Server rejected the access key.
+	ExitAuthFailure
+	// Server is unreachable or stopped responding.
+	ExitNetworkLost
+	// Any other failure.
+	ExitInternalError
+)
+
+func (r ExitReason) String() string {
+	switch r {
+	case ExitUserStopped:
+		return "user stopped"
+	case ExitServerDisconnect:
+		return "server disconnect"
+	case ExitAuthFailure:
+		return "auth failure"
+	case ExitNetworkLost:
+		return "network lost"
+	case ExitInternalError:
+		return "internal error"
+	default:
+		return "unknown"
+	}
+}
+
+// ExitStatus is a terminal status of the client returned by Run.
+type ExitStatus struct {
+	Reason ExitReason
+	// Human readable details, e.g. disconnect reason reported by the server.
+	Detail string
+	// Why the server has closed the session with ExitServerDisconnect, e.g. kicked by the
+	// operator or maintenance. DisconnectReasonUnknown if the server hasn't told.
+	ServerReason protocol.DisconnectReason
+}
+
+func (s ExitStatus) String() string {
+	if s.Detail == "" {
+		return s.Reason.String()
+	}
+	return s.Reason.String() + ": " + s.Detail
+}
+
+func exitStatusFromError(err error) ExitStatus {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return ExitStatus{Reason: ExitUserStopped}
+	}
+
+	status := ExitStatus{Reason: ExitInternalError, Detail: err.Error()}
+
+	switch err = classifyError(err); {
+	case errors.Is(err, errServerDisconnected):
+		status.Reason = ExitServerDisconnect
+		var disconnect disconnectError
+		if errors.As(err, &disconnect) {
+			status.ServerReason = disconnect.reason
+		}
+	case errors.Is(err, ErrUnauthorized):
+		status.Reason = ExitAuthFailure
+	case errors.Is(err, ErrNetwork):
+		status.Reason = ExitNetworkLost
+	}
+	return status
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"eiproxy/common"
+	"eiproxy/protocol"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestExitStatusFromError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ExitReason
+	}{
+		{"nil", nil, ExitUserStopped},
+		{"cancelled", fmt.Errorf("foo: %w", context.Canceled), ExitUserStopped},
+		{"disconnect", fmt.Errorf("main loop: %w", errServerDisconnected), ExitServerDisconnect},
+		{"unauthorized", fmt.Errorf("connect: %w", common.HttpError(http.StatusUnauthorized)),
+			ExitAuthFailure},
+		{"not responding", fmt.Errorf("main loop: %w", errServerNotResponding), ExitNetworkLost},
+		{"http error", common.HttpError(http.StatusInternalServerError), ExitInternalError},
+		{"other", errors.New("foo"), ExitInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitStatusFromError(tt.err); got.Reason != tt.want {
+				t.Errorf("exitStatusFromError() = %v, want %v", got.Reason, tt.want)
+			}
+		})
+	}
+
+	err := fmt.Errorf("main loop: %w", disconnectError{protocol.DisconnectReasonMaintenance})
+	got := exitStatusFromError(err)
+	if got.Reason != ExitServerDisconnect || got.ServerReason != protocol.DisconnectReasonMaintenance ||
+		got.Detail != "main loop: server disconnected: maintenance" {
+		t.Errorf("exitStatusFromError() with server reason = %+v", got)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"unauthorized", common.HttpError(http.StatusUnauthorized), ErrUnauthorized},
+		{"forbidden", fmt.Errorf("connect: %w", common.HttpError(http.StatusForbidden)), ErrUnauthorized},
+		{"maintenance", common.HttpError(http.StatusServiceUnavailable), ErrMaintenance},
+		{"key expired", &common.ApiError{Status: http.StatusForbidden,
+			Response: protocol.ErrorResponse{Code: protocol.ErrorCodeKeyExpired}}, ErrUnauthorized},
+		{"maintenance code", &common.ApiError{Status: http.StatusInternalServerError,
+			Response: protocol.ErrorResponse{Code: protocol.ErrorCodeMaintenance}}, ErrMaintenance},
+		{"server full", fmt.Errorf("server returned error: %w", protocol.ConnectionCodeServerFull),
+			ErrServerFull},
+		{"version mismatch", protocol.ConnectionCodeVersionMismatch, ErrVersionMismatch},
+		{"not responding", fmt.Errorf("main loop: %w", errServerNotResponding), ErrNetwork},
+		{"dns", &net.DNSError{Err: "no such host", Name: "example.com"}, ErrNetwork},
+		{"already classified", fmt.Errorf("%w: foo", ErrMaintenance), ErrMaintenance},
+		{"http error", common.HttpError(http.StatusInternalServerError), nil},
+		{"cancelled", context.Canceled, nil},
+		{"other", errors.New("foo"), nil},
+	}
+	classes := []error{ErrUnauthorized, ErrServerFull, ErrVersionMismatch, ErrMaintenance, ErrNetwork}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError(tt.err)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("classifyError() = %v, doesn't wrap the original error", err)
+			}
+			for _, class := range classes {
+				if got := errors.Is(err, class); got != (class == tt.want) {
+					t.Errorf("errors.Is(classifyError(), %v) = %v", class, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"eiproxy/proxytest"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// expectRelayed sends packets from peer via srv until the game receives one, so it tolerates
+// lossy links and sessions which are still recovering.
+func expectRelayed(t *testing.T, srv *proxytest.Server, game *net.UDPConn, peer netip.AddrPort,
+	timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	var buf [64]byte
+	for time.Now().Before(deadline) {
+		data := fmt.Sprintf("ping %v", time.Now().UnixNano())
+		_ = srv.Send(peer, []byte(data))
+		game.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		for {
+			n, _, err := game.ReadFromUDP(buf[:])
+			if err != nil {
+				break
+			}
+			if string(buf[:n]) == data {
+				return
+			}
+		}
+	}
+	t.Fatalf("game hasn't received packets from %v", peer)
+}
+
+func assertRunning(t *testing.T, done <-chan runResult) {
+	t.Helper()
+	select {
+	case r := <-done:
+		t.Fatalf("client stopped: %v, %v", r.status, r.err)
+	default:
+	}
+}
+
+func TestFaultsResumeAfterOutage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for session timeouts")
+	}
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.Capabilities = append(proxytest.DefaultCapabilities, protocol.CapabilityResume)
+	srv.KeepAliveInterval, srv.SessionTimeout, srv.ResumeGrace = 1, 3, 10
+	game, c, _, done := startTestClient(t, srv, nil)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	peer := netip.MustParseAddrPort("10.0.0.5:1234")
+	expectRelayed(t, srv, game, peer, 5*time.Second)
+
+	// Outage outlives the session timeout, so the client has to resume the session.
+	srv.SetFaults(proxytest.Faults{Loss: 1})
+	time.Sleep(4 * time.Second)
+	srv.SetFaults(proxytest.Faults{})
+
+	expectRelayed(t, srv, game, peer, 5*time.Second)
+	assertRunning(t, done)
+	if reconnects := c.Stats().Reconnects; reconnects == 0 {
+		t.Errorf("Stats().Reconnects = 0, want the session resumed")
+	}
+}
+
+func TestFaultsResumeExpiredSession(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for session timeouts")
+	}
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.Capabilities = append(proxytest.DefaultCapabilities, protocol.CapabilityResume)
+	srv.KeepAliveInterval, srv.SessionTimeout, srv.ResumeGrace = 1, 3, 10
+	game, c, _, done := startTestClient(t, srv, nil)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Server forgets the session during the outage, so resumption fails and the client has to
+	// open a new session.
+	srv.SetFaults(proxytest.Faults{Loss: 1})
+	srv.ExpireSessions()
+	time.Sleep(4 * time.Second)
+	srv.SetFaults(proxytest.Faults{})
+
+	if err := srv.WaitForClient(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	expectRelayed(t, srv, game, netip.MustParseAddrPort("10.0.0.5:1234"), 5*time.Second)
+	assertRunning(t, done)
+	if reconnects := c.Stats().Reconnects; reconnects == 0 {
+		t.Errorf("Stats().Reconnects = 0, want a resume attempt")
+	}
+}
+
+func TestFaultsLossyLinkKeepsSession(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for session timeouts")
+	}
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	srv.KeepAliveInterval, srv.SessionTimeout = 1, 3
+	game, c, _, done := startTestClient(t, srv, nil)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.SetFaults(proxytest.Faults{
+		Latency: 20 * time.Millisecond, Jitter: 30 * time.Millisecond,
+		Loss: 0.1, Duplicate: 0.2, Reorder: 0.2,
+	})
+	peer := netip.MustParseAddrPort("10.0.0.5:1234")
+	for i := 0; i < 5; i++ {
+		expectRelayed(t, srv, game, peer, 5*time.Second)
+		time.Sleep(time.Second)
+	}
+	assertRunning(t, done)
+	if reconnects := c.Stats().Reconnects; reconnects != 0 {
+		t.Errorf("Stats().Reconnects = %d, want 0", reconnects)
+	}
+}
+
+func TestFaultsKeepAliveExpiry(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for session timeouts")
+	}
+	tests := []struct {
+		name   string
+		faults proxytest.Faults
+	}{
+		{"dead link", proxytest.Faults{Loss: 1}},
+		{"latency above timeout", proxytest.Faults{Latency: 5 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := proxytest.NewServer()
+			defer srv.Close()
+			srv.KeepAliveInterval, srv.SessionTimeout = 1, 3
+			_, _, _, done := startTestClient(t, srv, nil)
+			if err := srv.WaitForClient(5 * time.Second); err != nil {
+				t.Fatal(err)
+			}
+
+			srv.SetFaults(tt.faults)
+			r := waitRun(t, done, 10*time.Second)
+			if !errors.Is(r.err, ErrNetwork) || r.status.Reason != ExitNetworkLost {
+				t.Errorf("Run() = %v, %v, want %v", r.status, r.err, ErrNetwork)
+			}
+		})
+	}
+}
+
+func TestFaultsFloodKeepsSession(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	game, c, _, done := startTestClient(t, srv, nil)
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// The game doesn't read while the relay floods it. Packets which don't fit into the client
+	// channels must be dropped without stalling the session.
+	srv.SetFaults(proxytest.Faults{Duplicate: 0.5})
+	peer := netip.MustParseAddrPort("10.0.0.5:1234")
+	payload := make([]byte, 512)
+	for i := 0; i < 3*dataChanSize; i++ {
+		if err := srv.Send(peer, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.SetFaults(proxytest.Faults{})
+	t.Logf("Dropped %d packets", c.Stats().Dropped)
+
+	expectRelayed(t, srv, game, peer, 5*time.Second)
+	assertRunning(t, done)
+}
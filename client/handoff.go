@@ -0,0 +1,52 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+)
+
+// Handoffer is implemented by clients which can pass their connection to the proxy server to
+// a new process, e.g. on upgrade without dropping the hosted game. See Config.InheritedConn.
+type Handoffer interface {
+	// ProxyConnFile returns a duplicate of the socket connected to the proxy server.
+	ProxyConnFile() (*os.File, error)
+}
+
+func (c *client) ProxyConnFile() (*os.File, error) {
+	c.mut.Lock()
+	conn := c.proxyConn
+	c.mut.Unlock()
+	if conn == nil {
+		return nil, errors.New("not connected to the proxy server")
+	}
+	if !sessionResumable(c.currentSession()) {
+		return nil, errors.New("encrypted session can't be handed off")
+	}
+	udpConn, ok := conn.Conn.(*net.UDPConn)
+	if !ok {
+		return nil, errors.New("connection via TURN server can't be handed off")
+	}
+	return udpConn.File()
+}
+
+// takeInheritedConn returns Config.InheritedConn if it's connected to addr. It's used only once,
+// later connections are dialed as usual.
+func (c *client) takeInheritedConn(addr string) net.Conn {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	conn := c.inheritedConn
+	c.inheritedConn = nil
+	if conn == nil {
+		return nil
+	}
+	if conn.RemoteAddr().String() != addr {
+		log.Printf("Inherited connection is to %v instead of %s, closing it", conn.RemoteAddr(), addr)
+		conn.Close()
+		return nil
+	}
+	log.Printf("Using connection to %s inherited from the previous process", addr)
+	return conn
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTakeInheritedConn(t *testing.T) {
+	server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	addr := server.LocalAddr().String()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("udp4", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	conn := dial()
+	defer conn.Close()
+	c := newClient(Config{InheritedConn: conn})
+	if _, err := c.ProxyConnFile(); err == nil {
+		t.Errorf("ProxyConnFile() without connection error = nil")
+	}
+	if got := c.takeInheritedConn(addr); got != conn {
+		t.Errorf("takeInheritedConn() = %v, want inherited connection", got)
+	}
+	if got := c.takeInheritedConn(addr); got != nil {
+		t.Errorf("second takeInheritedConn() = %v, want nil", got)
+	}
+
+	other := dial()
+	c = newClient(Config{InheritedConn: other})
+	if got := c.takeInheritedConn("127.0.0.1:1"); got != nil {
+		t.Errorf("takeInheritedConn() of another server = %v, want nil", got)
+	}
+	if _, err := other.Write([]byte{0}); err == nil {
+		t.Errorf("connection to another server isn't closed")
+	}
+}
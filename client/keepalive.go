@@ -0,0 +1,60 @@
+package client
+
+import "time"
+
+// Keep alive gap is doubled after this many answered keep alives in a row.
+const keepAliveProbeSuccesses = 3
+
+// keepAliveTuner looks for the longest keep alive interval the NAT in front of the client
+// tolerates. Keep alives are only sent when the uplink is idle, so the interval is the gap
+// after which the NAT binding must still be alive. The gap grows until a keep alive sent
+// after it isn't answered, which means the binding has expired, and then it settles on the
+// last gap that worked.
+type keepAliveTuner struct {
+	max       time.Duration
+	interval  time.Duration
+	safe      time.Duration // longest interval known to work
+	successes int
+	settled   bool
+}
+
+func newKeepAliveTuner(base, max time.Duration) *keepAliveTuner {
+	if max < base {
+		max = base
+	}
+	return &keepAliveTuner{max: max, interval: base, safe: base, settled: base == max}
+}
+
+func (t *keepAliveTuner) Interval() time.Duration {
+	return t.interval
+}
+
+// answered is called when keep alive sent after the current interval was answered.
+func (t *keepAliveTuner) answered() {
+	if t.settled {
+		return
+	}
+	t.safe = t.interval
+	t.successes++
+	if t.successes < keepAliveProbeSuccesses {
+		return
+	}
+
+	t.successes = 0
+	t.interval *= 2
+	if t.interval >= t.max {
+		t.interval = t.max
+		t.settled = true
+	}
+}
+
+// missed is called when keep alive sent after the current interval wasn't answered.
+func (t *keepAliveTuner) missed() {
+	t.successes = 0
+	if t.interval == t.safe {
+		// Lost keep alive while settled, don't change anything because of a single loss.
+		return
+	}
+	t.interval = t.safe
+	t.settled = true
+}
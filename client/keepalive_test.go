@@ -0,0 +1,40 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeepAliveTuner(t *testing.T) {
+	const s = time.Second
+	tests := []struct {
+		name      string
+		base, max time.Duration
+		// Keep alive results: true if answered.
+		results []bool
+		want    time.Duration
+	}{
+		{"starts with base", 3 * s, 20 * s, nil, 3 * s},
+		{"grows", 3 * s, 20 * s, []bool{true, true, true}, 6 * s},
+		{"capped by max", 3 * s, 10 * s, []bool{true, true, true, true, true, true}, 10 * s},
+		{"single loss at base is ignored", 3 * s, 20 * s, []bool{false, true, true, true}, 6 * s},
+		{"settles after miss", 3 * s, 20 * s,
+			[]bool{true, true, true, true, true, true, false, true, true, true, true}, 6 * s},
+		{"max below base", 3 * s, s, []bool{true, true, true}, 3 * s},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tuner := newKeepAliveTuner(tt.base, tt.max)
+			for _, answered := range tt.results {
+				if answered {
+					tuner.answered()
+				} else {
+					tuner.missed()
+				}
+			}
+			if got := tuner.Interval(); got != tt.want {
+				t.Errorf("Interval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// lifecycle runs a client in background for Start, Stop and Wait, so embedders don't need to
+// manage the context and the goroutine of Run themselves.
+type lifecycle struct {
+	run func(ctx context.Context) (ExitStatus, error)
+
+	mut     sync.Mutex
+	started bool
+	stopped bool
+	cancel  context.CancelFunc
+	done    chan struct{} // closed once stopped, created on first use
+	status  ExitStatus
+	err     error
+}
+
+// doneCh returns the channel closed once the client has stopped. Must be called with mut held.
+func (l *lifecycle) doneCh() chan struct{} {
+	if l.done == nil {
+		l.done = make(chan struct{})
+	}
+	return l.done
+}
+
+func (l *lifecycle) Start() error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if l.stopped {
+		return ErrStopped
+	}
+	if l.started {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.started = true
+	l.cancel = cancel
+	done := l.doneCh()
+	go func() {
+		defer cancel()
+		status, err := l.run(ctx)
+
+		l.mut.Lock()
+		l.stopped = true
+		l.status, l.err = status, err
+		l.mut.Unlock()
+		close(done)
+	}()
+	return nil
+}
+
+func (l *lifecycle) Stop(ctx context.Context) error {
+	l.mut.Lock()
+	if !l.started {
+		// Nothing to wait for, but the client can't be started anymore.
+		if !l.stopped {
+			l.stopped = true
+			l.status = ExitStatus{Reason: ExitUserStopped}
+			close(l.doneCh())
+		}
+		l.mut.Unlock()
+		return nil
+	}
+	l.cancel()
+	done := l.done
+	l.mut.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *lifecycle) Wait() (ExitStatus, error) {
+	l.mut.Lock()
+	done := l.doneCh()
+	l.mut.Unlock()
+	<-done
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.status, l.err
+}
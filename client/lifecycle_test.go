@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"eiproxy/proxytest"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStartStop(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	_, cfg := newTestConfig(t, srv)
+	c := New(cfg)
+
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	if err := c.Start(); err != nil {
+		t.Errorf("second Start() = %v, want nil", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.ProxyAddr(ctx); err != nil {
+		t.Fatalf("ProxyAddr() = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.Stop(ctx); err != nil {
+			t.Errorf("Stop() #%d = %v, want nil", i+1, err)
+		}
+	}
+	if status, err := c.Wait(); err != nil || status.Reason != ExitUserStopped {
+		t.Errorf("Wait() = %v, %v, want %v", status, err, ExitUserStopped)
+	}
+	if err := c.Start(); !errors.Is(err, ErrStopped) {
+		t.Errorf("Start() after Stop = %v, want %v", err, ErrStopped)
+	}
+}
+
+func TestStopBeforeStart(t *testing.T) {
+	c := newClient(Config{})
+	if err := c.Stop(context.Background()); err != nil {
+		t.Errorf("Stop() = %v, want nil", err)
+	}
+	if status, _ := c.Wait(); status.Reason != ExitUserStopped {
+		t.Errorf("Wait() = %v, want %v", status, ExitUserStopped)
+	}
+	if err := c.Start(); !errors.Is(err, ErrStopped) {
+		t.Errorf("Start() = %v, want %v", err, ErrStopped)
+	}
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"log"
+	"time"
+)
+
+// handleMaintenance reports maintenance announced by the server with EventMaintenance. Repeated
+// announcements, e.g. after the session is resumed, are reported once.
+func (c *client) handleMaintenance(frame []byte) {
+	m, err := protocol.DecodeMaintenance(frame)
+	if err != nil {
+		log.Printf("Main loop: dropping malformed maintenance announcement: %v", err)
+		c.recordMalformed(len(frame))
+		return
+	}
+	if m.Start.Equal(c.maintenance.Start) && m.Duration == c.maintenance.Duration &&
+		m.Message == c.maintenance.Message {
+		return
+	}
+	c.maintenance = m
+
+	if m.Cancelled() {
+		log.Printf("Server has cancelled the maintenance")
+	} else {
+		log.Printf("Server maintenance is scheduled at %s for %v: %s",
+			m.Start.Format(time.RFC3339), m.Duration, m.Message)
+	}
+	c.events.emit(Event{Type: EventMaintenance, Message: m.Message, Maintenance: m})
+}
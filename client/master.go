@@ -8,18 +8,59 @@ import (
 	"io"
 	"log"
 	"net"
+	"net/netip"
 	"os"
 	"sync"
 	"time"
 )
 
-const (
-	proxyMasterAddr = "127.0.0.1:28004"
-)
+// DefaultLocalMasterAddr is where the master server proxy listens by default. Game is pointed
+// to it instead of the real master server.
+const DefaultLocalMasterAddr = "127.0.0.1:28004"
+
+// PickLocalMasterAddr returns addr if both its TCP and UDP ports are free. Otherwise it returns
+// address with a free port on the same IP, so the session doesn't fail because something else
+// listens on the port.
+func PickLocalMasterAddr(addr string) (string, error) {
+	if err := checkLocalPortsFree(addr); err == nil {
+		return addr, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	for attempt := 0; attempt < 10; attempt++ {
+		// Take a free TCP port and check that UDP one is free as well.
+		l, err := net.Listen("tcp4", net.JoinHostPort(host, "0"))
+		if err != nil {
+			return "", fmt.Errorf("failed to find a free port: %w", err)
+		}
+		candidate := l.Addr().String()
+		l.Close()
+		if err = checkLocalPortsFree(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find a free port on %s", host)
+}
 
-func runMasterTCPProxy(ctx context.Context, masterAddr string) error {
+func checkLocalPortsFree(addr string) error {
+	l, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	pc, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return err
+	}
+	return pc.Close()
+}
+
+func runMasterTCPProxy(ctx context.Context, listenAddr, masterAddr string) error {
 	var lc net.ListenConfig
-	conn, err := lc.Listen(ctx, "tcp4", proxyMasterAddr)
+	conn, err := lc.Listen(ctx, "tcp4", listenAddr)
 	if err != nil {
 		return fmt.Errorf("master TCP proxy: failed to listen: %w", err)
 	}
@@ -92,12 +133,16 @@ func runMasterTCPProxy(ctx context.Context, masterAddr string) error {
 
 func runMasterUDPProxy(
 	ctx context.Context,
-	masterAddr *net.UDPAddr,
-	dataToGameCh <-chan []byte,
-	dataToServerCh chan<- []byte,
+	listenAddr string,
+	gameAddr *net.UDPAddr,
+	masterAddr netip.AddrPort,
+	addrFormat protocol.AddrFormat,
+	master *peer,
+	send func(data []byte, size int) bool, // queues data to the server, false if dropped
+	capture *captureWriter,
 ) error {
 	var lc net.ListenConfig
-	pc, err := lc.ListenPacket(ctx, "udp4", proxyMasterAddr)
+	pc, err := lc.ListenPacket(ctx, "udp4", listenAddr)
 	if err != nil {
 		return fmt.Errorf("master UDP proxy: failed to listen: %w", err)
 	}
@@ -123,14 +168,18 @@ func runMasterUDPProxy(
 			select {
 			case <-ctx.Done():
 				return
-			case data, ok = <-dataToGameCh:
+			case data, ok = <-master.dataCh:
 				if !ok {
 					return
 				}
 			}
 
 			_, err = conn.WriteToUDP(data, gameAddr)
-			if err != nil {
+			if err == nil {
+				master.traffic.addReceived(len(data))
+				capture.write(master, unmapAddrPort(gameAddr.AddrPort()), true, data)
+				putPacketBuf(data)
+			} else {
 				if isCancelledOrClosed(err) {
 					return
 				}
@@ -170,12 +219,16 @@ func runMasterUDPProxy(
 				// Empty packets are currently not supported.
 				continue
 			}
+			capture.write(master, unmapAddrPort(gameAddr.AddrPort()), false, buf[:n])
 
-			data := make([]byte, 0, n+protocol.AddrSize)
-			data = protocol.EncodeAddrData(data, masterAddr, buf[:n])
-			select {
-			case dataToServerCh <- data:
-			default:
+			data, err := addrFormat.EncodeAddrData(getPacketBuf(), masterAddr, buf[:n])
+			if err != nil {
+				log.Printf("Master UDP proxy: %v", err)
+				continue
+			}
+			if send(data, n) {
+				master.traffic.addSent(n)
+			} else {
 				log.Printf("Master UDP proxy: data channel is full")
 			}
 		}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPickLocalMasterAddr(t *testing.T) {
+	// Take a port by TCP only, UDP one must be free too.
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy := l.Addr().String()
+
+	got, err := PickLocalMasterAddr(busy)
+	if err != nil {
+		t.Fatalf("PickLocalMasterAddr() error = %v", err)
+	}
+	if got == busy {
+		t.Errorf("PickLocalMasterAddr() = %s, which is busy", got)
+	}
+	if err = checkLocalPortsFree(got); err != nil {
+		t.Errorf("PickLocalMasterAddr() = %s, which isn't free: %v", got, err)
+	}
+
+	l.Close()
+	if got, err = PickLocalMasterAddr(busy); err != nil || got != busy {
+		t.Errorf("PickLocalMasterAddr() = %s, %v, want %s", got, err, busy)
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"eiproxy/common"
+	"io"
+	"net/http"
+	"time"
+)
+
+// serveMetrics serves client stats in Prometheus text format on /metrics until ctx is done.
+func serveMetrics(ctx context.Context, addr string, c Client) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, c.Stats())
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	return srv.ListenAndServe()
+}
+
+// writeMetrics writes stats snapshot in Prometheus text format.
+func writeMetrics(w io.Writer, s Stats) {
+	m := common.NewPrometheusMetrics()
+	m.Counter(metricBytesSent, "Bytes sent to the proxy server.").Add(float64(s.BytesSent))
+	m.Counter(metricBytesReceived, "Bytes received from the proxy server.").Add(float64(s.BytesReceived))
+	m.Counter(metricPacketsSent, "Packets sent to the proxy server.").Add(float64(s.PacketsSent))
+	m.Counter(metricPacketsReceived, "Packets received from the proxy server.").Add(float64(s.PacketsReceived))
+	m.Counter(metricDropped, "Packets dropped because channels were full.").Add(float64(s.Dropped))
+	m.Counter(metricCorrupted, "Packets dropped because of checksum mismatch.").Add(float64(s.Corrupted))
+	m.Counter(metricMalformed, "Frames dropped because they couldn't be decoded.").Add(float64(s.Malformed))
+	m.Gauge(metricActivePeers, "Number of connected peers.").Set(float64(s.ActivePeers))
+	m.Gauge("eiproxy_keepalive_rtt_seconds", "Last keep alive round trip time.").Set(s.KeepAliveRTT.Seconds())
+	m.Gauge("eiproxy_rtt_seconds", "Smoothed round trip time to the proxy server.").Set(s.RTT.Seconds())
+	m.Gauge("eiproxy_packet_loss_ratio", "Share of pings to the proxy server lost.").Set(s.PacketLoss)
+	m.Counter(metricReconnects, "Number of reconnects to the proxy server.").Add(float64(s.Reconnects))
+
+	for _, p := range s.Peers {
+		peer := p.Addr.String()
+		m.Counter("eiproxy_peer_bytes_sent_total", "Game payload bytes sent to the peer.",
+			"peer", peer).Add(float64(p.BytesSent))
+		m.Counter("eiproxy_peer_bytes_received_total", "Game payload bytes received from the peer.",
+			"peer", peer).Add(float64(p.BytesReceived))
+		m.Counter("eiproxy_peer_dropped_packets_total", "Packets to the peer dropped because channels were full.",
+			"peer", peer).Add(float64(p.Dropped))
+	}
+	_, _ = m.WriteTo(w)
+}
+
+const (
+	metricBytesSent       = "eiproxy_bytes_sent_total"
+	metricBytesReceived   = "eiproxy_bytes_received_total"
+	metricPacketsSent     = "eiproxy_packets_sent_total"
+	metricPacketsReceived = "eiproxy_packets_received_total"
+	metricDropped         = "eiproxy_dropped_packets_total"
+	metricCorrupted       = "eiproxy_corrupted_packets_total"
+	metricMalformed       = "eiproxy_malformed_frames_total"
+	metricActivePeers     = "eiproxy_active_peers"
+	metricReconnects      = "eiproxy_reconnects_total"
+)
+
+// clientMetrics reports client events to Config.Metrics as they happen.
+type clientMetrics struct {
+	bytesSent       common.Counter
+	bytesReceived   common.Counter
+	packetsSent     common.Counter
+	packetsReceived common.Counter
+	dropped         common.Counter
+	corrupted       common.Counter
+	malformed       common.Counter
+	reconnects      common.Counter
+	activePeers     common.Gauge
+	keepAliveRTT    common.Histogram
+}
+
+func newClientMetrics(m common.Metrics) clientMetrics {
+	if m == nil {
+		m = common.NopMetrics
+	}
+	return clientMetrics{
+		bytesSent:       m.Counter(metricBytesSent, "Bytes sent to the proxy server."),
+		bytesReceived:   m.Counter(metricBytesReceived, "Bytes received from the proxy server."),
+		packetsSent:     m.Counter(metricPacketsSent, "Packets sent to the proxy server."),
+		packetsReceived: m.Counter(metricPacketsReceived, "Packets received from the proxy server."),
+		dropped:         m.Counter(metricDropped, "Packets dropped because channels were full."),
+		corrupted:       m.Counter(metricCorrupted, "Packets dropped because of checksum mismatch."),
+		malformed:       m.Counter(metricMalformed, "Frames dropped because they couldn't be decoded."),
+		reconnects:      m.Counter(metricReconnects, "Number of reconnects to the proxy server."),
+		activePeers:     m.Gauge(metricActivePeers, "Number of connected peers."),
+		keepAliveRTT: m.Histogram("eiproxy_keepalive_rtt_seconds", "Keep alive round trip time.",
+			[]float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}),
+	}
+}
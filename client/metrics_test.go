@@ -0,0 +1,41 @@
+package client
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	s := Stats{
+		BytesSent:    100,
+		Dropped:      2,
+		Corrupted:    4,
+		ActivePeers:  1,
+		KeepAliveRTT: 50 * time.Millisecond,
+		Reconnects:   3,
+		Peers: []PeerStats{
+			{Addr: netip.MustParseAddrPort("1.2.3.4:5678"), BytesSent: 10, BytesReceived: 20},
+		},
+	}
+
+	var sb strings.Builder
+	writeMetrics(&sb, s)
+	got := sb.String()
+
+	for _, want := range []string{
+		"# TYPE eiproxy_bytes_sent_total counter\neiproxy_bytes_sent_total 100\n",
+		"eiproxy_dropped_packets_total 2\n",
+		"eiproxy_corrupted_packets_total 4\n",
+		"# TYPE eiproxy_active_peers gauge\neiproxy_active_peers 1\n",
+		"eiproxy_keepalive_rtt_seconds 0.05\n",
+		"eiproxy_reconnects_total 3\n",
+		`eiproxy_peer_bytes_sent_total{peer="1.2.3.4:5678"} 10` + "\n",
+		`eiproxy_peer_bytes_received_total{peer="1.2.3.4:5678"} 20` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("writeMetrics() output doesn't contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package client
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GameEndpoint is an additional local game server relayed by the same process.
+type GameEndpoint struct {
+	// Name of the game server in logs, the game address by default.
+	Name            string `json:",omitempty"`
+	GameAddr        HostPort
+	LocalMasterAddr HostPort
+	// Access key of the session, Config.UserKey by default. Sessions of the same key get a
+	// proxy port each if the key allows several sessions, e.g. clans may host a few lobbies
+	// with a key per lobby instead.
+	UserKey protocol.UserKey
+}
+
+// multiClient runs an independent session per game endpoint. Each session gets its own proxy
+// port from the server, see protocol.ConnectSlotParam.
+type multiClient struct {
+	lifecycle
+	sessions    []Client
+	names       []string // name of each session for logs
+	metricsAddr string
+	endpoints   []GameEndpoint
+}
+
+func newMultiClient(cfg Config) Client {
+	first := GameEndpoint{GameAddr: cfg.GameAddr, LocalMasterAddr: cfg.LocalMasterAddr, UserKey: cfg.UserKey}
+	endpoints := append([]GameEndpoint{first}, cfg.Games...)
+
+	m := &multiClient{metricsAddr: cfg.MetricsAddr, endpoints: endpoints}
+	// Limits are for the whole traffic of the client.
+	limiter := newRateLimiter(cfg.RateLimit)
+	slots := make(map[protocol.UserKey]int)
+	for i, e := range endpoints {
+		sessionCfg := cfg
+		sessionCfg.Games = nil
+		sessionCfg.GameAddr = e.GameAddr
+		sessionCfg.LocalMasterAddr = e.LocalMasterAddr
+		if !e.UserKey.IsZero() {
+			sessionCfg.UserKey = e.UserKey
+		}
+		// Metrics are served for all sessions together.
+		sessionCfg.MetricsAddr = ""
+		sessionCfg.StateFile = slotPath(cfg.StateFile, i)
+		sessionCfg.PeerMapFile = slotPath(cfg.PeerMapFile, i)
+		sessionCfg.CaptureFile = slotPath(cfg.CaptureFile, i)
+		sessionCfg.DeadlineAuditFile = slotPath(cfg.DeadlineAuditFile, i)
+		// Only the first session could use it, but it isn't handed off by multiple sessions.
+		sessionCfg.InheritedConn = nil
+
+		c := newClient(sessionCfg)
+		c.slot = slots[sessionCfg.UserKey]
+		slots[sessionCfg.UserKey]++
+		c.rateLimiter = limiter
+		m.sessions = append(m.sessions, c)
+
+		name := e.Name
+		if name == "" {
+			name = e.GameAddr.String()
+		}
+		if name == "" {
+			name = defaultGameAddr
+		}
+		m.names = append(m.names, name)
+	}
+	m.lifecycle.run = m.Run
+	return m
+}
+
+// slotPath returns path of per session file, e.g. "state.1.json" for the second session.
+func slotPath(path string, i int) string {
+	if path == "" || i == 0 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(path, ext), i, ext)
+}
+
+func (m *multiClient) Run(ctx context.Context) (ExitStatus, error) {
+	if err := validateEndpoints(m.endpoints); err != nil {
+		return exitStatusFromError(err), err
+	}
+
+	for i, c := range m.sessions {
+		i, c := i, c
+		unsubscribe := c.Subscribe(func(e Event) {
+			switch e.Type {
+			case EventStateChanged:
+				if e.State == StateConnected {
+					log.Printf("Game server %s is available at %v", m.names[i], c.GetProxyAddr(0))
+				}
+			case EventPeerConnected, EventPeerDisconnected:
+			default:
+				return
+			}
+			m.logStatus()
+		})
+		defer unsubscribe()
+	}
+
+	if m.metricsAddr != "" {
+		go func() {
+			err := serveMetrics(ctx, m.metricsAddr, m)
+			log.Printf("Metrics server stopped: %v", err)
+		}()
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(m.sessions))
+	for i, c := range m.sessions {
+		wg.Add(1)
+		go func(i int, c Client) {
+			defer wg.Done()
+			if _, err := c.Run(ctx); err != nil {
+				errs[i] = fmt.Errorf("game server %s: %w", m.names[i], err)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	return exitStatusFromError(err), err
+}
+
+// logStatus logs state of all sessions, so the operator sees every game server at once.
+func (m *multiClient) logStatus() {
+	parts := make([]string, len(m.sessions))
+	for i, c := range m.sessions {
+		state := c.State()
+		parts[i] = fmt.Sprintf("%s: %v", m.names[i], state)
+		if state == StateConnected {
+			parts[i] += fmt.Sprintf(" at %v (%d players)", c.GetProxyAddr(0), c.Stats().ActivePeers)
+		}
+	}
+	log.Printf("Game servers: %s", strings.Join(parts, "; "))
+}
+
+// validateEndpoints checks that every game instance is pointed to its own master server proxy.
+func validateEndpoints(endpoints []GameEndpoint) error {
+	seen := make(map[string]bool)
+	for _, e := range endpoints {
+		addr := e.LocalMasterAddr.String()
+		if addr == "" {
+			addr = DefaultLocalMasterAddr
+		}
+		if seen[addr] {
+			return fmt.Errorf("several game servers use local master address %s, set LocalMasterAddr", addr)
+		}
+		seen[addr] = true
+	}
+	return nil
+}
+
+// ProxyAddr returns proxy address of the first game server.
+func (m *multiClient) ProxyAddr(ctx context.Context) (netip.AddrPort, error) {
+	return m.sessions[0].ProxyAddr(ctx)
+}
+
+// GetProxyAddr returns proxy address of the first game server.
+func (m *multiClient) GetProxyAddr(timeout time.Duration) netip.AddrPort {
+	return m.sessions[0].GetProxyAddr(timeout)
+}
+
+func (m *multiClient) GetUser(ctx context.Context) (protocol.UserResponse, error) {
+	return m.sessions[0].GetUser(ctx)
+}
+
+// Subscribe registers handler for events of all sessions.
+func (m *multiClient) Subscribe(handler EventHandler) func() {
+	var mut sync.Mutex
+	unsubscribes := make([]func(), len(m.sessions))
+	for i, c := range m.sessions {
+		// Sessions emit events from their own goroutines, but handlers expect sequential calls.
+		unsubscribes[i] = c.Subscribe(func(e Event) {
+			mut.Lock()
+			defer mut.Unlock()
+			handler(e)
+		})
+	}
+	return func() {
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+	}
+}
+
+// State returns Connected once all sessions are connected, otherwise the state of the first
+// session which isn't.
+func (m *multiClient) State() State {
+	for _, c := range m.sessions {
+		if s := c.State(); s != StateConnected {
+			return s
+		}
+	}
+	return StateConnected
+}
+
+// Stats returns traffic counters summed over all sessions.
+func (m *multiClient) Stats() Stats {
+	var total Stats
+	for _, c := range m.sessions {
+		s := c.Stats()
+		total.BytesSent += s.BytesSent
+		total.BytesReceived += s.BytesReceived
+		total.PacketsSent += s.PacketsSent
+		total.PacketsReceived += s.PacketsReceived
+		total.Dropped += s.Dropped
+		total.DroppedToServer += s.DroppedToServer
+		total.DroppedFromServer += s.DroppedFromServer
+		total.Corrupted += s.Corrupted
+		total.Malformed += s.Malformed
+		total.Reconnects += s.Reconnects
+		total.UploadRate += s.UploadRate
+		total.DownloadRate += s.DownloadRate
+		total.RateLimited += s.RateLimited
+		// Report the worst one.
+		if s.KeepAliveRTT > total.KeepAliveRTT {
+			total.KeepAliveRTT = s.KeepAliveRTT
+		}
+		if s.RTT > total.RTT {
+			total.RTT = s.RTT
+		}
+		if s.PacketLoss > total.PacketLoss {
+			total.PacketLoss = s.PacketLoss
+		}
+		total.Peers = append(total.Peers, s.Peers...)
+	}
+	sortPeerStats(total.Peers)
+	total.ActivePeers = len(total.Peers)
+	return total
+}
+
+func (m *multiClient) Peers() []PeerStats {
+	return m.Stats().Peers
+}
+
+func (m *multiClient) DropLog() []DropRecord {
+	var records []DropRecord
+	for _, c := range m.sessions {
+		records = append(records, c.DropLog()...)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+type stubClient struct {
+	Client
+	stats Stats
+	drops []DropRecord
+}
+
+func (c stubClient) Stats() Stats          { return c.stats }
+func (c stubClient) DropLog() []DropRecord { return c.drops }
+
+func TestMultiClient_Stats(t *testing.T) {
+	now := time.Now()
+	m := &multiClient{sessions: []Client{
+		stubClient{
+			stats: Stats{BytesSent: 10, KeepAliveRTT: time.Millisecond,
+				Peers: []PeerStats{{Addr: netip.MustParseAddrPort("5.5.5.5:1")}}},
+			drops: []DropRecord{{Time: now.Add(time.Second)}},
+		},
+		stubClient{
+			stats: Stats{BytesSent: 5, Reconnects: 1, KeepAliveRTT: 3 * time.Millisecond,
+				Peers: []PeerStats{{Addr: netip.MustParseAddrPort("1.1.1.1:1")}}},
+			drops: []DropRecord{{Time: now}},
+		},
+	}}
+
+	s := m.Stats()
+	if s.BytesSent != 15 || s.Reconnects != 1 || s.KeepAliveRTT != 3*time.Millisecond || s.ActivePeers != 2 {
+		t.Errorf("Stats() = %+v", s)
+	}
+	if s.Peers[0].Addr.Addr() != netip.MustParseAddr("1.1.1.1") {
+		t.Errorf("Stats().Peers aren't sorted: %v", s.Peers)
+	}
+	if drops := m.DropLog(); len(drops) != 2 || !drops[0].Time.Equal(now) {
+		t.Errorf("DropLog() = %v, want sorted by time", drops)
+	}
+}
+
+func TestNewMultiClient(t *testing.T) {
+	key1, key2 := protocol.UserKey{1}, protocol.UserKey{2}
+	cfg := Config{
+		UserKey:   key1,
+		StateFile: "state.json",
+		Games: []GameEndpoint{
+			{Name: "lobby2", LocalMasterAddr: MustParseHostPort("127.0.0.1:28005")},
+			{UserKey: key2, GameAddr: MustParseHostPort("192.168.1.13:8888"),
+				LocalMasterAddr: MustParseHostPort("127.0.0.1:28006")},
+		},
+	}
+	m := newMultiClient(cfg).(*multiClient)
+
+	tests := []struct {
+		key       protocol.UserKey
+		slot      int
+		stateFile string
+		name      string
+	}{
+		{key1, 0, "state.json", defaultGameAddr},
+		{key1, 1, "state.1.json", "lobby2"},
+		{key2, 0, "state.2.json", "192.168.1.13:8888"},
+	}
+	for i, tt := range tests {
+		c := m.sessions[i].(*client)
+		if c.cfg.UserKey != tt.key || c.slot != tt.slot || c.cfg.StateFile != tt.stateFile {
+			t.Errorf("session %d: key %v, slot %d, state file %q, want %v, %d, %q",
+				i, c.cfg.UserKey, c.slot, c.cfg.StateFile, tt.key, tt.slot, tt.stateFile)
+		}
+		if m.names[i] != tt.name {
+			t.Errorf("session %d: name %q, want %q", i, m.names[i], tt.name)
+		}
+	}
+}
+
+func TestSlotPath(t *testing.T) {
+	tests := []struct {
+		path string
+		slot int
+		want string
+	}{
+		{"", 1, ""},
+		{"state.json", 0, "state.json"},
+		{"state.json", 2, "state.2.json"},
+		{"dir/capture", 1, "dir/capture.1"},
+	}
+	for _, tt := range tests {
+		if got := slotPath(tt.path, tt.slot); got != tt.want {
+			t.Errorf("slotPath(%q, %d) = %q, want %q", tt.path, tt.slot, got, tt.want)
+		}
+	}
+}
+
+func TestValidateEndpoints(t *testing.T) {
+	ok := []GameEndpoint{{}, {LocalMasterAddr: MustParseHostPort("127.0.0.1:28005")}}
+	if err := validateEndpoints(ok); err != nil {
+		t.Errorf("validateEndpoints() error = %v", err)
+	}
+	clash := []GameEndpoint{{}, {LocalMasterAddr: MustParseHostPort(DefaultLocalMasterAddr)}}
+	if err := validateEndpoints(clash); err == nil {
+		t.Error("validateEndpoints() didn't detect the same local master address")
+	}
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"context"
+	"eiproxy/common"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NameResolver maps peer IPs to friendly names shown to the user instead of raw addresses.
+// It returns empty name if the peer is unknown.
+type NameResolver interface {
+	ResolveName(ctx context.Context, ip netip.Addr) (string, error)
+}
+
+// RosterResolver resolves names from a local roster, which is a JSON object mapping IPs
+// to names, e.g. {"203.0.113.5": "Vasya"}.
+type RosterResolver map[netip.Addr]string
+
+func LoadRoster(path string) (RosterResolver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read roster: %w", err)
+	}
+
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse roster: %w", err)
+	}
+
+	roster := make(RosterResolver, len(raw))
+	for ipStr, name := range raw {
+		ip, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse roster: %w", err)
+		}
+		roster[ip.Unmap()] = name
+	}
+	return roster, nil
+}
+
+func (r RosterResolver) ResolveName(ctx context.Context, ip netip.Addr) (string, error) {
+	return r[ip.Unmap()], nil
+}
+
+// APIResolver resolves names using a community API. It makes GET request to URL with "ip"
+// query parameter and expects protocol.PeerNameResponse.
+type APIResolver struct {
+	URL string
+}
+
+func (r APIResolver) ResolveName(ctx context.Context, ip netip.Addr) (string, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse name api url: %w", err)
+	}
+	q := u.Query()
+	q.Set("ip", ip.Unmap().String())
+	u.RawQuery = q.Encode()
+
+	var response struct {
+		Name string `json:"name"`
+	}
+	err = common.MakeApiRequestWithContext(ctx, http.MethodGet, u.String(), "", nil, &response)
+	if err != nil {
+		return "", err
+	}
+	return response.Name, nil
+}
+
+// ReverseDNSResolver uses PTR records as peer names.
+type ReverseDNSResolver struct{}
+
+func (ReverseDNSResolver) ResolveName(ctx context.Context, ip netip.Addr) (string, error) {
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip.Unmap().String())
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return strings.TrimSuffix(names[0], "."), nil
+}
+
+// ChainResolver asks resolvers in order and returns the first found name.
+type ChainResolver []NameResolver
+
+func (r ChainResolver) ResolveName(ctx context.Context, ip netip.Addr) (string, error) {
+	var firstErr error
+	for _, resolver := range r {
+		name, err := resolver.ResolveName(ctx, ip)
+		if err == nil && name != "" {
+			return name, nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", firstErr
+}
+
+// nameCache remembers resolved names, so each peer IP is resolved only once per client.
+// Lookups run without the lock, so a slow resolver delays only callers asking for the same IP.
+type nameCache struct {
+	mut      sync.Mutex
+	resolver NameResolver
+	names    map[netip.Addr]string
+	inFlight map[netip.Addr]*nameLookup
+}
+
+// nameLookup is a lookup in progress, shared by all callers asking for the same IP.
+type nameLookup struct {
+	done chan struct{}
+	name string
+}
+
+// setResolver replaces the resolver, forgetting names resolved by the old one.
+func (c *nameCache) setResolver(resolver NameResolver) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.resolver = resolver
+	c.names = nil
+	// Lookups of the old resolver finish for their callers, but aren't cached.
+	c.inFlight = nil
+}
+
+func (c *nameCache) resolve(ip netip.Addr) string {
+	c.mut.Lock()
+	if c.resolver == nil {
+		c.mut.Unlock()
+		return ""
+	}
+	if name, ok := c.names[ip]; ok {
+		c.mut.Unlock()
+		return name
+	}
+	if l, ok := c.inFlight[ip]; ok {
+		c.mut.Unlock()
+		<-l.done
+		return l.name
+	}
+	l := &nameLookup{done: make(chan struct{})}
+	if c.inFlight == nil {
+		c.inFlight = make(map[netip.Addr]*nameLookup)
+	}
+	c.inFlight[ip] = l
+	resolver := c.resolver
+	c.mut.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	name, err := resolver.ResolveName(ctx, ip)
+
+	c.mut.Lock()
+	if c.inFlight[ip] == l {
+		delete(c.inFlight, ip)
+		// Don't cache errors, they might be temporary.
+		if err == nil {
+			if c.names == nil {
+				c.names = make(map[netip.Addr]string)
+			}
+			c.names[ip] = name
+		}
+	}
+	c.mut.Unlock()
+
+	if err == nil {
+		l.name = name
+	}
+	close(l.done)
+	return l.name
+}
+
+func newNameResolver(cfg Config) NameResolver {
+	var chain ChainResolver
+	if cfg.NameResolver != nil {
+		chain = append(chain, cfg.NameResolver)
+	}
+	if cfg.RosterPath != "" {
+		roster, err := LoadRoster(cfg.RosterPath)
+		if err != nil {
+			log.Printf("Failed to load roster: %v", err)
+		} else {
+			chain = append(chain, roster)
+		}
+	}
+	if cfg.NameAPIURL != "" {
+		chain = append(chain, APIResolver{URL: cfg.NameAPIURL})
+	}
+	if cfg.ReverseDNS {
+		chain = append(chain, ReverseDNSResolver{})
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain
+}
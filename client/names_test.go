@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type failingResolver struct{}
+
+func (failingResolver) ResolveName(ctx context.Context, ip netip.Addr) (string, error) {
+	return "", errors.New("failed")
+}
+
+func TestRosterResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roster.json")
+	err := os.WriteFile(path, []byte(`{"203.0.113.5": "Vasya", "2001:db8::1": "Petya"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roster, err := LoadRoster(path)
+	if err != nil {
+		t.Fatalf("LoadRoster() error = %v", err)
+	}
+
+	resolver := ChainResolver{failingResolver{}, roster}
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.5", "Vasya"},
+		{"::ffff:203.0.113.5", "Vasya"},
+		{"2001:db8::1", "Petya"},
+		{"203.0.113.6", ""},
+	}
+	for _, tt := range tests {
+		name, _ := resolver.ResolveName(context.Background(), netip.MustParseAddr(tt.ip))
+		if name != tt.want {
+			t.Errorf("ResolveName(%v) = %q, want %q", tt.ip, name, tt.want)
+		}
+	}
+}
+
+func TestLoadRosterInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roster.json")
+	if err := os.WriteFile(path, []byte(`{"not an ip": "Vasya"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRoster(path); err == nil {
+		t.Errorf("LoadRoster() error = nil, want error")
+	}
+}
+
+// blockingResolver blocks lookups of slow IP until release is closed.
+type blockingResolver struct {
+	slow    netip.Addr
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (r *blockingResolver) ResolveName(ctx context.Context, ip netip.Addr) (string, error) {
+	r.calls.Add(1)
+	if ip == r.slow {
+		<-r.release
+		return "slow", nil
+	}
+	return "fast", nil
+}
+
+func TestNameCacheConcurrent(t *testing.T) {
+	slow := netip.MustParseAddr("203.0.113.5")
+	resolver := &blockingResolver{slow: slow, release: make(chan struct{})}
+	var cache nameCache
+	cache.setResolver(resolver)
+
+	names := make(chan string, 2)
+	for i := 0; i < 2; i++ {
+		go func() { names <- cache.resolve(slow) }()
+	}
+
+	// Other IPs are resolved while the slow lookup is in progress.
+	for resolver.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan string)
+	go func() { done <- cache.resolve(netip.MustParseAddr("203.0.113.6")) }()
+	select {
+	case name := <-done:
+		if name != "fast" {
+			t.Errorf("resolve() = %q, want %q", name, "fast")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("resolve() is blocked by the lookup of another IP")
+	}
+
+	close(resolver.release)
+	for i := 0; i < 2; i++ {
+		if name := <-names; name != "slow" {
+			t.Errorf("resolve() = %q, want %q", name, "slow")
+		}
+	}
+	if name := cache.resolve(slow); name != "slow" {
+		t.Errorf("cached resolve() = %q, want %q", name, "slow")
+	}
+	// Both callers of the slow IP have shared one lookup.
+	if got := resolver.calls.Load(); got != 2 {
+		t.Errorf("resolver is called %d times, want 2", got)
+	}
+}
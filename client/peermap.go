@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/netip"
+	"os"
+	"time"
+)
+
+// Remote IP keeps its virtual IP in Config.PeerMapFile this long since it was last seen.
+const peerMapTTL = 30 * 24 * time.Hour
+
+// peerMapEntry is persisted to Config.PeerMapFile, so the same remote IP is seen by the game at
+// the same virtual IP after restarts and the in-game address book stays valid.
+type peerMapEntry struct {
+	Remote   netip.Addr
+	Local    netip.Addr
+	LastSeen time.Time
+}
+
+// loadPeerMap restores mapping of remote IPs to virtual IPs within the current range.
+func (c *client) loadPeerMap() {
+	if c.cfg.PeerMapFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(c.cfg.PeerMapFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to read peer map: %v", err)
+		}
+		return
+	}
+	var entries []peerMapEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		log.Printf("Failed to parse peer map: %v", err)
+		return
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	restored := 0
+	for _, e := range entries {
+		if !e.Local.Is4() || time.Since(e.LastSeen) > peerMapTTL {
+			continue
+		}
+		if _, ok := c.remoteIPToLocalIP[e.Remote]; ok {
+			continue
+		}
+		// Range might have changed since the map was saved.
+		localIP := e.Local.As4()
+		if !c.virtualIPs.take(localIP) {
+			continue
+		}
+		c.remoteIPToLocalIP[e.Remote] = localIP
+		c.peerLastSeen[e.Remote] = e.LastSeen
+		restored++
+	}
+	log.Printf("Restored virtual IPs of %d remote IPs", restored)
+}
+
+// markPeerSeen records that remote IP has been seen and schedules saving of the peer map. It
+// must be called with c.mut locked.
+func (c *client) markPeerSeen(ip netip.Addr) {
+	if c.cfg.PeerMapFile == "" {
+		return
+	}
+	c.peerLastSeen[ip] = time.Now()
+	select {
+	case c.peerMapDirty <- struct{}{}:
+	default:
+	}
+}
+
+// runPeerMapSaver saves the peer map when it changes until ctx is done.
+func (c *client) runPeerMapSaver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			select {
+			case <-c.peerMapDirty:
+				c.savePeerMap()
+			default:
+			}
+			return
+		case <-c.peerMapDirty:
+			c.savePeerMap()
+		}
+	}
+}
+
+func (c *client) savePeerMap() {
+	c.mut.Lock()
+	entries := make([]peerMapEntry, 0, len(c.remoteIPToLocalIP))
+	for remote, local := range c.remoteIPToLocalIP {
+		if lastSeen, ok := c.peerLastSeen[remote]; ok {
+			entries = append(entries, peerMapEntry{Remote: remote, Local: netip.AddrFrom4(local), LastSeen: lastSeen})
+		}
+	}
+	c.mut.Unlock()
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		log.Printf("Failed to marshal peer map: %v", err)
+		return
+	}
+	tmpPath := c.cfg.PeerMapFile + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+		err = os.Rename(tmpPath, c.cfg.PeerMapFile)
+	}
+	if err != nil {
+		log.Printf("Failed to save peer map: %v", err)
+	}
+}
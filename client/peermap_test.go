@@ -0,0 +1,52 @@
+package client
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPeerMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	newTestClient := func(cidr string) *client {
+		c := newClient(Config{PeerMapFile: path})
+		var err error
+		if c.virtualIPs, err = newVirtualIPRange(cidr, nil); err != nil {
+			t.Fatal(err)
+		}
+		c.loadPeerMap()
+		return c
+	}
+	remote1, remote2 := netip.MustParseAddr("1.2.3.4"), netip.MustParseAddr("2001:db8::1")
+	stale := netip.MustParseAddr("5.6.7.8")
+
+	c := newTestClient("127.9.0.0/24")
+	for _, ip := range []netip.Addr{remote1, remote2, stale} {
+		c.remoteIPToLocalIP[ip] = c.virtualIPs.allocate()
+		c.markPeerSeen(ip)
+	}
+	c.peerLastSeen[stale] = time.Now().Add(-peerMapTTL - time.Hour)
+	c.savePeerMap()
+
+	c = newTestClient("127.9.0.0/24")
+	want := map[netip.Addr]string{remote1: "127.9.0.1", remote2: "127.9.0.2"}
+	if len(c.remoteIPToLocalIP) != len(want) {
+		t.Errorf("restored %d remote IPs, want %d", len(c.remoteIPToLocalIP), len(want))
+	}
+	for remote, local := range want {
+		if got := netip.AddrFrom4(c.remoteIPToLocalIP[remote]).String(); got != local {
+			t.Errorf("virtual IP of %v = %s, want %s", remote, got, local)
+		}
+	}
+	// Restored addresses aren't handed out to new remote IPs.
+	if got := netip.AddrFrom4(c.virtualIPs.allocate()).String(); got != "127.9.0.3" {
+		t.Errorf("allocate() = %s, want 127.9.0.3", got)
+	}
+
+	// Addresses out of the current range are dropped.
+	c = newTestClient("127.10.0.0/24")
+	if len(c.remoteIPToLocalIP) != 0 {
+		t.Errorf("restored %d remote IPs after range change, want 0", len(c.remoteIPToLocalIP))
+	}
+}
@@ -3,11 +3,11 @@ package client
 import (
 	"context"
 	"eiproxy/protocol"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/netip"
 	"os"
 	"strings"
 	"sync"
@@ -16,7 +16,7 @@ import (
 
 const dataChanSize = 1000
 
-var gameAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8888}
+const defaultGameAddr = "127.0.0.1:8888"
 
 type ipv4 [net.IPv4len]byte
 
@@ -24,57 +24,84 @@ func (ip ipv4) ToIP() net.IP {
 	return net.IPv4(ip[0], ip[1], ip[2], ip[3])
 }
 
-func (ip ipv4) Next() ipv4 {
-	ipnum := binary.BigEndian.Uint32(ip[:])
-	ipnum++
-	binary.BigEndian.PutUint32(ip[:], ipnum)
-	return ip
-}
+// dialProxy connects to the proxy server and authenticates the connection with handshake,
+// falling back to TURN server if the proxy server is unreachable.
+func (c *client) dialProxy(ctx context.Context, addr string, handshake func(*proxyConn) error) (*proxyConn, error) {
+	netConn := c.takeInheritedConn(addr)
+	if netConn == nil {
+		var d net.Dialer
+		var err error
+		netConn, err = d.DialContext(ctx, "udp4", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dial: %w", err)
+		}
+	}
+	conn := &proxyConn{Conn: netConn, codecs: c.codecs, traffic: &c.traffic, metrics: &c.metrics, audit: c.audit,
+		handshakeTimeout: c.cfg.Timeouts.handshake()}
 
-type addrPortV4 struct {
-	ip   ipv4
-	port uint16
-}
+	err := handshake(conn)
+	if err != nil && c.cfg.TURN != nil && !errors.Is(err, errSessionResumeFailed) {
+		log.Printf("Proxy server is unreachable (%v), falling back to TURN server %s", err, c.cfg.TURN.Addr)
+		conn.Close()
 
-func (ap addrPortV4) ToUDPAddr() *net.UDPAddr {
-	return &net.UDPAddr{
-		IP:   ap.ip.ToIP(),
-		Port: int(ap.port),
+		serverAddr := netConn.RemoteAddr().(*net.UDPAddr).AddrPort()
+		conn.Conn, err = dialTURN(*c.cfg.TURN, unmapAddrPort(serverAddr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect via TURN: %w", err)
+		}
+		err = handshake(conn)
 	}
-}
-
-func (c *client) runProxyClient(ctx context.Context, addr string) error {
-	var d net.Dialer
-	netConn, err := d.DialContext(ctx, "udp4", addr)
 	if err != nil {
-		return fmt.Errorf("failed to dial: %w", err)
+		conn.Close()
+		return nil, err
 	}
-	defer netConn.Close()
-	conn := netConn.(*net.UDPConn)
+	conn.io = newBatchIO(conn.Conn)
+	return conn, nil
+}
 
+func (c *client) runProxyClient(ctx context.Context, addr string) error {
 	log.Printf("Sending token to %#v", addr)
-	err = sendToken(conn, c.token)
+	conn, err := c.dialProxy(ctx, addr, func(conn *proxyConn) error { return sendToken(conn, c.tokenRequest()) })
 	if err != nil {
+		if c.resumed {
+			return fmt.Errorf("%w: %w", errSessionResumeFailed, err)
+		}
 		return fmt.Errorf("failed to send token: %w", err)
 	}
+	defer func() { conn.Close() }()
+	defer func() {
+		c.mut.Lock()
+		c.proxyConn = nil
+		c.mut.Unlock()
+	}()
 	log.Printf("Token has been sent")
+	c.setState(StateConnected, nil)
 
 	var wg sync.WaitGroup
 	defer wg.Wait() // wait after context is cancelled and dataToServerCh is closed
 
 	// Prepare a channel for master UDP proxy.
-	masterAddrPortV4 := addrPortV4{
-		ip:   ipv4(c.masterAddr.IP.To4()[:net.IPv4len]),
-		port: uint16(c.masterAddr.Port),
-	}
-	masterDataCh := make(chan []byte, dataChanSize)
-	masterDone := make(chan error)
-	c.remoteAddrToDataCh[masterAddrPortV4] = masterDataCh
-	c.nextLocalIP = ipv4{127, 0, 0, 2}
-
-	// We don't use run() approach as below, because we don't want to cancel childCtx.
+	master := newPeer(unmapAddrPort(c.masterAddr.AddrPort()), netip.Addr{})
+	master.isMaster = true
+	masterDone := make(chan error, 1)
+	c.peers[master.addr] = master
+	// Frames of the master server are still valid after a reconnect, so they are only released
+	// when the session ends.
+	defer c.upstream.remove(master)
+
+	// We don't use run() approach as below, because we don't want to cancel childCtx. The next
+	// attempt resolves the addresses again, so the master proxy must be gone once this one returns.
+	masterCtx, cancelMaster := context.WithCancel(ctx)
+	masterStopped := make(chan struct{})
+	defer func() {
+		cancelMaster()
+		<-masterStopped
+	}()
 	go func() {
-		err := runMasterUDPProxy(ctx, c.masterAddr, masterDataCh, c.dataToServerCh)
+		defer close(masterStopped)
+		send := func(data []byte, size int) bool { return c.sendToServer(master, data, size) }
+		err := runMasterUDPProxy(masterCtx, c.localMasterAddr, c.gameAddr, master.addr, c.addrFormat,
+			master, send, c.capture)
 		log.Printf("Master UDP proxy failed: %v", err)
 		masterDone <- err
 	}()
@@ -82,52 +109,107 @@ func (c *client) runProxyClient(ctx context.Context, addr string) error {
 	// Prepare a context for proxy reader/writer.
 	// If it's cancelled, it means that something went wrong with the connection.
 	// In such case we don't try to make a graceful shutdown.
-	childCtx, cancel := context.WithCancelCause(context.Background())
-	defer cancel(nil)
+	var childCtx context.Context
+	var cancel context.CancelCauseFunc
+	defer func() { cancel(nil) }()
 
-	go func() {
-		<-childCtx.Done()
-		conn.Close()
-	}()
+	start := func(conn *proxyConn) {
+		childCtx, cancel = context.WithCancelCause(context.Background())
+		ctx, cancel := childCtx, cancel
+		c.mut.Lock()
+		c.proxyConn = conn
+		c.mut.Unlock()
 
-	run := func(f func(ctx context.Context, conn *net.UDPConn) error, prefix string) {
-		wg.Add(1)
 		go func() {
-			defer wg.Done()
+			<-ctx.Done()
+			conn.Close()
+		}()
 
-			var err error
-			defer func() { cancel(err) }()
+		run := func(f func(ctx context.Context, conn *proxyConn) error, prefix string) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
 
-			err = f(childCtx, conn)
-			log.Printf("%s: stopped: %v", prefix, err)
+				var err error
+				defer func() { cancel(err) }()
 
-			err = ignoreCancelledOrClosed(err)
-			if err != nil {
-				err = fmt.Errorf("%s: %v", strings.ToLower(prefix), err)
-			}
-		}()
-	}
+				err = f(ctx, conn)
+				log.Printf("%s: stopped: %v", prefix, err)
+
+				err = ignoreCancelledOrClosed(err)
+				if err != nil {
+					err = fmt.Errorf("%s: %w", strings.ToLower(prefix), err)
+				}
+			}()
+		}
+
+		run(c.proxyMainLoopReader, "Main loop reader")
+		run(c.proxyMainLoopWriter, "Main loop writer")
 
-	run(c.proxyMainLoopReader, "Main loop reader")
-	run(c.proxyMainLoopWriter, "Main loop writer")
+		if c.keepsSession() {
+			go c.keepSessionSaved(ctx)
+		}
+		c.quality.reset()
+		// Pongs could be mistaken for data frames of the old address format.
+		if c.session.HasCapability(protocol.CapabilityPing) && c.addrFormat == protocol.AddrFormatV2 {
+			go c.runPinger(ctx)
+		}
+		if c.signedTokenEnabled() {
+			go c.runTokenRefresher(ctx)
+		}
+	}
+	start(conn)
 
 	var resultErr error
-	select {
-	case <-ctx.Done():
-		// Graceful shutdown.
-
-	case <-childCtx.Done():
-		// They can't decide to stop by themselves, so something happend.
-		err := context.Cause(childCtx)
-		log.Printf("Client failed: %v", err)
-		return err
-
-	case err := <-masterDone:
-		// Master proxy failed. Remember the error and continue gracefull shutdown.
-		resultErr = err
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			// Graceful shutdown.
+			if c.keepsSession() {
+				// Keep the session on the server, so it can be resumed after restart.
+				log.Printf("Context done, leaving session for resumption")
+				c.setState(StateStopping, nil)
+				c.saveSession(c.currentSession())
+				return nil
+			}
+			break loop
+
+		case <-childCtx.Done():
+			// They can't decide to stop by themselves, so something happend.
+			err := context.Cause(childCtx)
+			log.Printf("Client failed: %v", err)
+			if !c.session.HasCapability(protocol.CapabilityResume) ||
+				errors.Is(err, errServerDisconnected) || ctx.Err() != nil {
+				return err
+			}
+
+			// Reconnect with the same token, so the proxy address stays the same.
+			wg.Wait()
+			c.traffic.reconnects.Add(1)
+			c.metrics.reconnects.Add(1)
+			c.setState(StateReconnecting, err)
+			// Keep the old connection for the deferred Close if resumption fails.
+			resumed, err := c.resumeProxy(ctx, addr)
+			if err != nil {
+				return err
+			}
+			conn = resumed
+			c.mut.Lock()
+			c.peers[master.addr] = master
+			c.mut.Unlock()
+			c.setState(StateConnected, nil)
+			start(conn)
+
+		case err := <-masterDone:
+			// Master proxy failed. Remember the error and continue gracefull shutdown.
+			resultErr = err
+			break loop
+		}
 	}
 
 	log.Printf("Context done, disconnecting")
+	c.setState(StateStopping, nil)
 	for retry := 0; retry < 10; retry++ {
 		c.dataToServerCh <- []byte{byte(protocol.ProxyClientRequestTypeDisconnect)}
 
@@ -143,38 +225,100 @@ func (c *client) runProxyClient(ctx context.Context, addr string) error {
 	return fmt.Errorf("failed to disconnect")
 }
 
-func sendToken(conn *net.UDPConn, token protocol.Token) error {
-	err := conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+// resumeProxy reconnects to the proxy server with the current session token after connection
+// was lost. It keeps trying during the grace period the server keeps the session for.
+func (c *client) resumeProxy(ctx context.Context, addr string) (*proxyConn, error) {
+	deadline := time.Now().Add(c.session.ResumeGracePeriod())
+	for {
+		log.Printf("Resuming session")
+		conn, err := c.dialProxy(ctx, addr, func(conn *proxyConn) error { return sendResume(conn, c.resumeRequest()) })
+		if err == nil {
+			log.Printf("Session has been resumed")
+			return conn, nil
+		}
+		if errors.Is(err, errSessionResumeFailed) || time.Now().After(deadline) {
+			return nil, err
+		}
+		log.Printf("Failed to resume session: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func sendToken(conn *proxyConn, request []byte) error {
+	return handshake(conn, "token", request, func(resp protocol.ProxyServerResponseType) (bool, error) {
+		return resp == protocol.ProxyServerResponseTypeKeepAlive, nil
+	})
+}
+
+func sendResume(conn *proxyConn, request []byte) error {
+	return handshake(conn, "resume", request, func(resp protocol.ProxyServerResponseType) (bool, error) {
+		switch resp {
+		case protocol.ProxyServerResponseTypeResumed:
+			return true, nil
+		case protocol.ProxyServerResponseTypeSessionExpired:
+			return true, errSessionResumeFailed
+		}
+		return false, nil
+	})
+}
+
+// handshake sends request until server replies with a response accepted by handle or the
+// handshake timeout of conn expires.
+func handshake(
+	conn *proxyConn,
+	name string,
+	request []byte,
+	handle func(resp protocol.ProxyServerResponseType) (done bool, err error),
+) error {
+	const readTimeout = 100 * time.Millisecond
+	writeTimeout := conn.handshakeTimeout
+	if writeTimeout == 0 {
+		writeTimeout = defaultHandshakeTimeout
+	}
+	err := conn.SetWriteDeadline(time.Now().Add(writeTimeout))
 	if err != nil {
-		return fmt.Errorf("token: failed to set deadline: %w", err)
+		return fmt.Errorf("%s: failed to set deadline: %w", name, err)
 	}
+	conn.audit.set(auditHandshakeWrite, writeTimeout)
 
 	var buf [2048]byte
 	for {
-		_, err = conn.Write(token[:])
+		start := time.Now()
+		err = conn.writeFrame(request)
+		conn.audit.done(auditHandshakeWrite, start, err)
 		if err != nil {
-			return fmt.Errorf("token: failed to write: %w", err)
+			return fmt.Errorf("%s: failed to write: %w", name, err)
 		}
 
-		err := conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		err := conn.SetReadDeadline(time.Now().Add(readTimeout))
 		if err != nil {
-			return fmt.Errorf("token: failed to set deadline: %w", err)
+			return fmt.Errorf("%s: failed to set deadline: %w", name, err)
 		}
+		conn.audit.set(auditHandshakeRead, readTimeout)
 
-		n, err := conn.Read(buf[:])
+		start = time.Now()
+		frame, err := conn.readFrame(buf[:])
+		conn.audit.done(auditHandshakeRead, start, err)
 		if err != nil {
-			if !errors.Is(err, os.ErrDeadlineExceeded) {
-				return fmt.Errorf("token: failed to read: %w", err)
+			if !errors.Is(err, os.ErrDeadlineExceeded) && !isFrameDecodeError(err) {
+				return fmt.Errorf("%s: failed to read: %w", name, err)
+			}
+		} else if len(frame) > 0 {
+			if done, err := handle(protocol.ProxyServerResponseType(frame[0])); done {
+				return err
 			}
-		} else if n > 0 && buf[0] == byte(protocol.ProxyServerResponseTypeKeepAlive) {
-			return nil
 		}
 
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
-func (c *client) proxyMainLoopReader(ctx context.Context, conn *net.UDPConn) (err error) {
+func (c *client) proxyMainLoopReader(ctx context.Context, conn *proxyConn) (err error) {
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
@@ -184,26 +328,64 @@ func (c *client) proxyMainLoopReader(ctx context.Context, conn *net.UDPConn) (er
 	defer func() {
 		c.mut.Lock()
 		defer c.mut.Unlock()
-		c.remoteAddrToDataCh = make(map[addrPortV4]chan []byte, dataChanSize)
+		c.peers = make(map[netip.AddrPort]*peer)
 	}()
 
+	// Server is poked with the token a few times before the session is considered dead.
+	_, timeout := c.session.Liveness()
+	readTimeout := c.cfg.Timeouts.read(timeout)
+
 	lastSuccess := time.Now()
+	deliver := func(frame []byte) {
+		addr, data, err := c.addrFormat.DecodeAddrData(frame)
+		if err != nil {
+			log.Printf("Main loop: dropping malformed frame: %v", err)
+			c.recordMalformed(len(frame))
+			return
+		}
+		p := c.getPeer(ctx, &wg, addr)
+		p.markReceived(lastSuccess)
+		if !c.rateLimiter.allow(p, DropFromServer, len(data)) {
+			c.recordDrop(p, DropFromServer, len(data), DropReasonRateLimited)
+			return
+		}
+		pooled := append(getPacketBuf(), data...)
+		if !c.enqueue(p.dataCh, pooled, p, DropFromServer, len(data)) {
+			log.Printf("Main loop: data channel is full")
+		}
+	}
+
 	var buf [2048]byte
 	for {
-		err := conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		err := conn.SetReadDeadline(time.Now().Add(readTimeout))
 		if err != nil {
 			return fmt.Errorf("main-loop: failed to set read deadline: %w", err)
 		}
+		c.audit.set(auditMainLoopRead, readTimeout)
 
-		n, err := conn.Read(buf[:])
+		start := time.Now()
+		frame, err := conn.readFrame(buf[:])
+		c.audit.done(auditMainLoopRead, start, err)
 		if err != nil {
+			if errors.Is(err, protocol.ErrChecksumMismatch) {
+				log.Printf("Main loop: dropping corrupted frame")
+				c.traffic.corrupted.Add(1)
+				c.metrics.corrupted.Add(1)
+				c.recordDrop(nil, DropFromServer, 0, DropReasonCorrupted)
+				continue
+			}
+			if isFrameDecodeError(err) {
+				log.Printf("Main loop: dropping malformed frame: %v", err)
+				c.recordMalformed(0)
+				continue
+			}
 			if !errors.Is(err, os.ErrDeadlineExceeded) {
 				return fmt.Errorf("main-loop: failed to read: %w", err)
 			}
 
-			if time.Since(lastSuccess) > 30*time.Second {
+			if time.Since(lastSuccess) > timeout {
 				log.Printf("Main loop: server stopped responding")
-				return fmt.Errorf("main-loop: server stopped responding")
+				return fmt.Errorf("main-loop: %w", errServerNotResponding)
 			}
 
 			log.Printf("Main loop: server read timeout, sending token")
@@ -212,80 +394,183 @@ func (c *client) proxyMainLoopReader(ctx context.Context, conn *net.UDPConn) (er
 				return ctx.Err()
 
 			// This might get stuck if main writer exited.
-			case c.dataToServerCh <- c.token[:]:
+			case c.dataToServerCh <- c.tokenRequest():
 			}
 			continue
 		}
 
 		lastSuccess = time.Now()
 
-		if n == 0 {
+		if len(frame) == 0 {
 			// Empty packets are currently not supported.
 			continue
 		}
-		if n > protocol.AddrSize {
-			addr, data := protocol.DecodeAddrData(buf[:n])
-			dataCh := c.getWorkerChan(ctx, &wg, addr)
-			select {
-			case dataCh <- append([]byte(nil), data...):
-			default:
-				log.Printf("Main loop: data channel is full")
-			}
+		if c.addrFormat.IsDataFrame(frame) {
+			deliver(frame)
 		} else {
-			switch protocol.ProxyServerResponseType(buf[0]) {
+			switch protocol.ProxyServerResponseType(frame[0]) {
 			case protocol.ProxyServerResponseTypeKeepAlive:
 				log.Printf("Keep alive response")
+				if sent := c.traffic.keepAliveSent.Swap(0); sent != 0 {
+					rtt := time.Now().UnixNano() - sent
+					c.traffic.keepAliveRTT.Store(rtt)
+					c.metrics.keepAliveRTT.Observe(time.Duration(rtt).Seconds())
+				}
+			case protocol.ProxyServerResponseTypePong:
+				seq, err := protocol.DecodePong(frame)
+				if err != nil {
+					log.Printf("Main loop: dropping malformed pong: %v", err)
+					c.recordMalformed(len(frame))
+					continue
+				}
+				c.quality.pong(seq, lastSuccess)
+			case protocol.ProxyServerResponseTypeBatch:
+				frames, err := protocol.SplitBatch(frame)
+				if err != nil || c.addrFormat != protocol.AddrFormatV2 {
+					log.Printf("Main loop: dropping malformed batch: %v", err)
+					c.recordMalformed(len(frame))
+					continue
+				}
+				for _, frame := range frames {
+					if c.addrFormat.IsDataFrame(frame) {
+						deliver(frame)
+					}
+				}
+			case protocol.ProxyServerResponseTypeNewToken:
+				c.handleNewToken(frame)
+			case protocol.ProxyServerResponseTypeMaintenance:
+				c.handleMaintenance(frame)
 			case protocol.ProxyServerResponseTypeDisconnect:
 				log.Printf("Disconnect response")
-				return nil
+				return c.handleDisconnect(frame)
+			case protocol.ProxyServerResponseTypeTCPIncoming:
+				in, err := protocol.DecodeTCPIncoming(frame)
+				if err != nil {
+					log.Printf("Main loop: dropping malformed stream announcement: %v", err)
+					c.recordMalformed(len(frame))
+					continue
+				}
+				if !c.tcpEnabled() {
+					log.Printf("Main loop: dropping stream announcement, TCP relay is disabled")
+					continue
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := c.acceptTCPStream(ctx, in); err != nil {
+						log.Printf("TCP relay: stream from %v failed: %v", in.Peer, err)
+					}
+				}()
 			default:
-				log.Printf("Unexpected response %x", buf[0])
+				log.Printf("Unexpected response %x", frame[0])
 			}
 		}
 	}
 }
 
-func (c *client) proxyMainLoopWriter(ctx context.Context, conn *net.UDPConn) error {
-	const keepAliveInterval = 3 * time.Second
+func (c *client) proxyMainLoopWriter(ctx context.Context, conn *proxyConn) error {
+	keepAliveInterval, timeout := c.session.Liveness()
+	var tuner *keepAliveTuner
+	if c.adaptiveKeepAlive.Load() {
+		// Responses must arrive before the reader times out and starts poking the server.
+		tuner = newKeepAliveTuner(keepAliveInterval, timeout/4)
+	}
 	ticker := time.NewTicker(keepAliveInterval)
 	defer ticker.Stop()
+	keepAlivePending := false
 
 	err := conn.SetWriteDeadline(time.Time{})
 	if err != nil {
 		return fmt.Errorf("main-loop: failed to set write deadline: %w", err)
 	}
+	c.audit.set(auditMainLoopWrite, 0)
 
+	var next []byte // frame which didn't fit into the last batch
+	var nextControl bool
+	var frames [][]byte
 	for {
-		var data []byte
-		var ok bool
-		select {
-		case <-ctx.Done():
+		if ctx.Err() != nil {
 			return ctx.Err()
-		case data, ok = <-c.dataToServerCh:
-			if !ok {
-				return nil
-			}
+		}
+		var data []byte
+		// Only frames from peer queues are batched: control messages are told by their source,
+		// as some of them, such as the plain token, look like data frames.
+		control := true
+		if next != nil {
+			data, control, next = next, nextControl, nil
+		} else if queued, queuedControl, ok := c.nextToServer(); !ok {
+			return nil
+		} else if queued != nil {
+			data, control = queued, queuedControl
 			ticker.Reset(keepAliveInterval)
-		case <-ticker.C:
-			data = []byte{byte(protocol.ProxyClientRequestTypeKeepAlive)}
+		} else {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case data, ok = <-c.dataToServerCh:
+				if !ok {
+					return nil
+				}
+				ticker.Reset(keepAliveInterval)
+			case <-c.upstream.ready:
+				continue
+			case <-ticker.C:
+				if tuner != nil {
+					// Reader clears the send time once keep alive is answered.
+					if keepAlivePending && c.traffic.keepAliveSent.Load() != 0 {
+						tuner.missed()
+						// NAT binding has likely expired, so the server doesn't know the new one.
+						log.Printf("Keep alive wasn't answered, resending token")
+						if err := conn.writeFrame(c.tokenRequest()); err != nil {
+							return fmt.Errorf("main-loop: failed to write: %w", err)
+						}
+					} else if keepAlivePending {
+						tuner.answered()
+					}
+					if tuner.Interval() != keepAliveInterval {
+						keepAliveInterval = tuner.Interval()
+						log.Printf("Keep alive interval is %v", keepAliveInterval)
+					}
+					ticker.Reset(keepAliveInterval)
+				}
+				data = []byte{byte(protocol.ProxyClientRequestTypeKeepAlive)}
+				c.traffic.keepAliveSent.Store(time.Now().UnixNano())
+				keepAlivePending = true
+			}
 		}
 
-		_, err := conn.Write(data)
+		closed := false
+		if c.batchWindow > 0 && !control {
+			data, next, nextControl, closed = c.collectBatch(ctx, data)
+		}
+		frames = append(frames[:0], data)
+		if conn.io != nil && next == nil && !closed {
+			frames, closed = c.drainQueued(frames)
+		}
+
+		start := time.Now()
+		err := conn.writeFrames(frames)
+		c.audit.done(auditMainLoopWrite, start, err)
+		for _, frame := range frames {
+			putPacketBuf(frame)
+		}
 		if err != nil {
 			return fmt.Errorf("main-loop: failed to write: %w", err)
 		}
+		if closed {
+			return nil
+		}
 	}
 }
 
-func (c *client) handleWorker(
-	ctx context.Context,
-	remoteAddr *net.UDPAddr,
-	localIP net.IP,
-	dataCh <-chan []byte,
-) error {
-
-	d := net.Dialer{LocalAddr: &net.UDPAddr{IP: localIP, Port: 0}}
-	pc, err := d.DialContext(ctx, "udp4", gameAddr.String())
+func (c *client) handleWorker(ctx context.Context, p *peer) error {
+	remoteAddr := p.addr
+	var d net.Dialer
+	if c.gameAddr.IP.IsLoopback() {
+		// Each peer gets its own loopback address, so the game can tell players apart.
+		d.LocalAddr = &net.UDPAddr{IP: p.localIP.AsSlice(), Port: 0}
+	}
+	pc, err := d.DialContext(ctx, "udp4", c.gameAddr.String())
 	if err != nil {
 		return fmt.Errorf("worker: failed to listen: %w", err)
 	}
@@ -313,19 +598,26 @@ func (c *client) handleWorker(
 			select {
 			case <-ctx.Done():
 				return
-			case data, ok = <-dataCh:
+			case data, ok = <-p.dataCh:
 				if !ok {
 					return
 				}
 			}
 
+			start := time.Now()
 			_, err = conn.Write(data)
+			c.audit.done(auditWorkerWrite, start, err)
 			if err != nil {
+				putPacketBuf(data)
 				if isCancelledOrClosed(err) {
 					return
 				}
 				log.Printf("Worker: failed to write: %v", err)
+				continue
 			}
+			p.traffic.addReceived(len(data))
+			c.capture.write(p, unmapAddrPort(c.gameAddr.AddrPort()), true, data)
+			putPacketBuf(data)
 		}
 	}()
 
@@ -335,15 +627,19 @@ func (c *client) handleWorker(
 		defer conn.Close()
 		var buf [2048]byte
 		for {
-			err := conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+			readTimeout := c.cfg.Timeouts.workerIdle()
+			err := conn.SetReadDeadline(time.Now().Add(readTimeout))
 			if err != nil {
 				if err = ignoreCancelledOrClosed(err); err != nil {
 					log.Printf("Worker: failed to set read deadline: %v", err)
 				}
 				return
 			}
+			c.audit.set(auditWorkerRead, readTimeout)
 
+			start := time.Now()
 			n, err := conn.Read(buf[:])
+			c.audit.done(auditWorkerRead, start, err)
 			if err != nil {
 				if isCancelledOrClosed(err) {
 					return
@@ -362,12 +658,17 @@ func (c *client) handleWorker(
 				// Empty packets are currently not supported.
 				continue
 			}
+			c.capture.write(p, unmapAddrPort(c.gameAddr.AddrPort()), false, buf[:n])
 
-			data := make([]byte, 0, n+protocol.AddrSize)
-			data = protocol.EncodeAddrData(data, remoteAddr, buf[:n])
-			select {
-			case c.dataToServerCh <- data:
-			default:
+			// Peer might have moved to another port, see findReboundPeer.
+			data, err := c.addrFormat.EncodeAddrData(getPacketBuf(), p.currentAddr(), buf[:n])
+			if err != nil {
+				log.Printf("Worker: %v", err)
+				return
+			}
+			if c.sendToServer(p, data, n) {
+				p.traffic.addSent(n)
+			} else {
 				log.Printf("Worker: data channel is full")
 			}
 		}
@@ -377,52 +678,93 @@ func (c *client) handleWorker(
 	return nil
 }
 
-func (c *client) getWorkerChan(
+// getPeer returns peer for the remote address, starting a new worker if needed.
+func (c *client) getPeer(
 	ctx context.Context,
 	wg *sync.WaitGroup,
-	addr *net.UDPAddr,
-) chan []byte {
+	addr netip.AddrPort,
+) *peer {
 
-	ip := addr.IP.To4()
-	if ip == nil {
-		log.Printf("Received non-IPv4 address %v", addr)
-		return nil
-	}
-	addr4 := addrPortV4{ipv4(ip), uint16(addr.Port)}
+	addr = unmapAddrPort(addr)
 
 	c.mut.Lock()
 	defer c.mut.Unlock()
 
-	if dataCh, ok := c.remoteAddrToDataCh[addr4]; ok {
-		return dataCh
+	if p, ok := c.peers[addr]; ok {
+		return p
+	}
+	if p := c.findReboundPeer(addr, time.Now()); p != nil {
+		log.Printf("Peer %v has moved to %v, keeping its worker", p.currentAddr(), addr)
+		c.rebindPeer(p, addr)
+		return p
 	}
 
-	log.Printf("Creating worker for %v", addr4)
+	log.Printf("Creating worker for %v", addr)
 
-	localIP, ok := c.remoteIPToLocalIP[addr4.ip]
+	// Game supports only IPv4, so every remote IP (including IPv6 ones) is mapped to a local IPv4.
+	localIP, ok := c.remoteIPToLocalIP[addr.Addr()]
 	if !ok {
-		localIP = c.nextLocalIP
-		c.nextLocalIP = localIP.Next()
-		c.remoteIPToLocalIP[addr4.ip] = localIP
+		localIP = c.virtualIPs.allocate()
+		c.remoteIPToLocalIP[addr.Addr()] = localIP
 	}
+	c.markPeerSeen(addr.Addr())
 
-	dataCh := make(chan []byte, dataChanSize)
-	c.remoteAddrToDataCh[addr4] = dataCh
+	p := newPeer(addr, netip.AddrFrom4(localIP))
+	c.peers[addr] = p
+	c.metrics.activePeers.Add(1)
 
 	wg.Add(1)
-	go func(dataCh chan []byte) {
+	go func() {
 		defer wg.Done()
 
-		err := c.handleWorker(ctx, addr, localIP.ToIP(), dataCh)
+		// Name resolution might be slow, so don't delay the worker because of it.
+		peerEvent := Event{Peer: addr, LocalIP: p.localIP}
+		connectedEmitted := make(chan struct{})
+		go func() {
+			defer close(connectedEmitted)
+			peerEvent.PeerName = c.names.resolve(addr.Addr())
+			p.name.Store(&peerEvent.PeerName)
+			peerEvent.Type = EventPeerConnected
+			c.events.emit(peerEvent)
+		}()
+
+		if c.tcpEnabled() && c.gameAddr.IP.IsLoopback() {
+			// Listeners live as long as the worker of the peer.
+			tcpCtx, cancelTCP := context.WithCancel(ctx)
+			defer cancelTCP()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.runTCPListeners(tcpCtx, p)
+			}()
+		}
+
+		err := c.handleWorker(ctx, p)
 		if err != nil {
-			log.Printf("Worker for %v failed: %v", addr4, err)
+			log.Printf("Worker for %v failed: %v", addr, err)
 		}
 
+		<-connectedEmitted
+		peerEvent.Type = EventPeerDisconnected
+		peerEvent.Err = err
+		c.events.emit(peerEvent)
+		c.metrics.activePeers.Add(-1)
+
+		// Frames queued for the server would otherwise be sent after the peer has gone, e.g.
+		// to the new connection after a reconnect.
+		c.upstream.remove(p)
+
 		c.mut.Lock()
 		defer c.mut.Unlock()
-		delete(c.remoteAddrToDataCh, addr4)
-	}(dataCh)
-	return dataCh
+		if current := p.currentAddr(); c.peers[current] == p {
+			delete(c.peers, current)
+		}
+	}()
+	return p
+}
+
+func unmapAddrPort(addr netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
 }
 
 func ignoreCancelledOrClosed(err error) error {
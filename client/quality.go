@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"sync"
+	"time"
+)
+
+const (
+	pingInterval = time.Second
+	// Pong arriving later than this is counted as lost.
+	pingTimeout = 2 * time.Second
+	// Number of last pings packet loss is calculated over.
+	pingWindow = 30
+)
+
+// qualityMonitor measures round trip time and packet loss to the proxy server with pings, so
+// users can tell whether lag is caused by the proxy or by the game.
+type qualityMonitor struct {
+	mut   sync.Mutex
+	seq   uint32
+	pings [pingWindow]pingRecord // indexed by seq % pingWindow
+	rtt   time.Duration          // smoothed
+}
+
+type pingRecord struct {
+	seq      uint32
+	sent     time.Time
+	answered bool
+}
+
+func (m *qualityMonitor) reset() {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.pings = [pingWindow]pingRecord{}
+	m.rtt = 0
+}
+
+// newPing records a ping sent at now and returns its sequence number.
+func (m *qualityMonitor) newPing(now time.Time) uint32 {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.seq++
+	m.pings[m.seq%pingWindow] = pingRecord{seq: m.seq, sent: now}
+	return m.seq
+}
+
+// pong records reply to the ping with seq received at now. Duplicate, late and unknown
+// replies are ignored.
+func (m *qualityMonitor) pong(seq uint32, now time.Time) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	p := &m.pings[seq%pingWindow]
+	if p.sent.IsZero() || p.seq != seq || p.answered || now.Sub(p.sent) > pingTimeout {
+		return
+	}
+	p.answered = true
+
+	// Smooth RTT the same way TCP does, so a single slow reply doesn't cause a spike.
+	sample := now.Sub(p.sent)
+	if m.rtt == 0 {
+		m.rtt = sample
+	} else {
+		m.rtt += (sample - m.rtt) / 8
+	}
+}
+
+// result returns smoothed round trip time and share of lost pings among the ones which
+// are either answered or timed out.
+func (m *qualityMonitor) result(now time.Time) (rtt time.Duration, loss float64) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	var total, lost int
+	for _, p := range m.pings {
+		switch {
+		case p.sent.IsZero():
+		case p.answered:
+			total++
+		case now.Sub(p.sent) > pingTimeout:
+			total++
+			lost++
+		}
+	}
+	if total > 0 {
+		loss = float64(lost) / float64(total)
+	}
+	return m.rtt, loss
+}
+
+// runPinger sends pings to the proxy server until ctx is done.
+func (c *client) runPinger(ctx context.Context) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ping := protocol.EncodePing(c.quality.newPing(time.Now()))
+		select {
+		case <-ctx.Done():
+			return
+		case c.dataToServerCh <- ping:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQualityMonitor(t *testing.T) {
+	const ms = time.Millisecond
+	start := time.Now()
+	tests := []struct {
+		name string
+		// Reply delays of pings sent every pingInterval, negative if not answered.
+		delays   []time.Duration
+		wantRTT  time.Duration
+		wantLoss float64
+	}{
+		{"no pings", nil, 0, 0},
+		{"single", []time.Duration{40 * ms}, 40 * ms, 0},
+		{"smoothed", []time.Duration{40 * ms, 120 * ms}, 50 * ms, 0},
+		{"lost", []time.Duration{40 * ms, -1, 40 * ms, -1}, 40 * ms, 0.5},
+		{"late", []time.Duration{40 * ms, pingTimeout + ms}, 40 * ms, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m qualityMonitor
+			sent := start
+			for _, delay := range tt.delays {
+				seq := m.newPing(sent)
+				if delay >= 0 {
+					m.pong(seq, sent.Add(delay))
+					m.pong(seq, sent.Add(delay+ms)) // duplicate
+				}
+				sent = sent.Add(pingInterval)
+			}
+
+			// Pings still waiting for reply don't count.
+			sent = sent.Add(pingTimeout)
+			m.newPing(sent)
+			rtt, loss := m.result(sent.Add(ms))
+			if rtt != tt.wantRTT || loss != tt.wantLoss {
+				t.Errorf("result() = %v, %v, want %v, %v", rtt, loss, tt.wantRTT, tt.wantLoss)
+			}
+		})
+	}
+}
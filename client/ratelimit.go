@@ -0,0 +1,120 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimit caps game traffic relayed by the client, e.g. on metered or shared connections.
+// Packets over the limit are dropped, which the game treats as packet loss. Traffic of the
+// master server isn't limited, so the game stays listed.
+type RateLimit struct {
+	// Game data sent to peers and received from them, in kilobytes per second. Zero means no
+	// limit.
+	UploadKBps   int `json:",omitempty"`
+	DownloadKBps int `json:",omitempty"`
+	// Data which may be relayed at once over the rate, in kilobytes. Defaults to what the rate
+	// allows in a second. It's never less than the largest datagram, so every packet can pass.
+	BurstKB int `json:",omitempty"`
+}
+
+func (r RateLimit) validate() error {
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"UploadKBps", r.UploadKBps},
+		{"DownloadKBps", r.DownloadKBps},
+		{"BurstKB", r.BurstKB},
+	} {
+		if f.value < 0 {
+			return fmt.Errorf("invalid RateLimit.%s %d, it must not be negative", f.name, f.value)
+		}
+	}
+	return nil
+}
+
+// minBurst lets the largest datagram read from the game or the server through the bucket,
+// otherwise it would be dropped whatever the rate.
+const minBurst = 2048
+
+// tokenBucket allows rate bytes per second with bursts of up to burst bytes.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mut    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns the bucket for kbps with burstKB, nil if kbps is zero.
+func newTokenBucket(kbps, burstKB int) *tokenBucket {
+	if kbps == 0 {
+		return nil
+	}
+	rate := float64(kbps) * 1024
+	burst := rate
+	if burstKB > 0 {
+		burst = float64(burstKB) * 1024
+	}
+	if burst < minBurst {
+		burst = minBurst
+	}
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// allow takes size bytes from the bucket and reports whether they fit. Nil bucket allows
+// everything.
+func (b *tokenBucket) allow(now time.Time, size int) bool {
+	if b == nil {
+		return true
+	}
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if float64(size) > b.tokens {
+		return false
+	}
+	b.tokens -= float64(size)
+	return true
+}
+
+// rateLimiter applies Config.RateLimit to both directions. Limits may be replaced by
+// Reconfigure while packets are relayed.
+type rateLimiter struct {
+	upload   atomic.Pointer[tokenBucket]
+	download atomic.Pointer[tokenBucket]
+}
+
+func newRateLimiter(r RateLimit) *rateLimiter {
+	l := &rateLimiter{}
+	l.set(r)
+	return l
+}
+
+func (l *rateLimiter) set(r RateLimit) {
+	l.upload.Store(newTokenBucket(r.UploadKBps, r.BurstKB))
+	l.download.Store(newTokenBucket(r.DownloadKBps, r.BurstKB))
+}
+
+// allow reports whether a packet of p with size bytes of game data may be relayed in dir.
+func (l *rateLimiter) allow(p *peer, dir DropDirection, size int) bool {
+	if l == nil || p.isMaster {
+		return true
+	}
+	bucket := l.upload.Load()
+	if dir == DropFromServer {
+		bucket = l.download.Load()
+	}
+	return bucket.allow(time.Now(), size)
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"eiproxy/proxytest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name    string
+		kbps    int
+		burstKB int
+		packets []int         // sizes of packets sent at start
+		after   time.Duration // when the last packet is sent
+		last    int           // size of the last packet
+		want    []bool        // whether packets at start are allowed
+		wantEnd bool          // whether the last packet is allowed
+	}{
+		{name: "unlimited", packets: []int{1 << 20}, after: 0, last: 1 << 20, want: []bool{true}, wantEnd: true},
+		{name: "burst is a second by default", kbps: 4, packets: []int{4000, 96, 1}, after: 0, last: 1,
+			want: []bool{true, true, false}, wantEnd: false},
+		{name: "refills", kbps: 4, packets: []int{4096}, after: 500 * time.Millisecond, last: 2048,
+			want: []bool{true}, wantEnd: true},
+		{name: "default burst fits a datagram", kbps: 1, packets: []int{2048}, after: 0, last: 1,
+			want: []bool{true}, wantEnd: false},
+		{name: "burst fits a datagram", kbps: 8, burstKB: 1, packets: []int{2048}, after: 0, last: 1,
+			want: []bool{true}, wantEnd: false},
+		{name: "refill is capped by burst", kbps: 1, burstKB: 2, packets: []int{2048}, after: time.Hour,
+			last: 2049, want: []bool{true}, wantEnd: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(tt.kbps, tt.burstKB)
+			if b != nil {
+				b.last = start
+			}
+			for i, size := range tt.packets {
+				if got := b.allow(start, size); got != tt.want[i] {
+					t.Errorf("allow(%d) of packet %d = %v, want %v", size, i, got, tt.want[i])
+				}
+			}
+			if got := b.allow(start.Add(tt.after), tt.last); got != tt.wantEnd {
+				t.Errorf("allow(%d) after %v = %v, want %v", tt.last, tt.after, got, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestEndToEndRateLimit(t *testing.T) {
+	srv := proxytest.NewServer()
+	defer srv.Close()
+	game, c, _, _ := startTestClient(t, srv, func(cfg *Config) {
+		cfg.RateLimit = RateLimit{DownloadKBps: 1}
+	})
+	if err := srv.WaitForClient(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first packet fits into the burst of a datagram.
+	peer := netip.MustParseAddrPort("10.0.0.5:1234")
+	for i := 0; i < 3; i++ {
+		if err := srv.Send(peer, make([]byte, 1500)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	game.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var buf [2048]byte
+	if _, _, err := game.ReadFromUDP(buf[:]); err != nil {
+		t.Fatalf("game hasn't received the packet: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Stats().RateLimited < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := c.Stats().RateLimited; got != 2 {
+		t.Errorf("Stats().RateLimited = %d, want 2", got)
+	}
+}
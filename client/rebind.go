@@ -0,0 +1,58 @@
+package client
+
+import (
+	"net/netip"
+	"time"
+)
+
+// Peer's old port must be silent at least this long before packets from a new port of the same
+// IP are considered to come from the same player. Game clients send many packets per second,
+// so a player whose NAT rebound goes silent on the old port immediately, while two players
+// behind the same NAT keep sending from both ports.
+const peerRebindQuiet = time.Second
+
+// currentAddr returns the address the peer is currently seen at. It differs from addr after
+// the peer's NAT has rebound it to another port.
+func (p *peer) currentAddr() netip.AddrPort {
+	if addr := p.rebound.Load(); addr != nil {
+		return *addr
+	}
+	return p.addr
+}
+
+// markReceived records that a packet from the peer has arrived.
+func (p *peer) markReceived(now time.Time) {
+	p.lastReceived.Store(now.UnixNano())
+}
+
+// findReboundPeer returns the peer which has likely moved to addr because its NAT has rebound
+// it to another port, or nil if addr looks like a new player. Only a single peer of the same IP
+// which went silent recently is considered, so ambiguous cases start a new worker as before.
+// Silent peers live until their workers time out, which limits how late the move is detected.
+// It must be called with c.mut held.
+func (c *client) findReboundPeer(addr netip.AddrPort, now time.Time) *peer {
+	var found *peer
+	for _, p := range c.peers {
+		current := p.currentAddr()
+		if p.isMaster || current.Addr() != addr.Addr() || current == addr {
+			continue
+		}
+		if now.Sub(time.Unix(0, p.lastReceived.Load())) < peerRebindQuiet {
+			// Both ports are active, so they are different players.
+			return nil
+		}
+		if found != nil {
+			return nil
+		}
+		found = p
+	}
+	return found
+}
+
+// rebindPeer moves p to addr, so its worker and local endpoint keep serving it. It must be
+// called with c.mut held.
+func (c *client) rebindPeer(p *peer, addr netip.AddrPort) {
+	delete(c.peers, p.currentAddr())
+	p.rebound.Store(&addr)
+	c.peers[addr] = p
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestFindReboundPeer(t *testing.T) {
+	now := time.Now()
+	quiet, active := now.Add(-5*time.Second), now.Add(-100*time.Millisecond)
+	type existing struct {
+		addr         string
+		lastReceived time.Time
+		isMaster     bool
+	}
+	tests := []struct {
+		name  string
+		peers []existing
+		addr  string
+		want  string // addr of the found peer, empty if none
+	}{
+		{"no peers", nil, "1.2.3.4:2000", ""},
+		{"quiet peer of same ip", []existing{{"1.2.3.4:1000", quiet, false}}, "1.2.3.4:2000", "1.2.3.4:1000"},
+		{"active peer of same ip", []existing{{"1.2.3.4:1000", active, false}}, "1.2.3.4:2000", ""},
+		{"other ip", []existing{{"1.2.3.5:1000", quiet, false}}, "1.2.3.4:2000", ""},
+		{"master", []existing{{"1.2.3.4:1000", quiet, true}}, "1.2.3.4:2000", ""},
+		{"ambiguous", []existing{{"1.2.3.4:1000", quiet, false}, {"1.2.3.4:1001", quiet, false}},
+			"1.2.3.4:2000", ""},
+		{"another player is active", []existing{{"1.2.3.4:1000", quiet, false},
+			{"1.2.3.4:1001", active, false}}, "1.2.3.4:2000", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(Config{})
+			for _, e := range tt.peers {
+				p := newPeer(netip.MustParseAddrPort(e.addr), netip.Addr{})
+				p.isMaster = e.isMaster
+				p.markReceived(e.lastReceived)
+				c.peers[p.addr] = p
+			}
+
+			got := c.findReboundPeer(netip.MustParseAddrPort(tt.addr), now)
+			if (got == nil) != (tt.want == "") || got != nil && got.addr.String() != tt.want {
+				t.Errorf("findReboundPeer() = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebindPeer(t *testing.T) {
+	c := newClient(Config{})
+	oldAddr, newAddr := netip.MustParseAddrPort("1.2.3.4:1000"), netip.MustParseAddrPort("1.2.3.4:2000")
+	p := newPeer(oldAddr, netip.MustParseAddr("127.0.0.2"))
+	c.peers[oldAddr] = p
+
+	c.rebindPeer(p, newAddr)
+	if got := p.currentAddr(); got != newAddr {
+		t.Errorf("currentAddr() = %v, want %v", got, newAddr)
+	}
+	if _, ok := c.peers[oldAddr]; ok {
+		t.Errorf("peer is still registered at %v", oldAddr)
+	}
+	if c.peers[newAddr] != p {
+		t.Errorf("peer isn't registered at %v", newAddr)
+	}
+	if got := p.stats().Addr; got != newAddr {
+		t.Errorf("stats().Addr = %v, want %v", got, newAddr)
+	}
+}
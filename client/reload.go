@@ -0,0 +1,47 @@
+package client
+
+import (
+	"log"
+	"reflect"
+)
+
+// Reconfigurer is implemented by clients which can apply some config changes to the running
+// session without reconnecting.
+type Reconfigurer interface {
+	// Reconfigure applies cfg to the running session. It returns false without applying
+	// anything if cfg changes settings which require a new session, e.g. ServerURL or UserKey.
+	Reconfigure(cfg Config) bool
+}
+
+// withoutLiveSettings returns cfg with settings which Reconfigure applies to the running
+// session reset.
+func withoutLiveSettings(cfg Config) Config {
+	cfg.WaitForSlot = false       // checked on every connect
+	cfg.AdaptiveKeepAlive = false // applied from the next connection to the server
+	cfg.RosterPath = ""
+	cfg.NameAPIURL = ""
+	cfg.ReverseDNS = false
+	cfg.InheritedConn = nil // used only for the first connection
+	cfg.RateLimit = RateLimit{}
+	return cfg
+}
+
+func (c *client) Reconfigure(cfg Config) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if !reflect.DeepEqual(withoutLiveSettings(c.cfg), withoutLiveSettings(cfg)) {
+		return false
+	}
+	if reflect.DeepEqual(c.liveCfg, cfg) {
+		return true
+	}
+	c.liveCfg = cfg
+
+	c.waitForSlot.Store(cfg.WaitForSlot)
+	c.adaptiveKeepAlive.Store(cfg.AdaptiveKeepAlive)
+	c.names.setResolver(newNameResolver(cfg))
+	c.rateLimiter.set(cfg.RateLimit)
+	log.Printf("Config changes applied to the running session")
+	return true
+}
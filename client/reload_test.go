@@ -0,0 +1,42 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestClientReconfigure(t *testing.T) {
+	base := DefaultConfig()
+	otherURL, err := ParseURL("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   bool
+	}{
+		{"unchanged", func(cfg *Config) {}, true},
+		{"wait for slot", func(cfg *Config) { cfg.WaitForSlot = true }, true},
+		{"name sources", func(cfg *Config) { cfg.ReverseDNS = true; cfg.NameAPIURL = "http://names" }, true},
+		{"server url", func(cfg *Config) { cfg.ServerURL = otherURL }, false},
+		{"encryption", func(cfg *Config) { cfg.Encrypt = true; cfg.WaitForSlot = true }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(base)
+			cfg := base
+			tt.change(&cfg)
+			if got := c.Reconfigure(cfg); got != tt.want {
+				t.Fatalf("Reconfigure() = %v, want %v", got, tt.want)
+			}
+			wantWait := base.WaitForSlot
+			if tt.want {
+				wantWait = cfg.WaitForSlot
+			}
+			if got := c.waitForSlot.Load(); got != wantWait {
+				t.Errorf("waitForSlot = %v, want %v", got, wantWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestSendResume(t *testing.T) {
+	token := protocol.Token{1, 2, 3, 4, 5, 6}
+	tests := []struct {
+		name    string
+		resp    protocol.ProxyServerResponseType
+		wantErr error
+	}{
+		{"resumed", protocol.ProxyServerResponseTypeResumed, nil},
+		{"expired", protocol.ProxyServerResponseTypeSessionExpired, errSessionResumeFailed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			serverDone := make(chan struct{})
+			defer func() {
+				server.Close()
+				<-serverDone
+			}()
+
+			go func() {
+				defer close(serverDone)
+				var buf [64]byte
+				for {
+					n, addr, err := server.ReadFromUDP(buf[:])
+					if err != nil {
+						return
+					}
+					if string(buf[:n]) != string(protocol.EncodeResumeRequest(token)) {
+						continue
+					}
+					// Keep alives must not be taken for a reply to resume request.
+					_, _ = server.WriteToUDP([]byte{byte(protocol.ProxyServerResponseTypeKeepAlive)}, addr)
+					_, _ = server.WriteToUDP([]byte{byte(tt.resp)}, addr)
+				}
+			}()
+
+			netConn, err := net.Dial("udp4", server.LocalAddr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn := &proxyConn{Conn: netConn, traffic: &trafficCounters{}}
+			defer conn.Close()
+
+			err = sendResume(conn, protocol.EncodeResumeRequest(token))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("sendResume() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
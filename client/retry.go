@@ -0,0 +1,46 @@
+package client
+
+import "time"
+
+// RetryPolicy controls reconnection after the client loses connection to the server.
+type RetryPolicy struct {
+	// Maximum number of attempts in a row. Zero means default (5), negative means no limit.
+	MaxAttempts int `json:",omitempty"`
+	// Delay before the first attempt, doubled for each next one up to MaxDelaySeconds.
+	BaseDelaySeconds int `json:",omitempty"`
+	MaxDelaySeconds  int `json:",omitempty"`
+	// Retry even if the client has never connected successfully, e.g. when the server is
+	// temporarily unreachable on start.
+	RetryOnFirstFailure bool `json:",omitempty"`
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 5
+	}
+	if p.BaseDelaySeconds <= 0 {
+		p.BaseDelaySeconds = 2
+	}
+	if p.MaxDelaySeconds <= 0 {
+		p.MaxDelaySeconds = 60
+	}
+	return p
+}
+
+// exhausted reports whether attempt (starting from 1) exceeds MaxAttempts.
+func (p RetryPolicy) exhausted(attempt int) bool {
+	return p.MaxAttempts > 0 && attempt > p.MaxAttempts
+}
+
+// delay returns delay before attempt (starting from 1).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := time.Duration(p.BaseDelaySeconds) * time.Second
+	maxDelay := time.Duration(p.MaxDelaySeconds) * time.Second
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        RetryPolicy
+		attempt       int
+		wantDelay     time.Duration
+		wantExhausted bool
+	}{
+		{"default first", RetryPolicy{}, 1, 2 * time.Second, false},
+		{"default last", RetryPolicy{}, 5, 32 * time.Second, false},
+		{"default exhausted", RetryPolicy{}, 6, 60 * time.Second, true},
+		{"max delay", RetryPolicy{BaseDelaySeconds: 10, MaxDelaySeconds: 15}, 3, 15 * time.Second, false},
+		{"infinite", RetryPolicy{MaxAttempts: -1}, 1000, 60 * time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy.withDefaults()
+			if got := p.delay(tt.attempt); got != tt.wantDelay {
+				t.Errorf("delay() = %v, want %v", got, tt.wantDelay)
+			}
+			if got := p.exhausted(tt.attempt); got != tt.wantExhausted {
+				t.Errorf("exhausted() = %v, want %v", got, tt.wantExhausted)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"eiproxy/protocol"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// Session saved less than this time ago is resumed on start. It's shorter than the time server
+// keeps the session without keep alives.
+const sessionResumeGrace = 20 * time.Second
+
+var errSessionResumeFailed = errors.New("failed to resume session")
+
+// sessionState is persisted to Config.StateFile, so restarted client can resume the session
+// and keep the same proxy address. Session belongs to the user key and server it was created
+// with, the key is kept as a hash.
+type sessionState struct {
+	ServerURL  string
+	UserKey    string
+	MasterAddr string
+	Response   protocol.ConnectionResponse
+	SavedAt    time.Time
+}
+
+// sessionResumable reports whether the session may be resumed by another process. Ciphers of
+// an encrypted session start their nonces over in the new process, which would reuse them with
+// the same key, so such sessions are neither saved nor resumed.
+func sessionResumable(resp protocol.ConnectionResponse) bool {
+	return !resp.HasCapability(protocol.CapabilityEncryption)
+}
+
+func hashUserKey(key protocol.UserKey) string {
+	sum := sha256.Sum256(key[:])
+	return hex.EncodeToString(sum[:])
+}
+
+// loadSession returns saved session if it matches current config and is fresh enough.
+func (c *client) loadSession() (protocol.ConnectionResponse, bool) {
+	if c.cfg.StateFile == "" {
+		return protocol.ConnectionResponse{}, false
+	}
+
+	data, err := os.ReadFile(c.cfg.StateFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to read session state: %v", err)
+		}
+		return protocol.ConnectionResponse{}, false
+	}
+
+	var state sessionState
+	if err = json.Unmarshal(data, &state); err != nil {
+		log.Printf("Failed to parse session state: %v", err)
+		return protocol.ConnectionResponse{}, false
+	}
+
+	if state.ServerURL != c.cfg.ServerURL.String() || state.UserKey != hashUserKey(c.cfg.UserKey) ||
+		state.MasterAddr != c.cfg.MasterAddr.String() ||
+		state.Response.Token == nil || state.Response.Port == nil || !sessionResumable(state.Response) ||
+		time.Since(state.SavedAt) > sessionResumeGrace {
+		return protocol.ConnectionResponse{}, false
+	}
+	return state.Response, true
+}
+
+func (c *client) saveSession(resp protocol.ConnectionResponse) {
+	if c.cfg.StateFile == "" || !sessionResumable(resp) {
+		return
+	}
+
+	state := sessionState{
+		ServerURL:  c.cfg.ServerURL.String(),
+		UserKey:    hashUserKey(c.cfg.UserKey),
+		MasterAddr: c.cfg.MasterAddr.String(),
+		Response:   resp,
+		SavedAt:    time.Now(),
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("Failed to marshal session state: %v", err)
+		return
+	}
+
+	// State contains session token, so keep it private.
+	tmpPath := c.cfg.StateFile + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0600); err == nil {
+		err = os.Rename(tmpPath, c.cfg.StateFile)
+	}
+	if err != nil {
+		log.Printf("Failed to save session state: %v", err)
+	}
+}
+
+// keepsSession reports whether the session is saved and left on the server on stop, so the
+// next process resumes it.
+func (c *client) keepsSession() bool {
+	return c.cfg.StateFile != "" && sessionResumable(c.currentSession())
+}
+
+// keepSessionSaved refreshes saved session time until ctx is done.
+func (c *client) keepSessionSaved(ctx context.Context) {
+	ticker := time.NewTicker(sessionResumeGrace / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.saveSession(c.currentSession())
+		}
+	}
+}
+
+func (c *client) clearSession() {
+	if c.cfg.StateFile == "" {
+		return
+	}
+	if err := os.Remove(c.cfg.StateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove session state: %v", err)
+	}
+}
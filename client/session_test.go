@@ -0,0 +1,75 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionState(t *testing.T) {
+	token := protocol.Token{1, 2, 3, 4, 5, 6}
+	port := 12345
+	resp := protocol.ConnectionResponse{Token: &token, Port: &port}
+	cfg := Config{
+		ServerURL:  MustParseURL("https://example.com"),
+		MasterAddr: MustParseHostPort("master:28004"),
+	}
+
+	tests := []struct {
+		name   string
+		modify func(s *sessionState)
+		want   bool
+	}{
+		{"fresh", func(s *sessionState) {}, true},
+		{"stale", func(s *sessionState) { s.SavedAt = time.Now().Add(-2 * sessionResumeGrace) }, false},
+		{"other server", func(s *sessionState) { s.ServerURL = "https://other.com" }, false},
+		{"other user key", func(s *sessionState) { s.UserKey = hashUserKey(protocol.UserKey{1}) }, false},
+		{"no user key", func(s *sessionState) { s.UserKey = "" }, false},
+		{"other master", func(s *sessionState) { s.MasterAddr = "other:28004" }, false},
+		{"no token", func(s *sessionState) { s.Response.Token = nil }, false},
+		{"encrypted", func(s *sessionState) {
+			s.Response.Capabilities = []protocol.Capability{protocol.CapabilityEncryption}
+			s.Response.EncryptionKey = make([]byte, protocol.EncryptionKeySize)
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := cfg
+			cfg.StateFile = filepath.Join(t.TempDir(), "state.json")
+			c := New(cfg).(*client)
+			c.saveSession(resp)
+
+			data, err := os.ReadFile(cfg.StateFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var state sessionState
+			if err = json.Unmarshal(data, &state); err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(&state)
+			if data, err = json.Marshal(state); err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(cfg.StateFile, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := c.loadSession()
+			if ok != tt.want {
+				t.Fatalf("loadSession() ok = %v, want %v", ok, tt.want)
+			}
+			if ok && (*got.Token != token || *got.Port != port) {
+				t.Errorf("loadSession() = %v, want %v", got, resp)
+			}
+
+			c.clearSession()
+			if _, ok := c.loadSession(); ok {
+				t.Errorf("loadSession() after clearSession() ok = true, want false")
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"log"
+	"time"
+)
+
+const (
+	// Signed token is refreshed this long before it expires.
+	tokenRefreshMargin = time.Minute
+	// Refresh request is repeated this often until the server answers it.
+	tokenRefreshRetry = 5 * time.Second
+)
+
+func (c *client) signedTokenEnabled() bool {
+	return c.session.HasCapability(protocol.CapabilitySignedToken) && c.signedToken() != nil
+}
+
+// currentSession returns the session with the latest signed token.
+func (c *client) currentSession() protocol.ConnectionResponse {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.session
+}
+
+func (c *client) signedToken() []byte {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.session.SignedToken
+}
+
+func (c *client) setSignedToken(token []byte) {
+	c.mut.Lock()
+	c.session.SignedToken = token
+	c.mut.Unlock()
+}
+
+// tokenRequest returns the frame authenticating the tunnel.
+func (c *client) tokenRequest() []byte {
+	if c.signedTokenEnabled() {
+		return protocol.EncodeSignedTokenRequest(c.signedToken())
+	}
+	return c.token[:]
+}
+
+// resumeRequest returns the frame resuming the session.
+func (c *client) resumeRequest() []byte {
+	if c.signedTokenEnabled() {
+		return protocol.EncodeSignedResumeRequest(c.signedToken())
+	}
+	return protocol.EncodeResumeRequest(c.token)
+}
+
+// runTokenRefresher asks the proxy server for a new signed token before the current one
+// expires until ctx is done. Main loop reader stores the new token.
+func (c *client) runTokenRefresher(ctx context.Context) {
+	for {
+		token, err := protocol.ParseSignedToken(c.signedToken())
+		if err != nil {
+			log.Printf("Token refresher: %v", err)
+			return
+		}
+		wait := time.Until(token.Expiry) - tokenRefreshMargin
+		if wait < tokenRefreshRetry {
+			wait = tokenRefreshRetry
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		refreshed, err := protocol.ParseSignedToken(c.signedToken())
+		if err != nil || !refreshed.Expiry.Equal(token.Expiry) {
+			continue
+		}
+		log.Printf("Refreshing session token")
+		select {
+		case <-ctx.Done():
+			return
+		case c.dataToServerCh <- []byte{byte(protocol.ProxyClientRequestTypeRefreshToken)}:
+		}
+	}
+}
+
+// handleNewToken stores the token from the server response.
+func (c *client) handleNewToken(frame []byte) {
+	token, err := protocol.DecodeNewToken(frame)
+	if err != nil {
+		log.Printf("Main loop: dropping malformed token: %v", err)
+		c.recordMalformed(len(frame))
+		return
+	}
+	log.Printf("Session token has been refreshed")
+	c.setSignedToken(append([]byte(nil), token...))
+}
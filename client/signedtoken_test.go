@@ -0,0 +1,35 @@
+package client
+
+import (
+	"bytes"
+	"eiproxy/protocol"
+	"testing"
+	"time"
+)
+
+func TestSignedTokenRequests(t *testing.T) {
+	c := &client{token: protocol.Token{1, 2, 3, 4, 5, 6}}
+	if got := c.tokenRequest(); !bytes.Equal(got, c.token[:]) {
+		t.Errorf("tokenRequest() without signed token = %x, want %x", got, c.token[:])
+	}
+
+	signed := protocol.SignedToken{Port: 20001, UserID: 1, Expiry: time.Now().Add(time.Hour)}
+	c.session = protocol.ConnectionResponse{
+		Capabilities: []protocol.Capability{protocol.CapabilitySignedToken},
+		SignedToken:  signed.Sign([]byte("secret")),
+	}
+	if got, want := c.tokenRequest(), protocol.EncodeSignedTokenRequest(c.session.SignedToken); !bytes.Equal(got, want) {
+		t.Errorf("tokenRequest() = %x, want %x", got, want)
+	}
+
+	refreshed := signed
+	refreshed.Expiry = signed.Expiry.Add(time.Hour)
+	token := refreshed.Sign([]byte("secret"))
+	c.handleNewToken(protocol.EncodeNewToken(token))
+	if got, want := c.resumeRequest(), protocol.EncodeSignedResumeRequest(token); !bytes.Equal(got, want) {
+		t.Errorf("resumeRequest() after refresh = %x, want %x", got, want)
+	}
+	if !bytes.Equal(c.currentSession().SignedToken, token) {
+		t.Errorf("refreshed token isn't kept in the session")
+	}
+}
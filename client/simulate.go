@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	simulatedPacketInterval = 100 * time.Millisecond
+	simulationProxyTimeout  = 5 * time.Second
+)
+
+// SimulationResult tells how far dummy traffic of synthetic players got.
+type SimulationResult struct {
+	Players int // synthetic players started
+	Joined  int // players which joined the running client during simulation
+	Sent    int // packets sent to the proxy address
+	Replies int // packets received back from the game
+}
+
+func (r SimulationResult) String() string {
+	return fmt.Sprintf("%d of %d players joined, %d packets sent, %d replies from the game",
+		r.Joined, r.Players, r.Sent, r.Replies)
+}
+
+// SimulatePlayers checks the whole path from the relay to the game: it starts n synthetic
+// players sending dummy packets to the proxy address of the running client c for duration.
+// Players are counted as joined if the client sees them connect, the game might ignore dummy
+// packets, so replies are optional.
+func SimulatePlayers(ctx context.Context, c Client, n int, duration time.Duration) (SimulationResult, error) {
+	result := SimulationResult{Players: n}
+	proxyCtx, cancel := context.WithTimeout(ctx, simulationProxyTimeout)
+	addr, err := c.ProxyAddr(proxyCtx)
+	cancel()
+	if err != nil {
+		return result, fmt.Errorf("proxy address isn't assigned, is the session connected? %w", err)
+	}
+
+	var mut sync.Mutex
+	joined := make(map[netip.AddrPort]bool)
+	unsubscribe := c.Subscribe(func(e Event) {
+		if e.Type == EventPeerConnected {
+			mut.Lock()
+			joined[e.Peer] = true
+			mut.Unlock()
+		}
+	})
+	defer unsubscribe()
+
+	conns := make([]*net.UDPConn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for i := 0; i < n; i++ {
+		conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(addr))
+		if err != nil {
+			return result, fmt.Errorf("failed to open socket of simulated player: %w", err)
+		}
+		conns = append(conns, conn)
+	}
+
+	simCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	var sent, replies atomic.Int64
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		i, conn := i, conn
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, packetBufSize)
+			for {
+				if _, err := conn.Read(buf); err != nil {
+					if errors.Is(err, net.ErrClosed) {
+						return
+					}
+					continue
+				}
+				replies.Add(1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(simulatedPacketInterval)
+			defer ticker.Stop()
+			for seq := 1; ; seq++ {
+				payload := fmt.Appendf(nil, "eiproxy simulated player %d packet %d", i+1, seq)
+				if _, err := conn.Write(payload); err == nil {
+					sent.Add(1)
+				}
+				select {
+				case <-simCtx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+
+	<-simCtx.Done()
+	// Give the last packets time to arrive before sockets are closed.
+	time.Sleep(simulatedPacketInterval)
+	for _, conn := range conns {
+		conn.Close()
+	}
+	conns = nil
+	wg.Wait()
+
+	mut.Lock()
+	result.Joined = len(joined)
+	mut.Unlock()
+	if result.Joined > n {
+		// Real players joined at the same time.
+		result.Joined = n
+	}
+	result.Sent = int(sent.Load())
+	result.Replies = int(replies.Load())
+	return result, ctx.Err()
+}
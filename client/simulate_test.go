@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+// echoProxyClient stands for a running client with the relay and the game behind its proxy
+// address: it reports a peer connected on its first packet and echoes the packets back.
+type echoProxyClient struct {
+	Client
+	conn *net.UDPConn
+
+	mut     sync.Mutex
+	handler EventHandler
+}
+
+func (c *echoProxyClient) ProxyAddr(ctx context.Context) (netip.AddrPort, error) {
+	return c.conn.LocalAddr().(*net.UDPAddr).AddrPort(), nil
+}
+
+func (c *echoProxyClient) Subscribe(handler EventHandler) func() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.handler = handler
+	return func() {}
+}
+
+func (c *echoProxyClient) run() {
+	seen := make(map[netip.AddrPort]bool)
+	buf := make([]byte, packetBufSize)
+	for {
+		n, addr, err := c.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		if !seen[addr] {
+			seen[addr] = true
+			c.mut.Lock()
+			c.handler(Event{Type: EventPeerConnected, Peer: addr})
+			c.mut.Unlock()
+		}
+		_, _ = c.conn.WriteToUDPAddrPort(buf[:n], addr)
+	}
+}
+
+func TestSimulatePlayers(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &echoProxyClient{conn: conn}
+	go c.run()
+
+	result, err := SimulatePlayers(context.Background(), c, 3, 250*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Players != 3 || result.Joined != 3 || result.Sent < 3 || result.Replies == 0 {
+		t.Errorf("SimulatePlayers() = %+v", result)
+	}
+}
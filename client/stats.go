@@ -0,0 +1,227 @@
+package client
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of client traffic counters.
+type Stats struct {
+	// Datagrams exchanged with the proxy server, including control messages.
+	BytesSent       uint64
+	BytesReceived   uint64
+	PacketsSent     uint64
+	PacketsReceived uint64
+	// Packets dropped because internal data channels were full or they were malformed.
+	Dropped uint64
+	// Packets dropped because the channel to the proxy server or a channel from it to a peer's
+	// worker was full, see Config.Backpressure.
+	DroppedToServer   uint64
+	DroppedFromServer uint64
+	// Packets from the proxy server dropped because of checksum mismatch.
+	Corrupted uint64
+	// Frames from the proxy server dropped because they couldn't be decoded.
+	Malformed uint64
+
+	// Round trip time of the last keep alive exchange with the proxy server.
+	KeepAliveRTT time.Duration
+	// Number of times the client has reconnected after losing connection.
+	Reconnects uint64
+
+	// Smoothed round trip time to the proxy server and share of pings lost on the way, measured
+	// with pings. Zero if the server doesn't answer pings.
+	RTT        time.Duration
+	PacketLoss float64
+
+	// Game data sent to peers and received from them in bytes per second, averaged over the
+	// last second or so, and packets dropped because of Config.RateLimit.
+	UploadRate   float64
+	DownloadRate float64
+	RateLimited  uint64
+
+	ActivePeers int
+	Peers       []PeerStats
+}
+
+type PeerStats struct {
+	Addr    netip.AddrPort
+	LocalIP netip.Addr
+	Name    string // friendly name, if resolved
+
+	// Time of the last packet sent to or received from the peer.
+	LastActive time.Time
+
+	// Game payload sent to the peer and received from it.
+	BytesSent       uint64
+	BytesReceived   uint64
+	PacketsSent     uint64
+	PacketsReceived uint64
+	Dropped         uint64
+
+	// Throughput in bytes per second, averaged over the last second or so.
+	SendRate    float64
+	ReceiveRate float64
+}
+
+type trafficCounters struct {
+	bytesSent         atomic.Uint64
+	bytesReceived     atomic.Uint64
+	packetsSent       atomic.Uint64
+	packetsReceived   atomic.Uint64
+	dropped           atomic.Uint64
+	droppedToServer   atomic.Uint64
+	droppedFromServer atomic.Uint64
+	corrupted         atomic.Uint64
+	malformed         atomic.Uint64
+	rateLimited       atomic.Uint64
+
+	lastActive    atomic.Int64 // unix nanoseconds
+	keepAliveSent atomic.Int64 // unix nanoseconds
+	keepAliveRTT  atomic.Int64
+	reconnects    atomic.Uint64
+}
+
+func (t *trafficCounters) addSent(n int) {
+	t.bytesSent.Add(uint64(n))
+	t.packetsSent.Add(1)
+	t.lastActive.Store(time.Now().UnixNano())
+}
+
+func (t *trafficCounters) addReceived(n int) {
+	t.bytesReceived.Add(uint64(n))
+	t.packetsReceived.Add(1)
+	t.lastActive.Store(time.Now().UnixNano())
+}
+
+// peer is a remote player (or the master server) routed through the proxy.
+type peer struct {
+	addr     netip.AddrPort
+	localIP  netip.Addr
+	isMaster bool
+	dataCh   chan []byte
+	// Data frames to the server, see upstream. upstreamActive is guarded by upstream.mut.
+	upstreamCh     chan []byte
+	upstreamActive bool
+	traffic        trafficCounters
+	name           atomic.Pointer[string]
+
+	rebound      atomic.Pointer[netip.AddrPort] // set if peer has moved from addr, see currentAddr
+	lastReceived atomic.Int64                   // unix nanoseconds
+
+	rateMut       sync.Mutex
+	rateTime      time.Time
+	rateBytesSent uint64
+	rateBytesRecv uint64
+	sendRate      float64
+	receiveRate   float64
+}
+
+func newPeer(addr netip.AddrPort, localIP netip.Addr) *peer {
+	return &peer{
+		addr:       addr,
+		localIP:    localIP,
+		dataCh:     make(chan []byte, dataChanSize),
+		upstreamCh: make(chan []byte, peerUpstreamSize),
+		rateTime:   time.Now(),
+	}
+}
+
+func (p *peer) stats() PeerStats {
+	return p.statsAt(time.Now())
+}
+
+func (p *peer) statsAt(now time.Time) PeerStats {
+	s := PeerStats{
+		Addr:            p.currentAddr(),
+		LocalIP:         p.localIP,
+		BytesSent:       p.traffic.bytesSent.Load(),
+		BytesReceived:   p.traffic.bytesReceived.Load(),
+		PacketsSent:     p.traffic.packetsSent.Load(),
+		PacketsReceived: p.traffic.packetsReceived.Load(),
+		Dropped:         p.traffic.dropped.Load(),
+	}
+	if name := p.name.Load(); name != nil {
+		s.Name = *name
+	}
+	if lastActive := p.traffic.lastActive.Load(); lastActive != 0 {
+		s.LastActive = time.Unix(0, lastActive)
+	}
+
+	p.rateMut.Lock()
+	defer p.rateMut.Unlock()
+
+	// Recalculate rates not more often than once per second to smooth them.
+	if elapsed := now.Sub(p.rateTime).Seconds(); elapsed >= 1 {
+		p.sendRate = float64(s.BytesSent-p.rateBytesSent) / elapsed
+		p.receiveRate = float64(s.BytesReceived-p.rateBytesRecv) / elapsed
+		p.rateTime = now
+		p.rateBytesSent = s.BytesSent
+		p.rateBytesRecv = s.BytesReceived
+	}
+	s.SendRate = p.sendRate
+	s.ReceiveRate = p.receiveRate
+	return s
+}
+
+// CorruptionRate returns the share of packets received from the proxy server that were
+// corrupted.
+func (s Stats) CorruptionRate() float64 {
+	if s.PacketsReceived == 0 {
+		return 0
+	}
+	return float64(s.Corrupted) / float64(s.PacketsReceived)
+}
+
+func (c *client) Peers() []PeerStats {
+	return c.Stats().Peers
+}
+
+func (c *client) Stats() Stats {
+	s := Stats{
+		BytesSent:         c.traffic.bytesSent.Load(),
+		BytesReceived:     c.traffic.bytesReceived.Load(),
+		PacketsSent:       c.traffic.packetsSent.Load(),
+		PacketsReceived:   c.traffic.packetsReceived.Load(),
+		Dropped:           c.traffic.dropped.Load(),
+		DroppedToServer:   c.traffic.droppedToServer.Load(),
+		DroppedFromServer: c.traffic.droppedFromServer.Load(),
+		Corrupted:         c.traffic.corrupted.Load(),
+		Malformed:         c.traffic.malformed.Load(),
+		KeepAliveRTT:      time.Duration(c.traffic.keepAliveRTT.Load()),
+		Reconnects:        c.traffic.reconnects.Load(),
+		RateLimited:       c.traffic.rateLimited.Load(),
+	}
+	s.RTT, s.PacketLoss = c.quality.result(time.Now())
+
+	c.mut.Lock()
+	peers := make([]*peer, 0, len(c.peers))
+	for _, p := range c.peers {
+		if !p.isMaster {
+			peers = append(peers, p)
+		}
+	}
+	c.mut.Unlock()
+
+	for _, p := range peers {
+		ps := p.stats()
+		s.UploadRate += ps.SendRate
+		s.DownloadRate += ps.ReceiveRate
+		s.Peers = append(s.Peers, ps)
+	}
+	sortPeerStats(s.Peers)
+	s.ActivePeers = len(s.Peers)
+	return s
+}
+
+func sortPeerStats(peers []PeerStats) {
+	sort.Slice(peers, func(i, j int) bool {
+		a, b := peers[i].Addr, peers[j].Addr
+		if a.Addr() != b.Addr() {
+			return a.Addr().Less(b.Addr())
+		}
+		return a.Port() < b.Port()
+	})
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPeerRates(t *testing.T) {
+	type step struct {
+		after              time.Duration // since the previous step
+		sent, received     int
+		wantSend, wantRecv float64
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"first second", []step{{500 * time.Millisecond, 100, 200, 0, 0}}},
+		{"one second", []step{{time.Second, 100, 200, 100, 200}}},
+		{"averaged over elapsed time", []step{{2 * time.Second, 100, 300, 50, 150}}},
+		{"kept until next second", []step{
+			{time.Second, 100, 0, 100, 0},
+			{500 * time.Millisecond, 1000, 1000, 100, 0},
+			{500 * time.Millisecond, 0, 0, 1000, 1000},
+		}},
+		{"idle", []step{
+			{time.Second, 100, 100, 100, 100},
+			{time.Second, 0, 0, 0, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPeer(netip.MustParseAddrPort("1.1.1.1:1"), netip.Addr{})
+			now := p.rateTime
+			for i, s := range tt.steps {
+				if s.sent > 0 {
+					p.traffic.addSent(s.sent)
+				}
+				if s.received > 0 {
+					p.traffic.addReceived(s.received)
+				}
+				now = now.Add(s.after)
+				got := p.statsAt(now)
+				if got.SendRate != s.wantSend || got.ReceiveRate != s.wantRecv {
+					t.Errorf("step %d: rates = %v, %v, want %v, %v",
+						i, got.SendRate, got.ReceiveRate, s.wantSend, s.wantRecv)
+				}
+			}
+		})
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	c := newClient(Config{})
+	peers := []struct {
+		addr           string
+		isMaster       bool
+		sent, received int
+	}{
+		{"5.5.5.5:1", false, 100, 10},
+		{"1.1.1.1:2", false, 50, 20},
+		{"1.1.1.1:1", false, 0, 0},
+		{"9.9.9.9:28004", true, 1000, 1000},
+	}
+	for _, tp := range peers {
+		p := newPeer(netip.MustParseAddrPort(tp.addr), netip.Addr{})
+		p.isMaster = tp.isMaster
+		p.traffic.addSent(tp.sent)
+		p.traffic.addReceived(tp.received)
+		// Make rates available right away.
+		p.rateTime = p.rateTime.Add(-time.Second)
+		c.peers[p.addr] = p
+	}
+	c.traffic.addSent(10)
+	c.traffic.corrupted.Add(1)
+	c.traffic.addReceived(10)
+	c.traffic.rateLimited.Add(3)
+
+	s := c.Stats()
+	if s.ActivePeers != 3 || len(s.Peers) != 3 {
+		t.Fatalf("Stats() has %d active peers and %d peers, want 3 without the master server",
+			s.ActivePeers, len(s.Peers))
+	}
+	wantOrder := []string{"1.1.1.1:1", "1.1.1.1:2", "5.5.5.5:1"}
+	for i, want := range wantOrder {
+		if got := s.Peers[i].Addr.String(); got != want {
+			t.Errorf("Stats().Peers[%d] = %s, want %s", i, got, want)
+		}
+	}
+	// Rates are measured over a bit more than a second.
+	if s.UploadRate <= 0 || s.UploadRate > 150 || s.DownloadRate <= 0 || s.DownloadRate > 30 {
+		t.Errorf("Stats() rates = %v, %v, want sums of peer rates up to 150, 30", s.UploadRate, s.DownloadRate)
+	}
+	if s.BytesSent != 10 || s.PacketsReceived != 1 || s.RateLimited != 3 {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func TestCorruptionRate(t *testing.T) {
+	tests := []struct {
+		received, corrupted uint64
+		want                float64
+	}{
+		{0, 0, 0},
+		{10, 0, 0},
+		{10, 1, 0.1},
+		{4, 4, 1},
+	}
+	for _, tt := range tests {
+		s := Stats{PacketsReceived: tt.received, Corrupted: tt.corrupted}
+		if got := s.CorruptionRate(); got != tt.want {
+			t.Errorf("CorruptionRate() with %d of %d corrupted = %v, want %v",
+				tt.corrupted, tt.received, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"log"
+)
+
+// handleDisconnect reports the usage summary appended by the server to the disconnect
+// response with EventSessionSummary. It returns errServerDisconnected, along with the reason
+// if the server has told it.
+func (c *client) handleDisconnect(frame []byte) error {
+	summary, reason, err := protocol.DecodeDisconnect(frame)
+	if err != nil {
+		log.Printf("Main loop: dropping malformed session summary: %v", err)
+		c.recordMalformed(len(frame))
+		return errServerDisconnected
+	}
+	if summary != nil {
+		log.Printf("Session summary: lasted %v, up to %d peers, %d bytes relayed",
+			summary.Duration, summary.PeakPeers, summary.BytesRelayed)
+		c.events.emit(Event{Type: EventSessionSummary, Summary: *summary})
+	}
+	if reason == protocol.DisconnectReasonUnknown {
+		return errServerDisconnected
+	}
+	return disconnectError{reason}
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"eiproxy/common"
+	"eiproxy/protocol"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSupportDuration is how long logs are shared in support mode by default.
+const DefaultSupportDuration = 30 * time.Minute
+
+const (
+	supportFlushInterval = 5 * time.Second
+	supportMaxEntries    = 2000 // oldest entries are dropped if the endpoint is unreachable
+)
+
+// supportStream collects log lines and uploads them to the relay operator in batches.
+type supportStream struct {
+	mut     sync.Mutex
+	entries []protocol.SupportLogEntry
+
+	url         string
+	userKey     protocol.UserKey
+	fingerprint string
+}
+
+func (s *supportStream) Write(p []byte) (int, error) {
+	now := time.Now()
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		s.entries = append(s.entries, protocol.SupportLogEntry{Time: now, Message: line})
+	}
+	if extra := len(s.entries) - supportMaxEntries; extra > 0 {
+		s.entries = append(s.entries[:0], s.entries[extra:]...)
+	}
+	return len(p), nil
+}
+
+func (s *supportStream) flush(ctx context.Context) error {
+	s.mut.Lock()
+	entries := s.entries
+	s.entries = nil
+	s.mut.Unlock()
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	req := protocol.SupportLogRequest{ClientVersion: ClientVer, OS: runtime.GOOS, Entries: entries}
+	opts := common.ApiRequestOptions{AuthKey: s.userKey.String(), Fingerprint: s.fingerprint}
+	err := common.MakeApiRequestWithOptions(ctx, http.MethodPost, s.url, req, nil, opts)
+	if err != nil {
+		// Put them back to retry with the next batch.
+		s.mut.Lock()
+		s.entries = append(entries, s.entries...)
+		s.mut.Unlock()
+	}
+	return err
+}
+
+func (s *supportStream) run(ctx context.Context) {
+	ticker := time.NewTicker(supportFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.flush(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Support mode: failed to send logs: %v", err)
+			}
+		}
+	}
+}
+
+// StartSupportMode streams log output to the relay operator for duration d, so issues only
+// a particular user has can be debugged remotely. Logs include players' IP addresses, so it
+// must only be started with explicit user consent. Returned function stops streaming early.
+// Fingerprint pins the server key like Config.ServerFingerprint.
+func StartSupportMode(serverURL URL, userKey protocol.UserKey, fingerprint string, d time.Duration) (stop func()) {
+	s := &supportStream{
+		url:         serverURL.JoinPath("api/support/logs").String(),
+		userKey:     userKey,
+		fingerprint: fingerprint,
+	}
+
+	prev := log.Writer()
+	log.SetOutput(io.MultiWriter(prev, s))
+	log.Printf("Support mode: sharing logs with the relay operator for %v", d)
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run(ctx)
+		log.Printf("Support mode: stopped sharing logs")
+		log.SetOutput(prev)
+
+		// Send what's left, e.g. lines logged right before the stop.
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.flush(flushCtx)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
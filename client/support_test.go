@@ -0,0 +1,63 @@
+package client
+
+import (
+	"eiproxy/protocol"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStartSupportMode(t *testing.T) {
+	var mut sync.Mutex
+	var messages []string
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/support/logs" {
+			http.NotFound(w, r)
+			return
+		}
+		var req protocol.SupportLogRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mut.Lock()
+		defer mut.Unlock()
+		auth = r.Header.Get("Authorization")
+		for _, e := range req.Entries {
+			messages = append(messages, e.Message)
+		}
+	}))
+	defer srv.Close()
+
+	prev := log.Writer()
+	defer log.SetOutput(prev)
+
+	key := protocol.UserKey{1}
+	stop := StartSupportMode(MustParseURL(srv.URL), key, "", time.Minute)
+	log.Printf("shared line")
+	stop()
+	log.Printf("private line")
+
+	if log.Writer() != prev {
+		t.Error("log output isn't restored")
+	}
+
+	mut.Lock()
+	defer mut.Unlock()
+	all := strings.Join(messages, "\n")
+	if !strings.Contains(all, "shared line") || !strings.Contains(all, "stopped sharing logs") {
+		t.Errorf("uploaded logs = %q, want shared lines", all)
+	}
+	if strings.Contains(all, "private line") {
+		t.Errorf("uploaded logs = %q, contain line logged after stop", all)
+	}
+	if auth != "Bearer "+key.String() {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const tcpHandshakeTimeout = 10 * time.Second
+
+// tcpEnabled reports whether TCP streams are tunneled in the current session.
+func (c *client) tcpEnabled() bool {
+	return c.tcpAddr != ""
+}
+
+func (c *client) tcpPortAllowed(port uint16) bool {
+	for _, p := range c.cfg.TCPPorts {
+		if p == int(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// runTCPListeners accepts TCP connections of the game to the peer's local IP and tunnels them
+// to the same port of the peer.
+func (c *client) runTCPListeners(ctx context.Context, p *peer) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for _, port := range c.cfg.TCPPorts {
+		addr := net.JoinHostPort(p.localIP.String(), strconv.Itoa(port))
+		ln, err := net.Listen("tcp4", addr)
+		if err != nil {
+			log.Printf("TCP relay: failed to listen on %s: %v", addr, err)
+			continue
+		}
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-ctx.Done()
+			ln.Close()
+		}()
+		go func(port int) {
+			defer wg.Done()
+			remote := netip.AddrPortFrom(p.addr.Addr(), uint16(port))
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					if err = ignoreCancelledOrClosed(err); err != nil {
+						log.Printf("TCP relay: failed to accept: %v", err)
+					}
+					return
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := c.openTCPStream(ctx, conn, remote)
+					if err != nil {
+						log.Printf("TCP relay: stream to %v failed: %v", remote, err)
+					}
+				}()
+			}
+		}(port)
+	}
+}
+
+// openTCPStream tunnels game connection to the remote peer.
+func (c *client) openTCPStream(ctx context.Context, gameConn net.Conn, remote netip.AddrPort) error {
+	defer gameConn.Close()
+
+	request, err := protocol.EncodeTCPOpenRequest(c.token, remote)
+	if err != nil {
+		return err
+	}
+	serverConn, err := dialTCPStream(ctx, c.tcpAddr, request)
+	if err != nil {
+		return err
+	}
+	defer serverConn.Close()
+
+	log.Printf("TCP relay: stream to %v opened", remote)
+	return relayTCP(ctx, gameConn, serverConn)
+}
+
+// acceptTCPStream connects stream opened by remote peer to the game.
+func (c *client) acceptTCPStream(ctx context.Context, in protocol.TCPIncoming) error {
+	if !c.tcpPortAllowed(in.Port) {
+		return fmt.Errorf("port %d isn't relayed", in.Port)
+	}
+
+	var d net.Dialer
+	if c.gameAddr.IP.IsLoopback() {
+		// Game sees the stream coming from the same local IP as the peer's datagrams.
+		c.mut.Lock()
+		localIP, ok := c.remoteIPToLocalIP[in.Peer.Addr().Unmap()]
+		c.mut.Unlock()
+		if ok {
+			d.LocalAddr = &net.TCPAddr{IP: localIP.ToIP()}
+		}
+	}
+	gameAddr := net.JoinHostPort(c.gameAddr.IP.String(), strconv.Itoa(int(in.Port)))
+	gameConn, err := d.DialContext(ctx, "tcp4", gameAddr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to game: %w", err)
+	}
+	defer gameConn.Close()
+
+	request := protocol.EncodeTCPAcceptRequest(c.token, in.StreamID)
+	serverConn, err := dialTCPStream(ctx, c.tcpAddr, request)
+	if err != nil {
+		return err
+	}
+	defer serverConn.Close()
+
+	log.Printf("TCP relay: stream from %v accepted", in.Peer)
+	return relayTCP(ctx, gameConn, serverConn)
+}
+
+// dialTCPStream connects to the server stream port and sends stream request.
+func dialTCPStream(ctx context.Context, addr string, request []byte) (net.Conn, error) {
+	d := net.Dialer{Timeout: tcpHandshakeTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+
+	err = conn.SetDeadline(time.Now().Add(tcpHandshakeTimeout))
+	if err == nil {
+		_, err = conn.Write(request)
+	}
+	var status [1]byte
+	if err == nil {
+		_, err = io.ReadFull(conn, status[:])
+	}
+	if err == nil {
+		err = conn.SetDeadline(time.Time{})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("stream handshake failed: %w", err)
+	}
+	if protocol.TCPStreamStatus(status[0]) != protocol.TCPStreamStatusOK {
+		conn.Close()
+		return nil, errors.New("server refused the stream")
+	}
+	return conn, nil
+}
+
+// relayTCP copies data both ways until both sides are done or ctx is cancelled.
+func relayTCP(ctx context.Context, a, b net.Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		a.Close()
+		b.Close()
+	}()
+
+	errs := make(chan error, 2)
+	copyHalf := func(dst, src net.Conn) {
+		_, err := io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+		errs <- err
+	}
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+
+	err := errors.Join(<-errs, <-errs)
+	return ignoreCancelledOrClosed(err)
+}
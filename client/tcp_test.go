@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// runEchoStreamServer accepts stream connections, records their requests and echoes stream data.
+func runEchoStreamServer(t *testing.T) (addr string, requests chan protocol.TCPStreamRequest) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	requests = make(chan protocol.TCPStreamRequest, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := protocol.ReadTCPStreamRequest(conn)
+				if err != nil {
+					return
+				}
+				requests <- req
+				_, _ = conn.Write([]byte{byte(protocol.TCPStreamStatusOK)})
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String(), requests
+}
+
+func checkEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	msg := []byte("hello")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != string(msg) {
+		t.Fatalf("read %q, %v, want %q", buf, err, msg)
+	}
+}
+
+func TestOpenTCPStream(t *testing.T) {
+	serverAddr, requests := runEchoStreamServer(t)
+	c := newClient(Config{})
+	c.token = protocol.Token{1, 2, 3, 4, 5, 6}
+	c.tcpAddr = serverAddr
+
+	gameConn, tunnelConn := net.Pipe()
+	defer gameConn.Close()
+	remote := netip.MustParseAddrPort("1.2.3.4:8889")
+	go func() { _ = c.openTCPStream(context.Background(), tunnelConn, remote) }()
+
+	checkEcho(t, gameConn)
+	req := <-requests
+	want := protocol.TCPStreamRequest{Token: c.token, Type: protocol.TCPStreamRequestTypeOpen, Peer: remote}
+	if req != want {
+		t.Errorf("stream request = %+v, want %+v", req, want)
+	}
+}
+
+func TestAcceptTCPStream(t *testing.T) {
+	serverAddr, requests := runEchoStreamServer(t)
+
+	game, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer game.Close()
+	gamePort := game.Addr().(*net.TCPAddr).Port
+
+	c := newClient(Config{TCPPorts: []int{gamePort}})
+	c.token = protocol.Token{1, 2, 3, 4, 5, 6}
+	c.tcpAddr = serverAddr
+	c.gameAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8888}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := protocol.TCPIncoming{StreamID: 7, Port: uint16(gamePort), Peer: netip.MustParseAddrPort("1.2.3.4:5000")}
+	go func() { _ = c.acceptTCPStream(ctx, in) }()
+
+	conn, err := game.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	checkEcho(t, conn)
+	if req := <-requests; req.Type != protocol.TCPStreamRequestTypeAccept || req.StreamID != 7 {
+		t.Errorf("stream request = %+v, want accept of stream 7", req)
+	}
+
+	in.Port++
+	if err := c.acceptTCPStream(ctx, in); err == nil {
+		t.Errorf("stream to a port that isn't relayed was accepted")
+	}
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timeouts of network operations. Zero fields use defaults, which suit most connections; raise
+// them on slow links or flaky Wi-Fi.
+type Timeouts struct {
+	// Worker relaying a peer exits when the game sends nothing to the peer this long. Default 30.
+	WorkerIdleSeconds int `json:",omitempty"`
+	// Token and resume requests are repeated this long before the proxy server is considered
+	// unreachable. Default 5.
+	HandshakeSeconds int `json:",omitempty"`
+	// Proxy server is poked with the token when nothing has been received from it this long.
+	// Defaults to a third of the session timeout set by the server, i.e. 10 seconds. It's
+	// ignored unless it's shorter than the session timeout.
+	ReadSeconds int `json:",omitempty"`
+	// API requests are abandoned after this long. Default 5.
+	HTTPSeconds int `json:",omitempty"`
+}
+
+const (
+	defaultWorkerIdleTimeout = 30 * time.Second
+	defaultHandshakeTimeout  = 5 * time.Second
+	defaultHTTPTimeout       = 5 * time.Second
+)
+
+func (t Timeouts) validate() error {
+	for _, f := range []struct {
+		name       string
+		value, max int
+	}{
+		{"WorkerIdleSeconds", t.WorkerIdleSeconds, 3600},
+		{"HandshakeSeconds", t.HandshakeSeconds, 60},
+		{"ReadSeconds", t.ReadSeconds, 300},
+		{"HTTPSeconds", t.HTTPSeconds, 120},
+	} {
+		if f.value < 0 || f.value > f.max {
+			return fmt.Errorf("invalid Timeouts.%s %d, it must be between 0 and %d", f.name, f.value, f.max)
+		}
+	}
+	return nil
+}
+
+func (t Timeouts) workerIdle() time.Duration {
+	return secondsOr(t.WorkerIdleSeconds, defaultWorkerIdleTimeout)
+}
+
+func (t Timeouts) handshake() time.Duration {
+	return secondsOr(t.HandshakeSeconds, defaultHandshakeTimeout)
+}
+
+// HTTP returns the limit of API calls, see api.Client.Timeout.
+func (t Timeouts) HTTP() time.Duration {
+	return secondsOr(t.HTTPSeconds, defaultHTTPTimeout)
+}
+
+// read returns read timeout of the main loop for the session timeout set by the server.
+func (t Timeouts) read(sessionTimeout time.Duration) time.Duration {
+	if read := time.Duration(t.ReadSeconds) * time.Second; read > 0 && read < sessionTimeout {
+		return read
+	}
+	return sessionTimeout / 3
+}
+
+func secondsOr(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name           string
+		timeouts       Timeouts
+		wantErr        bool
+		wantWorker     time.Duration
+		wantHandshake  time.Duration
+		wantRead       time.Duration
+		wantHTTP       time.Duration
+		sessionTimeout time.Duration
+	}{
+		{
+			name:           "defaults",
+			sessionTimeout: 30 * time.Second,
+			wantWorker:     30 * time.Second,
+			wantHandshake:  5 * time.Second,
+			wantRead:       10 * time.Second,
+			wantHTTP:       5 * time.Second,
+		},
+		{
+			name:           "custom",
+			timeouts:       Timeouts{WorkerIdleSeconds: 60, HandshakeSeconds: 15, ReadSeconds: 20, HTTPSeconds: 30},
+			sessionTimeout: 30 * time.Second,
+			wantWorker:     60 * time.Second,
+			wantHandshake:  15 * time.Second,
+			wantRead:       20 * time.Second,
+			wantHTTP:       30 * time.Second,
+		},
+		{
+			name:           "read timeout beyond session timeout",
+			timeouts:       Timeouts{ReadSeconds: 60},
+			sessionTimeout: 30 * time.Second,
+			wantWorker:     30 * time.Second,
+			wantHandshake:  5 * time.Second,
+			wantRead:       10 * time.Second,
+			wantHTTP:       5 * time.Second,
+		},
+		{name: "negative", timeouts: Timeouts{HTTPSeconds: -1}, wantErr: true},
+		{name: "too long", timeouts: Timeouts{HandshakeSeconds: 600}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.timeouts.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := tt.timeouts.workerIdle(); got != tt.wantWorker {
+				t.Errorf("workerIdle() = %v, want %v", got, tt.wantWorker)
+			}
+			if got := tt.timeouts.handshake(); got != tt.wantHandshake {
+				t.Errorf("handshake() = %v, want %v", got, tt.wantHandshake)
+			}
+			if got := tt.timeouts.read(tt.sessionTimeout); got != tt.wantRead {
+				t.Errorf("read(%v) = %v, want %v", tt.sessionTimeout, got, tt.wantRead)
+			}
+			if got := tt.timeouts.HTTP(); got != tt.wantHTTP {
+				t.Errorf("http() = %v, want %v", got, tt.wantHTTP)
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// TURNConfig describes a TURN server (RFC 5766) used to relay the tunnel when the proxy server
+// isn't reachable directly.
+type TURNConfig struct {
+	Addr     string // host:port of the TURN server (UDP)
+	Username string
+	Password string
+}
+
+// STUN/TURN message types and attributes used by the client.
+const (
+	stunMagicCookie = 0x2112A442
+	stunHeaderSize  = 20
+
+	stunAllocateRequest         = 0x0003
+	stunAllocateResponse        = 0x0103
+	stunAllocateError           = 0x0113
+	stunRefreshRequest          = 0x0004
+	stunCreatePermissionRequest = 0x0008
+	stunCreatePermissionResp    = 0x0108
+	stunCreatePermissionError   = 0x0118
+	stunSendIndication          = 0x0016
+	stunDataIndication          = 0x0017
+
+	stunAttrUsername           = 0x0006
+	stunAttrMessageIntegrity   = 0x0008
+	stunAttrErrorCode          = 0x0009
+	stunAttrLifetime           = 0x000D
+	stunAttrXORPeerAddress     = 0x0012
+	stunAttrData               = 0x0013
+	stunAttrRealm              = 0x0014
+	stunAttrNonce              = 0x0015
+	stunAttrXORRelayedAddress  = 0x0016
+	stunAttrRequestedTransport = 0x0019
+
+	stunCodeUnauthorized = 401
+	stunCodeStaleNonce   = 438
+
+	turnTransportUDP = 17
+)
+
+var errInvalidSTUNMessage = errors.New("invalid STUN message")
+
+type stunAttr struct {
+	typ   uint16
+	value []byte
+}
+
+type stunMessage struct {
+	typ   uint16
+	tid   [12]byte
+	attrs []stunAttr
+}
+
+func newSTUNMessage(typ uint16) *stunMessage {
+	m := &stunMessage{typ: typ}
+	_, _ = rand.Read(m.tid[:])
+	return m
+}
+
+func (m *stunMessage) add(typ uint16, value []byte) {
+	m.attrs = append(m.attrs, stunAttr{typ, value})
+}
+
+func (m *stunMessage) get(typ uint16) ([]byte, bool) {
+	for _, a := range m.attrs {
+		if a.typ == typ {
+			return a.value, true
+		}
+	}
+	return nil, false
+}
+
+// encode serializes the message. If key is set, MESSAGE-INTEGRITY is appended.
+func (m *stunMessage) encode(key []byte) []byte {
+	buf := make([]byte, stunHeaderSize, 128)
+	binary.BigEndian.PutUint16(buf[0:], m.typ)
+	binary.BigEndian.PutUint32(buf[4:], stunMagicCookie)
+	copy(buf[8:], m.tid[:])
+
+	for _, a := range m.attrs {
+		buf = appendSTUNAttr(buf, a.typ, a.value)
+	}
+
+	if key != nil {
+		// Length must include MESSAGE-INTEGRITY attribute itself (4 + 20 bytes).
+		binary.BigEndian.PutUint16(buf[2:], uint16(len(buf)-stunHeaderSize+24))
+		mac := hmac.New(sha1.New, key)
+		mac.Write(buf)
+		buf = appendSTUNAttr(buf, stunAttrMessageIntegrity, mac.Sum(nil))
+	}
+
+	binary.BigEndian.PutUint16(buf[2:], uint16(len(buf)-stunHeaderSize))
+	return buf
+}
+
+func appendSTUNAttr(buf []byte, typ uint16, value []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, typ)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(value)))
+	buf = append(buf, value...)
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+	return buf
+}
+
+func decodeSTUNMessage(data []byte) (*stunMessage, error) {
+	if len(data) < stunHeaderSize || binary.BigEndian.Uint32(data[4:]) != stunMagicCookie {
+		return nil, errInvalidSTUNMessage
+	}
+	length := int(binary.BigEndian.Uint16(data[2:]))
+	if len(data) < stunHeaderSize+length {
+		return nil, errInvalidSTUNMessage
+	}
+
+	m := &stunMessage{typ: binary.BigEndian.Uint16(data[0:])}
+	copy(m.tid[:], data[8:20])
+
+	attrs := data[stunHeaderSize : stunHeaderSize+length]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		size := int(binary.BigEndian.Uint16(attrs[2:]))
+		if len(attrs) < 4+size {
+			return nil, errInvalidSTUNMessage
+		}
+		m.add(typ, attrs[4:4+size])
+		padded := (size + 3) &^ 3
+		if len(attrs) < 4+padded {
+			break
+		}
+		attrs = attrs[4+padded:]
+	}
+	return m, nil
+}
+
+func (m *stunMessage) errorCode() int {
+	value, ok := m.get(stunAttrErrorCode)
+	if !ok || len(value) < 4 {
+		return 0
+	}
+	return int(value[2])*100 + int(value[3])
+}
+
+func encodeXORAddr(addr netip.AddrPort, tid [12]byte) []byte {
+	ip := addr.Addr().Unmap()
+	buf := make([]byte, 4, 20)
+	buf[1] = 0x01 // IPv4
+	if ip.Is6() {
+		buf[1] = 0x02
+	}
+	binary.BigEndian.PutUint16(buf[2:], addr.Port()^(stunMagicCookie>>16))
+
+	var mask [16]byte
+	binary.BigEndian.PutUint32(mask[:], stunMagicCookie)
+	copy(mask[4:], tid[:])
+	for i, b := range ip.AsSlice() {
+		buf = append(buf, b^mask[i])
+	}
+	return buf
+}
+
+func decodeXORAddr(value []byte, tid [12]byte) (netip.AddrPort, error) {
+	if len(value) < 8 {
+		return netip.AddrPort{}, errInvalidSTUNMessage
+	}
+	ipLen := net.IPv4len
+	if value[1] == 0x02 {
+		ipLen = net.IPv6len
+	}
+	if len(value) < 4+ipLen {
+		return netip.AddrPort{}, errInvalidSTUNMessage
+	}
+
+	var mask [16]byte
+	binary.BigEndian.PutUint32(mask[:], stunMagicCookie)
+	copy(mask[4:], tid[:])
+	ipBytes := make([]byte, ipLen)
+	for i := range ipBytes {
+		ipBytes[i] = value[4+i] ^ mask[i]
+	}
+	ip, _ := netip.AddrFromSlice(ipBytes)
+	port := binary.BigEndian.Uint16(value[2:]) ^ (stunMagicCookie >> 16)
+	return netip.AddrPortFrom(ip, port), nil
+}
+
+// turnConn is a connection to peer relayed via TURN server. It implements net.Conn, so it can
+// be used in place of direct UDP connection to the proxy server.
+type turnConn struct {
+	*net.UDPConn
+	cfg  TURNConfig
+	peer netip.AddrPort
+
+	mut      sync.Mutex
+	realm    []byte
+	nonce    []byte
+	lifetime time.Duration
+	closed   chan struct{}
+	buf      [2048]byte
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func dialTURN(cfg TURNConfig, peer netip.AddrPort) (*turnConn, error) {
+	serverAddr, err := net.ResolveUDPAddr("udp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("turn: failed to resolve server: %w", err)
+	}
+	conn, err := net.DialUDP("udp", nil, serverAddr)
+	if err != nil {
+		return nil, fmt.Errorf("turn: failed to dial: %w", err)
+	}
+
+	t := &turnConn{UDPConn: conn, cfg: cfg, peer: peer, closed: make(chan struct{})}
+	if err := t.allocate(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := t.createPermission(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go t.refreshLoop()
+	return t, nil
+}
+
+func (t *turnConn) key() []byte {
+	h := md5.Sum([]byte(t.cfg.Username + ":" + string(t.realm) + ":" + t.cfg.Password))
+	return h[:]
+}
+
+func (t *turnConn) addAuth(m *stunMessage) []byte {
+	if t.realm == nil {
+		return nil
+	}
+	m.add(stunAttrUsername, []byte(t.cfg.Username))
+	m.add(stunAttrRealm, t.realm)
+	m.add(stunAttrNonce, t.nonce)
+	return t.key()
+}
+
+// roundTrip sends request and waits for response with the same transaction ID. If server asks
+// for authentication (or nonce is stale), it retries once with credentials.
+func (t *turnConn) roundTrip(build func() *stunMessage) (*stunMessage, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		req := build()
+		t.mut.Lock()
+		key := t.addAuth(req)
+		t.mut.Unlock()
+
+		resp, err := t.exchange(req.encode(key), req.tid)
+		if err != nil {
+			return nil, err
+		}
+
+		code := resp.errorCode()
+		if code != stunCodeUnauthorized && code != stunCodeStaleNonce {
+			return resp, nil
+		}
+
+		realm, _ := resp.get(stunAttrRealm)
+		nonce, ok := resp.get(stunAttrNonce)
+		if !ok {
+			return resp, nil
+		}
+		t.mut.Lock()
+		if realm != nil {
+			t.realm = append([]byte(nil), realm...)
+		}
+		t.nonce = append([]byte(nil), nonce...)
+		t.mut.Unlock()
+	}
+	return nil, fmt.Errorf("turn: authentication failed")
+}
+
+func (t *turnConn) exchange(req []byte, tid [12]byte) (*stunMessage, error) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := t.UDPConn.Write(req); err != nil {
+			return nil, fmt.Errorf("turn: failed to write: %w", err)
+		}
+		if err := t.UDPConn.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
+			return nil, fmt.Errorf("turn: failed to set deadline: %w", err)
+		}
+
+		for {
+			n, err := t.UDPConn.Read(t.buf[:])
+			if err != nil {
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					break // retransmit
+				}
+				return nil, fmt.Errorf("turn: failed to read: %w", err)
+			}
+			resp, err := decodeSTUNMessage(t.buf[:n])
+			if err == nil && resp.tid == tid {
+				return resp, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("turn: server didn't respond")
+}
+
+func (t *turnConn) allocate() error {
+	resp, err := t.roundTrip(func() *stunMessage {
+		m := newSTUNMessage(stunAllocateRequest)
+		m.add(stunAttrRequestedTransport, []byte{turnTransportUDP, 0, 0, 0})
+		return m
+	})
+	if err != nil {
+		return err
+	}
+	if resp.typ != stunAllocateResponse {
+		return fmt.Errorf("turn: allocation failed with code %d", resp.errorCode())
+	}
+
+	t.lifetime = 10 * time.Minute
+	if value, ok := resp.get(stunAttrLifetime); ok && len(value) == 4 {
+		t.lifetime = time.Duration(binary.BigEndian.Uint32(value)) * time.Second
+	}
+	if value, ok := resp.get(stunAttrXORRelayedAddress); ok {
+		relayed, err := decodeXORAddr(value, resp.tid)
+		if err == nil {
+			log.Printf("TURN: allocated relayed address %v, lifetime %v", relayed, t.lifetime)
+		}
+	}
+	return nil
+}
+
+func (t *turnConn) createPermission() error {
+	resp, err := t.roundTrip(func() *stunMessage {
+		m := newSTUNMessage(stunCreatePermissionRequest)
+		m.add(stunAttrXORPeerAddress, encodeXORAddr(t.peer, m.tid))
+		return m
+	})
+	if err != nil {
+		return err
+	}
+	if resp.typ != stunCreatePermissionResp {
+		return fmt.Errorf("turn: permission failed with code %d", resp.errorCode())
+	}
+	return nil
+}
+
+// refreshLoop keeps allocation and permission alive. Responses are consumed by Read, so
+// requests are sent without waiting for them.
+func (t *turnConn) refreshLoop() {
+	// Permissions expire in 5 minutes regardless of allocation lifetime.
+	interval := t.lifetime / 2
+	if interval > 4*time.Minute || interval <= 0 {
+		interval = 4 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.closed:
+			return
+		case <-ticker.C:
+		}
+
+		for _, m := range []*stunMessage{newSTUNMessage(stunRefreshRequest),
+			newSTUNMessage(stunCreatePermissionRequest)} {
+			if m.typ == stunCreatePermissionRequest {
+				m.add(stunAttrXORPeerAddress, encodeXORAddr(t.peer, m.tid))
+			}
+			t.mut.Lock()
+			key := t.addAuth(m)
+			t.mut.Unlock()
+			if _, err := t.UDPConn.Write(m.encode(key)); err != nil {
+				log.Printf("TURN: failed to refresh: %v", err)
+			}
+		}
+	}
+}
+
+func (t *turnConn) Write(data []byte) (int, error) {
+	m := newSTUNMessage(stunSendIndication)
+	m.add(stunAttrXORPeerAddress, encodeXORAddr(t.peer, m.tid))
+	m.add(stunAttrData, data)
+	if _, err := t.UDPConn.Write(m.encode(nil)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (t *turnConn) Read(buf []byte) (int, error) {
+	for {
+		n, err := t.UDPConn.Read(t.buf[:])
+		if err != nil {
+			return 0, err
+		}
+
+		m, err := decodeSTUNMessage(t.buf[:n])
+		if err != nil {
+			continue
+		}
+
+		switch m.typ {
+		case stunDataIndication:
+			data, ok := m.get(stunAttrData)
+			if !ok {
+				continue
+			}
+			return copy(buf, data), nil
+		default:
+			// Responses to refresh requests. Remember new nonce if it's stale.
+			if m.errorCode() == stunCodeStaleNonce {
+				if nonce, ok := m.get(stunAttrNonce); ok {
+					t.mut.Lock()
+					t.nonce = append([]byte(nil), nonce...)
+					t.mut.Unlock()
+				}
+			}
+		}
+	}
+}
+
+// Close releases the allocation and closes the connection. It may be called concurrently, e.g.
+// by the session and on context cancellation, only the first call does the work.
+func (t *turnConn) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+
+		// Release allocation, don't wait for response.
+		m := newSTUNMessage(stunRefreshRequest)
+		m.add(stunAttrLifetime, []byte{0, 0, 0, 0})
+		t.mut.Lock()
+		key := t.addAuth(m)
+		t.mut.Unlock()
+		_, _ = t.UDPConn.Write(m.encode(key))
+
+		t.closeErr = t.UDPConn.Close()
+	})
+	return t.closeErr
+}
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"sync"
+	"testing"
+)
+
+func TestXORAddr(t *testing.T) {
+	tests := []string{"1.2.3.4:5678", "[2001:db8::1]:28004"}
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			addr := netip.MustParseAddrPort(tt)
+			tid := [12]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+			got, err := decodeXORAddr(encodeXORAddr(addr, tid), tid)
+			if err != nil {
+				t.Fatalf("decodeXORAddr() error = %v", err)
+			}
+			if got != addr {
+				t.Errorf("decodeXORAddr() = %v, want %v", got, addr)
+			}
+		})
+	}
+}
+
+func TestSTUNMessageIntegrity(t *testing.T) {
+	m := newSTUNMessage(stunAllocateRequest)
+	m.add(stunAttrUsername, []byte("user"))
+	key := []byte("key")
+	data := m.encode(key)
+
+	decoded, err := decodeSTUNMessage(data)
+	if err != nil {
+		t.Fatalf("decodeSTUNMessage() error = %v", err)
+	}
+	if decoded.typ != m.typ || decoded.tid != m.tid {
+		t.Fatalf("decodeSTUNMessage() header mismatch")
+	}
+	if username, _ := decoded.get(stunAttrUsername); string(username) != "user" {
+		t.Errorf("username = %q, want %q", username, "user")
+	}
+
+	integrity, ok := decoded.get(stunAttrMessageIntegrity)
+	if !ok {
+		t.Fatalf("MESSAGE-INTEGRITY is missing")
+	}
+	signed := append([]byte(nil), data[:len(data)-24]...)
+	binary.BigEndian.PutUint16(signed[2:], uint16(len(data)-stunHeaderSize))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(signed)
+	if !bytes.Equal(integrity, mac.Sum(nil)) {
+		t.Errorf("MESSAGE-INTEGRITY mismatch")
+	}
+}
+
+// fakeTURNServer requires authentication and echoes Send indications back as Data indications.
+func fakeTURNServer(t *testing.T, conn net.PacketConn) {
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := decodeSTUNMessage(buf[:n])
+		if err != nil {
+			t.Errorf("server: %v", err)
+			return
+		}
+
+		resp := &stunMessage{tid: req.tid}
+		_, authorized := req.get(stunAttrMessageIntegrity)
+		switch {
+		case req.typ == stunSendIndication:
+			resp.typ = stunDataIndication
+			peer, _ := req.get(stunAttrXORPeerAddress)
+			data, _ := req.get(stunAttrData)
+			resp.add(stunAttrXORPeerAddress, peer)
+			resp.add(stunAttrData, data)
+		case !authorized:
+			resp.typ = req.typ | 0x0110
+			resp.add(stunAttrErrorCode, []byte{0, 0, 4, 1})
+			resp.add(stunAttrRealm, []byte("realm"))
+			resp.add(stunAttrNonce, []byte("nonce"))
+		default:
+			resp.typ = req.typ | 0x0100
+			resp.add(stunAttrLifetime, []byte{0, 0, 0x02, 0x58})
+		}
+		_, _ = conn.WriteTo(resp.encode(nil), addr)
+	}
+}
+
+func TestTURNConn(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go fakeTURNServer(t, server)
+
+	cfg := TURNConfig{Addr: server.LocalAddr().String(), Username: "user", Password: "pass"}
+	conn, err := dialTURN(cfg, netip.MustParseAddrPort("10.0.0.1:28004"))
+	if err != nil {
+		t.Fatalf("dialTURN() error = %v", err)
+	}
+	defer conn.Close()
+
+	if string(conn.realm) != "realm" || string(conn.nonce) != "nonce" {
+		t.Errorf("realm/nonce = %q/%q, want realm/nonce", conn.realm, conn.nonce)
+	}
+
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	buf := make([]byte, 100)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if string(buf[:n]) != "hello" {
+		t.Errorf("Read() = %q, want %q", buf[:n], "hello")
+	}
+
+	// Session and context cancellation may close the connection at the same time.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.Close()
+		}()
+	}
+	wg.Wait()
+}
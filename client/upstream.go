@@ -0,0 +1,110 @@
+package client
+
+import "sync"
+
+// Data frames a peer may have queued for the server.
+const peerUpstreamSize = 100
+
+// upstream hands out data frames queued by peers for the server round-robin, so a peer
+// flooding the client fills only its own queue and can't starve the others. Frames stay in
+// peer.upstreamCh, upstream only tracks which peers have some.
+type upstream struct {
+	mut    sync.Mutex
+	active []*peer       // peers with queued frames in service order
+	ready  chan struct{} // signalled when a frame is queued
+}
+
+func newUpstream() *upstream {
+	return &upstream{ready: make(chan struct{}, 1)}
+}
+
+// queued schedules p after it has queued a frame.
+func (u *upstream) queued(p *peer) {
+	u.mut.Lock()
+	if !p.upstreamActive {
+		p.upstreamActive = true
+		u.active = append(u.active, p)
+	}
+	u.mut.Unlock()
+
+	select {
+	case u.ready <- struct{}{}:
+	default:
+	}
+}
+
+// remove unschedules p and releases frames it has left queued. It's called once the worker of
+// p has stopped, so nothing is queued after it.
+func (u *upstream) remove(p *peer) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	if p.upstreamActive {
+		p.upstreamActive = false
+		for i, q := range u.active {
+			if q == p {
+				copy(u.active[i:], u.active[i+1:])
+				u.active[len(u.active)-1] = nil
+				u.active = u.active[:len(u.active)-1]
+				break
+			}
+		}
+	}
+	for {
+		select {
+		case data := <-p.upstreamCh:
+			putPacketBuf(data)
+		default:
+			return
+		}
+	}
+}
+
+// pop returns the next frame of the next peer in turn, or nil if nothing is queued.
+func (u *upstream) pop() []byte {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	for len(u.active) > 0 {
+		p := u.active[0]
+		u.active[0] = nil
+		u.active = u.active[1:]
+		select {
+		case data := <-p.upstreamCh:
+			if len(p.upstreamCh) > 0 {
+				u.active = append(u.active, p)
+			} else {
+				p.upstreamActive = false
+			}
+			return data
+		default:
+			p.upstreamActive = false
+		}
+	}
+	return nil
+}
+
+// sendToServer queues data frame of p for the server and reports whether it has been queued.
+func (c *client) sendToServer(p *peer, data []byte, size int) bool {
+	if !c.rateLimiter.allow(p, DropToServer, size) {
+		putPacketBuf(data)
+		c.recordDrop(p, DropToServer, size, DropReasonRateLimited)
+		return false
+	}
+	if !c.enqueue(p.upstreamCh, data, p, DropToServer, size) {
+		return false
+	}
+	c.upstream.queued(p)
+	return true
+}
+
+// nextToServer returns the next queued message for the server without waiting. Control
+// messages go first, then data frames of peers in turn. control tells which one data is, as
+// a control message such as the plain token may look like a data frame. ok is false if
+// dataToServerCh has been closed.
+func (c *client) nextToServer() (data []byte, control, ok bool) {
+	select {
+	case data, ok := <-c.dataToServerCh:
+		return data, true, ok
+	default:
+	}
+	return c.upstream.pop(), false, true
+}
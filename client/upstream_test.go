@@ -0,0 +1,75 @@
+package client
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestUpstreamRoundRobin(t *testing.T) {
+	c := newClient(Config{})
+	flooder := newPeer(netip.MustParseAddrPort("1.1.1.1:1"), netip.Addr{})
+	quiet := newPeer(netip.MustParseAddrPort("2.2.2.2:2"), netip.Addr{})
+
+	for i := 0; i < peerUpstreamSize+10; i++ {
+		c.sendToServer(flooder, []byte{'f'}, 1)
+	}
+	c.sendToServer(quiet, []byte{'q'}, 1)
+	c.sendToServer(quiet, []byte{'q'}, 1)
+
+	// Flooder only overflows its own queue.
+	if got := flooder.traffic.dropped.Load(); got != 10 {
+		t.Errorf("flooder dropped %d packets, want 10", got)
+	}
+	if got := quiet.traffic.dropped.Load(); got != 0 {
+		t.Errorf("quiet peer dropped %d packets, want 0", got)
+	}
+
+	var order []byte
+	for {
+		data, _, ok := c.nextToServer()
+		if !ok || data == nil {
+			break
+		}
+		order = append(order, data[0])
+	}
+	if len(order) != peerUpstreamSize+2 {
+		t.Fatalf("got %d frames, want %d", len(order), peerUpstreamSize+2)
+	}
+	if got := string(order[:5]); got != "fqfqf" {
+		t.Errorf("frames are served in order %q, want %q", got, "fqfqf")
+	}
+
+	// Control messages go first.
+	c.sendToServer(flooder, []byte{'f'}, 1)
+	c.dataToServerCh <- []byte{'k'}
+	if data, control, _ := c.nextToServer(); string(data) != "k" || !control {
+		t.Errorf("nextToServer() = %q, %v, want control message first", data, control)
+	}
+}
+
+func TestUpstreamRemove(t *testing.T) {
+	c := newClient(Config{})
+	gone := newPeer(netip.MustParseAddrPort("1.1.1.1:1"), netip.Addr{})
+	other := newPeer(netip.MustParseAddrPort("2.2.2.2:2"), netip.Addr{})
+
+	c.sendToServer(gone, []byte{'g'}, 1)
+	c.sendToServer(other, []byte{'o'}, 1)
+	c.sendToServer(gone, []byte{'g'}, 1)
+	c.upstream.remove(gone)
+
+	if n := len(gone.upstreamCh); n != 0 {
+		t.Errorf("removed peer has %d frames queued, want 0", n)
+	}
+	if data, _, _ := c.nextToServer(); string(data) != "o" {
+		t.Errorf("nextToServer() = %q, want the frame of the other peer", data)
+	}
+	if data, _, _ := c.nextToServer(); data != nil {
+		t.Errorf("nextToServer() = %q, want nothing after the removed peer", data)
+	}
+
+	// Peer queueing again after removal is scheduled as usual.
+	c.sendToServer(gone, []byte{'g'}, 1)
+	if data, _, _ := c.nextToServer(); string(data) != "g" {
+		t.Errorf("nextToServer() = %q, want the new frame", data)
+	}
+}
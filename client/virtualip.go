@@ -0,0 +1,114 @@
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+)
+
+// DefaultVirtualIPRange is used for local addresses of peers unless Config.VirtualIPRange is
+// set.
+const DefaultVirtualIPRange = "127.0.0.0/8"
+
+// virtualIPRange hands out local IPv4 addresses the game sees remote peers at.
+type virtualIPRange struct {
+	prefix      netip.Prefix
+	first, last uint32
+	next        uint32
+	reserved    map[uint32]bool // addresses of local interfaces and taken ones, never handed out
+}
+
+// newVirtualIPRange validates the range in CIDR notation against addresses of local interfaces,
+// which are skipped, so peers don't collide with them.
+func newVirtualIPRange(cidr string, localAddrs []netip.Addr) (*virtualIPRange, error) {
+	if cidr == "" {
+		cidr = DefaultVirtualIPRange
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if !prefix.Addr().Is4() {
+		return nil, fmt.Errorf("%s isn't an IPv4 range, game supports only IPv4", cidr)
+	}
+	if !prefix.Addr().IsLoopback() {
+		// Peers' sockets are bound to these addresses, so they must belong to this machine
+		// without any network setup.
+		return nil, fmt.Errorf("%s isn't a loopback range, e.g. 127.1.0.0/16", cidr)
+	}
+	prefix = prefix.Masked()
+
+	base := prefix.Addr().As4()
+	first := binary.BigEndian.Uint32(base[:])
+	last := first | uint32(1<<(32-prefix.Bits())-1)
+	if prefix.Bits() < 31 {
+		// Skip network and broadcast addresses.
+		first++
+		last--
+	}
+
+	r := &virtualIPRange{prefix: prefix, first: first, last: last, next: first, reserved: map[uint32]bool{}}
+	for _, addr := range localAddrs {
+		addr = addr.Unmap()
+		if addr.Is4() && prefix.Contains(addr) {
+			ip := addr.As4()
+			r.reserved[binary.BigEndian.Uint32(ip[:])] = true
+		}
+	}
+	if uint64(len(r.reserved)) > uint64(last-first) {
+		return nil, fmt.Errorf("all addresses of %s are used by local interfaces", cidr)
+	}
+	return r, nil
+}
+
+// localInterfaceAddrs returns addresses of local interfaces.
+func localInterfaceAddrs() ([]netip.Addr, error) {
+	ifAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interface addresses: %w", err)
+	}
+	var addrs []netip.Addr
+	for _, a := range ifAddrs {
+		if ipNet, ok := a.(*net.IPNet); ok {
+			if addr, ok := netip.AddrFromSlice(ipNet.IP); ok {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// take reserves ip, e.g. restored from the peer map, so it isn't handed out again. It returns
+// false if ip isn't in the range or is already reserved.
+func (r *virtualIPRange) take(ip ipv4) bool {
+	n := binary.BigEndian.Uint32(ip[:])
+	if n < r.first || n > r.last || r.reserved[n] {
+		return false
+	}
+	r.reserved[n] = true
+	return true
+}
+
+// allocate returns the next free address. When the range is exhausted, addresses are reused
+// from the start of the range.
+func (r *virtualIPRange) allocate() ipv4 {
+	n := r.next
+	// Taken addresses might fill the whole range, so it's scanned at most once.
+	for i := uint64(0); i <= uint64(r.last-r.first); i++ {
+		n = r.next
+		if r.next == r.last {
+			r.next = r.first
+			log.Printf("Virtual IP range %s is exhausted, reusing addresses", r.prefix)
+		} else {
+			r.next++
+		}
+		if !r.reserved[n] {
+			break
+		}
+	}
+	var ip ipv4
+	binary.BigEndian.PutUint32(ip[:], n)
+	return ip
+}
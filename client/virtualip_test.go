@@ -0,0 +1,44 @@
+package client
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestVirtualIPRange(t *testing.T) {
+	lo := []netip.Addr{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("192.168.1.5")}
+	tests := []struct {
+		name    string
+		cidr    string
+		local   []netip.Addr
+		want    []string // allocated addresses in order
+		wantErr bool
+	}{
+		{"default", "", lo, []string{"127.0.0.2", "127.0.0.3"}, false},
+		{"custom", "127.1.0.0/16", lo, []string{"127.1.0.1", "127.1.0.2"}, false},
+		{"unmasked", "127.1.2.3/24", nil, []string{"127.1.2.1", "127.1.2.2"}, false},
+		{"skips local interfaces", "127.2.0.0/29",
+			[]netip.Addr{netip.MustParseAddr("127.2.0.2"), netip.MustParseAddr("::ffff:127.2.0.3")},
+			[]string{"127.2.0.1", "127.2.0.4"}, false},
+		{"wraps around", "127.3.0.0/30", nil, []string{"127.3.0.1", "127.3.0.2", "127.3.0.1"}, false},
+		{"single address", "127.4.0.9/32", nil, []string{"127.4.0.9", "127.4.0.9"}, false},
+		{"all taken", "127.5.0.0/30",
+			[]netip.Addr{netip.MustParseAddr("127.5.0.1"), netip.MustParseAddr("127.5.0.2")}, nil, true},
+		{"not loopback", "10.0.0.0/8", nil, nil, true},
+		{"ipv6", "::1/128", nil, nil, true},
+		{"invalid", "127.0.0.1", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newVirtualIPRange(tt.cidr, tt.local)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newVirtualIPRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for i, want := range tt.want {
+				if got := netip.AddrFrom4(r.allocate()).String(); got != want {
+					t.Errorf("allocate() #%d = %s, want %s", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+// Command protogen writes canonical test vectors of the proxy protocol, so alternative client
+// implementations can check their compatibility. Every datagram is generated for every
+// combination of frame codecs with fixed keys, nonces and padding, which are included in the
+// output.
+//
+// Usage:
+//
+//	go run ./cmd/protogen -o vectors.json
+package main
+
+import (
+	"eiproxy/protocol"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+var outPath = flag.String("o", "", "Output file. Vectors are written to stdout by default")
+
+type direction string
+
+const (
+	clientToServer direction = "client-to-server"
+	serverToClient direction = "server-to-client"
+)
+
+// Vectors is the generated file.
+type Vectors struct {
+	ProtocolVersion string
+	Token           string // session token
+	EncryptionKey   string // session key from ConnectionResponse
+	ObfsNonce       string
+	ObfsPadding     string
+	EncryptionNonce string
+	Notes           []string
+	Datagrams       []Datagram
+	Streams         []Stream
+}
+
+// Datagram is a frame sent over the tunnel with the given codecs applied.
+type Datagram struct {
+	Name         string
+	Description  string
+	Direction    direction
+	Capabilities []protocol.Capability
+	Frame        string // frame before codecs
+	Data         string // datagram on the wire
+}
+
+// Stream is a request starting a TCP stream connection. Codecs don't apply to streams.
+type Stream struct {
+	Name        string
+	Description string
+	Data        string
+}
+
+type message struct {
+	name        string
+	description string
+	direction   direction
+	frame       []byte
+	addrV2      bool // requires CapabilityAddrV2
+}
+
+var (
+	token         = protocol.Token{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	encryptionKey = sequence(0x00, protocol.EncryptionKeySize)
+	obfsNonce     = [4]byte{0xa1, 0xa2, 0xa3, 0xa4}
+	obfsPadding   = []byte{0xb1, 0xb2, 0xb3}
+	sealNonce     = make([]byte, 12) // counter of the first datagram sealed with the key
+
+	peerV4   = netip.MustParseAddrPort("203.0.113.7:8888")
+	peerV6   = netip.MustParseAddrPort("[2001:db8::7]:8888")
+	gameData = []byte("EI game datagram")
+)
+
+func sequence(start byte, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = start + byte(i)
+	}
+	return b
+}
+
+func messages() []message {
+	mustEncode := func(f protocol.AddrFormat, addr netip.AddrPort) []byte {
+		frame, err := f.EncodeAddrData(nil, addr, gameData)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return frame
+	}
+	incoming, err := protocol.EncodeTCPIncoming(protocol.TCPIncoming{StreamID: 7, Port: 8889, Peer: peerV4})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return []message{
+		{"token", "Session token authenticating the tunnel, resent on read timeout",
+			clientToServer, token[:], false},
+		{"keepalive-request", "Keep alive", clientToServer,
+			[]byte{byte(protocol.ProxyClientRequestTypeKeepAlive)}, false},
+		{"disconnect-request", "Graceful disconnect", clientToServer,
+			[]byte{byte(protocol.ProxyClientRequestTypeDisconnect)}, false},
+		{"resume-request", "Re-attach to the session after connection loss", clientToServer,
+			protocol.EncodeResumeRequest(token), false},
+		{"ping-request", "Ping 7 measuring round trip time", clientToServer, protocol.EncodePing(7), true},
+		{"data-v1-ipv4-to-peer", "Game datagram to IPv4 peer", clientToServer,
+			mustEncode(protocol.AddrFormatV1, peerV4), false},
+		{"data-v2-ipv4-to-peer", "Game datagram to IPv4 peer", clientToServer,
+			mustEncode(protocol.AddrFormatV2, peerV4), true},
+		{"data-v2-ipv6-to-peer", "Game datagram to IPv6 peer", clientToServer,
+			mustEncode(protocol.AddrFormatV2, peerV6), true},
+
+		{"keepalive-response", "Keep alive reply, also confirms the token", serverToClient,
+			[]byte{byte(protocol.ProxyServerResponseTypeKeepAlive)}, false},
+		{"disconnect-response", "Session closed by the server", serverToClient,
+			[]byte{byte(protocol.ProxyServerResponseTypeDisconnect)}, false},
+		{"resumed-response", "Session resumed", serverToClient,
+			[]byte{byte(protocol.ProxyServerResponseTypeResumed)}, false},
+		{"session-expired-response", "Session can't be resumed", serverToClient,
+			[]byte{byte(protocol.ProxyServerResponseTypeSessionExpired)}, false},
+		{"pong-response", "Reply to ping 7", serverToClient, protocol.EncodePong(7), true},
+		{"data-v1-ipv4-from-peer", "Game datagram from IPv4 peer", serverToClient,
+			mustEncode(protocol.AddrFormatV1, peerV4), false},
+		{"data-v2-ipv4-from-peer", "Game datagram from IPv4 peer", serverToClient,
+			mustEncode(protocol.AddrFormatV2, peerV4), true},
+		{"data-v2-ipv6-from-peer", "Game datagram from IPv6 peer", serverToClient,
+			mustEncode(protocol.AddrFormatV2, peerV6), true},
+		{"tcp-incoming", "Stream 7 opened by the peer to game port 8889", serverToClient,
+			incoming, true},
+	}
+}
+
+// codecSets lists every combination of frame codecs in the order they are applied.
+func codecSets() [][]protocol.Capability {
+	codecs := []protocol.Capability{
+		protocol.CapabilityChecksum, protocol.CapabilityEncryption, protocol.CapabilityObfuscation,
+	}
+	var sets [][]protocol.Capability
+	for mask := 0; mask < 1<<len(codecs); mask++ {
+		var set []protocol.Capability
+		for i, c := range codecs {
+			if mask&(1<<i) != 0 {
+				set = append(set, c)
+			}
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// encode applies codecs to the frame the same way the client does: checksum is the innermost
+// one and obfuscation is the outermost.
+func encode(frame []byte, dir direction, caps []protocol.Capability) ([]byte, error) {
+	// Fresh ciphers seal the frame with the first counter nonce, see sealNonce.
+	c2s, s2c, err := protocol.NewSessionCiphers(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	cipher := c2s
+	if dir == serverToClient {
+		cipher = s2c
+	}
+
+	data := frame
+	for _, c := range caps {
+		switch c {
+		case protocol.CapabilityChecksum:
+			data = protocol.AppendChecksum(nil, data)
+		case protocol.CapabilityEncryption:
+			data = cipher.Seal(nil, data)
+		case protocol.CapabilityObfuscation:
+			data = protocol.NewObfuscator(token).ObfuscateWith(nil, data, obfsNonce, obfsPadding)
+		}
+	}
+	return data, nil
+}
+
+func generate() (Vectors, error) {
+	v := Vectors{
+		ProtocolVersion: protocol.Version,
+		Token:           hex.EncodeToString(token[:]),
+		EncryptionKey:   hex.EncodeToString(encryptionKey),
+		ObfsNonce:       hex.EncodeToString(obfsNonce[:]),
+		ObfsPadding:     hex.EncodeToString(obfsPadding),
+		EncryptionNonce: hex.EncodeToString(sealNonce),
+		Notes: []string{
+			"Codecs are applied in order: crc (innermost), enc, obfs (outermost).",
+			"Real implementations must use random obfuscation nonces and padding.",
+			"Encryption nonce is a big-endian counter of datagrams sealed with the key, starting at 0.",
+			"Frames marked with addr-v2 are only valid when AddrFormatV2 is negotiated.",
+		},
+	}
+
+	for _, m := range messages() {
+		for _, codecs := range codecSets() {
+			caps := []protocol.Capability{}
+			if m.addrV2 {
+				caps = append(caps, protocol.CapabilityAddrV2)
+			}
+			caps = append(caps, codecs...)
+
+			data, err := encode(m.frame, m.direction, codecs)
+			if err != nil {
+				return v, err
+			}
+			name := m.name
+			if len(codecs) > 0 {
+				name += "+" + strings.ReplaceAll(protocol.FormatCapabilities(codecs), ",", "+")
+			}
+			v.Datagrams = append(v.Datagrams, Datagram{
+				Name:         name,
+				Description:  m.description,
+				Direction:    m.direction,
+				Capabilities: caps,
+				Frame:        hex.EncodeToString(m.frame),
+				Data:         hex.EncodeToString(data),
+			})
+		}
+	}
+
+	openV4, err := protocol.EncodeTCPOpenRequest(token, netip.AddrPortFrom(peerV4.Addr(), 8889))
+	if err != nil {
+		return v, err
+	}
+	openV6, err := protocol.EncodeTCPOpenRequest(token, netip.AddrPortFrom(peerV6.Addr(), 8889))
+	if err != nil {
+		return v, err
+	}
+	v.Streams = []Stream{
+		{"tcp-open-ipv4", "Open stream to port 8889 of IPv4 peer", hex.EncodeToString(openV4)},
+		{"tcp-open-ipv6", "Open stream to port 8889 of IPv6 peer", hex.EncodeToString(openV6)},
+		{"tcp-accept", "Accept stream 7 announced by the server",
+			hex.EncodeToString(protocol.EncodeTCPAcceptRequest(token, 7))},
+		{"tcp-status-ok", "Server reply to a stream request",
+			hex.EncodeToString([]byte{byte(protocol.TCPStreamStatusOK)})},
+	}
+	return v, nil
+}
+
+func main() {
+	flag.Parse()
+
+	v, err := generate()
+	if err != nil {
+		log.Fatalf("Failed to generate vectors: %v", err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	data = append(data, '\n')
+
+	if *outPath == "" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = os.WriteFile(*outPath, data, 0644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"eiproxy/protocol"
+	"encoding/hex"
+	"slices"
+	"testing"
+)
+
+// TestVectorsDecode checks that every generated datagram decodes back to its frame, so
+// the vectors agree with the protocol package.
+func TestVectorsDecode(t *testing.T) {
+	v, err := generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[string]bool)
+	for _, d := range v.Datagrams {
+		if names[d.Name] {
+			t.Errorf("duplicate vector name %q", d.Name)
+		}
+		names[d.Name] = true
+
+		// Every vector is the first datagram of its session, so it needs fresh ciphers.
+		c2s, s2c, err := protocol.NewSessionCiphers(encryptionKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		frame, _ := hex.DecodeString(d.Frame)
+		data, _ := hex.DecodeString(d.Data)
+		cipher := c2s
+		if d.Direction == serverToClient {
+			cipher = s2c
+		}
+		if slices.Contains(d.Capabilities, protocol.CapabilityObfuscation) {
+			data, err = protocol.NewObfuscator(token).Deobfuscate(nil, data)
+			if err != nil {
+				t.Fatalf("%s: %v", d.Name, err)
+			}
+		}
+		if slices.Contains(d.Capabilities, protocol.CapabilityEncryption) {
+			data, err = cipher.Open(nil, data)
+			if err != nil {
+				t.Fatalf("%s: %v", d.Name, err)
+			}
+		}
+		if slices.Contains(d.Capabilities, protocol.CapabilityChecksum) {
+			data, err = protocol.VerifyChecksum(data)
+			if err != nil {
+				t.Fatalf("%s: %v", d.Name, err)
+			}
+		}
+		if !bytes.Equal(data, frame) {
+			t.Errorf("%s: decoded %x, want %x", d.Name, data, frame)
+		}
+	}
+	if want := 17 * 8; len(v.Datagrams) != want {
+		t.Errorf("got %d datagrams, want %d", len(v.Datagrams), want)
+	}
+}
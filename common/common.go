@@ -3,19 +3,110 @@ package common
 import (
 	"bytes"
 	"context"
+	"eiproxy/protocol"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 )
 
+// UserAgent is sent with all API requests, so relay operators can tell which clients are
+// still in use. It must be set at startup, before any request is made.
+var UserAgent = "eiproxy"
+
 type HttpError int
 
 func (e HttpError) Error() string {
 	return http.StatusText(int(e))
 }
 
+// ApiError is an error status with protocol.ErrorResponse sent by the server. It matches both
+// the HttpError of the status and the error code with errors.Is and errors.As.
+type ApiError struct {
+	Status   HttpError
+	Response protocol.ErrorResponse
+}
+
+func (e *ApiError) Error() string {
+	if e.Response.Message != "" {
+		return fmt.Sprintf("%v: %s", e.Response.Code, e.Response.Message)
+	}
+	return e.Response.Code.Error()
+}
+
+func (e *ApiError) Unwrap() []error {
+	return []error{e.Status, e.Response.Code}
+}
+
+// Error bodies larger than this aren't parsed.
+const maxErrorBodySize = 64 * 1024
+
+// apiError returns the error of a response with an error status and the delay requested by the
+// server with Retry-After header or retry_after field.
+func apiError(resp *http.Response) (retryAfter time.Duration, err error) {
+	retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+
+	var body protocol.ErrorResponse
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if json.Unmarshal(data, &body) != nil || body.Code == "" {
+		// Server doesn't send error bodies.
+		return retryAfter, HttpError(resp.StatusCode)
+	}
+	if retryAfter == 0 && body.RetryAfter != nil && *body.RetryAfter > 0 {
+		retryAfter = time.Duration(*body.RetryAfter) * time.Second
+	}
+	return retryAfter, &ApiError{Status: HttpError(resp.StatusCode), Response: body}
+}
+
+// ApiRetry controls retries of API requests failed with a transient error: a connection error,
+// a 5xx status or 429 Too Many Requests. The zero value makes a single attempt.
+type ApiRetry struct {
+	// Attempts including the first one.
+	MaxAttempts int
+	// Delay before the second attempt, doubled for each next one up to MaxDelay. Delays are
+	// jittered, so clients failed together don't retry together. Retry-After of the response
+	// is used instead if present, capped by MaxDelay as well.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultApiRetry rides out a short hiccup without keeping the user waiting.
+var DefaultApiRetry = ApiRetry{MaxAttempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// delay returns the delay before attempt (starting from 2).
+func (r ApiRetry) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if retryAfter > r.MaxDelay {
+			return r.MaxDelay
+		}
+		return retryAfter
+	}
+	delay := r.BaseDelay
+	for i := 2; i < attempt && delay < r.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.MaxDelay {
+		delay = r.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// ApiRequestOptions are optional settings of MakeApiRequestWithOptions.
+type ApiRequestOptions struct {
+	AuthKey string // sent as a bearer token if set
+	Retry   ApiRetry
+	// Hex SHA-256 of the server's public key, see KeyFingerprint. If set, the request requires
+	// HTTPS and the server's certificate is trusted only if it has this key.
+	Fingerprint string
+}
+
 func MakeApiRequest(method, url string, authKey string, params, response any) error {
 	return MakeApiRequestWithContext(context.Background(), method, url, authKey, params, response)
 }
@@ -25,6 +116,70 @@ func MakeApiRequestWithContext(
 	method, url, authKey string,
 	params, response any,
 ) error {
+	return MakeApiRequestWithOptions(ctx, method, url, params, response, ApiRequestOptions{AuthKey: authKey})
+}
+
+// MakeApiRequestWithOptions makes an API request, retrying it according to opts.Retry. All
+// attempts are made within the deadline of ctx, if any.
+func MakeApiRequestWithOptions(
+	ctx context.Context,
+	method, url string,
+	params, response any,
+	opts ApiRequestOptions,
+) error {
+	for attempt := 1; ; attempt++ {
+		retryAfter, err := makeApiRequest(ctx, method, url, params, response, opts)
+		if err == nil || attempt >= opts.Retry.MaxAttempts || !isTransientApiError(ctx, err) {
+			return err
+		}
+
+		timer := time.NewTimer(opts.Retry.delay(attempt+1, retryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// errSendRequest wraps errors of sending the request and receiving the response headers.
+var errSendRequest = errors.New("failed to send request")
+
+func isTransientApiError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var httpErr HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr >= 500 || httpErr == http.StatusTooManyRequests
+	}
+	return errors.Is(err, errSendRequest) && !errors.Is(err, ErrFingerprintMismatch)
+}
+
+// parseRetryAfter returns the delay of Retry-After header, either in seconds or a date, or 0 if
+// it's missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// makeApiRequest makes a single attempt of the request. It returns the delay requested by the
+// server with Retry-After along with an HTTP error.
+func makeApiRequest(
+	ctx context.Context,
+	method, url string,
+	params, response any,
+	opts ApiRequestOptions,
+) (retryAfter time.Duration, err error) {
 	var timeout = 5 * time.Second
 
 	if deadline, ok := ctx.Deadline(); ok && !deadline.IsZero() {
@@ -35,7 +190,7 @@ func MakeApiRequestWithContext(
 	if params != nil {
 		requestData, err := json.Marshal(params)
 		if err != nil {
-			return fmt.Errorf("failed to marshal request: %w", err)
+			return 0, fmt.Errorf("failed to marshal request: %w", err)
 		}
 		reader = bytes.NewReader(requestData)
 	}
@@ -45,33 +200,40 @@ func MakeApiRequestWithContext(
 
 	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	if authKey != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", authKey))
+	if opts.AuthKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", opts.AuthKey))
 	}
 	req.Header.Set("Content-type", "application/json")
+	req.Header.Set("User-Agent", UserAgent)
 
 	hc := http.Client{
 		Timeout: timeout,
 	}
+	if opts.Fingerprint != "" {
+		if req.URL.Scheme != "https" {
+			return 0, fmt.Errorf("server key can only be pinned with https: %w", ErrFingerprintMismatch)
+		}
+		hc.Transport = pinnedTransport(opts.Fingerprint)
+	}
 	resp, err := hc.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return 0, fmt.Errorf("%w: %w", errSendRequest, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return HttpError(resp.StatusCode)
+		return apiError(resp)
 	}
 
 	if response != nil {
 		decoder := json.NewDecoder(resp.Body)
 		if err := decoder.Decode(response); err != nil {
-			return fmt.Errorf("failed to decode response: %w", err)
+			return 0, fmt.Errorf("failed to decode response: %w", err)
 		}
 	}
 
-	return nil
+	return 0, nil
 }
@@ -0,0 +1,224 @@
+package common
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetry = ApiRetry{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func TestMakeApiRequestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int // responses in order, the last one repeats
+		retry        ApiRetry
+		wantAttempts int32
+		wantErr      error
+	}{
+		{name: "success", statuses: []int{200}, retry: testRetry, wantAttempts: 1},
+		{name: "recovers", statuses: []int{503, 502, 200}, retry: testRetry, wantAttempts: 3},
+		{name: "exhausted", statuses: []int{500}, retry: testRetry, wantAttempts: 3,
+			wantErr: HttpError(http.StatusInternalServerError)},
+		{name: "too many requests", statuses: []int{429, 200}, retry: testRetry, wantAttempts: 2},
+		{name: "client error", statuses: []int{401}, retry: testRetry, wantAttempts: 1,
+			wantErr: HttpError(http.StatusUnauthorized)},
+		{name: "no retries", statuses: []int{503}, wantAttempts: 1,
+			wantErr: HttpError(http.StatusServiceUnavailable)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := int(attempts.Add(1)) - 1
+				status := tt.statuses[min(i, len(tt.statuses)-1)]
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					_, _ = w.Write([]byte(`{"ok":true}`))
+				}
+			}))
+			defer srv.Close()
+
+			var response struct{ OK bool }
+			err := MakeApiRequestWithOptions(context.Background(), http.MethodGet, srv.URL, nil,
+				&response, ApiRequestOptions{Retry: tt.retry})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("MakeApiRequestWithOptions() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !response.OK {
+				t.Errorf("response isn't decoded")
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("made %d attempts, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestMakeApiRequestRetriesConnectionErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	start := time.Now()
+	err := MakeApiRequestWithOptions(context.Background(), http.MethodGet, url, nil, nil,
+		ApiRequestOptions{Retry: ApiRetry{MaxAttempts: 2, BaseDelay: 50 * time.Millisecond, MaxDelay: time.Second}})
+	if !errors.Is(err, errSendRequest) {
+		t.Errorf("MakeApiRequestWithOptions() = %v, want %v", err, errSendRequest)
+	}
+	// Jittered delay is at least half of the base one.
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Errorf("request failed in %v, want a retry after a delay", elapsed)
+	}
+}
+
+func TestMakeApiRequestStopsOnContextDone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := MakeApiRequestWithOptions(ctx, http.MethodGet, srv.URL, nil, nil,
+		ApiRequestOptions{Retry: ApiRetry{MaxAttempts: 3, MaxDelay: time.Minute}})
+	if !errors.Is(err, HttpError(http.StatusServiceUnavailable)) {
+		t.Errorf("MakeApiRequestWithOptions() = %v, want %v", err, HttpError(http.StatusServiceUnavailable))
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("request took %v, want it to stop with the context", elapsed)
+	}
+}
+
+func TestMakeApiRequestErrorBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode protocol.ErrorCode // empty if the body isn't an error response
+		wantText string
+	}{
+		{name: "error response", body: `{"code":"key_expired","message":"expired on 2024-01-01"}`,
+			wantCode: protocol.ErrorCodeKeyExpired, wantText: "access key has expired: expired on 2024-01-01"},
+		{name: "no message", body: `{"code":"maintenance"}`,
+			wantCode: protocol.ErrorCodeMaintenance, wantText: "server is under maintenance"},
+		{name: "plain text", body: "Forbidden", wantText: "Forbidden"},
+		{name: "no code", body: `{"message":"foo"}`, wantText: "Forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			err := MakeApiRequest(http.MethodGet, srv.URL, "", nil, nil)
+			if !errors.Is(err, HttpError(http.StatusForbidden)) {
+				t.Errorf("MakeApiRequest() = %v, want %v", err, HttpError(http.StatusForbidden))
+			}
+			var apiErr *ApiError
+			if got := errors.As(err, &apiErr); got != (tt.wantCode != "") {
+				t.Fatalf("errors.As(%v, *ApiError) = %v, want %v", err, got, tt.wantCode != "")
+			}
+			if tt.wantCode != "" && !errors.Is(err, tt.wantCode) {
+				t.Errorf("MakeApiRequest() = %v, want code %v", err, tt.wantCode)
+			}
+			if err.Error() != tt.wantText {
+				t.Errorf("error text = %q, want %q", err.Error(), tt.wantText)
+			}
+		})
+	}
+}
+
+func TestApiErrorRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"code":"rate_limited","retry_after":1}`))
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	err := MakeApiRequestWithOptions(context.Background(), http.MethodGet, srv.URL, nil, nil,
+		ApiRequestOptions{Retry: ApiRetry{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Minute}})
+	if err != nil {
+		t.Fatalf("MakeApiRequestWithOptions() = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want retry_after of 1s", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestApiRetryDelay(t *testing.T) {
+	r := ApiRetry{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for attempt, max := range map[int]time.Duration{2: 100, 3: 200, 4: 300, 10: 300} {
+		max *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if d := r.delay(attempt, 0); d < max/2 || d > max {
+				t.Errorf("delay(%d) = %v, want between %v and %v", attempt, d, max/2, max)
+			}
+		}
+	}
+	if d := r.delay(2, time.Hour); d != r.MaxDelay {
+		t.Errorf("delay with Retry-After = %v, want it capped by %v", d, r.MaxDelay)
+	}
+}
+
+func TestMakeApiRequestFingerprint(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	pin := KeyFingerprint(srv.Certificate())
+
+	tests := []struct {
+		name        string
+		url         string
+		fingerprint string
+		wantErr     error
+	}{
+		{"pinned", srv.URL, pin, nil},
+		{"pinned upper case", srv.URL, strings.ToUpper(pin), nil},
+		{"other key", srv.URL, strings.Repeat("0", len(pin)), ErrFingerprintMismatch},
+		{"plain http", strings.Replace(srv.URL, "https:", "http:", 1), pin, ErrFingerprintMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := MakeApiRequestWithOptions(context.Background(), http.MethodGet, tt.url, nil, nil,
+				ApiRequestOptions{Fingerprint: tt.fingerprint, Retry: testRetry})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("MakeApiRequestWithOptions() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
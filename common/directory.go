@@ -0,0 +1,24 @@
+package common
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ListRelays fetches relays published in the community directory.
+func ListRelays(ctx context.Context, directoryURL string) ([]protocol.RelayInfo, error) {
+	reqURL, err := url.JoinPath(directoryURL, "api/relays")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request url: %w", err)
+	}
+
+	var response protocol.RelayListResponse
+	err = MakeApiRequestWithContext(ctx, http.MethodGet, reqURL, "", nil, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Relays, nil
+}
@@ -0,0 +1,230 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics creates instruments used by client and server code to report telemetry. Labels are
+// given as name, value pairs. Creating an instrument with the same name and labels again
+// returns the same instrument.
+//
+// Embedders can implement it to wire their own telemetry. PrometheusMetrics and NopMetrics
+// are provided.
+type Metrics interface {
+	Counter(name, help string, labels ...string) Counter
+	Gauge(name, help string, labels ...string) Gauge
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+}
+
+type Counter interface {
+	Add(delta float64)
+}
+
+type Gauge interface {
+	Set(value float64)
+	Add(delta float64)
+}
+
+type Histogram interface {
+	Observe(value float64)
+}
+
+// NopMetrics discards everything.
+var NopMetrics Metrics = nopMetrics{}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Counter(string, string, ...string) Counter                { return nopInstrument{} }
+func (nopMetrics) Gauge(string, string, ...string) Gauge                    { return nopInstrument{} }
+func (nopMetrics) Histogram(string, string, []float64, ...string) Histogram { return nopInstrument{} }
+
+type nopInstrument struct{}
+
+func (nopInstrument) Add(float64)     {}
+func (nopInstrument) Set(float64)     {}
+func (nopInstrument) Observe(float64) {}
+
+// PrometheusMetrics keeps metrics in memory and serves them in Prometheus text format without
+// depending on the Prometheus client library.
+type PrometheusMetrics struct {
+	mut      sync.Mutex
+	families []*metricFamily // in registration order
+	byName   map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name    string
+	typ     string
+	help    string
+	buckets []float64
+	series  []*metricSeries
+}
+
+type metricSeries struct {
+	labels string // formatted, e.g. `{peer="1.2.3.4:5678"}`
+
+	mut     sync.Mutex
+	value   float64
+	buckets []float64 // histogram bucket upper bounds, shared with the family
+	counts  []uint64  // histogram bucket counts, not cumulative
+	sum     float64
+	count   uint64
+}
+
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{byName: make(map[string]*metricFamily)}
+}
+
+func (m *PrometheusMetrics) Counter(name, help string, labels ...string) Counter {
+	return (*promCounter)(m.series(name, "counter", help, nil, labels))
+}
+
+func (m *PrometheusMetrics) Gauge(name, help string, labels ...string) Gauge {
+	return (*promGauge)(m.series(name, "gauge", help, nil, labels))
+}
+
+func (m *PrometheusMetrics) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	return (*promHistogram)(m.series(name, "histogram", help, buckets, labels))
+}
+
+func (m *PrometheusMetrics) series(name, typ, help string, buckets []float64, labels []string) *metricSeries {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	f := m.byName[name]
+	if f == nil {
+		buckets = append([]float64(nil), buckets...)
+		sort.Float64s(buckets)
+		f = &metricFamily{name: name, typ: typ, help: help, buckets: buckets}
+		m.byName[name] = f
+		m.families = append(m.families, f)
+	} else if f.typ != typ {
+		panic(fmt.Sprintf("metric %s is already registered as %s", name, f.typ))
+	}
+
+	formatted := formatLabels(labels)
+	for _, s := range f.series {
+		if s.labels == formatted {
+			return s
+		}
+	}
+	s := &metricSeries{labels: formatted, buckets: f.buckets, counts: make([]uint64, len(f.buckets))}
+	f.series = append(f.series, s)
+	return s
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	if len(labels)%2 != 0 {
+		panic("labels must be name, value pairs")
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i < len(labels); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// WriteTo writes all metrics in Prometheus text format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mut.Lock()
+	families := make([]metricFamily, len(m.families))
+	for i, f := range m.families {
+		families[i] = *f
+		families[i].series = append([]*metricSeries(nil), f.series...)
+	}
+	m.mut.Unlock()
+
+	var sb strings.Builder
+	for _, f := range families {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		for _, s := range f.series {
+			s.mut.Lock()
+			if f.typ == "histogram" {
+				writeHistogram(&sb, f, s)
+			} else {
+				fmt.Fprintf(&sb, "%s%s %s\n", f.name, s.labels, formatValue(s.value))
+			}
+			s.mut.Unlock()
+		}
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+func writeHistogram(sb *strings.Builder, f metricFamily, s *metricSeries) {
+	// "le" label goes after the series labels.
+	labels := func(le string) string {
+		if s.labels == "" {
+			return fmt.Sprintf(`{le=%q}`, le)
+		}
+		return fmt.Sprintf(`%s,le=%q}`, strings.TrimSuffix(s.labels, "}"), le)
+	}
+
+	var cumulative uint64
+	for i, bound := range f.buckets {
+		cumulative += s.counts[i]
+		fmt.Fprintf(sb, "%s_bucket%s %d\n", f.name, labels(formatValue(bound)), cumulative)
+	}
+	fmt.Fprintf(sb, "%s_bucket%s %d\n", f.name, labels("+Inf"), s.count)
+	fmt.Fprintf(sb, "%s_sum%s %s\n", f.name, s.labels, formatValue(s.sum))
+	fmt.Fprintf(sb, "%s_count%s %d\n", f.name, s.labels, s.count)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = m.WriteTo(w)
+}
+
+type promCounter metricSeries
+
+func (c *promCounter) Add(delta float64) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.value += delta
+}
+
+type promGauge metricSeries
+
+func (g *promGauge) Set(value float64) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.value = value
+}
+
+func (g *promGauge) Add(delta float64) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.value += delta
+}
+
+type promHistogram metricSeries
+
+func (h *promHistogram) Observe(value float64) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+	h.sum += value
+	h.count++
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+}
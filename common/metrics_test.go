@@ -0,0 +1,52 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.Counter("requests_total", "Requests.").Add(2)
+	m.Counter("requests_total", "Requests.").Add(1)
+	m.Gauge("peers", "Peers.", "relay", "eu").Set(3)
+	m.Gauge("peers", "Peers.", "relay", "us").Add(-1)
+	h := m.Histogram("rtt_seconds", "RTT.", []float64{0.1, 0.05}, "relay", "eu")
+	h.Observe(0.01)
+	h.Observe(0.07)
+	h.Observe(2)
+
+	var sb strings.Builder
+	if _, err := m.WriteTo(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total 3
+# HELP peers Peers.
+# TYPE peers gauge
+peers{relay="eu"} 3
+peers{relay="us"} -1
+# HELP rtt_seconds RTT.
+# TYPE rtt_seconds histogram
+rtt_seconds_bucket{relay="eu",le="0.05"} 1
+rtt_seconds_bucket{relay="eu",le="0.1"} 2
+rtt_seconds_bucket{relay="eu",le="+Inf"} 3
+rtt_seconds_sum{relay="eu"} 2.08
+rtt_seconds_count{relay="eu"} 3
+`
+	if got := sb.String(); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrometheusMetrics_TypeMismatch(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.Counter("x", "X.")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	m.Gauge("x", "X.")
+}
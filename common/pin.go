@@ -0,0 +1,46 @@
+package common
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var ErrFingerprintMismatch = errors.New("server key doesn't match pinned fingerprint")
+
+// KeyFingerprint returns hex SHA-256 of the public key of cert. Unlike the fingerprint of the
+// whole certificate, it stays the same when the certificate is renewed with the same key.
+func KeyFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+// Transports are kept per fingerprint, so pinned requests reuse connections too.
+var pinnedTransports sync.Map // fingerprint -> *http.Transport
+
+// pinnedTransport returns transport which requires the key of the server certificate to match
+// fingerprint. The pin replaces verification by certificate authorities, so self-hosted relays
+// may use self-signed certificates.
+func pinnedTransport(fingerprint string) *http.Transport {
+	if t, ok := pinnedTransports.Load(fingerprint); ok {
+		return t.(*http.Transport)
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: true, // replaced by VerifyConnection
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 ||
+				!strings.EqualFold(KeyFingerprint(cs.PeerCertificates[0]), fingerprint) {
+				return ErrFingerprintMismatch
+			}
+			return nil
+		},
+	}
+	actual, _ := pinnedTransports.LoadOrStore(fingerprint, t)
+	return actual.(*http.Transport)
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"fmt"
+	"os"
+)
+
+// SetupWarnings checks that the app runs with least privileges from a directory it can write
+// config and logs to. It returns human readable warnings with suggestions how to fix the setup.
+func SetupWarnings(dir string) []string {
+	return setupWarnings(dir, IsElevated())
+}
+
+func setupWarnings(dir string, elevated bool) []string {
+	var warnings []string
+	if elevated {
+		warnings = append(warnings, "EI Proxy is running with administrator rights, but it doesn't "+
+			"need them. Please run it as a regular user, otherwise config and log files it creates "+
+			"might become read-only for you later.")
+	}
+	if err := CheckWritable(dir); err != nil {
+		warnings = append(warnings, fmt.Sprintf("Can't write to %s: %v. Config and log files are "+
+			"kept next to the executable, so please move EI Proxy to a folder you own "+
+			"(e.g. Documents) instead of Program Files.", dir, err))
+	}
+	return warnings
+}
+
+// CheckWritable checks that a file can be created in dir.
+func CheckWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".eiproxy-write-check-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
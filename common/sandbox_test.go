@@ -0,0 +1,58 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetupWarnings(t *testing.T) {
+	writable := t.TempDir()
+
+	// Creating files under a regular file fails even for root.
+	notDir := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		dir      string
+		elevated bool
+		want     []string
+	}{
+		{"ok", writable, false, nil},
+		{"elevated", writable, true, []string{"administrator rights"}},
+		{"not writable", notDir, false, []string{"Can't write to"}},
+		{"elevated and not writable", notDir, true, []string{"administrator rights", "Can't write to"}},
+		{"missing dir", filepath.Join(writable, "missing"), false, []string{"Can't write to"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := setupWarnings(tt.dir, tt.elevated)
+			if len(got) != len(tt.want) {
+				t.Fatalf("setupWarnings() = %q, want %d warnings", got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(got[i], want) {
+					t.Errorf("setupWarnings()[%d] = %q, want it to contain %q", i, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckWritable(dir); err != nil {
+		t.Fatalf("CheckWritable() error = %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("CheckWritable() left %d files behind", len(entries))
+	}
+}
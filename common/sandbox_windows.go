@@ -0,0 +1,14 @@
+package common
+
+import "syscall"
+
+var procIsUserAnAdmin = syscall.NewLazyDLL("shell32.dll").NewProc("IsUserAnAdmin")
+
+// IsElevated reports whether the process runs with administrator rights.
+func IsElevated() bool {
+	if procIsUserAnAdmin.Find() != nil {
+		return false
+	}
+	r, _, _ := procIsUserAnAdmin.Call()
+	return r != 0
+}
@@ -0,0 +1,22 @@
+package common
+
+import (
+	"context"
+	"eiproxy/protocol"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GetServerStatus fetches public status of the relay. Fingerprint pins the relay's key if set,
+// see ApiRequestOptions.
+func GetServerStatus(ctx context.Context, serverURL, fingerprint string) (protocol.ServerStatusResponse, error) {
+	var response protocol.ServerStatusResponse
+	reqURL, err := url.JoinPath(serverURL, "api/status")
+	if err != nil {
+		return response, fmt.Errorf("failed to build request url: %w", err)
+	}
+	err = MakeApiRequestWithOptions(ctx, http.MethodGet, reqURL, nil, &response,
+		ApiRequestOptions{Fingerprint: fingerprint})
+	return response, err
+}
@@ -0,0 +1,34 @@
+package common
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// WatchFile calls onChange whenever modification time or size of the file at path changes,
+// checking it every interval until ctx is done. The file is polled rather than watched with
+// OS notifications, as editors often replace the file instead of writing to it.
+func WatchFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last, _ := os.Stat(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// The file might be in the middle of being replaced, check again later.
+			continue
+		}
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+			onChange()
+		}
+	}
+}
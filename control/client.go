@@ -0,0 +1,44 @@
+package control
+
+import (
+	"context"
+	"eiproxy/common"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Client calls the control API of a running instance, e.g. for the status command.
+type Client struct {
+	Addr  string // host:port the API listens on
+	Token string
+}
+
+func (c Client) Status(ctx context.Context) (StatusResponse, error) {
+	var resp StatusResponse
+	err := c.get(ctx, "api/status", &resp)
+	return resp, err
+}
+
+func (c Client) Stats(ctx context.Context) (StatsResponse, error) {
+	var resp StatsResponse
+	err := c.get(ctx, "api/stats", &resp)
+	return resp, err
+}
+
+// Simulate runs players synthetic players against the running session for duration.
+func (c Client) Simulate(ctx context.Context, players int, duration time.Duration) (SimulationResponse, error) {
+	var resp SimulationResponse
+	path := fmt.Sprintf("api/simulate?players=%d&seconds=%d", players, int(duration.Seconds()))
+	err := c.request(ctx, http.MethodPost, path, &resp)
+	return resp, err
+}
+
+func (c Client) get(ctx context.Context, path string, response any) error {
+	return c.request(ctx, http.MethodGet, path, response)
+}
+
+func (c Client) request(ctx context.Context, method, path string, response any) error {
+	url := "http://" + c.Addr + "/" + path
+	return common.MakeApiRequestWithContext(ctx, method, url, c.Token, nil, response)
+}
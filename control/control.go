@@ -0,0 +1,481 @@
+// Package control implements an HTTP API to control the client remotely, e.g. by a tournament
+// bot hosting matches on several eiproxy instances.
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"eiproxy/client"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Address to serve the API on, e.g. "127.0.0.1:8090". API is disabled if empty.
+	Addr string `json:",omitempty"`
+	// Bearer token required in the Authorization header. Required unless Addr is loopback,
+	// where requests without it are only accepted from local clients other than browsers.
+	Token string `json:",omitempty"`
+	// Restart the session this many seconds after it stopped by itself, e.g. when retries
+	// were exhausted. Disabled if zero.
+	RestartDelay int `json:",omitempty"`
+}
+
+var (
+	ErrSessionRunning    = errors.New("session is already running")
+	ErrSessionNotRunning = errors.New("session is not running")
+	ErrReloadUnsupported = errors.New("config reload is not supported")
+)
+
+// ReloadFunc reads the config again and returns it along with the client factory for new
+// sessions.
+type ReloadFunc func() (cfg client.Config, newClient func() client.Client, err error)
+
+// Server owns the client session and serves the API.
+type Server struct {
+	cfg    Config
+	events eventHub
+
+	mut        sync.Mutex
+	newClient  func() client.Client
+	reload     ReloadFunc
+	session    *session
+	restart    *time.Timer // pending restart of the stopped session
+	restarts   int
+	gameStatus func() *ProcessResponse
+}
+
+type session struct {
+	client      client.Client
+	cancel      context.CancelFunc
+	done        chan struct{}
+	started     time.Time
+	state       client.State
+	peers       map[string]client.Event
+	unsubscribe func()
+}
+
+func NewServer(cfg Config, newClient func() client.Client) *Server {
+	return &Server{cfg: cfg, newClient: newClient}
+}
+
+// SetGameStatus reports the status of the game server launched along with the client.
+func (s *Server) SetGameStatus(status func() *ProcessResponse) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.gameStatus = status
+}
+
+// SetReload enables config reload via the API.
+func (s *Server) SetReload(reload ReloadFunc) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.reload = reload
+}
+
+// Reload reads the config again. The new config is applied to the running session if the
+// client supports it (see client.Reconfigurer), otherwise the session is restarted. API
+// settings themselves are not reloaded.
+func (s *Server) Reload() error {
+	s.mut.Lock()
+	reload := s.reload
+	s.mut.Unlock()
+	if reload == nil {
+		return ErrReloadUnsupported
+	}
+
+	cfg, newClient, err := reload()
+	if err != nil {
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+	s.mut.Lock()
+	s.newClient = newClient
+	s.mut.Unlock()
+	log.Printf("Control API: config reloaded")
+
+	if sess := s.currentSession(); sess != nil {
+		if r, ok := sess.client.(client.Reconfigurer); ok && r.Reconfigure(cfg) {
+			return nil
+		}
+	}
+
+	if err := s.StopSession(); errors.Is(err, ErrSessionNotRunning) {
+		return nil
+	}
+	return s.StartSession()
+}
+
+// Run serves the API until ctx is done. Running session is stopped on return.
+func (s *Server) Run(ctx context.Context) error {
+	if s.cfg.Token == "" && !isLoopback(s.cfg.Addr) {
+		return fmt.Errorf("control: token is required to listen on %s", s.cfg.Addr)
+	}
+
+	srv := &http.Server{Addr: s.cfg.Addr, Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+		s.events.close()
+	}()
+	defer s.StopSession()
+
+	log.Printf("Control API: listening on %s", s.cfg.Addr)
+	err := srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/session/start", s.handleStart)
+	mux.HandleFunc("/api/session/stop", s.handleStop)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	mux.HandleFunc("/api/droplog", s.handleDropLog)
+	mux.HandleFunc("/api/stats", s.handleStats)
+	mux.HandleFunc("/api/peers", s.handlePeers)
+	mux.HandleFunc("/api/config/reload", s.handleReload)
+	mux.HandleFunc("/api/simulate", s.handleSimulate)
+	return s.authorize(mux)
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.Token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		} else if !isLoopbackHost(r.Host) || r.Header.Get("Origin") != "" {
+			// Without the token any web page could reach the API through the browser: cross-site
+			// requests carry Origin and DNS rebinding pages have their own Host.
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// StartSession starts a new client session in background.
+func (s *Server) StartSession() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.session != nil {
+		return ErrSessionRunning
+	}
+	s.cancelRestart()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sess := &session{
+		client:  s.newClient(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		started: time.Now(),
+		peers:   make(map[string]client.Event),
+	}
+	sess.unsubscribe = sess.client.Subscribe(func(e client.Event) {
+		s.mut.Lock()
+		switch e.Type {
+		case client.EventStateChanged:
+			sess.state = e.State
+		case client.EventPeerConnected:
+			sess.peers[e.Peer.String()] = e
+		case client.EventPeerDisconnected:
+			delete(sess.peers, e.Peer.String())
+		}
+		s.mut.Unlock()
+		s.events.publish(newEventResponse(e))
+	})
+	s.session = sess
+
+	go func() {
+		defer close(sess.done)
+		status, err := sess.client.Run(ctx)
+		log.Printf("Control API: session stopped: %v: %v", status, err)
+
+		sess.unsubscribe()
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		if s.session == sess {
+			s.session = nil
+		}
+		if ctx.Err() == nil && s.cfg.RestartDelay > 0 {
+			s.scheduleRestart(time.Duration(s.cfg.RestartDelay) * time.Second)
+		}
+	}()
+	return nil
+}
+
+// scheduleRestart starts the session again after delay unless it's stopped or started before.
+// It must be called with s.mut locked.
+func (s *Server) scheduleRestart(delay time.Duration) {
+	log.Printf("Control API: restarting session in %v", delay)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		s.mut.Lock()
+		if s.restart != timer {
+			s.mut.Unlock()
+			return
+		}
+		s.restart = nil
+		s.restarts++
+		s.mut.Unlock()
+
+		if err := s.StartSession(); err != nil && !errors.Is(err, ErrSessionRunning) {
+			log.Printf("Control API: failed to restart session: %v", err)
+		}
+	})
+	s.restart = timer
+}
+
+// cancelRestart must be called with s.mut locked.
+func (s *Server) cancelRestart() {
+	if s.restart != nil {
+		s.restart.Stop()
+		s.restart = nil
+	}
+}
+
+// StopSession stops running session and waits until it's done.
+func (s *Server) StopSession() error {
+	s.mut.Lock()
+	sess := s.session
+	s.cancelRestart()
+	s.mut.Unlock()
+	if sess == nil {
+		return ErrSessionNotRunning
+	}
+
+	sess.cancel()
+	<-sess.done
+	return nil
+}
+
+func (s *Server) Status() StatusResponse {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	resp := StatusResponse{State: client.StateStopped.String(), Restarts: s.restarts}
+	if s.gameStatus != nil {
+		resp.Game = s.gameStatus()
+	}
+	if s.session == nil {
+		return resp
+	}
+
+	resp.State = s.session.state.String()
+	resp.StartedAt = s.session.started
+	if addr := s.session.client.GetProxyAddr(0); addr.IsValid() {
+		resp.ProxyAddr = addr.String()
+	}
+	stats := s.session.client.Stats()
+	resp.CorruptedFrames = stats.Corrupted
+	resp.CorruptionRate = stats.CorruptionRate()
+	resp.RTTMillis = stats.RTT.Milliseconds()
+	resp.PacketLoss = stats.PacketLoss
+	for _, e := range s.session.peers {
+		resp.Peers = append(resp.Peers, PeerResponse{
+			Addr:    e.Peer.String(),
+			Name:    e.PeerName,
+			LocalIP: e.LocalIP.String(),
+		})
+	}
+	return resp
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.Status())
+}
+
+func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.StartSession(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, s.Status())
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.StopSession(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, s.Status())
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var stats client.Stats
+	if sess := s.currentSession(); sess != nil {
+		stats = sess.client.Stats()
+	}
+	writeJSON(w, newStatsResponse(stats))
+}
+
+func (s *Server) handlePeers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	peers := []PeerStatsResponse{}
+	if sess := s.currentSession(); sess != nil {
+		for _, p := range sess.client.Peers() {
+			peers = append(peers, newPeerStatsResponse(p))
+		}
+	}
+	writeJSON(w, peers)
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.Reload(); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, ErrReloadUnsupported) {
+			code = http.StatusNotImplemented
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	writeJSON(w, s.Status())
+}
+
+// Limits of player simulation requested via the API.
+const (
+	defaultSimulatedPlayers = 3
+	maxSimulatedPlayers     = 16
+	defaultSimulationTime   = 10 * time.Second
+	maxSimulationTime       = time.Minute
+)
+
+// Simulate runs synthetic players against the running session, see client.SimulatePlayers.
+func (s *Server) Simulate(ctx context.Context, players int, duration time.Duration) (SimulationResponse, error) {
+	sess := s.currentSession()
+	if sess == nil {
+		return SimulationResponse{}, ErrSessionNotRunning
+	}
+	result, err := client.SimulatePlayers(ctx, sess.client, players, duration)
+	log.Printf("Control API: player simulation: %v", result)
+	return SimulationResponse(result), err
+}
+
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	players, duration := defaultSimulatedPlayers, defaultSimulationTime
+	if v := r.URL.Query().Get("players"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSimulatedPlayers {
+			http.Error(w, fmt.Sprintf("players must be 1..%d", maxSimulatedPlayers), http.StatusBadRequest)
+			return
+		}
+		players = n
+	}
+	if v := r.URL.Query().Get("seconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || time.Duration(n)*time.Second > maxSimulationTime {
+			http.Error(w, fmt.Sprintf("seconds must be 1..%d", int(maxSimulationTime.Seconds())),
+				http.StatusBadRequest)
+			return
+		}
+		duration = time.Duration(n) * time.Second
+	}
+
+	resp, err := s.Simulate(r.Context(), players, duration)
+	if errors.Is(err, ErrSessionNotRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) currentSession() *session {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.session
+}
+
+func (s *Server) handleDropLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	records := []DropRecordResponse{}
+	if sess := s.currentSession(); sess != nil {
+		for _, d := range sess.client.DropLog() {
+			records = append(records, DropRecordResponse{
+				Time:      d.Time,
+				Direction: string(d.Direction),
+				Peer:      d.Peer.String(),
+				Size:      d.Size,
+				Reason:    string(d.Reason),
+			})
+		}
+	}
+	writeJSON(w, records)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Control API: failed to write response: %v", err)
+	}
+}
+
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	return isLoopbackHost(host)
+}
+
+// isLoopbackHost reports whether host, with optional port, e.g. of the Host header, is local.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,453 @@
+package control
+
+import (
+	"bufio"
+	"context"
+	"eiproxy/client"
+	"eiproxy/protocol"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClient connects immediately and reports a single peer.
+type fakeClient struct {
+	mut      sync.Mutex
+	handlers []client.EventHandler
+}
+
+func (c *fakeClient) emit(e client.Event) {
+	c.mut.Lock()
+	handlers := c.handlers
+	c.mut.Unlock()
+	for _, h := range handlers {
+		h(e)
+	}
+}
+
+func (c *fakeClient) Run(ctx context.Context) (client.ExitStatus, error) {
+	c.emit(client.Event{Type: client.EventStateChanged, State: client.StateConnected})
+	c.emit(client.Event{Type: client.EventPeerConnected, Peer: netip.MustParseAddrPort("1.2.3.4:5678")})
+	<-ctx.Done()
+	c.emit(client.Event{Type: client.EventStateChanged, State: client.StateStopped})
+	return client.ExitStatus{Reason: client.ExitUserStopped}, nil
+}
+
+func (c *fakeClient) Start() error {
+	return nil
+}
+
+func (c *fakeClient) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (c *fakeClient) Wait() (client.ExitStatus, error) {
+	return client.ExitStatus{Reason: client.ExitUserStopped}, nil
+}
+
+func (c *fakeClient) ProxyAddr(ctx context.Context) (netip.AddrPort, error) {
+	return netip.MustParseAddrPort("10.0.0.1:20000"), nil
+}
+
+func (c *fakeClient) GetProxyAddr(timeout time.Duration) netip.AddrPort {
+	return netip.MustParseAddrPort("10.0.0.1:20000")
+}
+
+func (c *fakeClient) GetUser(ctx context.Context) (protocol.UserResponse, error) {
+	return protocol.UserResponse{}, nil
+}
+
+func (c *fakeClient) Subscribe(handler client.EventHandler) func() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.handlers = append(c.handlers, handler)
+	return func() {}
+}
+
+func (c *fakeClient) State() client.State          { return client.StateConnected }
+func (c *fakeClient) Stats() client.Stats          { return client.Stats{} }
+func (c *fakeClient) Peers() []client.PeerStats    { return nil }
+func (c *fakeClient) DropLog() []client.DropRecord { return nil }
+
+func TestServer(t *testing.T) {
+	s := NewServer(Config{Token: "secret"}, func() client.Client { return &fakeClient{} })
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	request := func(method, path, token string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := request(http.MethodGet, "/api/status", "wrong")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status with wrong token = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	events := request(http.MethodGet, "/api/events", "secret")
+	defer events.Body.Close()
+
+	resp = request(http.MethodPost, "/api/session/start", "secret")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("start = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// Wait for peer join event.
+	scanner := bufio.NewScanner(events.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e EventResponse
+		if err := json.Unmarshal([]byte(data), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Type == client.EventPeerConnected.String() {
+			if e.Peer != "1.2.3.4:5678" {
+				t.Errorf("peer = %q, want %q", e.Peer, "1.2.3.4:5678")
+			}
+			break
+		}
+	}
+
+	resp = request(http.MethodGet, "/api/status", "secret")
+	var status StatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if status.State != "connected" || status.ProxyAddr != "10.0.0.1:20000" || len(status.Peers) != 1 {
+		t.Errorf("status = %+v", status)
+	}
+
+	resp = request(http.MethodPost, "/api/session/start", "secret")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("second start = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+
+	resp = request(http.MethodPost, "/api/session/stop", "secret")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stop = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if got := s.Status().State; got != "stopped" {
+		t.Errorf("state after stop = %q, want %q", got, "stopped")
+	}
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	s := NewServer(Config{Addr: "0.0.0.0:0"}, func() client.Client { return &fakeClient{} })
+	if err := s.Run(context.Background()); err == nil {
+		t.Errorf("Run() without token on public address error = nil")
+	}
+}
+
+func TestServerRejectsBrowsersWithoutToken(t *testing.T) {
+	s := NewServer(Config{}, func() client.Client { return &fakeClient{} })
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		want   int
+	}{
+		{"local client", "", "", http.StatusOK},
+		{"localhost", "localhost:8090", "", http.StatusOK},
+		{"cross-site request", "", "https://example.com", http.StatusForbidden},
+		{"DNS rebinding", "example.com:8090", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/status", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+// failingClient stops right after start, as if retries were exhausted.
+type failingClient struct {
+	fakeClient
+}
+
+func (c *failingClient) Run(ctx context.Context) (client.ExitStatus, error) {
+	return client.ExitStatus{Reason: client.ExitNetworkLost}, errors.New("network is down")
+}
+
+func TestServerRestartsSession(t *testing.T) {
+	var mut sync.Mutex
+	started := 0
+	s := NewServer(Config{RestartDelay: 1}, func() client.Client {
+		mut.Lock()
+		defer mut.Unlock()
+		started++
+		return &failingClient{}
+	})
+	if err := s.StartSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Status().Restarts == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if s.Status().Restarts == 0 {
+		t.Fatalf("session wasn't restarted")
+	}
+
+	// Explicit stop cancels pending restart.
+	_ = s.StopSession()
+	mut.Lock()
+	startedBefore := started
+	mut.Unlock()
+	time.Sleep(1500 * time.Millisecond)
+	mut.Lock()
+	defer mut.Unlock()
+	if started != startedBefore {
+		t.Errorf("session was restarted after stop")
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	var mut sync.Mutex
+	var created []string
+	factory := func(name string) func() client.Client {
+		return func() client.Client {
+			mut.Lock()
+			defer mut.Unlock()
+			created = append(created, name)
+			return &fakeClient{}
+		}
+	}
+	s := NewServer(Config{}, factory("old"))
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/config/reload", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("reload without loader = %d, want %d", resp.StatusCode, http.StatusNotImplemented)
+	}
+
+	if err := s.StartSession(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.StopSession()
+
+	s.SetReload(func() (client.Config, func() client.Client, error) {
+		return client.Config{}, nil, errors.New("bad config")
+	})
+	if err := s.Reload(); err == nil {
+		t.Errorf("Reload() with bad config error = nil")
+	}
+
+	s.SetReload(func() (client.Config, func() client.Client, error) {
+		return client.Config{}, factory("new"), nil
+	})
+	resp, err = http.Post(ts.URL+"/api/config/reload", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reload = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// Running session is restarted with the new config.
+	mut.Lock()
+	defer mut.Unlock()
+	if want := []string{"old", "new"}; !slices.Equal(created, want) {
+		t.Errorf("created clients = %v, want %v", created, want)
+	}
+}
+
+// reconfigurableClient applies configs with WaitForSlot changed only.
+type reconfigurableClient struct {
+	fakeClient
+	applied []client.Config
+}
+
+func (c *reconfigurableClient) Reconfigure(cfg client.Config) bool {
+	if cfg.Encrypt {
+		return false
+	}
+	c.applied = append(c.applied, cfg)
+	return true
+}
+
+func TestServerReloadReconfigures(t *testing.T) {
+	var created int
+	s := NewServer(Config{}, func() client.Client { created++; return &reconfigurableClient{} })
+	if err := s.StartSession(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.StopSession()
+	running := s.currentSession().client.(*reconfigurableClient)
+
+	cfg := client.Config{WaitForSlot: true}
+	s.SetReload(func() (client.Config, func() client.Client, error) { return cfg, s.newClient, nil })
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 || len(running.applied) != 1 {
+		t.Errorf("after live reload: created %d clients, applied %d configs, want 1, 1",
+			created, len(running.applied))
+	}
+
+	cfg.Encrypt = true
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if created != 2 {
+		t.Errorf("after reload requiring restart: created %d clients, want 2", created)
+	}
+}
+
+func TestServerStats(t *testing.T) {
+	s := NewServer(Config{}, func() client.Client { return &fakeClient{} })
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for _, path := range []string{"/api/stats", "/api/peers"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := new(strings.Builder)
+		_, _ = io.Copy(body, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !json.Valid([]byte(body.String())) {
+			t.Errorf("%s = %d %q", path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestServerRejectsWrongMethod(t *testing.T) {
+	s := NewServer(Config{}, func() client.Client { return &fakeClient{} })
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		method, path string
+	}{
+		{http.MethodPost, "/api/status"},
+		{http.MethodGet, "/api/session/start"},
+		{http.MethodGet, "/api/session/stop"},
+		{http.MethodPost, "/api/events"},
+		{http.MethodPost, "/api/droplog"},
+		{http.MethodPost, "/api/stats"},
+		{http.MethodPost, "/api/peers"},
+		{http.MethodDelete, "/api/peers"},
+		{http.MethodGet, "/api/config/reload"},
+		{http.MethodGet, "/api/simulate"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	s := NewServer(Config{Token: "secret"}, func() client.Client { return &fakeClient{} })
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	if err := s.StartSession(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.StopSession()
+
+	ctx := context.Background()
+	addr := ts.Listener.Addr().String()
+	if _, err := (Client{Addr: addr, Token: "wrong"}).Status(ctx); err == nil {
+		t.Errorf("Status() with wrong token error = nil")
+	}
+
+	c := Client{Addr: addr, Token: "secret"}
+	status, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.StartedAt.IsZero() {
+		t.Errorf("status = %+v, want StartedAt set", status)
+	}
+	if _, err := c.Stats(ctx); err != nil {
+		t.Errorf("Stats() error = %v", err)
+	}
+}
+
+func TestServerSimulate(t *testing.T) {
+	s := NewServer(Config{}, func() client.Client { return &fakeClient{} })
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", http.StatusConflict}, // session isn't running
+		{"?players=0", http.StatusBadRequest},
+		{"?players=100", http.StatusBadRequest},
+		{"?seconds=3600", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(ts.URL+"/api/simulate"+tt.query, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("simulate%s = %d, want %d", tt.query, resp.StatusCode, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const eventBufferSize = 100
+
+// eventHub fans out events to API subscribers. Slow subscribers lose events instead of
+// blocking the client.
+type eventHub struct {
+	mut    sync.Mutex
+	subs   map[chan EventResponse]struct{}
+	closed bool
+}
+
+func (h *eventHub) subscribe() (chan EventResponse, bool) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	if h.closed {
+		return nil, false
+	}
+	if h.subs == nil {
+		h.subs = make(map[chan EventResponse]struct{})
+	}
+	ch := make(chan EventResponse, eventBufferSize)
+	h.subs[ch] = struct{}{}
+	return ch, true
+}
+
+func (h *eventHub) unsubscribe(ch chan EventResponse) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+func (h *eventHub) publish(e EventResponse) {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+func (h *eventHub) close() {
+	h.mut.Lock()
+	defer h.mut.Unlock()
+
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// handleEvents streams events as Server-Sent Events until the client disconnects.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, ok := s.events.subscribe()
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	defer s.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			if _, err = fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package control
+
+import (
+	"eiproxy/client"
+	"time"
+)
+
+type StatusResponse struct {
+	State     string         `json:"state"`
+	ProxyAddr string         `json:"proxy_addr,omitempty"`
+	Peers     []PeerResponse `json:"peers,omitempty"`
+	// Time the running session was started.
+	StartedAt time.Time `json:"started_at,omitempty"`
+
+	// Frames from the relay dropped because of checksum mismatch, and their share of all
+	// received frames.
+	CorruptedFrames uint64  `json:"corrupted_frames,omitempty"`
+	CorruptionRate  float64 `json:"corruption_rate,omitempty"`
+
+	// Round trip time to the relay and share of pings lost, if the relay answers pings.
+	RTTMillis  int64   `json:"rtt_ms,omitempty"`
+	PacketLoss float64 `json:"packet_loss,omitempty"`
+
+	// Times the session was restarted after it stopped by itself.
+	Restarts int `json:"restarts,omitempty"`
+	// Game server launched along with the client in host mode.
+	Game *ProcessResponse `json:"game,omitempty"`
+}
+
+type StatsResponse struct {
+	BytesSent       uint64 `json:"bytes_sent"`
+	BytesReceived   uint64 `json:"bytes_received"`
+	PacketsSent     uint64 `json:"packets_sent"`
+	PacketsReceived uint64 `json:"packets_received"`
+	Dropped         uint64 `json:"dropped"`
+	// Dropped because the channel to the relay or from it to a player was full.
+	DroppedToServer   uint64 `json:"dropped_to_server"`
+	DroppedFromServer uint64 `json:"dropped_from_server"`
+	Corrupted         uint64 `json:"corrupted"`
+	Malformed         uint64 `json:"malformed"`
+	Reconnects        uint64 `json:"reconnects"`
+
+	KeepAliveRTTMillis int64   `json:"keepalive_rtt_ms"`
+	RTTMillis          int64   `json:"rtt_ms"`
+	PacketLoss         float64 `json:"packet_loss"`
+	ActivePeers        int     `json:"active_peers"`
+
+	// Game data relayed in bytes per second and packets dropped by the rate limit.
+	UploadRate   float64 `json:"upload_rate"`
+	DownloadRate float64 `json:"download_rate"`
+	RateLimited  uint64  `json:"rate_limited"`
+}
+
+type PeerStatsResponse struct {
+	Addr       string    `json:"addr"`
+	Name       string    `json:"name,omitempty"`
+	LocalIP    string    `json:"local_ip,omitempty"`
+	LastActive time.Time `json:"last_active,omitempty"`
+
+	BytesSent       uint64  `json:"bytes_sent"`
+	BytesReceived   uint64  `json:"bytes_received"`
+	PacketsSent     uint64  `json:"packets_sent"`
+	PacketsReceived uint64  `json:"packets_received"`
+	Dropped         uint64  `json:"dropped"`
+	SendRate        float64 `json:"send_rate"`    // bytes per second
+	ReceiveRate     float64 `json:"receive_rate"` // bytes per second
+}
+
+type SimulationResponse struct {
+	Players int `json:"players"`
+	Joined  int `json:"joined"`
+	Sent    int `json:"sent"`
+	Replies int `json:"replies"`
+}
+
+type ProcessResponse struct {
+	Running  bool   `json:"running"`
+	PID      int    `json:"pid,omitempty"`
+	Restarts int    `json:"restarts,omitempty"`
+	LastExit string `json:"last_exit,omitempty"`
+}
+
+type PeerResponse struct {
+	Addr    string `json:"addr"`
+	Name    string `json:"name,omitempty"`
+	LocalIP string `json:"local_ip,omitempty"`
+}
+
+type EventResponse struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	State    string    `json:"state,omitempty"`
+	Peer     string    `json:"peer,omitempty"`
+	PeerName string    `json:"peer_name,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	// Set for maintenance events, which have no start if the maintenance is cancelled.
+	MaintenanceStart   *time.Time `json:"maintenance_start,omitempty"`
+	MaintenanceSeconds int        `json:"maintenance_seconds,omitempty"`
+	// Set for session summary events.
+	Summary *SessionSummaryResponse `json:"summary,omitempty"`
+}
+
+type SessionSummaryResponse struct {
+	Seconds      int    `json:"seconds"`
+	PeakPeers    int    `json:"peak_peers"`
+	BytesRelayed uint64 `json:"bytes_relayed"`
+}
+
+type DropRecordResponse struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Peer      string    `json:"peer,omitempty"`
+	Size      int       `json:"size"`
+	Reason    string    `json:"reason"`
+}
+
+func newStatsResponse(s client.Stats) StatsResponse {
+	return StatsResponse{
+		BytesSent:          s.BytesSent,
+		BytesReceived:      s.BytesReceived,
+		PacketsSent:        s.PacketsSent,
+		PacketsReceived:    s.PacketsReceived,
+		Dropped:            s.Dropped,
+		DroppedToServer:    s.DroppedToServer,
+		DroppedFromServer:  s.DroppedFromServer,
+		Corrupted:          s.Corrupted,
+		Malformed:          s.Malformed,
+		Reconnects:         s.Reconnects,
+		KeepAliveRTTMillis: s.KeepAliveRTT.Milliseconds(),
+		RTTMillis:          s.RTT.Milliseconds(),
+		PacketLoss:         s.PacketLoss,
+		ActivePeers:        s.ActivePeers,
+		UploadRate:         s.UploadRate,
+		DownloadRate:       s.DownloadRate,
+		RateLimited:        s.RateLimited,
+	}
+}
+
+func newPeerStatsResponse(p client.PeerStats) PeerStatsResponse {
+	return PeerStatsResponse{
+		Addr:            p.Addr.String(),
+		Name:            p.Name,
+		LocalIP:         p.LocalIP.String(),
+		LastActive:      p.LastActive,
+		BytesSent:       p.BytesSent,
+		BytesReceived:   p.BytesReceived,
+		PacketsSent:     p.PacketsSent,
+		PacketsReceived: p.PacketsReceived,
+		Dropped:         p.Dropped,
+		SendRate:        p.SendRate,
+		ReceiveRate:     p.ReceiveRate,
+	}
+}
+
+func newEventResponse(e client.Event) EventResponse {
+	resp := EventResponse{Type: e.Type.String(), Time: e.Time}
+	switch e.Type {
+	case client.EventStateChanged:
+		resp.State = e.State.String()
+	case client.EventPeerConnected, client.EventPeerDisconnected:
+		resp.Peer = e.Peer.String()
+		resp.PeerName = e.PeerName
+	case client.EventDeprecationWarning, client.EventDropWarning:
+		resp.Message = e.Message
+	case client.EventMaintenance:
+		resp.Message = e.Message
+		if !e.Maintenance.Cancelled() {
+			start := e.Maintenance.Start
+			resp.MaintenanceStart = &start
+			resp.MaintenanceSeconds = int(e.Maintenance.Duration.Seconds())
+		}
+	case client.EventSessionSummary:
+		resp.Summary = &SessionSummaryResponse{
+			Seconds:      int(e.Summary.Duration.Seconds()),
+			PeakPeers:    e.Summary.PeakPeers,
+			BytesRelayed: e.Summary.BytesRelayed,
+		}
+	}
+	if e.Err != nil {
+		resp.Error = e.Err.Error()
+	}
+	return resp
+}
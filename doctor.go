@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"eiproxy/client"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"runtime"
+	"strings"
+)
+
+// Game reads the master server address from these keys under HKCU.
+const (
+	gameKeyPath         = `Software\Nival Interactive\EvilIslands\Network Settings`
+	starterKeyPath      = `Software\Gipat.Ru\EI_Starter\EvilIslands\Network Settings`
+	masterAddrValueName = "Master Server Name"
+)
+
+var errGameSettingsNotFound = errors.New("game settings not found")
+
+// runDoctor implements the doctor command, which checks connectivity and local setup and
+// prints a report users can paste into bug reports.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	stunServers := fs.String("stun", strings.Join(client.DefaultSTUNServers, ","),
+		"Comma separated STUN servers used to detect NAT type, empty to skip the check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := clientConfig{Config: client.DefaultConfig()}
+	if err := parseConfig(*configPath, &cfg); err != nil {
+		return err
+	}
+	applyClientOverrides(&cfg)
+
+	fmt.Printf("eiproxy %s, %s/%s, config %s\n", client.ClientVer, runtime.GOOS, runtime.GOARCH, *configPath)
+	failed := 0
+	report := func(r client.DiagnosticResult) {
+		fmt.Printf("[%-7s] %s: %s\n", r.Status, r.Check, r.Details)
+		if r.Status == client.DiagnosticFailed {
+			failed++
+		}
+	}
+	var stun []string
+	if *stunServers != "" {
+		stun = strings.Split(*stunServers, ",")
+	}
+	client.Diagnose(context.Background(), cfg.Config, stun, report)
+	report(diagnoseGameSettings())
+
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+// diagnoseGameSettings checks that the game is pointed to the local master server, as the CLI
+// doesn't change game settings itself.
+func diagnoseGameSettings() client.DiagnosticResult {
+	const check = "Game master server"
+	values, err := readGameMasterAddrs()
+	if errors.Is(err, errGameSettingsNotFound) {
+		return client.DiagnosticResult{Check: check, Status: client.DiagnosticSkipped, Details: err.Error()}
+	}
+	if err != nil {
+		return client.DiagnosticResult{Check: check, Status: client.DiagnosticWarning, Details: err.Error()}
+	}
+
+	var details []string
+	local := false
+	for _, name := range []string{"starter", "game"} {
+		if value, ok := values[name]; ok {
+			details = append(details, fmt.Sprintf("%s uses %q", name, value))
+			local = local || isLoopbackHost(value)
+		}
+	}
+	if !local {
+		details = append(details, "point the game to 127.0.0.1 (see README)")
+		return client.DiagnosticResult{Check: check, Status: client.DiagnosticWarning, Details: strings.Join(details, ", ")}
+	}
+	return client.DiagnosticResult{Check: check, Status: client.DiagnosticOK, Details: strings.Join(details, ", ")}
+}
+
+func isLoopbackHost(value string) bool {
+	host := strings.TrimSpace(value)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
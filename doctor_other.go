@@ -0,0 +1,72 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readGameMasterAddrs returns master server addresses set for the game and the starter in the
+// registry of the wine prefix (WINEPREFIX or ~/.wine).
+func readGameMasterAddrs() (map[string]string, error) {
+	prefix := os.Getenv("WINEPREFIX")
+	if prefix == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errGameSettingsNotFound
+		}
+		prefix = filepath.Join(home, ".wine")
+	}
+	f, err := os.Open(filepath.Join(prefix, "user.reg"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: no wine prefix in %s", errGameSettingsNotFound, prefix)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := map[string]string{
+		strings.ToLower(gameKeyPath):    "game",
+		strings.ToLower(starterKeyPath): "starter",
+	}
+	values := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Sections look like [Software\\Nival Interactive\\EvilIslands\\Network Settings] 1700000000.
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				continue
+			}
+			section = keys[strings.ToLower(strings.ReplaceAll(line[1:end], `\\`, `\`))]
+			continue
+		}
+		// Values look like "Master Server Name"="127.0.0.1".
+		name, value, ok := strings.Cut(line, "=")
+		if section == "" || !ok {
+			continue
+		}
+		if name, err = strconv.Unquote(name); err != nil || name != masterAddrValueName {
+			continue
+		}
+		if value, err = strconv.Unquote(value); err == nil {
+			values[section] = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w in %s", errGameSettingsNotFound, prefix)
+	}
+	return values, nil
+}
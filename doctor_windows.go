@@ -0,0 +1,43 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// readGameMasterAddrs returns master server addresses set for the game and the starter.
+func readGameMasterAddrs() (map[string]string, error) {
+	values := map[string]string{}
+	for name, path := range map[string]string{"game": gameKeyPath, "starter": starterKeyPath} {
+		if value, err := registryString(path, masterAddrValueName); err == nil {
+			values[name] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil, errGameSettingsNotFound
+	}
+	return values, nil
+}
+
+func registryString(path, name string) (string, error) {
+	pathUTF16, _ := syscall.UTF16PtrFromString(path)
+	nameUTF16, _ := syscall.UTF16PtrFromString(name)
+
+	var key syscall.Handle
+	err := syscall.RegOpenKeyEx(syscall.HKEY_CURRENT_USER, pathUTF16, 0, syscall.KEY_READ, &key)
+	if err != nil {
+		return "", err
+	}
+	defer syscall.RegCloseKey(key)
+
+	var typ, size uint32
+	if err = syscall.RegQueryValueEx(key, nameUTF16, nil, &typ, nil, &size); err != nil {
+		return "", err
+	}
+	data := make([]uint16, size/2+1)
+	err = syscall.RegQueryValueEx(key, nameUTF16, nil, &typ, (*byte)(unsafe.Pointer(&data[0])), &size)
+	if err != nil {
+		return "", err
+	}
+	return syscall.UTF16ToString(data), nil
+}
@@ -1,3 +1,7 @@
 module eiproxy
 
 go 1.21.5
+
+require golang.org/x/net v0.30.0
+
+require golang.org/x/sys v0.26.0 // indirect
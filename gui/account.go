@@ -0,0 +1,157 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"eiproxy/client"
+	"eiproxy/protocol"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lxn/walk"
+	dec "github.com/lxn/walk/declarative"
+)
+
+// Last known account information, refreshed after the proxy connects.
+var (
+	accountMut  sync.Mutex
+	accountInfo *protocol.UserResponse
+)
+
+// refreshAccount fetches account information with c and remembers it for the account dialog.
+func refreshAccount(c client.Client) {
+	user, err := c.GetUser(context.Background())
+	if err != nil {
+		log.Printf("Failed to get account information: %v", err)
+		return
+	}
+	storeAccount(user)
+}
+
+func storeAccount(user protocol.UserResponse) {
+	accountMut.Lock()
+	accountInfo = &user
+	accountMut.Unlock()
+}
+
+func cachedAccount() *protocol.UserResponse {
+	accountMut.Lock()
+	defer accountMut.Unlock()
+	return accountInfo
+}
+
+// fetchAccount fetches account information for the configured key.
+func fetchAccount() (*protocol.UserResponse, error) {
+	loadConfig()
+	userKey, err := protocol.UserKeyFromString(normalizeKey(cfg.UserKey))
+	if err != nil {
+		return nil, err
+	}
+	c, err := newAPIClient(userKey)
+	if err != nil {
+		return nil, err
+	}
+	user, err := c.GetUser(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	storeAccount(user)
+	return &user, nil
+}
+
+// showAccount shows information about the user's account.
+func showAccount() {
+	user := cachedAccount()
+	if user == nil {
+		var err error
+		if user, err = fetchAccount(); err != nil {
+			showErrorF("Failed to get account information: %v", err)
+			return
+		}
+	}
+
+	var dlg *walk.Dialog
+	var btnOk *walk.PushButton
+	var emailEdit, portEdit, createdEdit, lastUsedEdit, expiresEdit *walk.LineEdit
+
+	fill := func(user *protocol.UserResponse) {
+		_ = emailEdit.SetText(user.Email)
+		_ = portEdit.SetText(formatAccountPort(user.Port))
+		_ = createdEdit.SetText(formatAccountTime(&user.CreationTime))
+		_ = lastUsedEdit.SetText(formatAccountTime(&user.LastUsedTime))
+		_ = expiresEdit.SetText(formatAccountTime(user.ExpirationTime))
+	}
+	field := func(label string, edit **walk.LineEdit) []dec.Widget {
+		return []dec.Widget{
+			dec.Label{Text: tr(label)},
+			dec.LineEdit{AssignTo: edit, ReadOnly: true},
+		}
+	}
+
+	var fields []dec.Widget
+	fields = append(fields, field("Email:", &emailEdit)...)
+	fields = append(fields, field("Reserved port:", &portEdit)...)
+	fields = append(fields, field("Created:", &createdEdit)...)
+	fields = append(fields, field("Last used:", &lastUsedEdit)...)
+	fields = append(fields, field("Expires:", &expiresEdit)...)
+
+	_ = dec.Dialog{
+		AssignTo:      &dlg,
+		Title:         tr("Account"),
+		Icon:          walk.IconInformation(),
+		Font:          dec.Font{PointSize: walk.IntFrom96DPI(10, 96)},
+		DefaultButton: &btnOk,
+		CancelButton:  &btnOk,
+		MinSize:       dec.Size{Width: 350},
+		Layout:        dec.VBox{},
+		Children: []dec.Widget{
+			dec.Composite{
+				Layout:   dec.Grid{Columns: 2, MarginsZero: true},
+				Children: fields,
+			},
+			dec.Composite{
+				Layout: dec.HBox{MarginsZero: true},
+				Children: []dec.Widget{
+					dec.PushButton{
+						Text: tr("Refresh"),
+						OnClicked: func() {
+							user, err := fetchAccount()
+							if err != nil {
+								showErrorF("Failed to get account information: %v", err)
+								return
+							}
+							fill(user)
+						},
+					},
+					dec.HSpacer{},
+					dec.PushButton{
+						AssignTo:  &btnOk,
+						Text:      tr("OK"),
+						OnClicked: func() { dlg.Accept() },
+					},
+				},
+			},
+		},
+	}.Create(getAndShowMainWindow())
+
+	fill(user)
+	applyTheme(dlg)
+	dlg.Run()
+}
+
+func formatAccountPort(port int) string {
+	if port == 0 {
+		return tr("not reserved")
+	}
+	return strconv.Itoa(port)
+}
+
+func formatAccountTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return tr("never")
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
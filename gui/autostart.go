@@ -0,0 +1,101 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lxn/walk"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	runKeyPath    = `Software\Microsoft\Windows\CurrentVersion\Run`
+	runValueName  = "EIProxy"
+	minimizedFlag = "--minimized"
+)
+
+var (
+	autoStartCheck  *walk.CheckBox
+	autoStartAction *walk.Action
+)
+
+// launchedMinimized reports whether the app should start hidden in the tray, e.g. after login.
+func launchedMinimized() bool {
+	for _, arg := range os.Args[1:] {
+		if arg == minimizedFlag {
+			return true
+		}
+	}
+	return false
+}
+
+func autoStartCommand() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%s" %s`, exePath, minimizedFlag), nil
+}
+
+func isAutoStartEnabled() bool {
+	key, err := registry.OpenKey(registry.CURRENT_USER, runKeyPath, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	defer key.Close()
+
+	_, _, err = key.GetStringValue(runValueName)
+	return err == nil
+}
+
+// setAutoStart registers or unregisters the app to start with Windows.
+func setAutoStart(enabled bool) error {
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, runKeyPath, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	if !enabled {
+		err = key.DeleteValue(runValueName)
+		if errors.Is(err, registry.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	cmd, err := autoStartCommand()
+	if err != nil {
+		return err
+	}
+	return key.SetStringValue(runValueName, cmd)
+}
+
+// refreshAutoStart points the registered command to the current executable, which might
+// have been moved or renamed since it was enabled.
+func refreshAutoStart() {
+	if isAutoStartEnabled() {
+		if err := setAutoStart(true); err != nil {
+			log.Printf("Failed to update auto start: %v", err)
+		}
+	}
+}
+
+// toggleAutoStart applies the choice made with the checkbox or the tray menu and keeps both
+// in sync.
+func toggleAutoStart(enabled bool) {
+	if err := setAutoStart(enabled); err != nil {
+		showErrorF("Failed to change auto start: %v", err)
+		enabled = isAutoStartEnabled()
+	}
+	if autoStartCheck != nil && autoStartCheck.Checked() != enabled {
+		autoStartCheck.SetChecked(enabled)
+	}
+	if autoStartAction != nil && autoStartAction.Checked() != enabled {
+		_ = autoStartAction.SetChecked(enabled)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"eiproxy/client"
 	"encoding/json"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,20 +13,95 @@ import (
 type config struct {
 	MasterAddr              string
 	ServerURL               string
+	ServerFingerprint       string `json:",omitempty"` // pinned key of ServerURL, see client.Config
 	UserKey                 string
 	UpdateCheckTime         time.Time
 	UpdateCheckIntervalDays int
 	LogFile                 string
+	KeyCheckTime            time.Time
+	KeyCheckIntervalHours   int
+	KeyExpiryWarningDays    int
+	Obfuscate               bool   `json:",omitempty"`
+	Encrypt                 bool   `json:",omitempty"`
+	Checksum                bool   `json:",omitempty"`
+	Compress                bool   `json:",omitempty"`
+	BatchWindowMs           int    `json:",omitempty"` // coalesce packets sent within this window
+	AdaptiveKeepAlive       bool   `json:",omitempty"`
+	WaitForSlot             bool   `json:",omitempty"`
+	BootstrapFromServer     bool   `json:",omitempty"` // take master address and settings from the server
+	AutoConnect             bool   `json:",omitempty"` // start the session right after launch
+	Language                string `json:",omitempty"` // "en" or "ru", Windows UI language by default
+	Theme                   string `json:",omitempty"` // "light", "dark" or "system" (default)
+	RosterPath              string `json:",omitempty"` // JSON file mapping peer IPs to names
+	NameAPIURL              string `json:",omitempty"`
+	DirectoryURL            string `json:",omitempty"` // community relay directory
+	VirtualIPRange          string `json:",omitempty"` // loopback range players are seen at
+	PeerMapFile             string `json:",omitempty"` // keeps players' virtual IPs across restarts
+	CaptureFile             string `json:",omitempty"` // pcapng dump of relayed packets for debugging
+	DeadlineAuditFile       string `json:",omitempty"` // report on socket deadlines written on stop
+	UserAgent               string `json:",omitempty"` // overrides user agent sent with API requests
+
+	// "registry" (default) points the game to the proxy while it's running, "detect" leaves
+	// profiles already pointing to it alone and asks about the others.
+	MasterOverrideMode string `json:",omitempty"`
+	// Remembered answers of the detect mode by profile name ("game", "starter", "game-machine"
+	// or the registry location of other profiles).
+	MasterOverrideProfiles map[string]bool `json:",omitempty"`
+	// Override the game installed for all users as well. It requires administrator rights.
+	OverrideMachineRegistry bool `json:",omitempty"`
+	// Registry values with the master server address of installs in other locations. Known
+	// vendor keys are scanned for them as well unless DisableProfileDiscovery is set.
+	MasterAddrProfiles      []masterAddrProfileConfig `json:",omitempty"`
+	DisableProfileDiscovery bool                      `json:",omitempty"`
+
+	// Timeouts of network operations for slow or flaky connections, defaults if not set.
+	Timeouts *client.Timeouts `json:",omitempty"`
+
+	// Caps of game traffic for metered or shared connections, no limits if not set.
+	RateLimit *client.RateLimit `json:",omitempty"`
+
+	// Last time a server deprecation warning was shown, they are shown once a day.
+	DeprecationWarningTime time.Time
+
+	// Own TURN server used as a fallback if the proxy server is unreachable.
+	TURNAddr     string `json:",omitempty"`
+	TURNUsername string `json:",omitempty"`
+	TURNPassword string `json:",omitempty"`
+
+	// Additional executables (e.g. "game.exe") used to detect that the game is running.
+	GameExecutables []string `json:",omitempty"`
+	// Game or EI Starter executable started by "Launch game", found via the registry if empty.
+	GamePath string `json:",omitempty"`
+	// Stop the proxy once the game started by "Launch game" exits.
+	StopWithGame bool `json:",omitempty"`
+	// Stop the proxy when the game has been closed for this many minutes, 0 disables it.
+	AutoStopMinutes int `json:",omitempty"`
+	// Priority class (normal, above_normal, high) and CPU affinity mask applied to eiproxy
+	// while the game is running. Empty values leave the process untouched.
+	GameplayPriority    string `json:",omitempty"`
+	GameplayCPUAffinity uint64 `json:",omitempty"`
 }
 
-var (
-	cfg           config
-	defaultConfig = config{
-		ServerURL:  webSite,
-		MasterAddr: "vps.gipat.ru:28004",
+var cfg config
+
+// getDefaultConfig returns defaults shared with the CLI. If endpoints.json is placed next to
+// the executable, its first endpoint is used instead.
+func getDefaultConfig() config {
+	defaults := client.DefaultConfig()
+	c := config{
+		ServerURL:  defaults.ServerURL.String(),
+		MasterAddr: defaults.MasterAddr.String(),
 		UserKey:    userKeyPlaceholder,
 	}
-)
+	if endpoints, ok := loadEndpointsOverride(); ok {
+		c.ServerURL = endpoints[0].ServerURL
+		c.ServerFingerprint = endpoints[0].Fingerprint
+		if endpoints[0].MasterAddr != "" {
+			c.MasterAddr = endpoints[0].MasterAddr
+		}
+	}
+	return c
+}
 
 // getConfigPath returns path to config file in the same directory as executable.
 func getConfigPath() string {
@@ -39,24 +116,24 @@ func loadConfig() {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			data, err = json.MarshalIndent(defaultConfig, "", "  ")
-			if err != nil {
-				fatal(err)
-			}
-			err = os.WriteFile(configPath, data, 0644)
-			if err != nil {
-				fatal(err)
-			}
-			cfg = defaultConfig
+			writeDefaultConfig()
 			return
 		}
 		fatal(err)
 	}
 
-	// Try to unmarshal config file.
+	// Try to unmarshal config file. If it's corrupted, keep a copy and start over with defaults.
 	err = json.Unmarshal(data, &cfg)
 	if err != nil {
-		fatal(err)
+		brokenPath := configPath + ".broken"
+		log.Printf("Failed to parse config: %v, moving it to %s", err, brokenPath)
+		if err := os.Rename(configPath, brokenPath); err != nil {
+			fatal(err)
+		}
+		writeDefaultConfig()
+		showWarningF("Config file eiproxy.json was corrupted, default settings are used. "+
+			"Old file was saved as %s, please enter your access key again.", filepath.Base(brokenPath))
+		return
 	}
 
 	if cfg.UserKey == userKeyPlaceholder {
@@ -66,6 +143,18 @@ func loadConfig() {
 	cfg.UserKey = normalizeKey(cfg.UserKey)
 }
 
+func writeDefaultConfig() {
+	cfg = getDefaultConfig()
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		fatal(err)
+	}
+	err = os.WriteFile(getConfigPath(), data, 0644)
+	if err != nil {
+		fatal(err)
+	}
+}
+
 func saveConfig() {
 	cfg.UserKey = normalizeKey(cfg.UserKey)
 
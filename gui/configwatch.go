@@ -0,0 +1,35 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"eiproxy/common"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// runConfigWatch applies changes of eiproxy.json made while the app is running, e.g. when
+// it's edited by hand, to the running session.
+func runConfigWatch() {
+	defer handleCrash()
+
+	path := getConfigPath()
+	common.WatchFile(context.Background(), path, 2*time.Second, func() {
+		// loadConfig resets a config it can't parse, which is likely a half-saved edit here.
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &config{})
+		}
+		if err != nil {
+			log.Printf("Config changes are ignored: %v", err)
+			return
+		}
+		mainWnd.Synchronize(func() {
+			loadConfig()
+			reloadSession()
+		})
+	})
+}
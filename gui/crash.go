@@ -0,0 +1,114 @@
+//go:build windows
+
+package main
+
+import (
+	"archive/zip"
+	"eiproxy/client"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"syscall"
+	"time"
+
+	"github.com/lxn/walk"
+	"github.com/lxn/win"
+)
+
+const issuesURL = "https://github.com/koteyur/eiproxy/issues"
+
+// handleCrash saves a crash report and offers to send it if the goroutine panics, then exits.
+// It must be deferred directly at the start of main and of long-running goroutines, as a panic
+// in any goroutine kills the process.
+func handleCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	log.Printf("Panic: %v\n%s", r, stack)
+
+	path, err := writeCrashReport(r, stack)
+	if err != nil {
+		log.Printf("Failed to write crash report: %v", err)
+		walk.MsgBox(nil, tr("Crash"), trf("EI Proxy has crashed: %v\n\nPlease report the bug at %s",
+			r, issuesURL), walk.MsgBoxIconError)
+		os.Exit(2)
+	}
+
+	log.Printf("Crash report is saved to %s", path)
+	answer := walk.MsgBox(nil, tr("Crash"),
+		trf("EI Proxy has crashed: %v\n\nA report is saved to %s. It has the log and settings "+
+			"without your access key. Please attach it to a bug report.\n\n"+
+			"Yes - open the folder with the report\nNo - open the bug tracker", r, path),
+		walk.MsgBoxYesNoCancel|walk.MsgBoxIconError)
+	switch answer {
+	case walk.DlgCmdYes:
+		_ = exec.Command("explorer.exe", "/select,"+path).Start()
+	case walk.DlgCmdNo:
+		win.ShellExecute(0, syscall.StringToUTF16Ptr("open"), syscall.StringToUTF16Ptr(issuesURL),
+			nil, nil, win.SW_SHOWNORMAL)
+	}
+	os.Exit(2)
+}
+
+// writeCrashReport writes a zip with the panic, the recent log and the config without secrets
+// next to the executable, or to the temp directory if it isn't writable.
+func writeCrashReport(r interface{}, stack []byte) (string, error) {
+	name := fmt.Sprintf("eiproxy-crash-%s.zip", time.Now().Format("20060102-150405"))
+	path := filepath.Join(getExeDir(), name)
+	f, err := os.Create(path)
+	if err != nil {
+		path = filepath.Join(os.TempDir(), name)
+		if f, err = os.Create(path); err != nil {
+			return "", err
+		}
+	}
+	defer f.Close()
+
+	reportCfg := cfg
+	reportCfg.UserKey = redacted(reportCfg.UserKey)
+	reportCfg.TURNPassword = redacted(reportCfg.TURNPassword)
+	cfgData, err := json.MarshalIndent(reportCfg, "", "  ")
+	if err != nil {
+		cfgData = []byte(err.Error())
+	}
+	logText, _ := appLog.text()
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"panic.txt", []byte(fmt.Sprintf("Version: %s\r\nOS: %s/%s\r\nTime: %s\r\n\r\nPanic: %v\r\n\r\n%s",
+			client.ClientVer, runtime.GOOS, runtime.GOARCH, time.Now().Format(time.RFC3339), r, stack))},
+		{"config.json", cfgData},
+		{"log.txt", []byte(logText + "\r\n")},
+	}
+
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			return "", err
+		}
+		if _, err = w.Write(file.data); err != nil {
+			return "", err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
+
+func redacted(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "<redacted>"
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"eiproxy/client"
+	"eiproxy/protocol"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Known-good relay endpoints baked into the executable. They are used for default config and
+// as a fallback when the relay directory is unreachable. An endpoint may pin the key of its
+// server with "fingerprint", see protocol.RelayInfo.
+//
+//go:embed endpoints.json
+var builtinEndpointsJSON []byte
+
+// knownEndpoints returns built-in relay endpoints, unless they are overridden by endpoints.json
+// placed next to the executable. The default relay is returned if the built-in list is broken.
+func knownEndpoints() []protocol.RelayInfo {
+	if endpoints, ok := loadEndpointsOverride(); ok {
+		return endpoints
+	}
+
+	endpoints, err := parseEndpoints(builtinEndpointsJSON)
+	if err != nil {
+		log.Printf("Invalid built-in endpoints, using the default relay: %v", err)
+		defaults := client.DefaultConfig()
+		return []protocol.RelayInfo{{
+			Name:       "EI Proxy",
+			ServerURL:  defaults.ServerURL.String(),
+			MasterAddr: defaults.MasterAddr.String(),
+		}}
+	}
+	return endpoints
+}
+
+func loadEndpointsOverride() ([]protocol.RelayInfo, bool) {
+	data, err := os.ReadFile(filepath.Join(getExeDir(), "endpoints.json"))
+	if err != nil {
+		return nil, false
+	}
+	endpoints, err := parseEndpoints(data)
+	if err != nil {
+		log.Printf("Ignoring invalid endpoints.json: %v", err)
+		return nil, false
+	}
+	return endpoints, true
+}
+
+func parseEndpoints(data []byte) ([]protocol.RelayInfo, error) {
+	var endpoints []protocol.RelayInfo
+	if err := json.Unmarshal(data, &endpoints); err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoints")
+	}
+	for _, e := range endpoints {
+		if e.ServerURL == "" {
+			return nil, errors.New("endpoint without server_url")
+		}
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,175 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxn/walk"
+)
+
+// Registry values with the install directory, looked up in the key of a master server profile
+// and its parents.
+var installDirValueNames = []string{"Install Path", "InstallPath", "Path", "Folder"}
+
+// Executables of the game and EI Starter looked up in the install directory, in order of
+// preference.
+var gameExeNames = []string{"game.exe", "EI_Starter.exe", "EIStarter.exe"}
+
+var errGameNotFound = errors.New("game executable not found")
+
+// findGameExecutable returns config.GamePath or the executable found via the registry keys of
+// master server profiles.
+func findGameExecutable() (string, error) {
+	if cfg.GamePath != "" {
+		if _, err := os.Stat(cfg.GamePath); err != nil {
+			return "", err
+		}
+		return cfg.GamePath, nil
+	}
+
+	for _, p := range enabledMasterAddrProfiles() {
+		for path := p.path; path != ""; path = parentKeyPath(path) {
+			for _, valueName := range installDirValueNames {
+				dir, err := registryKeyString(p.root, path, valueName)
+				if err != nil || dir == "" {
+					continue
+				}
+				if exe := findExecutable(dir); exe != "" {
+					return exe, nil
+				}
+			}
+		}
+	}
+	return "", errGameNotFound
+}
+
+func parentKeyPath(path string) string {
+	i := strings.LastIndex(path, `\`)
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// findExecutable returns the game executable in dir, the value might point to the executable
+// itself.
+func findExecutable(dir string) string {
+	dir = strings.Trim(dir, `"`)
+	if strings.EqualFold(filepath.Ext(dir), ".exe") {
+		dir = filepath.Dir(dir)
+	}
+	names := append(append([]string(nil), gameExeNames...), cfg.GameExecutables...)
+	for _, name := range names {
+		exe := filepath.Join(dir, name)
+		if info, err := os.Stat(exe); err == nil && !info.IsDir() {
+			return exe
+		}
+	}
+	return ""
+}
+
+// gameLauncher starts the game once the proxy is connected, so the game finds the server
+// right away.
+type gameLauncher struct {
+	mut       sync.Mutex
+	connected bool
+	pending   string // executable to start once connected
+}
+
+var launcher gameLauncher
+
+// launch starts exe now if the proxy is connected, otherwise once it is.
+func (l *gameLauncher) launch(exe string) {
+	l.mut.Lock()
+	connected := l.connected
+	if !connected {
+		l.pending = exe
+	}
+	l.mut.Unlock()
+
+	if connected {
+		runGame(exe)
+	} else {
+		log.Printf("Game will be launched once the proxy is connected")
+	}
+}
+
+func (l *gameLauncher) setConnected(connected bool) {
+	l.mut.Lock()
+	l.connected = connected
+	exe := ""
+	if connected {
+		exe, l.pending = l.pending, ""
+	}
+	l.mut.Unlock()
+
+	if exe != "" {
+		runGame(exe)
+	}
+}
+
+// reset forgets the pending launch when the session is over.
+func (l *gameLauncher) reset() {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	l.connected = false
+	l.pending = ""
+}
+
+// launchGame starts the game, starting the proxy first if it isn't running.
+func launchGame() {
+	if isGameRunning() {
+		showMessageF("Launch game", walk.MsgBoxIconInformation, "Game is already running.")
+		return
+	}
+	exe, err := findGameExecutable()
+	if err != nil {
+		log.Printf("Failed to find the game: %v", err)
+		showErrorF("Failed to find the game executable. Please set GamePath in eiproxy.json to "+
+			"the path of game.exe.\n\nError: %v", err)
+		return
+	}
+
+	launcher.launch(exe)
+	if !sessionActive.Load() {
+		start()
+		if !sessionActive.Load() {
+			// Start has been cancelled or failed.
+			launcher.reset()
+		}
+	}
+}
+
+// runGame starts exe and stops the proxy after the game exits if config.StopWithGame is set.
+func runGame(exe string) {
+	cmd := exec.Command(exe)
+	cmd.Dir = filepath.Dir(exe)
+	if err := cmd.Start(); err != nil {
+		showErrorF("Failed to launch the game: %v", err)
+		return
+	}
+	log.Printf("Launched %s", exe)
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("%s exited: %v", filepath.Base(exe), err)
+		}
+		// EI Starter exits after launching the game, so wait for the game as well.
+		for isGameRunning() {
+			time.Sleep(5 * time.Second)
+		}
+		log.Printf("Game has exited")
+		if cfg.StopWithGame {
+			log.Printf("Stopping the proxy as the game has exited")
+			mainWnd.Synchronize(func() { stopSession() })
+		}
+	}()
+}
@@ -0,0 +1,150 @@
+//go:build windows
+
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/lxn/walk"
+	dec "github.com/lxn/walk/declarative"
+)
+
+// Links with this prefix open help window instead of browser.
+const helpURLPrefix = "help:"
+
+//go:embed help/help.txt
+var helpText string
+
+type helpTopic struct {
+	Title string
+	Body  string
+}
+
+// parseHelpTopics splits help text into topics. Each topic starts with a "# Title" line.
+func parseHelpTopics(text string) []helpTopic {
+	var topics []helpTopic
+	for _, line := range strings.Split(text, "\n") {
+		if title, ok := strings.CutPrefix(line, "# "); ok {
+			topics = append(topics, helpTopic{Title: strings.TrimSpace(title)})
+			continue
+		}
+		if len(topics) > 0 {
+			topics[len(topics)-1].Body += line + "\r\n"
+		}
+	}
+	for i := range topics {
+		topics[i].Body = strings.TrimSpace(topics[i].Body)
+	}
+	return topics
+}
+
+// helpLink returns link to help topic, which can be used in message boxes.
+func helpLink(topic string) string {
+	return fmt.Sprintf(`<a href="%s%s">%s</a>`, helpURLPrefix, topic, tr("Help"))
+}
+
+func filterHelpTopics(topics []helpTopic, query string) []helpTopic {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return topics
+	}
+
+	var result []helpTopic
+	for _, t := range topics {
+		if strings.Contains(strings.ToLower(t.Title), query) ||
+			strings.Contains(strings.ToLower(t.Body), query) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// showHelp shows help window. If topic is not empty, it's used as initial search query.
+func showHelp(topic string) {
+	allTopics := parseHelpTopics(helpText)
+	topics := filterHelpTopics(allTopics, topic)
+
+	var dlg *walk.Dialog
+	var searchEdit *walk.LineEdit
+	var topicList *walk.ListBox
+	var bodyEdit *walk.TextEdit
+	var btnClose *walk.PushButton
+
+	titles := func() []string {
+		result := make([]string, len(topics))
+		for i, t := range topics {
+			result[i] = t.Title
+		}
+		return result
+	}
+
+	showTopic := func() {
+		i := topicList.CurrentIndex()
+		if i < 0 || i >= len(topics) {
+			_ = bodyEdit.SetText("")
+			return
+		}
+		_ = bodyEdit.SetText(topics[i].Body)
+	}
+
+	_ = dec.Dialog{
+		AssignTo:     &dlg,
+		Title:        tr("Help"),
+		Icon:         walk.IconInformation(),
+		Font:         dec.Font{PointSize: walk.IntFrom96DPI(10, 96)},
+		CancelButton: &btnClose,
+		MinSize:      dec.Size{Width: 600, Height: 400},
+		Layout:       dec.VBox{},
+		Children: []dec.Widget{
+			dec.LineEdit{
+				AssignTo:  &searchEdit,
+				Text:      topic,
+				CueBanner: "Search...",
+				OnTextChanged: func() {
+					topics = filterHelpTopics(allTopics, searchEdit.Text())
+					_ = topicList.SetModel(titles())
+					if len(topics) > 0 {
+						_ = topicList.SetCurrentIndex(0)
+					}
+					showTopic()
+				},
+			},
+			dec.HSplitter{
+				Children: []dec.Widget{
+					dec.ListBox{
+						AssignTo:              &topicList,
+						Model:                 titles(),
+						OnCurrentIndexChanged: showTopic,
+						StretchFactor:         1,
+					},
+					dec.TextEdit{
+						AssignTo:      &bodyEdit,
+						ReadOnly:      true,
+						VScroll:       true,
+						StretchFactor: 2,
+					},
+				},
+			},
+			dec.Composite{
+				Layout: dec.HBox{},
+				Children: []dec.Widget{
+					dec.HSpacer{},
+					dec.PushButton{
+						AssignTo:  &btnClose,
+						Text:      tr("Close"),
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}.Create(getAndShowMainWindow())
+
+	if len(topics) > 0 {
+		_ = topicList.SetCurrentIndex(0)
+		showTopic()
+	}
+	applyTheme(dlg)
+	_ = dlg.Run()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"unsafe"
 
@@ -60,6 +61,17 @@ func registryKeyString(rootKey win.HKEY, subKeyPath, valueName string) (value st
 	return syscall.UTF16ToString(data), nil
 }
 
+func registryKeyExists(rootKey win.HKEY, subKeyPath string) bool {
+	subKeyPathUTF16, _ := syscall.UTF16PtrFromString(subKeyPath)
+
+	var hKey win.HKEY
+	if win.RegOpenKeyEx(rootKey, subKeyPathUTF16, 0, win.KEY_READ, &hKey) != win.ERROR_SUCCESS {
+		return false
+	}
+	win.RegCloseKey(hKey)
+	return true
+}
+
 func setRegistryKeyString(rootKey win.HKEY, subKeyPath, valueName, value string) error {
 	subKeyPathUTF16, _ := syscall.UTF16PtrFromString(subKeyPath)
 	valueNameUTF16, _ := syscall.UTF16PtrFromString(valueName)
@@ -94,6 +106,28 @@ func setRegistryKeyString(rootKey win.HKEY, subKeyPath, valueName, value string)
 	return nil
 }
 
+// registrySubKeys returns names of subkeys of the key, or nil if it can't be opened.
+func registrySubKeys(rootKey win.HKEY, subKeyPath string) []string {
+	subKeyPathUTF16, _ := syscall.UTF16PtrFromString(subKeyPath)
+
+	var hKey syscall.Handle
+	if syscall.RegOpenKeyEx(syscall.Handle(rootKey), subKeyPathUTF16, 0,
+		syscall.KEY_ENUMERATE_SUB_KEYS, &hKey) != nil {
+		return nil
+	}
+	defer syscall.RegCloseKey(hKey)
+
+	var names []string
+	var buf [256]uint16 // key names are limited to 255 characters
+	for i := uint32(0); ; i++ {
+		n := uint32(len(buf))
+		if syscall.RegEnumKeyEx(hKey, i, &buf[0], &n, nil, nil, nil, nil) != nil {
+			return names
+		}
+		names = append(names, syscall.UTF16ToString(buf[:n]))
+	}
+}
+
 func msgBox(
 	owner walk.Form,
 	title string,
@@ -117,7 +151,7 @@ func msgBox(
 	var dlg *walk.Dialog
 	err := dec.Dialog{
 		AssignTo:      &dlg,
-		Title:         title,
+		Title:         tr(title),
 		Icon:          icon,
 		Font:          dec.Font{PointSize: walk.IntFrom96DPI(10, 96)},
 		CancelButton:  &btnOk,
@@ -127,7 +161,7 @@ func msgBox(
 			dec.LinkLabel{
 				OnLinkActivated: onLinkActivated,
 				MaxSize:         dec.Size{Width: 300},
-				Text:            fmt.Sprintf(format, args...),
+				Text:            trf(format, args...),
 			},
 			dec.Composite{
 				Layout: dec.HBox{},
@@ -135,7 +169,7 @@ func msgBox(
 					dec.HSpacer{},
 					dec.PushButton{
 						AssignTo: &btnOk,
-						Text:     "OK",
+						Text:     tr("OK"),
 						OnClicked: func() {
 							dlg.Accept()
 						},
@@ -147,14 +181,19 @@ func msgBox(
 	}.Create(owner)
 	if err != nil {
 		// Fallback to message box.
-		walk.MsgBox(owner, title, fmt.Sprintf(format, args...), style)
+		walk.MsgBox(owner, tr(title), trf(format, args...), style)
 		return
 	}
 
+	applyTheme(dlg)
 	_ = dlg.Run()
 }
 
 func onLinkActivated(link *walk.LinkLabelLink) {
+	if topic, ok := strings.CutPrefix(link.URL(), helpURLPrefix); ok {
+		showHelp(topic)
+		return
+	}
 	win.ShellExecute(mainWnd.Handle(),
 		syscall.StringToUTF16Ptr("open"),
 		syscall.StringToUTF16Ptr(link.URL()),
@@ -0,0 +1,65 @@
+//go:build windows
+
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// String tables map English texts to their translations. Texts without translation are
+// shown in English.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var translations map[string]string
+
+// setupLanguage loads the string table for the language set in config or, by default,
+// for the Windows UI language.
+func setupLanguage() {
+	lang := strings.ToLower(cfg.Language)
+	if lang == "" {
+		lang = systemLanguage()
+	}
+	if lang == "en" {
+		return
+	}
+
+	data, err := localeFiles.ReadFile("locales/" + lang + ".json")
+	if err != nil {
+		log.Printf("Language %q isn't supported, using English", lang)
+		return
+	}
+	if err := json.Unmarshal(data, &translations); err != nil {
+		log.Printf("Failed to load %q translation: %v", lang, err)
+	}
+}
+
+// systemLanguage returns ISO 639-1 code of the preferred Windows UI language, e.g. "ru".
+func systemLanguage() string {
+	langs, err := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME)
+	if err != nil || len(langs) == 0 {
+		return "en"
+	}
+	lang, _, _ := strings.Cut(langs[0], "-")
+	return strings.ToLower(lang)
+}
+
+// tr returns translation of the English text.
+func tr(text string) string {
+	if t, ok := translations[text]; ok && t != "" {
+		return t
+	}
+	return text
+}
+
+// trf translates format and formats it like fmt.Sprintf.
+func trf(format string, args ...any) string {
+	return fmt.Sprintf(tr(format), args...)
+}
@@ -0,0 +1,88 @@
+//go:build windows
+
+package main
+
+import (
+	"eiproxy/client"
+	"eiproxy/protocol"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// sessionActive is set while the proxy session is running. Background key checks are
+// postponed until the app is idle.
+var sessionActive atomic.Bool
+
+// runKeyChecks periodically validates the stored key in background and warns the user
+// if it's revoked or about to expire.
+func runKeyChecks() {
+	defer handleCrash()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		mainWnd.Synchronize(startKeyCheck)
+		<-ticker.C
+	}
+}
+
+// startKeyCheck must be called from UI thread.
+func startKeyCheck() {
+	if sessionActive.Load() {
+		return
+	}
+
+	loadConfig()
+
+	// Key check disabled or there is no key yet.
+	if cfg.KeyCheckIntervalHours < 0 || cfg.UserKey == "" {
+		return
+	}
+
+	// Set default key check interval.
+	if cfg.KeyCheckIntervalHours == 0 {
+		cfg.KeyCheckIntervalHours = 24
+	}
+	if cfg.KeyExpiryWarningDays == 0 {
+		cfg.KeyExpiryWarningDays = 7
+	}
+
+	interval := time.Duration(cfg.KeyCheckIntervalHours) * time.Hour
+	if time.Since(cfg.KeyCheckTime) < interval {
+		return
+	}
+
+	key := cfg.UserKey
+	go func() {
+		user, err := getUser(key)
+		mainWnd.Synchronize(func() { finishKeyCheck(user, err) })
+	}()
+}
+
+func finishKeyCheck(user protocol.UserResponse, err error) {
+	if err != nil {
+		if !errors.Is(err, client.ErrUnauthorized) {
+			// Network and server errors are transient, just try again later.
+			log.Printf("Background key check failed: %v", err)
+			return
+		}
+		log.Printf("Background key check: key is unauthorized: %v", err)
+		showToast("Access key is invalid",
+			trf("Your access key was revoked or has expired. Please get a new one at %s", webSite))
+	} else if user.ExpirationTime != nil {
+		left := time.Until(*user.ExpirationTime)
+		warnBefore := time.Duration(cfg.KeyExpiryWarningDays) * 24 * time.Hour
+		if left < warnBefore {
+			log.Printf("Background key check: key expires at %v", *user.ExpirationTime)
+			showToast("Access key expires soon",
+				trf("Your access key expires on %s. Please renew it at %s",
+					user.ExpirationTime.Local().Format("2006-01-02 15:04"), webSite))
+		}
+	}
+
+	cfg.KeyCheckTime = time.Now()
+	saveConfig()
+}
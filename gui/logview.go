@@ -0,0 +1,202 @@
+//go:build windows
+
+package main
+
+import (
+	"eiproxy/client"
+	"eiproxy/protocol"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lxn/walk"
+	dec "github.com/lxn/walk/declarative"
+)
+
+const logBufferLines = 5000
+
+// logBuffer keeps the most recent log lines in memory for the log viewer.
+type logBuffer struct {
+	mut     sync.Mutex
+	lines   []string
+	version uint64 // incremented on every write
+}
+
+var appLog logBuffer
+
+// stopSupportMode stops sharing logs with the relay operator, nil if not sharing.
+var stopSupportMode func()
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		b.lines = append(b.lines, line)
+	}
+	if extra := len(b.lines) - logBufferLines; extra > 0 {
+		b.lines = append(b.lines[:0], b.lines[extra:]...)
+	}
+	b.version++
+	return len(p), nil
+}
+
+func (b *logBuffer) text() (string, uint64) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return strings.Join(b.lines, "\r\n"), b.version
+}
+
+// showLogViewer shows recent log lines, refreshing them while the window is open.
+func showLogViewer() {
+	var dlg *walk.Dialog
+	var logEdit *walk.TextEdit
+	var btnClose *walk.PushButton
+	var btnSupport *walk.PushButton
+
+	text, version := appLog.text()
+
+	_ = dec.Dialog{
+		AssignTo:     &dlg,
+		Title:        tr("Log"),
+		Icon:         walk.IconInformation(),
+		Font:         dec.Font{PointSize: walk.IntFrom96DPI(10, 96)},
+		CancelButton: &btnClose,
+		MinSize:      dec.Size{Width: 700, Height: 450},
+		Layout:       dec.VBox{},
+		Children: []dec.Widget{
+			dec.TextEdit{
+				AssignTo: &logEdit,
+				Font:     dec.Font{Family: "Consolas", PointSize: walk.IntFrom96DPI(9, 96)},
+				Text:     text,
+				ReadOnly: true,
+				VScroll:  true,
+				HScroll:  true,
+			},
+			dec.Composite{
+				Layout: dec.HBox{},
+				Children: []dec.Widget{
+					dec.PushButton{
+						Text: tr("Copy"),
+						OnClicked: func() {
+							text, _ := appLog.text()
+							if err := walk.Clipboard().SetText(text); err != nil {
+								showErrorF("Failed to copy log: %v", err)
+							}
+						},
+					},
+					dec.PushButton{
+						Text:      tr("Save..."),
+						OnClicked: func() { saveLog(dlg) },
+					},
+					dec.PushButton{
+						AssignTo:  &btnSupport,
+						Text:      supportButtonText(),
+						OnClicked: func() { toggleSupportMode(dlg); _ = btnSupport.SetText(supportButtonText()) },
+					},
+					dec.HSpacer{},
+					dec.PushButton{
+						AssignTo:  &btnClose,
+						Text:      tr("Close"),
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}.Create(getAndShowMainWindow())
+
+	scrollToEnd := func() {
+		logEdit.SetTextSelection(logEdit.TextLength(), logEdit.TextLength())
+		logEdit.ScrollToCaret()
+	}
+	scrollToEnd()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			dlg.Synchronize(func() {
+				text, v := appLog.text()
+				if v == version || logEdit.IsDisposed() {
+					return
+				}
+				version = v
+				_ = logEdit.SetText(text)
+				scrollToEnd()
+			})
+		}
+	}()
+
+	applyTheme(dlg)
+	_ = dlg.Run()
+}
+
+func supportButtonText() string {
+	if stopSupportMode != nil {
+		return "Stop sharing"
+	}
+	return "Share with support..."
+}
+
+// toggleSupportMode starts streaming logs to the relay operator after asking for consent,
+// or stops it.
+func toggleSupportMode(owner walk.Form) {
+	if stopSupportMode != nil {
+		stopSupportMode()
+		stopSupportMode = nil
+		return
+	}
+
+	serverURL, err := client.ParseURL(cfg.ServerURL)
+	if err != nil {
+		showErrorF("Invalid server URL in eiproxy.json: %v", err)
+		return
+	}
+	userKey, err := protocol.UserKeyFromString(cfg.UserKey)
+	if err != nil {
+		showErrorF("Invalid access key: %v", err)
+		return
+	}
+
+	minutes := int(client.DefaultSupportDuration.Minutes())
+	answer := walk.MsgBox(owner, tr("Share log with support"),
+		trf("The log will be sent to the relay operator for the next %d minutes to help "+
+			"them find out what's wrong. It includes IP addresses of players connecting to you.\n\n"+
+			"Do you agree?", minutes),
+		walk.MsgBoxYesNo|walk.MsgBoxIconQuestion)
+	if answer != walk.DlgCmdYes {
+		return
+	}
+
+	stopSupportMode = client.StartSupportMode(serverURL, userKey, cfg.ServerFingerprint,
+		client.DefaultSupportDuration)
+}
+
+func saveLog(owner walk.Form) {
+	fd := walk.FileDialog{
+		Title:    tr("Save log"),
+		Filter:   "Log files (*.log)|*.log|All files (*.*)|*.*",
+		FilePath: "eiproxy.log",
+	}
+	ok, err := fd.ShowSave(owner)
+	if err != nil {
+		showErrorF("Failed to save log: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	text, _ := appLog.text()
+	if err := os.WriteFile(fd.FilePath, []byte(text+"\r\n"), 0644); err != nil {
+		showErrorF("Failed to save log: %v", err)
+	}
+}
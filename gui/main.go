@@ -4,18 +4,17 @@ package main
 
 import (
 	"context"
+	"eiproxy/api"
 	"eiproxy/client"
 	"eiproxy/common"
 	"eiproxy/protocol"
 	"errors"
 	"fmt"
+	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
-	"strconv"
-	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -25,12 +24,17 @@ import (
 	"golang.org/x/sys/windows"
 )
 
+const (
+	simulatedPlayers = 3
+	simulationTime   = 10 * time.Second
+)
+
 const (
 	mwWidth            = 280
 	mwHeight           = 300
 	mwTitle            = "EI Proxy"
 	userKeyPlaceholder = "Put your access key here"
-	webSite            = "https://ei.koteyur.dev/proxy"
+	webSite            = client.DefaultServerURL
 )
 
 var (
@@ -38,31 +42,51 @@ var (
 	startBt, stopBt *walk.PushButton
 	proxyStatus     *walk.TextEdit
 	proxyIPEdit     *walk.TextEdit
+	copyAddrBt      *walk.PushButton
+	shareAddrBt     *walk.PushButton
+	peerList        *walk.ListBox
 
-	stopAndWait = func() {}
+	stopAndWait   = func() {}
+	stopSession   = func() {}
+	reloadSession = func() {}
+	simulate      = func() {}
 
-	errKeyUnauthorized   = errors.New("key unauthorized")
-	errServerMaintenance = errors.New("server maintenance")
-	errServerInvalid     = errors.New("server invalid")
-	errNetwork           = errors.New("network error")
+	errServerInvalid = errors.New("server invalid")
 )
 
 func main() {
 	defer ensureSingleAppInstance()()
+	defer handleCrash()
+
+	// Keep logs in memory for the log viewer in addition to the log file.
+	log.SetOutput(&appLog)
+
+	for _, warning := range common.SetupWarnings(getExeDir()) {
+		log.Print(warning)
+		showWarningF("%s\n\n%s", warning, helpLink("permissions"))
+	}
 
 	loadConfig()
+	setupLanguage()
+	common.UserAgent = client.UserAgent("gui")
+	if cfg.UserAgent != "" {
+		common.UserAgent = cfg.UserAgent
+	}
 	if cfg.LogFile != "" {
-		path := cfg.LogFile
-		if !filepath.IsAbs(cfg.LogFile) {
-			path = filepath.Join(getExeDir(), cfg.LogFile)
-		}
-		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		f, err := os.OpenFile(getLogPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 		if err != nil {
 			fatal(err)
 		}
 		defer f.Close()
-		log.SetOutput(f)
+		log.SetOutput(io.MultiWriter(f, &appLog))
+	}
+
+	removeOldExecutable()
+
+	if err := registerURLScheme(); err != nil {
+		log.Printf("Failed to register URL scheme: %v", err)
 	}
+	refreshAutoStart()
 
 	// Try to set main window icon.
 	// ID of GrpIcon assigned by rsrc tool: rsrc -manifest app.manifest -ico app.ico -o rsrc.syso
@@ -76,9 +100,10 @@ func main() {
 		Font:     dec.Font{PointSize: walk.IntFrom96DPI(12, 96)},
 		Title:    mwTitle,
 		AssignTo: &mainWnd,
+		Visible:  !launchedMinimized(),
 		Size:     dec.Size{Width: mwWidth, Height: mwHeight},
 		OnSizeChanged: func() {
-			_ = mainWnd.SetSize(walk.Size{Width: mwWidth, Height: mwHeight})
+			fitMainWindow()
 		},
 		Layout: dec.VBox{
 			MarginsZero: true,
@@ -89,56 +114,94 @@ func main() {
 				Layout: dec.HBox{},
 				Children: []dec.Widget{
 					dec.PushButton{
-						Text:      "Start",
+						Text:      tr("Start"),
 						OnClicked: start,
 						AssignTo:  &startBt,
 					},
 					dec.PushButton{
-						Text:      "Stop",
+						Text:      tr("Stop"),
 						Enabled:   false,
-						OnClicked: func() {},
+						OnClicked: func() { stopSession() },
 						AssignTo:  &stopBt,
 					},
+					dec.PushButton{
+						Text:      tr("Launch game"),
+						OnClicked: launchGame,
+					},
 				},
 			},
 			dec.Composite{
-				Layout:    dec.Grid{Columns: 2},
+				Layout:    dec.Grid{Columns: 4},
 				MaxSize:   dec.Size{Height: 10},
 				Alignment: dec.AlignHCenterVNear,
 				Children: []dec.Widget{
 					dec.TextLabel{
-						Text: "Status:",
+						Text: tr("Status:"),
 					},
 					dec.TextEdit{
 						Font:          dec.Font{PointSize: walk.IntFrom96DPI(9, 96)},
-						Text:          "stopped",
+						Text:          tr("stopped"),
 						Enabled:       false,
 						ReadOnly:      true,
 						TextAlignment: dec.AlignFar,
 						AssignTo:      &proxyStatus,
+						ColumnSpan:    3,
 					},
 					dec.TextLabel{
-						Text: "Proxy IP:",
+						Text: tr("Proxy IP:"),
 					},
 					dec.TextEdit{
 						Font:          dec.Font{PointSize: walk.IntFrom96DPI(9, 96)},
-						Text:          "unassigned",
+						Text:          tr("unassigned"),
 						Enabled:       false,
 						ReadOnly:      true,
 						TextAlignment: dec.AlignFar,
 						AssignTo:      &proxyIPEdit,
 					},
+					// The read-only edit is awkward to select, so the address can be copied
+					// with a click.
+					dec.PushButton{
+						Text:      tr("Copy"),
+						Enabled:   false,
+						AssignTo:  &copyAddrBt,
+						OnClicked: func() { handleAppCommand(appCommandCopyAddress) },
+					},
+					dec.PushButton{
+						Text:      tr("Share..."),
+						Enabled:   false,
+						AssignTo:  &shareAddrBt,
+						OnClicked: func() { handleAppCommand(appCommandShareAddress) },
+					},
 				},
 			},
 
-			dec.VSpacer{},
+			dec.ListBox{
+				Font:     dec.Font{PointSize: walk.IntFrom96DPI(9, 96)},
+				AssignTo: &peerList,
+			},
 
 			dec.Composite{
 				Layout: dec.HBox{},
 				Children: []dec.Widget{
+					dec.PushButton{
+						Text:      tr("Relays"),
+						OnClicked: showRelays,
+					},
+					dec.PushButton{
+						Text:      tr("Account"),
+						OnClicked: showAccount,
+					},
+					dec.PushButton{
+						Text:      tr("Log"),
+						OnClicked: showLogViewer,
+					},
 					dec.HSpacer{},
 					dec.PushButton{
-						Text: "About",
+						Text:      tr("Help"),
+						OnClicked: func() { showHelp("") },
+					},
+					dec.PushButton{
+						Text: tr("About"),
 						OnClicked: func() {
 							showAbout(appIcon)
 						},
@@ -153,11 +216,21 @@ func main() {
 				Alignment: dec.AlignHFarVCenter,
 				MaxSize:   dec.Size{Height: 20},
 				Children: []dec.Widget{
+					dec.CheckBox{
+						Font:     dec.Font{PointSize: walk.IntFrom96DPI(9, 96)},
+						Text:     tr("Start with Windows"),
+						Checked:  isAutoStartEnabled(),
+						AssignTo: &autoStartCheck,
+						OnCheckedChanged: func() {
+							toggleAutoStart(autoStartCheck.Checked())
+						},
+					},
 					dec.HSpacer{},
 					dec.HSeparator{},
 					dec.LinkLabel{
-						Text:            fmt.Sprintf(`<a id="this" href="%s">website</a>`, webSite),
+						Text:            fmt.Sprintf(`<a id="this" href="%s">%s</a>`, webSite, tr("website")),
 						OnLinkActivated: onLinkActivated,
+						AssignTo:        &serverStatusLink,
 					},
 					dec.HSeparator{},
 					dec.Label{Text: fmt.Sprintf("ver. %s", client.ClientVer)},
@@ -174,16 +247,36 @@ func main() {
 		win.GetWindowLong(mainWnd.Handle(), win.GWL_STYLE) & ^win.WS_MAXIMIZEBOX & ^win.WS_SIZEBOX)
 
 	_ = mainWnd.SetIcon(appIcon)
+	applyTheme(mainWnd)
+	followSystemTheme(mainWnd)
 
 	ni := createTrayIcon(mainWnd, appIcon)
 	defer func() { _ = ni.Dispose() }()
+	notifyIcon = ni
+	applyTrayState(stoppedUIState)
+
+	uiDone := make(chan struct{})
+	go ui.run(uiDone)
 
 	mainWnd.Closing().Attach(func(canceled *bool, reason walk.CloseReason) {
+		close(uiDone)
 		stopAndWait()
 	})
 
 	mainWnd.Starting().Attach(func() {
+		restoreStaleMasterAddr(mainWnd)
 		checkUpdates()
+		if cfg.AutoConnect {
+			if _, err := protocol.UserKeyFromString(cfg.UserKey); err == nil {
+				log.Printf("Connecting automatically")
+				start()
+			} else {
+				log.Printf("Auto connect is skipped, access key isn't set")
+			}
+		}
+		go runKeyChecks()
+		go runServerStatusChecks()
+		go runConfigWatch()
 	})
 
 	mainWnd.Run()
@@ -193,8 +286,7 @@ func start() {
 	loadConfig()
 
 	if cfg.UserKey == "" {
-		ok := showEnterKeyDialog("")
-		if !ok {
+		if ok := showSetupWizard(); !ok {
 			return
 		}
 	} else {
@@ -202,18 +294,21 @@ func start() {
 			tryAgainMessage := ""
 			if errors.Is(err, protocol.ErrInvalidKey) {
 				tryAgainMessage = "Key has invalid format. Please try again."
-			} else if errors.Is(err, errKeyUnauthorized) {
+			} else if errors.Is(err, protocol.ErrorCodeKeyExpired) {
+				tryAgainMessage = "Your access key has expired. Please enter a new one."
+			} else if errors.Is(err, client.ErrUnauthorized) {
 				tryAgainMessage = "It seems your access key is invalid. Please try again."
-			} else if errors.Is(err, errServerMaintenance) {
-				showErrorF("Server is under maintenance. Please try again later.\n\nError: %v", err)
+			} else if errors.Is(err, client.ErrMaintenance) {
+				showErrorF("Server is under maintenance. Please try again later.\n\nError: %v\n\n%s",
+					err, helpLink("maintenance"))
 				return
 			} else if errors.Is(err, errServerInvalid) {
 				showErrorF("Server returned invalid response. If you changed server address "+
-					"in eiproxy.json, please check it.\n\nError: %v", err)
+					"in eiproxy.json, please check it.\n\nError: %v\n\n%s", err, helpLink("invalid response"))
 				return
-			} else if errors.Is(err, errNetwork) {
+			} else if errors.Is(err, client.ErrNetwork) {
 				showErrorF("Failed to connect to server. Please check your internet connection."+
-					"\n\nError: %v", err)
+					"\n\nError: %v\n\n%s", err, helpLink("network"))
 				return
 			} else {
 				showErrorF("Failed to check access key: %v", err)
@@ -232,16 +327,93 @@ func start() {
 		return
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	c := newClient(userKey)
+	// Something else might listen on the default port, e.g. another proxy tool.
+	localMasterAddr, err := client.PickLocalMasterAddr(client.DefaultLocalMasterAddr)
+	if err != nil {
+		showErrorF("Failed to find a free local port: %v", err)
+		return
+	}
+	if localMasterAddr != client.DefaultLocalMasterAddr && cfg.MasterOverrideMode == masterOverrideDetect {
+		// Game is pointed to the default port, another one won't do without the override.
+		showErrorF("Port of the local master server %s is used by another program. Please close it "+
+			"and try again.", client.DefaultLocalMasterAddr)
+		return
+	}
+	if localMasterAddr != client.DefaultLocalMasterAddr {
+		log.Printf("Port of %s is busy, game will use local master server %s",
+			client.DefaultLocalMasterAddr, localMasterAddr)
+	}
 
-	// Disable start button and enable stop button.
-	startBt.SetEnabled(false)
-	proxyStatus.SetText("starting...")
-	handle := stopBt.Clicked().Attach(func() {
-		stopBt.SetEnabled(false)
-		proxyStatus.SetText("stopping...")
-		cancel()
+	c, err := newClient(userKey, localMasterAddr)
+	if err != nil {
+		showErrorF("Invalid server settings in eiproxy.json: %v", err)
+		return
+	}
+	startedToastShown := false
+	c.Subscribe(func(e client.Event) {
+		switch e.Type {
+		case client.EventStateChanged:
+			switch e.State {
+			case client.StateConnected:
+				addr := c.GetProxyAddr(0)
+				ui.update(func(s *uiState) {
+					s.status = "started"
+					s.proxyAddr = addr.String()
+					s.canStop = true
+				})
+				go refreshAccount(c)
+				launcher.setConnected(true)
+				if !startedToastShown {
+					startedToastShown = true
+					message := trf("Your server is available at %s", addr)
+					if localMasterAddr != client.DefaultLocalMasterAddr {
+						message += "\n" + trf("Game uses local master server %s", localMasterAddr)
+					}
+					showToast("Proxy started", message,
+						toastAction{Text: "Copy address", Command: appCommandCopyAddress},
+						toastAction{Text: "Open log", Command: appCommandOpenLog},
+						toastAction{Text: "Stop", Command: appCommandStop},
+					)
+				}
+			case client.StateResolving:
+				ui.update(func(s *uiState) { s.status = "resolving server address..." })
+			case client.StateConnecting:
+				ui.update(func(s *uiState) {
+					// Waiting for a slot happens while connecting, so keep showing it.
+					if s.status != "waiting for slot..." {
+						s.status = "connecting..."
+					}
+				})
+			case client.StateHandshaking:
+				ui.update(func(s *uiState) { s.status = "opening tunnel..." })
+			case client.StateReconnecting:
+				launcher.setConnected(false)
+				ui.update(func(s *uiState) { s.status = "reconnecting..." })
+			case client.StateStopping:
+				launcher.setConnected(false)
+				ui.update(func(s *uiState) { s.status = "stopping..."; s.canStop = false })
+			}
+		case client.EventPeerConnected:
+			name := e.PeerName
+			if name == "" {
+				name = e.Peer.Addr().String()
+			}
+			showToast("Player connected", trf("%s joined your server", name),
+				toastAction{Text: "Open log", Command: appCommandOpenLog},
+				toastAction{Text: "Stop", Command: appCommandStop},
+			)
+		case client.EventDeprecationWarning:
+			showDeprecationWarning(e.Message)
+		case client.EventMaintenance:
+			showMaintenanceNotice(e.Maintenance)
+		case client.EventSessionSummary:
+			summary := formatSessionSummary(e.Summary)
+			ui.update(func(s *uiState) { s.summary = summary })
+		case client.EventDropWarning:
+			showToast("Packets are dropped", tr("The proxy can't keep up with the game traffic, "+
+				"players might lag. Close programs which load the network or the CPU."),
+				toastAction{Text: "Open log", Command: appCommandOpenLog})
+		}
 	})
 
 	if isGameRunning() {
@@ -249,78 +421,127 @@ func start() {
 			"Otherwise your server might be unavailable for other players.")
 	}
 
-	// Override master addr in:
-	// - HKCU\Software\Gipat.Ru\EI_Starter\EvilIslands\Network Settings\Master Server Name
-	// - Software\Nival Interactive\EvilIslands\Network Settings\Master Server Name
-	const (
-		HKCU           = win.HKEY_CURRENT_USER
-		gameKeyPath    = `Software\Nival Interactive\EvilIslands\Network Settings`
-		starterKeyPath = `Software\Gipat.Ru\EI_Starter\EvilIslands\Network Settings`
-	)
-	prevGame, err := registryKeyString(HKCU, gameKeyPath, "Master Server Name")
-	if err == nil {
-		err = setRegistryKeyString(HKCU, gameKeyPath, "Master Server Name", "127.0.0.1:28004")
+	profiles := enabledMasterAddrProfiles()
+	if cfg.MasterOverrideMode == masterOverrideDetect {
+		profiles = chooseMasterAddrOverrides(localMasterAddr)
+	}
+	restoreRegistry, err := overrideMasterAddr(localMasterAddr, profiles)
+	if err != nil {
+		showErrorF("Failed to override master server address: %v", err)
+		return
+	}
+
+	// Disable start button right away, stop button is enabled once connected.
+	ui.updateNow(func(s *uiState) { *s = uiState{status: "starting..."} })
+	stopSession = func() {
+		ui.update(func(s *uiState) { s.status = "stopping..."; s.canStop = false })
+		go func() { _ = c.Stop(context.Background()) }()
+	}
+
+	if cfg.WaitForSlot {
+		// Server might be full, let user stop waiting for a slot.
+		time.AfterFunc(5*time.Second, func() {
+			ui.update(func(s *uiState) {
+				if s.status == "starting..." || s.status == "connecting..." {
+					s.status = "waiting for slot..."
+					s.canStop = true
+				}
+			})
+		})
+	}
+
+	// Changes of eiproxy.json are applied to the running session, or it's restarted.
+	var restartSession atomic.Bool
+	reloadSession = func() {
+		key, err := protocol.UserKeyFromString(cfg.UserKey)
 		if err != nil {
-			showErrorF("Failed to override game's master addr: %v", err)
+			log.Printf("Failed to apply config changes: invalid access key: %v", err)
 			return
 		}
-	}
-
-	prevStarter, err := registryKeyString(HKCU, starterKeyPath, "Master Server Name")
-	if err == nil {
-		err = setRegistryKeyString(HKCU, starterKeyPath, "Master Server Name", "127.0.0.1:28004")
+		clientCfg, err := newClientConfig(key, localMasterAddr)
 		if err != nil {
-			showErrorF("Failed to override starter's master addr: %v", err)
+			log.Printf("Failed to apply config changes: %v", err)
 			return
 		}
+		if r, ok := c.(client.Reconfigurer); ok && r.Reconfigure(clientCfg) {
+			return
+		}
+		log.Printf("Restarting session to apply config changes")
+		restartSession.Store(true)
+		stopSession()
+	}
+
+	simulate = func() {
+		go func() {
+			log.Printf("Simulating %d players", simulatedPlayers)
+			result, err := client.SimulatePlayers(context.Background(), c, simulatedPlayers, simulationTime)
+			log.Printf("Player simulation: %v: %v", result, err)
+			if err != nil {
+				return
+			}
+			message := trf("%d of %d simulated players reached your server, %d replies from the game",
+				result.Joined, result.Players, result.Replies)
+			showToast("Player simulation finished", message,
+				toastAction{Text: "Open log", Command: appCommandOpenLog})
+		}()
 	}
 
+	ui.setStatsSource(c.Stats, cfg.RateLimit != nil)
+	sessionActive.Store(true)
 	done := make(chan struct{})
-	noUpdateUI := false
-	stopAndWait = func() { noUpdateUI = true; cancel(); <-done }
+	stopAndWait = func() { _ = c.Stop(context.Background()); <-done }
+	// It fails only if the client has already been stopped, which Wait reports.
+	_ = c.Start()
+	go watchGameExit(done, stopSession)
 	go func() {
+		defer handleCrash()
+		var tuning processTuning
+		go tuning.watch(done)
 		defer close(done)
-		defer cancel()
-		err := c.Run(ctx)
-		log.Printf("Client stopped: %v", err)
-		if err != nil && !errors.Is(err, context.Canceled) {
-			showErrorF("Client error: %v", err)
-		}
-
-		// Restore master addr in registry.
-		if prevGame != "" {
-			err = setRegistryKeyString(HKCU, gameKeyPath, "Master Server Name", prevGame)
-			if err != nil {
-				showErrorF("Failed to restore game's master addr: %v", err)
-			}
-		}
-		if prevStarter != "" {
-			err = setRegistryKeyString(HKCU, starterKeyPath, "Master Server Name", prevStarter)
-			if err != nil {
-				showErrorF("Failed to restore starter's master addr: %v", err)
+		status, err := c.Wait()
+		log.Printf("Client stopped: %v: %v", status, err)
+		switch status.Reason {
+		case client.ExitUserStopped:
+		case client.ExitAuthFailure:
+			// Ask for a new key once the session is cleaned up.
+			defer mainWnd.Synchronize(func() {
+				if showEnterKeyDialog("Server rejected your access key. Please enter a valid one.") {
+					start()
+				}
+			})
+		case client.ExitServerDisconnect, client.ExitNetworkLost:
+			if m, ok := maintenanceInProgress(); ok {
+				showMaintenanceStopped(m)
+			} else if status.Reason == client.ExitServerDisconnect {
+				showMessageF("Disconnected", walk.MsgBoxIconInformation,
+					"Server has closed the session.\n\nDetails: %v", err)
+			} else {
+				showErrorF("Connection to the server was lost. Please check your internet connection."+
+					"\n\nError: %v\n\n%s", err, helpLink("network"))
 			}
+		default:
+			showErrorF("Client error: %v\n\n%s", err, helpLink(""))
 		}
 
-		if !noUpdateUI {
-			stopBt.SetEnabled(false)
-			startBt.SetEnabled(true)
-			proxyIPEdit.SetEnabled(false)
-			proxyIPEdit.SetText("unassigned")
-			proxyStatus.SetText("stopped")
-			stopBt.Clicked().Detach(handle)
-		}
+		restoreRegistry()
+
+		announcedMaintenance.Store(nil)
+		launcher.reset()
+		ui.setStatsSource(nil, false)
+		ui.update(func(s *uiState) {
+			// Summary of the session might have arrived just before it ended.
+			summary := s.summary
+			*s = stoppedUIState
+			s.summary = summary
+		})
 		stopAndWait = func() {}
-	}()
-
-	go func() {
-		addr := c.GetProxyAddr(5000 * time.Millisecond)
-		if addr == "" {
-			return
+		stopSession = func() {}
+		reloadSession = func() {}
+		simulate = func() {}
+		sessionActive.Store(false)
+		if restartSession.Load() {
+			mainWnd.Synchronize(start)
 		}
-		proxyIPEdit.SetEnabled(true)
-		proxyIPEdit.SetText(addr)
-		proxyStatus.SetText("started")
-		stopBt.SetEnabled(true)
 	}()
 }
 
@@ -333,14 +554,14 @@ func showEnterKeyDialog(reason string) bool {
 
 	text := ""
 	if reason != "" {
-		text += reason + "\n\n"
+		text += tr(reason) + "\n\n"
 	}
-	text += "Please enter your access key. You can get it here: " +
+	text += tr("Please enter your access key. You can get it here: ") +
 		fmt.Sprintf(`<a id="this" href="%s">%s</a>`, webSite, webSite)
 
 	_ = dec.Dialog{
 		AssignTo:      &dlg,
-		Title:         "Enter access key",
+		Title:         tr("Enter access key"),
 		Icon:          walk.IconQuestion(),
 		DefaultButton: &buttonOk,
 		CancelButton:  &buttonCancel,
@@ -371,7 +592,7 @@ func showEnterKeyDialog(reason string) bool {
 				Children: []dec.Widget{
 					dec.PushButton{
 						AssignTo: &buttonOk,
-						Text:     "OK",
+						Text:     tr("OK"),
 						Enabled:  false,
 						OnClicked: func() {
 							key = keyEdit.Text()
@@ -389,7 +610,7 @@ func showEnterKeyDialog(reason string) bool {
 					},
 					dec.PushButton{
 						AssignTo: &buttonCancel,
-						Text:     "Cancel",
+						Text:     tr("Cancel"),
 						OnClicked: func() {
 							dlg.Cancel()
 						},
@@ -399,6 +620,7 @@ func showEnterKeyDialog(reason string) bool {
 		},
 	}.Create(getAndShowMainWindow())
 
+	applyTheme(dlg)
 	if dlg.Run() != walk.DlgCmdOK {
 		return false
 	}
@@ -409,14 +631,14 @@ func showEnterKeyDialog(reason string) bool {
 }
 
 func showAbout(icon walk.Image) {
-	var aboutText = `Tool for setting up public servers in the Evil Islands game without requiring a public IP or VPN. It's free and open source.
+	var aboutText = tr("Tool for setting up public servers in the Evil Islands game without requiring a public IP or VPN. It's free and open source.") + `
 
-- Version: ` + client.ClientVer + `
-- Author: Yury Kotov (aka Demoth)
-- Site: <a href="` + webSite + `">` + webSite + `</a>
-- Source code: <a href="https://github.com/koteyur/eiproxy">https://github.com/koteyur/eiproxy</a>
+- ` + tr("Version") + `: ` + client.ClientVer + `
+- ` + tr("Author") + `: ` + tr("Yury Kotov (aka Demoth)") + `
+- ` + tr("Site") + `: <a href="` + webSite + `">` + webSite + `</a>
+- ` + tr("Source code") + `: <a href="https://github.com/koteyur/eiproxy">https://github.com/koteyur/eiproxy</a>
 
-Third party components used:
+` + tr("Third party components used:") + `
 - Walk: <a href="https://github.com/lxn/walk">https://github.com/lxn/walk</a>
 - Win: <a href="https://github.com/lxn/win">https://github.com/lxn/win</a>
 `
@@ -425,7 +647,7 @@ Third party components used:
 	var dlg *walk.Dialog
 	_ = dec.Dialog{
 		AssignTo:      &dlg,
-		Title:         "About",
+		Title:         tr("About"),
 		Icon:          icon,
 		Font:          dec.Font{PointSize: walk.IntFrom96DPI(10, 96)},
 		CancelButton:  &btnOk,
@@ -453,7 +675,7 @@ Third party components used:
 					dec.HSpacer{},
 					dec.PushButton{
 						AssignTo: &btnOk,
-						Text:     "OK",
+						Text:     tr("OK"),
 						OnClicked: func() {
 							dlg.Accept()
 						},
@@ -464,6 +686,7 @@ Third party components used:
 		},
 	}.Create(mainWnd)
 
+	applyTheme(dlg)
 	_ = dlg.Run()
 }
 
@@ -493,6 +716,10 @@ func createTrayIcon(mw *walk.MainWindow, icon *walk.Icon) *walk.NotifyIcon {
 					mw.Hide()
 					return 0
 				}
+			case win.WM_COPYDATA:
+				cmd := receiveAppCommand(lParam)
+				mw.Synchronize(func() { handleAppCommand(cmd) })
+				return 1
 			}
 			return win.CallWindowProc(prevWndProc, hwnd, msg, wParam, lParam)
 		}),
@@ -515,9 +742,40 @@ func createTrayIcon(mw *walk.MainWindow, icon *walk.Icon) *walk.NotifyIcon {
 		}
 	})
 
+	// Session can be controlled from the tray without opening the window.
+	trayStatusAction = walk.NewAction()
+	_ = trayStatusAction.SetEnabled(false)
+	trayStartAction = newTrayAction("&Start", start)
+	trayStopAction = newTrayAction("S&top", func() { stopSession() })
+	trayCopyAction = newTrayAction("&Copy proxy IP", func() { handleAppCommand(appCommandCopyAddress) })
+	trayShareAction = newTrayAction("S&hare proxy IP...", func() { handleAppCommand(appCommandShareAddress) })
+	traySimulateAction = newTrayAction("Test with simulated &players", func() { simulate() })
+	trayRepairAction = newTrayAction("&Repair registry", repairRegistry)
+	trayLaunchAction := newTrayAction("&Launch game", launchGame)
+	for _, a := range []*walk.Action{
+		trayStatusAction, trayStartAction, trayStopAction, trayLaunchAction, trayCopyAction,
+		trayShareAction, traySimulateAction, trayRepairAction,
+		walk.NewSeparatorAction(),
+	} {
+		if err := ni.ContextMenu().Actions().Add(a); err != nil {
+			fatal(err)
+		}
+	}
+
+	autoStartAction = walk.NewAction()
+	if err := autoStartAction.SetText(tr("Start with &Windows")); err != nil {
+		fatal(err)
+	}
+	_ = autoStartAction.SetCheckable(true)
+	_ = autoStartAction.SetChecked(isAutoStartEnabled())
+	autoStartAction.Triggered().Attach(func() { toggleAutoStart(autoStartAction.Checked()) })
+	if err := ni.ContextMenu().Actions().Add(autoStartAction); err != nil {
+		fatal(err)
+	}
+
 	// We put an exit action into the context menu.
 	exitAction := walk.NewAction()
-	if err := exitAction.SetText("E&xit"); err != nil {
+	if err := exitAction.SetText(tr("E&xit")); err != nil {
 		fatal(err)
 	}
 	exitAction.Triggered().Attach(func() { walk.App().Exit(0) })
@@ -534,112 +792,33 @@ func createTrayIcon(mw *walk.MainWindow, icon *walk.Icon) *walk.NotifyIcon {
 }
 
 func checkKey(key string) error {
+	_, err := getUser(key)
+	return err
+}
+
+func getUser(key string) (protocol.UserResponse, error) {
 	key = normalizeKey(key)
 
 	userKey, err := protocol.UserKeyFromString(key)
 	if err != nil {
-		return err
-	}
-
-	_, err = newClient(userKey).GetUser(context.Background())
-	if err != nil {
-		var httpErr common.HttpError
-		if errors.As(err, &httpErr) {
-			switch httpErr {
-			case http.StatusUnauthorized:
-				return fmt.Errorf("%w: %w", errKeyUnauthorized, err)
-			case http.StatusServiceUnavailable:
-				return fmt.Errorf("%w: %w", errServerMaintenance, err)
-			default:
-				return fmt.Errorf("%w: %w", errServerInvalid, err)
-			}
-		}
-		return fmt.Errorf("%w: %w", errNetwork, err)
-	}
-
-	return nil
-}
-
-func checkUpdates() {
-	loadConfig()
-
-	// Update check disabled.
-	if cfg.UpdateCheckIntervalDays < 0 {
-		return
-	}
-
-	// Set default update check interval.
-	if cfg.UpdateCheckIntervalDays == 0 {
-		cfg.UpdateCheckIntervalDays = 7
+		return protocol.UserResponse{}, err
 	}
 
-	interval := time.Duration(cfg.UpdateCheckIntervalDays) * 24 * time.Hour
-	if time.Since(cfg.UpdateCheckTime) < interval {
-		return
-	}
-	cfg.UpdateCheckTime = time.Now()
-	saveConfig()
-
-	var response []struct {
-		HTMLURL    string `json:"html_url"`
-		TagName    string `json:"tag_name"`
-		Draft      bool   `json:"draft"`
-		Prerelease bool   `json:"prerelease"`
-	}
-	err := common.MakeApiRequest(http.MethodGet,
-		"https://api.github.com/repos/koteyur/eiproxy/releases", "", nil, &response)
+	c, err := newAPIClient(userKey)
 	if err != nil {
-		showErrorF("Failed to check for updates: %v", err)
-		return
+		return protocol.UserResponse{}, fmt.Errorf("%w: %w", errServerInvalid, err)
 	}
-
-	var verRegexp = regexp.MustCompile(`^v?\d+\.\d+\.\d+$`)
-
-	isVerGreater := func(v1, v2 string) bool {
-		// Assume that version looks like: v1.2.3 (3 numbers, no suffixes).
-		parts1 := strings.Split(strings.TrimPrefix(v1, "v"), ".")
-		parts2 := strings.Split(strings.TrimPrefix(v2, "v"), ".")
-		for i := 0; i < len(parts1) && i < len(parts2); i++ {
-			p1, _ := strconv.Atoi(parts1[i])
-			p2, _ := strconv.Atoi(parts2[i])
-			if p1 > p2 {
-				return true
-			} else if p1 < p2 {
-				return false
-			}
-		}
-		return false
+	user, err := c.GetUser(context.Background())
+	if err != nil && !errors.Is(err, client.ErrUnauthorized) &&
+		!errors.Is(err, client.ErrMaintenance) && !errors.Is(err, client.ErrNetwork) {
+		return user, fmt.Errorf("%w: %w", errServerInvalid, err)
 	}
 
-	var lastURL string
-	lastVer := client.ClientVer
-	includePrerelease := strings.HasPrefix(lastVer, "0.")
-	for _, r := range response {
-		if r.Draft || r.Prerelease && !includePrerelease || !verRegexp.MatchString(r.TagName) {
-			continue
-		}
-
-		if isVerGreater(r.TagName, lastVer) {
-			lastVer = r.TagName
-			lastURL = r.HTMLURL
-		}
-	}
-
-	if lastURL != "" {
-		showMessageF("New version available", walk.MsgBoxIconInformation,
-			"New version of EI Proxy is available: %s\n\n"+
-				"Please download it from: <a id=\"this\" href=\"%s\">%s</a>",
-			lastVer, lastURL, lastURL)
-	}
-}
-
-func isGameRunning() bool {
-	hWnd := win.FindWindow(windows.StringToUTF16Ptr("EIGAME"),
-		windows.StringToUTF16Ptr("Evil Islands"))
-	return hWnd != 0
+	return user, nil
 }
 
 func ensureSingleAppInstance() func() {
+	cmd, hasCmd := parseAppCommand(os.Args[1:])
 	handle, err := windows.CreateMutex(nil, false, windows.StringToUTF16Ptr("EIProxyClient"))
 	if err != nil {
 		if errors.Is(err, windows.ERROR_ALREADY_EXISTS) {
@@ -647,18 +826,35 @@ func ensureSingleAppInstance() func() {
 			hWnd := win.FindWindow(windows.StringToUTF16Ptr(walkWindowClass),
 				windows.StringToUTF16Ptr(mwTitle))
 			if hWnd != 0 {
-				win.ShowWindow(hWnd, win.SW_RESTORE)
-				win.SetForegroundWindow(hWnd)
+				if hasCmd {
+					// Launched from a toast button, pass the command to running instance.
+					sendAppCommand(hWnd, cmd)
+				} else if !launchedMinimized() {
+					win.ShowWindow(hWnd, win.SW_RESTORE)
+					win.SetForegroundWindow(hWnd)
+				}
 			}
 			os.Exit(0)
 		}
 		fatal(err)
 	}
+	if hasCmd {
+		// Nothing to apply the command to.
+		_ = windows.CloseHandle(handle)
+		os.Exit(0)
+	}
 	return func() {
 		_ = windows.CloseHandle(handle)
 	}
 }
 
+func getLogPath() string {
+	if filepath.IsAbs(cfg.LogFile) {
+		return cfg.LogFile
+	}
+	return filepath.Join(getExeDir(), cfg.LogFile)
+}
+
 func getAndShowMainWindow() walk.Form {
 	if mainWnd != nil {
 		if !mainWnd.Visible() {
@@ -671,13 +867,102 @@ func getAndShowMainWindow() walk.Form {
 	return nil
 }
 
-func newClient(userKey protocol.UserKey) client.Client {
+func newClient(userKey protocol.UserKey, localMasterAddr string) (client.Client, error) {
+	clientCfg, err := newClientConfig(userKey, localMasterAddr)
+	if err != nil {
+		return nil, err
+	}
+	return client.New(clientCfg), nil
+}
+
+// newAPIClient returns the client of the server API set in the app config.
+func newAPIClient(userKey protocol.UserKey) (api.Client, error) {
+	serverURL, err := client.ParseURL(cfg.ServerURL)
+	if err != nil {
+		return api.Client{}, fmt.Errorf("ServerURL: %w", err)
+	}
+	var timeouts client.Timeouts
+	if cfg.Timeouts != nil {
+		timeouts = *cfg.Timeouts
+	}
+	return api.Client{
+		ServerURL:   serverURL.URL,
+		UserKey:     userKey,
+		Timeout:     timeouts.HTTP(),
+		Fingerprint: cfg.ServerFingerprint,
+	}, nil
+}
+
+// newClientConfig returns client config built from the app config.
+func newClientConfig(userKey protocol.UserKey, localMasterAddr string) (client.Config, error) {
+	masterAddr, err := client.ParseHostPort(cfg.MasterAddr)
+	if err != nil {
+		return client.Config{}, fmt.Errorf("MasterAddr: %w", err)
+	}
+	localMaster, err := client.ParseHostPort(localMasterAddr)
+	if err != nil {
+		return client.Config{}, fmt.Errorf("local master address: %w", err)
+	}
+	serverURL, err := client.ParseURL(cfg.ServerURL)
+	if err != nil {
+		return client.Config{}, fmt.Errorf("ServerURL: %w", err)
+	}
+
+	rosterPath := cfg.RosterPath
+	if rosterPath != "" && !filepath.IsAbs(rosterPath) {
+		rosterPath = filepath.Join(getExeDir(), rosterPath)
+	}
+
 	clientCfg := client.Config{
-		MasterAddr: cfg.MasterAddr,
-		ServerURL:  cfg.ServerURL,
-		UserKey:    userKey,
+		MasterAddr:          masterAddr,
+		ServerURL:           serverURL,
+		ServerFingerprint:   cfg.ServerFingerprint,
+		UserKey:             userKey,
+		Obfuscate:           cfg.Obfuscate,
+		Encrypt:             cfg.Encrypt,
+		LocalMasterAddr:     localMaster,
+		Checksum:            cfg.Checksum,
+		Compress:            cfg.Compress,
+		BatchWindowMs:       cfg.BatchWindowMs,
+		AdaptiveKeepAlive:   cfg.AdaptiveKeepAlive,
+		WaitForSlot:         cfg.WaitForSlot,
+		BootstrapFromServer: cfg.BootstrapFromServer,
+		RosterPath:          rosterPath,
+		NameAPIURL:          cfg.NameAPIURL,
+		VirtualIPRange:      cfg.VirtualIPRange,
+	}
+	if cfg.CaptureFile != "" {
+		clientCfg.CaptureFile = cfg.CaptureFile
+		if !filepath.IsAbs(cfg.CaptureFile) {
+			clientCfg.CaptureFile = filepath.Join(getExeDir(), cfg.CaptureFile)
+		}
+	}
+	if cfg.Timeouts != nil {
+		clientCfg.Timeouts = *cfg.Timeouts
+	}
+	if cfg.RateLimit != nil {
+		clientCfg.RateLimit = *cfg.RateLimit
+	}
+	if cfg.PeerMapFile != "" {
+		clientCfg.PeerMapFile = cfg.PeerMapFile
+		if !filepath.IsAbs(cfg.PeerMapFile) {
+			clientCfg.PeerMapFile = filepath.Join(getExeDir(), cfg.PeerMapFile)
+		}
+	}
+	if cfg.DeadlineAuditFile != "" {
+		clientCfg.DeadlineAuditFile = cfg.DeadlineAuditFile
+		if !filepath.IsAbs(cfg.DeadlineAuditFile) {
+			clientCfg.DeadlineAuditFile = filepath.Join(getExeDir(), cfg.DeadlineAuditFile)
+		}
+	}
+	if cfg.TURNAddr != "" {
+		clientCfg.TURN = &client.TURNConfig{
+			Addr:     cfg.TURNAddr,
+			Username: cfg.TURNUsername,
+			Password: cfg.TURNPassword,
+		}
 	}
-	return client.New(clientCfg)
+	return clientCfg, nil
 }
 
 func fatal(err error) {
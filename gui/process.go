@@ -0,0 +1,207 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/lxn/win"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32                   = windows.NewLazySystemDLL("kernel32.dll")
+	procGetProcessAffinityMask = kernel32.NewProc("GetProcessAffinityMask")
+	procSetProcessAffinityMask = kernel32.NewProc("SetProcessAffinityMask")
+)
+
+var priorityClasses = map[string]uint32{
+	"normal":       windows.NORMAL_PRIORITY_CLASS,
+	"above_normal": windows.ABOVE_NORMAL_PRIORITY_CLASS,
+	"high":         windows.HIGH_PRIORITY_CLASS,
+}
+
+func isGameRunning() bool {
+	hWnd := win.FindWindow(windows.StringToUTF16Ptr("EIGAME"),
+		windows.StringToUTF16Ptr("Evil Islands"))
+	if hWnd != 0 {
+		return true
+	}
+	return len(cfg.GameExecutables) > 0 && isProcessRunning(cfg.GameExecutables)
+}
+
+// isProcessRunning checks whether any process with one of the given executable names is running.
+func isProcessRunning(exeNames []string) bool {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		log.Printf("Failed to list processes: %v", err)
+		return false
+	}
+	defer windows.CloseHandle(snapshot)
+
+	entry := windows.ProcessEntry32{Size: uint32(unsafe.Sizeof(windows.ProcessEntry32{}))}
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		exeFile := windows.UTF16ToString(entry.ExeFile[:])
+		for _, name := range exeNames {
+			if strings.EqualFold(exeFile, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// watchGameExit calls stop once the game has been closed for config.AutoStopMinutes, so an idle
+// session doesn't hold the server port. It returns when done is closed.
+func watchGameExit(done <-chan struct{}, stop func()) {
+	if cfg.AutoStopMinutes <= 0 {
+		return
+	}
+	delay := time.Duration(cfg.AutoStopMinutes) * time.Minute
+
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	var seen bool
+	var closedAt time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		switch {
+		case isGameRunning():
+			seen = true
+			closedAt = time.Time{}
+		case !seen:
+			// Game hasn't been started yet.
+		case closedAt.IsZero():
+			log.Printf("Game has been closed, stopping the proxy in %v unless it's started again", delay)
+			closedAt = time.Now()
+		case time.Since(closedAt) >= delay:
+			log.Printf("Game has been closed for %v, stopping the proxy", delay)
+			showToast("Proxy stopped", trf("The game has been closed for %d minutes, so the "+
+				"proxy has been stopped.", cfg.AutoStopMinutes))
+			stop()
+			return
+		}
+	}
+}
+
+// processTuning applies priority and CPU affinity from config to the current process while
+// the game is running and restores previous values afterwards.
+type processTuning struct {
+	mut          sync.Mutex
+	applied      bool
+	prevPriority uint32
+	prevAffinity uintptr
+}
+
+func (t *processTuning) enabled() bool {
+	return cfg.GameplayPriority != "" || cfg.GameplayCPUAffinity != 0
+}
+
+// watch periodically checks if the game is running until done is closed.
+func (t *processTuning) watch(done <-chan struct{}) {
+	if !t.enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	defer t.restore()
+
+	for {
+		if isGameRunning() {
+			t.apply()
+		} else {
+			t.restore()
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *processTuning) apply() {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if t.applied {
+		return
+	}
+
+	proc := windows.CurrentProcess()
+	prevPriority, err := windows.GetPriorityClass(proc)
+	if err != nil {
+		log.Printf("Failed to get process priority: %v", err)
+		return
+	}
+	var prevAffinity, systemAffinity uintptr
+	r, _, err := procGetProcessAffinityMask.Call(uintptr(proc),
+		uintptr(unsafe.Pointer(&prevAffinity)), uintptr(unsafe.Pointer(&systemAffinity)))
+	if r == 0 {
+		log.Printf("Failed to get process affinity: %v", err)
+		return
+	}
+
+	if cfg.GameplayPriority != "" {
+		priority, ok := priorityClasses[cfg.GameplayPriority]
+		if !ok {
+			log.Printf("Unknown gameplay priority %q", cfg.GameplayPriority)
+		} else if err := windows.SetPriorityClass(proc, priority); err != nil {
+			log.Printf("Failed to set process priority: %v", err)
+		}
+	}
+	if cfg.GameplayCPUAffinity != 0 {
+		if err := setProcessAffinity(uintptr(cfg.GameplayCPUAffinity) & systemAffinity); err != nil {
+			log.Printf("Failed to set process affinity: %v", err)
+		}
+	}
+
+	log.Printf("Game is running, applied process priority %q and affinity %#x",
+		cfg.GameplayPriority, cfg.GameplayCPUAffinity)
+	t.prevPriority = prevPriority
+	t.prevAffinity = prevAffinity
+	t.applied = true
+}
+
+func (t *processTuning) restore() {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if !t.applied {
+		return
+	}
+
+	if err := windows.SetPriorityClass(windows.CurrentProcess(), t.prevPriority); err != nil {
+		log.Printf("Failed to restore process priority: %v", err)
+	}
+	if err := setProcessAffinity(t.prevAffinity); err != nil {
+		log.Printf("Failed to restore process affinity: %v", err)
+	}
+
+	log.Printf("Restored process priority and affinity")
+	t.applied = false
+}
+
+func setProcessAffinity(mask uintptr) error {
+	if mask == 0 {
+		return fmt.Errorf("affinity mask doesn't match any available CPU")
+	}
+	r, _, err := procSetProcessAffinityMask.Call(uintptr(windows.CurrentProcess()), mask)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,494 @@
+//go:build windows
+
+package main
+
+import (
+	"eiproxy/client"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lxn/walk"
+	dec "github.com/lxn/walk/declarative"
+	"github.com/lxn/win"
+)
+
+// Master server address is overridden in:
+// - HKCU\Software\Gipat.Ru\EI_Starter\EvilIslands\Network Settings\Master Server Name
+// - HKCU\Software\Nival Interactive\EvilIslands\Network Settings\Master Server Name
+// - HKLM\Software\Nival Interactive\EvilIslands\Network Settings\Master Server Name, if
+// OverrideMachineRegistry is set
+// - values listed in config.MasterAddrProfiles or found under known vendor keys
+const (
+	HKCU                = win.HKEY_CURRENT_USER
+	HKLM                = win.HKEY_LOCAL_MACHINE
+	gameKeyPath         = `Software\Nival Interactive\EvilIslands\Network Settings`
+	starterKeyPath      = `Software\Gipat.Ru\EI_Starter\EvilIslands\Network Settings`
+	masterAddrValueName = "Master Server Name"
+)
+
+// Values of config.MasterOverrideMode.
+const (
+	// Point the game to the proxy while it's running. It's the default.
+	masterOverrideRegistry = "registry"
+	// Leave the registry alone if the game already points to the proxy, otherwise ask which
+	// profiles to override.
+	masterOverrideDetect = "detect"
+)
+
+// masterAddrProfile is a registry value where a game copy or a launcher keeps the master
+// server address.
+type masterAddrProfile struct {
+	name  string // key in config.MasterOverrideProfiles
+	title string
+	root  win.HKEY
+	path  string
+	value string
+}
+
+var builtinMasterAddrProfiles = []masterAddrProfile{
+	{"game", "Evil Islands", HKCU, gameKeyPath, masterAddrValueName},
+	{"starter", "EI Starter", HKCU, starterKeyPath, masterAddrValueName},
+	{"game-machine", "Evil Islands (all users)", HKLM, gameKeyPath, masterAddrValueName},
+}
+
+// Vendor keys scanned for other installs, e.g. localized or repacked ones, which keep the
+// master server address in a "Network Settings" subkey.
+var masterAddrVendorPaths = []string{
+	`Software\Nival Interactive`,
+	`Software\Nival`,
+	`Software\1C`,
+	`Software\GOG.com\Games`,
+	`Software\Gipat.Ru`,
+}
+
+// Subkey levels scanned below a vendor key.
+const masterAddrScanDepth = 4
+
+var registryHives = map[string]win.HKEY{"HKCU": HKCU, "HKLM": HKLM}
+
+func hiveName(root win.HKEY) string {
+	for name, h := range registryHives {
+		if h == root {
+			return name
+		}
+	}
+	return fmt.Sprintf("%#x", uintptr(root))
+}
+
+// newMasterAddrProfile returns a profile named after its location.
+func newMasterAddrProfile(root win.HKEY, path, value string) masterAddrProfile {
+	location := fmt.Sprintf(`%s\%s\%s`, hiveName(root), path, value)
+	return masterAddrProfile{name: location, title: location, root: root, path: path, value: value}
+}
+
+// machine reports whether the profile requires administrator rights, see
+// config.OverrideMachineRegistry.
+func (p masterAddrProfile) machine() bool {
+	return p.root == HKLM
+}
+
+func (p masterAddrProfile) sameLocation(other masterAddrProfile) bool {
+	return p.root == other.root && strings.EqualFold(p.path, other.path) &&
+		strings.EqualFold(p.value, other.value)
+}
+
+func (p masterAddrProfile) read() (string, error) {
+	return registryKeyString(p.root, p.path, p.value)
+}
+
+func (p masterAddrProfile) write(value string) error {
+	return setRegistryKeyString(p.root, p.path, p.value, value)
+}
+
+// enabledMasterAddrProfiles returns built-in, configured and discovered profiles which exist
+// and may be overridden.
+func enabledMasterAddrProfiles() []masterAddrProfile {
+	candidates := append([]masterAddrProfile(nil), builtinMasterAddrProfiles...)
+	for _, pc := range cfg.MasterAddrProfiles {
+		p, err := pc.profile()
+		if err != nil {
+			log.Printf("Skipping master server profile %q: %v", pc.Path, err)
+			continue
+		}
+		candidates = append(candidates, p)
+	}
+	candidates = append(candidates, discoverMasterAddrProfiles()...)
+
+	var profiles []masterAddrProfile
+next:
+	for _, p := range candidates {
+		if p.machine() && !cfg.OverrideMachineRegistry {
+			continue
+		}
+		for _, added := range profiles {
+			if added.sameLocation(p) {
+				continue next
+			}
+		}
+		if _, err := p.read(); err == nil {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles
+}
+
+// discoverMasterAddrProfiles scans vendor keys for "Network Settings" subkeys with the master
+// server address.
+func discoverMasterAddrProfiles() []masterAddrProfile {
+	if cfg.DisableProfileDiscovery {
+		return nil
+	}
+	var profiles []masterAddrProfile
+	var scan func(root win.HKEY, path string, depth int)
+	scan = func(root win.HKEY, path string, depth int) {
+		for _, name := range registrySubKeys(root, path) {
+			subPath := path + `\` + name
+			if strings.EqualFold(name, "Network Settings") {
+				p := newMasterAddrProfile(root, subPath, masterAddrValueName)
+				if _, err := p.read(); err == nil {
+					profiles = append(profiles, p)
+				}
+			} else if depth > 1 {
+				scan(root, subPath, depth-1)
+			}
+		}
+	}
+	for _, root := range []win.HKEY{HKCU, HKLM} {
+		if root == HKLM && !cfg.OverrideMachineRegistry {
+			continue
+		}
+		for _, path := range masterAddrVendorPaths {
+			scan(root, path, masterAddrScanDepth)
+		}
+	}
+	return profiles
+}
+
+// masterAddrProfileConfig is a registry value with the master server address of an install
+// which isn't found automatically.
+type masterAddrProfileConfig struct {
+	Hive  string `json:",omitempty"` // "HKCU" (default) or "HKLM"
+	Path  string // e.g. "Software\\Vendor\\EvilIslands\\Network Settings"
+	Value string `json:",omitempty"` // "Master Server Name" by default
+}
+
+func (pc masterAddrProfileConfig) profile() (masterAddrProfile, error) {
+	hive := pc.Hive
+	if hive == "" {
+		hive = "HKCU"
+	}
+	root, ok := registryHives[strings.ToUpper(hive)]
+	if !ok {
+		return masterAddrProfile{}, fmt.Errorf("unknown hive %q, use HKCU or HKLM", pc.Hive)
+	}
+	path := strings.Trim(pc.Path, `\`)
+	if path == "" {
+		return masterAddrProfile{}, errors.New("path is empty")
+	}
+	value := pc.Value
+	if value == "" {
+		value = masterAddrValueName
+	}
+	return newMasterAddrProfile(root, path, value), nil
+}
+
+// registryBackupPath is the file with master server addresses overridden by the running
+// session. It's written before the registry is changed and removed once the values are
+// restored, so they can be restored on the next launch if the process is killed.
+func registryBackupPath() string {
+	return filepath.Join(getExeDir(), "registry-backup.json")
+}
+
+// registryBackupEntry is the previous value of an overridden profile. It keeps the location,
+// so the value is restored even if the profile is no longer configured or found.
+type registryBackupEntry struct {
+	Title    string
+	Hive     string
+	Path     string
+	Value    string
+	Previous string
+}
+
+func (e registryBackupEntry) profile() masterAddrProfile {
+	return masterAddrProfile{title: e.Title, root: registryHives[e.Hive], path: e.Path, value: e.Value}
+}
+
+func loadRegistryBackup() ([]registryBackupEntry, error) {
+	data, err := os.ReadFile(registryBackupPath())
+	if err != nil {
+		return nil, err
+	}
+	var backup []registryBackupEntry
+	if err = json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", registryBackupPath(), err)
+	}
+	return backup, nil
+}
+
+// overrideMasterAddr points profiles to the local master server addr and returns a function
+// which restores previous values.
+func overrideMasterAddr(addr string, profiles []masterAddrProfile) (restore func(), err error) {
+	if len(profiles) == 0 {
+		return func() {}, nil
+	}
+
+	// Values left by a crashed session are restored to the backed up or default ones.
+	prevBackup, _ := loadRegistryBackup()
+	var backup []registryBackupEntry
+	for _, p := range profiles {
+		value, err := p.read()
+		if err != nil {
+			continue
+		}
+		if isProxyMasterAddr(value, addr) {
+			value = cfg.MasterAddr
+			for _, e := range prevBackup {
+				if e.profile().sameLocation(p) {
+					value = e.Previous
+				}
+			}
+		}
+		backup = append(backup, registryBackupEntry{
+			Title: p.title, Hive: hiveName(p.root), Path: p.path, Value: p.value, Previous: value,
+		})
+	}
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err == nil {
+		err = os.WriteFile(registryBackupPath(), data, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up previous values: %w", err)
+	}
+
+	restore = func() { restoreMasterAddr(backup) }
+	for _, e := range backup {
+		if err := e.profile().write(addr); err != nil {
+			restore()
+			return nil, fmt.Errorf("%s: %w", e.Title, err)
+		}
+	}
+	return restore, nil
+}
+
+// restoreMasterAddr writes backed up values to the registry and removes the backup if all of
+// them are restored.
+func restoreMasterAddr(backup []registryBackupEntry) {
+	failed := false
+	for _, e := range backup {
+		if err := e.profile().write(e.Previous); err != nil {
+			showErrorF("Failed to restore master server address of %s: %v", e.Title, err)
+			failed = true
+			continue
+		}
+		log.Printf("Restored master server address of %s: %s", e.Title, e.Previous)
+	}
+	if failed {
+		return
+	}
+	if err := os.Remove(registryBackupPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove registry backup: %v", err)
+	}
+}
+
+// isProxyMasterAddr reports whether the registry value points to the master proxy listening
+// on addr or on the default address, which older versions always used, i.e. it was written by
+// eiproxy and never restored. Other local addresses, e.g. of a master server run by the user,
+// are left alone.
+func isProxyMasterAddr(value, addr string) bool {
+	return pointsToMasterAddr(value, addr) || pointsToMasterAddr(value, client.DefaultLocalMasterAddr)
+}
+
+// isLocalAddr reports whether the registry value points to this machine.
+func isLocalAddr(value string) bool {
+	host := strings.TrimSpace(value)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+// pointsToMasterAddr reports whether the registry value makes the game use the local master
+// server addr. The game uses the default port if the value has none.
+func pointsToMasterAddr(value, addr string) bool {
+	if !isLocalAddr(value) {
+		return false
+	}
+	_, port, err := net.SplitHostPort(strings.TrimSpace(value))
+	if err != nil {
+		return addr == client.DefaultLocalMasterAddr
+	}
+	_, wantPort, _ := net.SplitHostPort(addr)
+	return port == wantPort
+}
+
+// chooseMasterAddrOverrides returns profiles to override in the detect mode. Profiles which
+// already point to the proxy are left alone, the user is asked about the others unless the
+// choice has been remembered.
+func chooseMasterAddrOverrides(addr string) []masterAddrProfile {
+	var ask, chosen []masterAddrProfile
+	for _, p := range enabledMasterAddrProfiles() {
+		value, _ := p.read()
+		if pointsToMasterAddr(value, addr) {
+			log.Printf("%s already uses the local master server %s", p.title, value)
+			continue
+		}
+		override, remembered := cfg.MasterOverrideProfiles[p.name]
+		switch {
+		case !remembered:
+			ask = append(ask, p)
+		case override:
+			chosen = append(chosen, p)
+		}
+	}
+	if len(ask) == 0 {
+		return chosen
+	}
+
+	var dlg *walk.Dialog
+	var rememberCb *walk.CheckBox
+	checks := make([]*walk.CheckBox, len(ask))
+	children := []dec.Widget{
+		dec.Label{
+			Text: trf("These don't point to the local master server %s, so the game won't see "+
+				"the proxy. Choose which of them to point to it while the proxy is running.", addr),
+			MaxSize: dec.Size{Width: 400},
+		},
+	}
+	for i, p := range ask {
+		value, _ := p.read()
+		children = append(children, dec.CheckBox{
+			AssignTo: &checks[i],
+			Text:     fmt.Sprintf("%s (%s)", tr(p.title), value),
+			Checked:  true,
+		})
+	}
+	var btnOK, btnCancel *walk.PushButton
+	children = append(children,
+		dec.CheckBox{AssignTo: &rememberCb, Text: tr("Remember my choice")},
+		dec.Composite{
+			Layout: dec.HBox{MarginsZero: true},
+			Children: []dec.Widget{
+				dec.HSpacer{},
+				dec.PushButton{AssignTo: &btnOK, Text: tr("OK"), OnClicked: func() { dlg.Accept() }},
+				dec.PushButton{AssignTo: &btnCancel, Text: tr("Skip"), OnClicked: func() { dlg.Cancel() }},
+			},
+		},
+	)
+	_ = dec.Dialog{
+		AssignTo:      &dlg,
+		Title:         tr("Master server"),
+		Icon:          walk.IconQuestion(),
+		Font:          dec.Font{PointSize: walk.IntFrom96DPI(10, 96)},
+		DefaultButton: &btnOK,
+		CancelButton:  &btnCancel,
+		Layout:        dec.VBox{},
+		Children:      children,
+	}.Create(getAndShowMainWindow())
+	applyTheme(dlg)
+	accepted := dlg.Run() == walk.DlgCmdOK
+
+	remember := rememberCb.Checked()
+	for i, p := range ask {
+		override := accepted && checks[i].Checked()
+		if override {
+			chosen = append(chosen, p)
+		}
+		if remember {
+			if cfg.MasterOverrideProfiles == nil {
+				cfg.MasterOverrideProfiles = make(map[string]bool)
+			}
+			cfg.MasterOverrideProfiles[p.name] = override
+		}
+	}
+	if remember {
+		saveConfig()
+	}
+	return chosen
+}
+
+// restoreStaleMasterAddr restores master server addresses backed up by a session which
+// hasn't cleaned up, e.g. because the process was killed. Without the backup, e.g. after a
+// crash of an older version, it offers to restore the default address if the game still uses
+// the local proxy.
+func restoreStaleMasterAddr(owner walk.Form) {
+	backup, err := loadRegistryBackup()
+	if err == nil {
+		log.Printf("Previous session hasn't restored master server addresses, restoring them")
+		restoreMasterAddr(backup)
+		return
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to load registry backup: %v", err)
+	}
+	if cfg.MasterOverrideMode == masterOverrideDetect {
+		// The game might be pointed to the proxy on purpose.
+		return
+	}
+
+	type override struct {
+		profile masterAddrProfile
+		value   string
+	}
+	var stale []override
+	for _, p := range enabledMasterAddrProfiles() {
+		value, err := p.read()
+		if err == nil && isProxyMasterAddr(value, client.DefaultLocalMasterAddr) {
+			stale = append(stale, override{p, value})
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	log.Printf("Master server address still points to the local proxy %s", stale[0].value)
+	answer := walk.MsgBox(owner, tr("Restore master server"),
+		trf("The game still uses the local master server %s, probably left by a crash of "+
+			"a previous version. Without the proxy running the game won't find any servers.\n\n"+
+			"Restore the master server address %s?", stale[0].value, cfg.MasterAddr),
+		walk.MsgBoxYesNo|walk.MsgBoxIconQuestion)
+	if answer != walk.DlgCmdYes {
+		return
+	}
+
+	for _, o := range stale {
+		err := o.profile.write(cfg.MasterAddr)
+		if err != nil {
+			showErrorF("Failed to restore master server address of %s: %v", o.profile.title, err)
+			continue
+		}
+		log.Printf("Restored master server address of %s: %s", o.profile.title, cfg.MasterAddr)
+	}
+}
+
+// repairRegistry restores master server addresses on user request, e.g. when the game can't
+// find any servers after the proxy was killed.
+func repairRegistry() {
+	if backup, err := loadRegistryBackup(); err == nil {
+		restoreMasterAddr(backup)
+	} else {
+		for _, p := range enabledMasterAddrProfiles() {
+			value, err := p.read()
+			if err != nil || !isProxyMasterAddr(value, client.DefaultLocalMasterAddr) {
+				continue
+			}
+			if err = p.write(cfg.MasterAddr); err != nil {
+				showErrorF("Failed to restore master server address of %s: %v", p.title, err)
+				return
+			}
+			log.Printf("Restored master server address of %s: %s", p.title, cfg.MasterAddr)
+		}
+	}
+	showMessageF("Repair registry", walk.MsgBoxIconInformation,
+		"Master server addresses of the game are restored.")
+}
@@ -0,0 +1,122 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"eiproxy/common"
+	"eiproxy/protocol"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lxn/walk"
+	dec "github.com/lxn/walk/declarative"
+)
+
+// showRelays shows relays from the community directory and lets user pick one.
+func showRelays() {
+	loadConfig()
+
+	directoryURL := cfg.DirectoryURL
+	if directoryURL == "" {
+		directoryURL = webSite
+	}
+
+	title := tr("Relays published by the community:")
+	relays, err := common.ListRelays(context.Background(), directoryURL)
+	if err != nil {
+		log.Printf("Failed to fetch relay list: %v", err)
+		title = tr("Relay directory is unavailable, showing built-in relays:")
+		relays = knownEndpoints()
+	}
+	if len(relays) == 0 {
+		showMessageF("Relays", walk.MsgBoxIconInformation, "There are no relays in the directory.")
+		return
+	}
+
+	items := make([]string, len(relays))
+	current := -1
+	for i, r := range relays {
+		items[i] = formatRelay(r)
+		if strings.TrimSuffix(r.ServerURL, "/") == strings.TrimSuffix(cfg.ServerURL, "/") {
+			current = i
+		}
+	}
+
+	var dlg *walk.Dialog
+	var relayList *walk.ListBox
+	var btnOk, btnCancel *walk.PushButton
+
+	_ = dec.Dialog{
+		AssignTo:      &dlg,
+		Title:         tr("Select relay"),
+		Icon:          walk.IconQuestion(),
+		Font:          dec.Font{PointSize: walk.IntFrom96DPI(10, 96)},
+		DefaultButton: &btnOk,
+		CancelButton:  &btnCancel,
+		MinSize:       dec.Size{Width: 450, Height: 300},
+		Layout:        dec.VBox{},
+		Children: []dec.Widget{
+			dec.Label{Text: title},
+			dec.ListBox{
+				AssignTo:        &relayList,
+				Model:           items,
+				OnItemActivated: func() { dlg.Accept() },
+			},
+			dec.Composite{
+				Layout: dec.HBox{},
+				Children: []dec.Widget{
+					dec.HSpacer{},
+					dec.PushButton{
+						AssignTo:  &btnOk,
+						Text:      tr("Use selected"),
+						OnClicked: func() { dlg.Accept() },
+					},
+					dec.PushButton{
+						AssignTo:  &btnCancel,
+						Text:      tr("Cancel"),
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}.Create(getAndShowMainWindow())
+
+	if current >= 0 {
+		_ = relayList.SetCurrentIndex(current)
+	}
+	applyTheme(dlg)
+	if dlg.Run() != walk.DlgCmdOK {
+		return
+	}
+
+	i := relayList.CurrentIndex()
+	if i < 0 {
+		return
+	}
+	relay := relays[i]
+	cfg.ServerURL = relay.ServerURL
+	cfg.ServerFingerprint = relay.Fingerprint
+	if relay.MasterAddr != "" {
+		cfg.MasterAddr = relay.MasterAddr
+	}
+	saveConfig()
+
+	if startBt.Enabled() {
+		return
+	}
+	showMessageF("Relay changed", walk.MsgBoxIconInformation,
+		"New relay will be used after the proxy is restarted.")
+}
+
+func formatRelay(r protocol.RelayInfo) string {
+	s := r.Name
+	if r.Region != "" {
+		s += fmt.Sprintf(" [%s]", r.Region)
+	}
+	if r.Capacity > 0 {
+		s += fmt.Sprintf(" - %d/%d", r.Occupancy, r.Capacity)
+	}
+	return s + " - " + r.ServerURL
+}
@@ -0,0 +1,182 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"eiproxy/common"
+	"eiproxy/protocol"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/lxn/walk"
+)
+
+const (
+	serverStatusInterval = 5 * time.Minute
+	// Last known status is shown for this long while the relay is unreachable.
+	serverStatusMaxAge = 30 * time.Minute
+)
+
+var serverStatusLink *walk.LinkLabel
+
+// Last fetched relay status. Accessed only from UI thread.
+var serverStatus struct {
+	status    protocol.ServerStatusResponse
+	serverURL string
+	fetched   time.Time
+}
+
+// runServerStatusChecks periodically refreshes relay status shown in the status bar.
+func runServerStatusChecks() {
+	defer handleCrash()
+
+	ticker := time.NewTicker(serverStatusInterval)
+	defer ticker.Stop()
+
+	for {
+		mainWnd.Synchronize(startServerStatusCheck)
+		<-ticker.C
+	}
+}
+
+// startServerStatusCheck must be called from UI thread.
+func startServerStatusCheck() {
+	serverURL, fingerprint := cfg.ServerURL, cfg.ServerFingerprint
+	if serverURL != serverStatus.serverURL {
+		// Relay was changed, status of the old one is irrelevant.
+		serverStatus.status = protocol.ServerStatusResponse{}
+		serverStatus.serverURL = serverURL
+		serverStatus.fetched = time.Time{}
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		status, err := common.GetServerStatus(ctx, serverURL, fingerprint)
+		mainWnd.Synchronize(func() { finishServerStatusCheck(serverURL, status, err) })
+	}()
+}
+
+func finishServerStatusCheck(serverURL string, status protocol.ServerStatusResponse, err error) {
+	if serverURL != serverStatus.serverURL {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get server status: %v", err)
+	} else {
+		if status.Notice != "" && status.Notice != serverStatus.status.Notice {
+			log.Printf("Server notice: %s", status.Notice)
+			showToast("Server notice", status.Notice)
+		}
+		serverStatus.status = status
+		serverStatus.fetched = time.Now()
+	}
+
+	text, tooltip := formatServerStatus(serverStatus.status, serverStatus.fetched)
+	_ = serverStatusLink.SetText(fmt.Sprintf(`<a id="this" href="%s">%s</a>`, webSite, text))
+	_ = serverStatusLink.SetToolTipText(tooltip)
+}
+
+// formatServerStatus returns status bar text and tooltip for the relay status fetched at
+// fetched. It falls back to the plain website link if the status is unknown or outdated.
+func formatServerStatus(s protocol.ServerStatusResponse, fetched time.Time) (text, tooltip string) {
+	if fetched.IsZero() || time.Since(fetched) > serverStatusMaxAge {
+		return tr("website"), ""
+	}
+
+	switch {
+	case s.Maintenance:
+		text = tr("maintenance")
+	case s.Capacity > 0:
+		text = trf("relay load %d%%", 100*s.Occupancy/s.Capacity)
+	default:
+		text = trf("%d sessions", s.Occupancy)
+	}
+	tooltip = trf("Server version %s, %d sessions", s.Version, s.Occupancy)
+	if s.Capacity > 0 {
+		tooltip = trf("Server version %s, %d of %d sessions", s.Version, s.Occupancy, s.Capacity)
+	}
+	if s.Notice != "" {
+		tooltip += "\n" + s.Notice
+	}
+	return text, tooltip
+}
+
+// showDeprecationWarning shows a warning about protocol features going away, at most once
+// a day so it isn't repeated on every reconnect.
+func showDeprecationWarning(message string) {
+	mainWnd.Synchronize(func() {
+		if time.Since(cfg.DeprecationWarningTime) < 24*time.Hour {
+			return
+		}
+		cfg.DeprecationWarningTime = time.Now()
+		saveConfig()
+		showToast("Client update needed", message,
+			toastAction{Text: "Open log", Command: appCommandOpenLog})
+	})
+}
+
+// Maintenance announced by the server in the current session, nil if none.
+var announcedMaintenance atomic.Pointer[protocol.Maintenance]
+
+// showMaintenanceNotice tells the user about maintenance announced by the server and remembers
+// it, so the connection lost during the maintenance is explained.
+func showMaintenanceNotice(m protocol.Maintenance) {
+	if m.Cancelled() {
+		announcedMaintenance.Store(nil)
+		showToast("Maintenance cancelled", tr("The server maintenance has been cancelled."))
+		return
+	}
+	announcedMaintenance.Store(&m)
+
+	message := trf("The server will be down for maintenance from %s.", formatMaintenanceTime(m.Start))
+	if m.Duration > 0 {
+		message = trf("The server will be down for maintenance from %s to %s.",
+			formatMaintenanceTime(m.Start), formatMaintenanceTime(m.Start.Add(m.Duration)))
+	}
+	if m.Message != "" {
+		message += "\n" + m.Message
+	}
+	showToast("Server maintenance", message)
+}
+
+// maintenanceInProgress returns the announced maintenance if the server is down for it now.
+func maintenanceInProgress() (protocol.Maintenance, bool) {
+	m := announcedMaintenance.Load()
+	if m == nil {
+		return protocol.Maintenance{}, false
+	}
+	// Server might close sessions a bit earlier.
+	now := time.Now().Add(time.Minute)
+	if now.Before(m.Start) || m.Duration > 0 && now.After(m.Start.Add(m.Duration+time.Minute)) {
+		return protocol.Maintenance{}, false
+	}
+	return *m, true
+}
+
+// showMaintenanceStopped explains that the session has ended because of the maintenance.
+func showMaintenanceStopped(m protocol.Maintenance) {
+	details := ""
+	if m.Message != "" {
+		details = "\n\n" + m.Message
+	}
+	if m.Duration > 0 {
+		showMessageF("Server maintenance", walk.MsgBoxIconInformation,
+			"Server is down for maintenance until %s. Please try again later.%s",
+			formatMaintenanceTime(m.Start.Add(m.Duration)), details)
+		return
+	}
+	showMessageF("Server maintenance", walk.MsgBoxIconInformation,
+		"Server is down for maintenance. Please try again later.%s", details)
+}
+
+func formatMaintenanceTime(t time.Time) string {
+	t = t.Local()
+	if t.Format(time.DateOnly) == time.Now().Format(time.DateOnly) {
+		return t.Format("15:04")
+	}
+	return t.Format("2006-01-02 15:04")
+}
@@ -0,0 +1,146 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+	"unsafe"
+
+	"github.com/lxn/walk"
+	"github.com/lxn/win"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// Values of config.Theme.
+const (
+	themeSystem = "system" // follow the Windows app mode, it's the default
+	themeLight  = "light"
+	themeDark   = "dark"
+)
+
+const personalizeKeyPath = `Software\Microsoft\Windows\CurrentVersion\Themes\Personalize`
+
+var (
+	dwmapi                    = windows.NewLazySystemDLL("dwmapi.dll")
+	procDwmSetWindowAttribute = dwmapi.NewProc("DwmSetWindowAttribute")
+)
+
+// Title bar follows the dark mode since Windows 10 20H1, older versions ignore it.
+const dwmwaUseImmersiveDarkMode = 20
+
+var (
+	darkBackground = walk.RGB(0x20, 0x20, 0x20)
+	darkText       = walk.RGB(0xf0, 0xf0, 0xf0)
+	// Shared by all forms, created on first use.
+	darkBrush walk.Brush
+)
+
+// isDarkTheme tells whether windows should be dark according to config.Theme.
+func isDarkTheme() bool {
+	switch cfg.Theme {
+	case themeDark:
+		return true
+	case "", themeSystem:
+		return isSystemDarkMode()
+	case themeLight:
+	default:
+		log.Printf("Unknown theme %q, using the light one", cfg.Theme)
+	}
+	return false
+}
+
+// isSystemDarkMode reports whether dark mode is chosen for apps in Windows settings.
+func isSystemDarkMode() bool {
+	key, err := registry.OpenKey(registry.CURRENT_USER, personalizeKeyPath, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	defer key.Close()
+	light, _, err := key.GetIntegerValue("AppsUseLightTheme")
+	return err == nil && light == 0
+}
+
+// applyTheme colors the form and its widgets. Buttons and check boxes keep the system look,
+// as common controls can't be recolored without owner drawing.
+func applyTheme(form walk.Form) {
+	dark := isDarkTheme()
+
+	var useDark int32
+	if dark {
+		useDark = 1
+	}
+	// Fails on systems without the attribute, the title bar stays light there.
+	_, _, _ = procDwmSetWindowAttribute.Call(uintptr(form.Handle()), dwmwaUseImmersiveDarkMode,
+		uintptr(unsafe.Pointer(&useDark)), unsafe.Sizeof(useDark))
+
+	var background walk.Brush
+	textColor := walk.Color(win.GetSysColor(win.COLOR_WINDOWTEXT))
+	if dark {
+		if darkBrush == nil {
+			brush, err := walk.NewSolidColorBrush(darkBackground)
+			if err != nil {
+				log.Printf("Failed to create background brush: %v", err)
+				return
+			}
+			darkBrush = brush
+		}
+		background = darkBrush
+		textColor = darkText
+	}
+	// Nil background restores the default one of the form.
+	form.SetBackground(background)
+	applyTextColor(form.Children(), textColor)
+}
+
+func applyTextColor(widgets *walk.WidgetList, c walk.Color) {
+	for i := 0; i < widgets.Len(); i++ {
+		w := widgets.At(i)
+		if colored, ok := w.(interface{ SetTextColor(walk.Color) }); ok {
+			colored.SetTextColor(c)
+		}
+		if container, ok := w.(walk.Container); ok {
+			applyTextColor(container.Children(), c)
+		}
+	}
+}
+
+// followSystemTheme reapplies the theme to the form when it's activated, so a change of the
+// Windows app mode is picked up without a restart.
+func followSystemTheme(form walk.Form) {
+	dark := isDarkTheme()
+	form.Activating().Attach(func() {
+		if d := isDarkTheme(); d != dark {
+			dark = d
+			applyTheme(form)
+		}
+	})
+}
+
+// fitMainWindow keeps the main window at its fixed size scaled to the DPI. The window grows if
+// the content doesn't fit, as fonts don't scale exactly, e.g. at 125% or 150%.
+func fitMainWindow() {
+	size := mainWnd.SizeFrom96DPI(walk.Size{Width: mwWidth, Height: mwHeight})
+
+	type minSizer interface {
+		MinSizeForSize(size walk.Size) walk.Size
+	}
+	if layout, ok := walk.CreateLayoutItemsForContainer(mainWnd).(minSizer); ok {
+		bounds, client := mainWnd.BoundsPixels(), mainWnd.ClientBoundsPixels()
+		frameWidth, frameHeight := bounds.Width-client.Width, bounds.Height-client.Height
+		content := layout.MinSizeForSize(walk.Size{
+			Width:  size.Width - frameWidth,
+			Height: size.Height - frameHeight,
+		})
+		if w := content.Width + frameWidth; w > size.Width {
+			size.Width = w
+		}
+		if h := content.Height + frameHeight; h > size.Height {
+			size.Height = h
+		}
+	}
+
+	if size != mainWnd.SizePixels() {
+		_ = mainWnd.SetSizePixels(size)
+	}
+}
@@ -0,0 +1,200 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/lxn/walk"
+	"github.com/lxn/win"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// URL scheme used by toast buttons to send commands back to the running app.
+const appURLScheme = "eiproxy"
+
+type appCommand string
+
+const (
+	appCommandCopyAddress  appCommand = "copy-address"
+	appCommandShareAddress appCommand = "share-address"
+	appCommandOpenLog      appCommand = "open-log"
+	appCommandStop         appCommand = "stop"
+)
+
+type toastAction struct {
+	Text    string
+	Command appCommand
+}
+
+var notifyIcon *walk.NotifyIcon
+
+// registerURLScheme registers eiproxy: URL scheme for the current user, so clicking a toast
+// button starts this executable with the command as an argument.
+func registerURLScheme() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	key, _, err := registry.CreateKey(registry.CURRENT_USER,
+		`Software\Classes\`+appURLScheme, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+
+	if err = key.SetStringValue("", "URL:"+mwTitle); err != nil {
+		return err
+	}
+	if err = key.SetStringValue("URL Protocol", ""); err != nil {
+		return err
+	}
+
+	cmdKey, _, err := registry.CreateKey(key, `shell\open\command`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer cmdKey.Close()
+
+	return cmdKey.SetStringValue("", fmt.Sprintf(`"%s" "%%1"`, exePath))
+}
+
+// showToast shows Windows toast notification with optional action buttons.
+// If toast can't be shown, it falls back to a plain tray balloon.
+// Title and action texts are translated, message is expected to be translated by the caller.
+func showToast(title, message string, actions ...toastAction) {
+	title = tr(title)
+	var actionsXML strings.Builder
+	for _, a := range actions {
+		fmt.Fprintf(&actionsXML, `<action content="%s" activationType="protocol" arguments="%s:%s"/>`,
+			html.EscapeString(tr(a.Text)), appURLScheme, a.Command)
+	}
+
+	toastXML := fmt.Sprintf(`<toast><visual><binding template="ToastGeneric">`+
+		`<text>%s</text><text>%s</text></binding></visual><actions>%s</actions></toast>`,
+		html.EscapeString(title), html.EscapeString(message), actionsXML.String())
+
+	// There is no simple way to use WinRT from Go, so let powershell do the job.
+	// AppID of powershell is used, as only registered apps are allowed to show toasts.
+	const appID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+	script := `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] | Out-Null
+$xml = New-Object Windows.Data.Xml.Dom.XmlDocument
+$xml.LoadXml('` + strings.ReplaceAll(toastXML, "'", "''") + `')
+$toast = New-Object Windows.UI.Notifications.ToastNotification $xml
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('` + appID + `').Show($toast)`
+
+	// Script is passed encoded, as stdin of powershell uses OEM code page and would break
+	// non-English texts.
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive",
+		"-EncodedCommand", encodePowerShellCommand(script))
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: windows.CREATE_NO_WINDOW}
+
+	go func() {
+		if output, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("Failed to show toast: %v: %s", err, output)
+			if notifyIcon != nil {
+				_ = notifyIcon.ShowInfo(title, message)
+			}
+		}
+	}()
+}
+
+// encodePowerShellCommand encodes script for -EncodedCommand: base64 of UTF-16LE.
+func encodePowerShellCommand(script string) string {
+	chars := utf16.Encode([]rune(script))
+	data := make([]byte, 0, len(chars)*2)
+	for _, c := range chars {
+		data = append(data, byte(c), byte(c>>8))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// parseAppCommand extracts command from eiproxy:<command> URL passed as an argument.
+func parseAppCommand(args []string) (appCommand, bool) {
+	for _, arg := range args {
+		if cmd, ok := strings.CutPrefix(arg, appURLScheme+":"); ok {
+			return appCommand(strings.Trim(cmd, "/")), true
+		}
+	}
+	return "", false
+}
+
+// sendAppCommand passes command to already running instance via WM_COPYDATA.
+func sendAppCommand(hWnd win.HWND, cmd appCommand) {
+	data, _ := syscall.UTF16FromString(string(cmd))
+	cds := copyDataStruct{
+		cbData: uint32(len(data) * 2),
+		lpData: unsafe.Pointer(&data[0]),
+	}
+	win.SendMessage(hWnd, win.WM_COPYDATA, 0, uintptr(unsafe.Pointer(&cds)))
+}
+
+// receiveAppCommand decodes command sent by sendAppCommand.
+func receiveAppCommand(lParam uintptr) appCommand {
+	cds := *(**copyDataStruct)(unsafe.Pointer(&lParam))
+	if cds.cbData == 0 {
+		return ""
+	}
+	data := unsafe.Slice((*uint16)(cds.lpData), cds.cbData/2)
+	return appCommand(syscall.UTF16ToString(data))
+}
+
+type copyDataStruct struct {
+	dwData uintptr
+	cbData uint32
+	lpData unsafe.Pointer
+}
+
+func handleAppCommand(cmd appCommand) {
+	switch cmd {
+	case appCommandCopyAddress:
+		copyProxyAddr(func(addr string) string { return addr })
+	case appCommandShareAddress:
+		// Message for other players, ready to paste into a chat.
+		copyProxyAddr(func(addr string) string {
+			return trf("Connect to %s via the in-game address book", addr)
+		})
+	case appCommandOpenLog:
+		openLog()
+	case appCommandStop:
+		stopSession()
+	default:
+		log.Printf("Unknown app command: %q", cmd)
+	}
+}
+
+// copyProxyAddr puts the text made by format from the proxy address into the clipboard.
+func copyProxyAddr(format func(addr string) string) {
+	addr := proxyIPEdit.Text()
+	if !proxyIPEdit.Enabled() {
+		showWarningF("Proxy address is not assigned yet.")
+		return
+	}
+	if err := walk.Clipboard().SetText(format(addr)); err != nil {
+		showErrorF("Failed to copy proxy address: %v", err)
+	}
+}
+
+func openLog() {
+	if cfg.LogFile == "" {
+		showLogViewer()
+		return
+	}
+	win.ShellExecute(mainWnd.Handle(),
+		syscall.StringToUTF16Ptr("open"),
+		syscall.StringToUTF16Ptr(getLogPath()),
+		nil, nil, win.SW_SHOWNORMAL,
+	)
+}
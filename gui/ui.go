@@ -0,0 +1,241 @@
+//go:build windows
+
+package main
+
+import (
+	"eiproxy/client"
+	"eiproxy/protocol"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lxn/walk"
+)
+
+// uiState is what the main window shows. Background goroutines only change the state and
+// ui applies it on the UI thread, coalescing frequent changes.
+type uiState struct {
+	status    string
+	proxyAddr string // empty while unassigned
+	canStart  bool
+	canStop   bool
+	peers     []string
+	quality   string // connection quality to the proxy server, empty if unknown
+	summary   string // usage of the last session reported by the server, kept once it's stopped
+}
+
+var stoppedUIState = uiState{status: "stopped", canStart: true}
+
+type uiUpdater struct {
+	mut   sync.Mutex
+	state uiState
+	dirty bool
+
+	// Source of the connected peers and connection quality, polled on each tick while session
+	// is running.
+	statsSource func() client.Stats
+	// Show traffic of the game, e.g. when it's capped by config.RateLimit.
+	showUsage bool
+}
+
+var ui = uiUpdater{state: stoppedUIState}
+
+const uiUpdateInterval = 250 * time.Millisecond
+
+// update changes the state, which will be shown on the next tick.
+func (u *uiUpdater) update(f func(s *uiState)) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	f(&u.state)
+	u.dirty = true
+}
+
+func (u *uiUpdater) setStatsSource(source func() client.Stats, showUsage bool) {
+	u.mut.Lock()
+	defer u.mut.Unlock()
+	u.statsSource = source
+	u.showUsage = showUsage
+	u.state.peers = nil
+	u.state.quality = ""
+	u.dirty = true
+}
+
+// updateNow changes the state and applies it immediately. Must be called on the UI thread.
+func (u *uiUpdater) updateNow(f func(s *uiState)) {
+	u.mut.Lock()
+	f(&u.state)
+	state := u.state
+	u.dirty = false
+	u.mut.Unlock()
+
+	applyUIState(state)
+}
+
+// run applies state changes to widgets until done is closed.
+func (u *uiUpdater) run(done <-chan struct{}) {
+	defer handleCrash()
+
+	ticker := time.NewTicker(uiUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		u.mut.Lock()
+		if u.statsSource != nil {
+			stats := u.statsSource()
+			peers := formatPeers(stats.Peers)
+			if !slices.Equal(peers, u.state.peers) {
+				u.state.peers = peers
+				u.dirty = true
+			}
+			quality := formatQuality(stats)
+			if u.showUsage {
+				quality = joinStatus(quality, formatUsage(stats))
+			}
+			if quality != u.state.quality {
+				u.state.quality = quality
+				u.dirty = true
+			}
+		}
+		state, dirty := u.state, u.dirty
+		u.dirty = false
+		u.mut.Unlock()
+
+		if dirty {
+			mainWnd.Synchronize(func() { applyUIState(state) })
+		}
+	}
+}
+
+func applyUIState(s uiState) {
+	status := tr(s.status)
+	if len(s.peers) > 0 {
+		status = trf("%s (%d players)", status, len(s.peers))
+	}
+	if s.quality != "" {
+		status += ", " + s.quality
+	}
+	if s.summary != "" {
+		status += ", " + s.summary
+	}
+	_ = proxyStatus.SetText(status)
+	_ = peerList.SetModel(s.peers)
+
+	if s.proxyAddr != "" {
+		proxyIPEdit.SetEnabled(true)
+		_ = proxyIPEdit.SetText(s.proxyAddr)
+	} else {
+		proxyIPEdit.SetEnabled(false)
+		_ = proxyIPEdit.SetText(tr("unassigned"))
+	}
+	copyAddrBt.SetEnabled(s.proxyAddr != "")
+	shareAddrBt.SetEnabled(s.proxyAddr != "")
+
+	startBt.SetEnabled(s.canStart)
+	stopBt.SetEnabled(s.canStop)
+	applyTrayState(s)
+}
+
+var (
+	trayStatusAction *walk.Action
+	trayStartAction  *walk.Action
+	trayStopAction   *walk.Action
+	trayCopyAction   *walk.Action
+	trayShareAction  *walk.Action
+
+	traySimulateAction *walk.Action
+	trayRepairAction   *walk.Action
+)
+
+func newTrayAction(text string, triggered func()) *walk.Action {
+	a := walk.NewAction()
+	if err := a.SetText(tr(text)); err != nil {
+		fatal(err)
+	}
+	a.Triggered().Attach(triggered)
+	return a
+}
+
+// applyTrayState updates the tray menu and tooltip, so the state is visible without opening
+// the window.
+func applyTrayState(s uiState) {
+	if notifyIcon == nil || trayStatusAction == nil {
+		return
+	}
+	status := trf("Status: %s", tr(s.status))
+	if len(s.peers) > 0 {
+		status = trf("%s, %d players", status, len(s.peers))
+	}
+	_ = trayStatusAction.SetText(status)
+	_ = trayStartAction.SetEnabled(s.canStart)
+	_ = trayStopAction.SetEnabled(s.canStop)
+	_ = trayCopyAction.SetEnabled(s.proxyAddr != "")
+	_ = trayShareAction.SetEnabled(s.proxyAddr != "")
+	_ = traySimulateAction.SetEnabled(s.proxyAddr != "")
+	// Running session keeps the registry pointed to the proxy.
+	_ = trayRepairAction.SetEnabled(s.canStart)
+
+	tooltip := fmt.Sprintf("%s - %s", mwTitle, tr(s.status))
+	if s.proxyAddr != "" {
+		tooltip += "\n" + s.proxyAddr
+	}
+	_ = notifyIcon.SetToolTip(tooltip)
+}
+
+// formatQuality formats connection quality to the proxy server, e.g. "ping 42 ms, loss 0%".
+func formatQuality(s client.Stats) string {
+	if s.RTT == 0 {
+		return ""
+	}
+	return trf("ping %d ms, loss %.0f%%", s.RTT.Milliseconds(), 100*s.PacketLoss)
+}
+
+// formatUsage formats traffic of the game, e.g. "up 12 KB/s, down 30 KB/s".
+func formatUsage(s client.Stats) string {
+	return trf("up %.0f KB/s, down %.0f KB/s", s.UploadRate/1024, s.DownloadRate/1024)
+}
+
+func joinStatus(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + ", " + b
+}
+
+// formatSessionSummary formats usage of the ended session, e.g. "last session 2 h 15 min, up to
+// 5 players, 120.5 MB".
+func formatSessionSummary(s protocol.SessionSummary) string {
+	minutes := int(s.Duration.Round(time.Minute) / time.Minute)
+	duration := trf("%d min", minutes)
+	if minutes >= 60 {
+		duration = trf("%d h %d min", minutes/60, minutes%60)
+	}
+	relayed := fmt.Sprintf("%d KB", s.BytesRelayed/1024)
+	if s.BytesRelayed >= 1<<20 {
+		relayed = fmt.Sprintf("%.1f MB", float64(s.BytesRelayed)/(1<<20))
+	}
+	return trf("last session %s, up to %d players, %s", duration, s.PeakPeers, relayed)
+}
+
+// formatPeers formats peers for the peer list, e.g. "Player (1.2.3.4) - 12 KB, idle 15s".
+func formatPeers(peers []client.PeerStats) []string {
+	lines := make([]string, 0, len(peers))
+	for _, p := range peers {
+		line := p.Addr.Addr().String()
+		if p.Name != "" {
+			line = fmt.Sprintf("%s (%s)", p.Name, line)
+		}
+		line += fmt.Sprintf(" - %d KB", (p.BytesSent+p.BytesReceived)/1024)
+		if idle := time.Since(p.LastActive); !p.LastActive.IsZero() && idle > 5*time.Second {
+			line += fmt.Sprintf(", idle %v", idle.Truncate(time.Second))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
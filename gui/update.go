@@ -0,0 +1,293 @@
+//go:build windows
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"eiproxy/client"
+	"eiproxy/common"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lxn/walk"
+	dec "github.com/lxn/walk/declarative"
+	"github.com/lxn/win"
+)
+
+const releasesURL = "https://api.github.com/repos/koteyur/eiproxy/releases"
+
+type releaseAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+type release struct {
+	HTMLURL    string         `json:"html_url"`
+	TagName    string         `json:"tag_name"`
+	Body       string         `json:"body"` // changelog
+	Draft      bool           `json:"draft"`
+	Prerelease bool           `json:"prerelease"`
+	Assets     []releaseAsset `json:"assets"`
+}
+
+func (r release) asset(name string) (releaseAsset, bool) {
+	for _, a := range r.Assets {
+		if strings.EqualFold(a.Name, name) {
+			return a, true
+		}
+	}
+	return releaseAsset{}, false
+}
+
+func checkUpdates() {
+	loadConfig()
+
+	// Update check disabled.
+	if cfg.UpdateCheckIntervalDays < 0 {
+		return
+	}
+
+	// Set default update check interval.
+	if cfg.UpdateCheckIntervalDays == 0 {
+		cfg.UpdateCheckIntervalDays = 7
+	}
+
+	interval := time.Duration(cfg.UpdateCheckIntervalDays) * 24 * time.Hour
+	if time.Since(cfg.UpdateCheckTime) < interval {
+		return
+	}
+	cfg.UpdateCheckTime = time.Now()
+	saveConfig()
+
+	var response []release
+	err := common.MakeApiRequestWithOptions(context.Background(), http.MethodGet, releasesURL,
+		nil, &response, common.ApiRequestOptions{Retry: common.DefaultApiRetry})
+	if err != nil {
+		showErrorF("Failed to check for updates: %v\n\n%s", err, helpLink("updates"))
+		return
+	}
+
+	if r, ok := findUpdate(response, client.ClientVer); ok {
+		showUpdateDialog(r)
+	}
+}
+
+// findUpdate returns the newest release which is newer than current version.
+func findUpdate(releases []release, currentVer string) (release, bool) {
+	var verRegexp = regexp.MustCompile(`^v?\d+\.\d+\.\d+$`)
+
+	isVerGreater := func(v1, v2 string) bool {
+		// Assume that version looks like: v1.2.3 (3 numbers, no suffixes).
+		parts1 := strings.Split(strings.TrimPrefix(v1, "v"), ".")
+		parts2 := strings.Split(strings.TrimPrefix(v2, "v"), ".")
+		for i := 0; i < len(parts1) && i < len(parts2); i++ {
+			p1, _ := strconv.Atoi(parts1[i])
+			p2, _ := strconv.Atoi(parts2[i])
+			if p1 > p2 {
+				return true
+			} else if p1 < p2 {
+				return false
+			}
+		}
+		return false
+	}
+
+	var last release
+	lastVer := currentVer
+	includePrerelease := strings.HasPrefix(currentVer, "0.")
+	for _, r := range releases {
+		if r.Draft || r.Prerelease && !includePrerelease || !verRegexp.MatchString(r.TagName) {
+			continue
+		}
+
+		if isVerGreater(r.TagName, lastVer) {
+			lastVer = r.TagName
+			last = r
+		}
+	}
+	return last, last.TagName != ""
+}
+
+func showUpdateDialog(r release) {
+	exeName := filepath.Base(os.Args[0])
+	_, canInstall := r.asset(exeName)
+
+	changelog := strings.TrimSpace(r.Body)
+	if changelog == "" {
+		changelog = tr("No changelog provided.")
+	}
+
+	var dlg *walk.Dialog
+	var btnDownload, btnInstall, btnLater *walk.PushButton
+	_ = dec.Dialog{
+		AssignTo:      &dlg,
+		Title:         tr("New version available"),
+		Icon:          walk.IconInformation(),
+		Font:          dec.Font{PointSize: walk.IntFrom96DPI(10, 96)},
+		DefaultButton: &btnDownload,
+		CancelButton:  &btnLater,
+		MinSize:       dec.Size{Width: 450, Height: 350},
+		Layout:        dec.VBox{},
+		Children: []dec.Widget{
+			dec.Label{
+				Text: trf("New version of EI Proxy is available: %s (current: %s)",
+					r.TagName, client.ClientVer),
+			},
+			dec.TextEdit{
+				Text:     strings.ReplaceAll(changelog, "\n", "\r\n"),
+				ReadOnly: true,
+				VScroll:  true,
+			},
+			dec.Composite{
+				Layout: dec.HBox{},
+				Children: []dec.Widget{
+					dec.HSpacer{},
+					dec.PushButton{
+						AssignTo: &btnInstall,
+						Text:     tr("Install"),
+						Visible:  canInstall,
+						OnClicked: func() {
+							dlg.Accept()
+							installUpdate(r, exeName)
+						},
+					},
+					dec.PushButton{
+						AssignTo: &btnDownload,
+						Text:     tr("Download"),
+						OnClicked: func() {
+							dlg.Accept()
+							win.ShellExecute(mainWnd.Handle(),
+								syscall.StringToUTF16Ptr("open"),
+								syscall.StringToUTF16Ptr(r.HTMLURL),
+								nil, nil, win.SW_SHOWNORMAL,
+							)
+						},
+					},
+					dec.PushButton{
+						AssignTo:  &btnLater,
+						Text:      tr("Later"),
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}.Create(getAndShowMainWindow())
+
+	applyTheme(dlg)
+	dlg.Run()
+}
+
+// installUpdate downloads new executable and swaps it with the running one. Running exe can't
+// be overwritten on Windows, but it can be renamed, so the old one is removed on next start.
+func installUpdate(r release, exeName string) {
+	exePath, err := os.Executable()
+	if err != nil {
+		showErrorF("Failed to install update: %v", err)
+		return
+	}
+
+	newPath := exePath + ".new"
+	err = downloadAsset(r, exeName, newPath)
+	if err != nil {
+		os.Remove(newPath)
+		showErrorF("Failed to download update: %v", err)
+		return
+	}
+
+	oldPath := exePath + ".old"
+	os.Remove(oldPath)
+	if err = os.Rename(exePath, oldPath); err != nil {
+		os.Remove(newPath)
+		showErrorF("Failed to install update: %v", err)
+		return
+	}
+	if err = os.Rename(newPath, exePath); err != nil {
+		_ = os.Rename(oldPath, exePath)
+		showErrorF("Failed to install update: %v", err)
+		return
+	}
+
+	log.Printf("Updated to %s", r.TagName)
+	showMessageF("Update installed", walk.MsgBoxIconInformation,
+		"EI Proxy %s has been installed. Please restart EI Proxy to use it.", r.TagName)
+}
+
+// downloadAsset downloads release asset to path and verifies it against <name>.sha256 asset,
+// which the release must have.
+func downloadAsset(r release, name, path string) error {
+	a, ok := r.asset(name)
+	if !ok {
+		return fmt.Errorf("release doesn't have %s", name)
+	}
+	sumAsset, ok := r.asset(name + ".sha256")
+	if !ok {
+		return fmt.Errorf("release doesn't have checksum of %s", name)
+	}
+
+	httpClient := http.Client{Timeout: 2 * time.Minute}
+	resp, err := httpClient.Get(a.BrowserDownloadURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return common.HttpError(resp.StatusCode)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	resp, err = httpClient.Get(sumAsset.BrowserDownloadURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return common.HttpError(resp.StatusCode)
+	}
+
+	// Format of sha256sum: "<hex>  <file name>".
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], hex.EncodeToString(h.Sum(nil))) {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
+
+// removeOldExecutable removes executable left after the update.
+func removeOldExecutable() {
+	exePath, err := os.Executable()
+	if err != nil {
+		return
+	}
+	if err := os.Remove(exePath + ".old"); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove old executable: %v", err)
+	}
+}
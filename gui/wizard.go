@@ -0,0 +1,259 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"eiproxy/client"
+	"eiproxy/protocol"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/lxn/walk"
+	dec "github.com/lxn/walk/declarative"
+)
+
+// showSetupWizard guides through the first setup: access key, game detection, startup choices
+// and a connectivity test. The config is saved only if the wizard is finished.
+func showSetupWizard() bool {
+	var dlg *walk.Dialog
+	var pages [4]*walk.Composite
+	var keyEdit *walk.LineEdit
+	var gameLabel *walk.Label
+	var autoStartCb, autoConnectCb *walk.CheckBox
+	var testLog *walk.TextEdit
+	var btnBack, btnNext, btnCancel, btnTest *walk.PushButton
+
+	page := 0
+	key := ""
+	testRunning := false
+
+	showPage := func(i int) {
+		page = i
+		for j, p := range pages {
+			p.SetVisible(j == i)
+		}
+		btnBack.SetEnabled(i > 0)
+		if i == len(pages)-1 {
+			_ = btnNext.SetText(tr("Finish"))
+		} else {
+			_ = btnNext.SetText(tr("Next"))
+		}
+		btnNext.SetEnabled(i != 0 || keyEdit.Text() != "")
+	}
+
+	runTest := func() {
+		userKey, err := protocol.UserKeyFromString(key)
+		if err != nil {
+			return
+		}
+		clientCfg, err := newClientConfig(userKey, client.DefaultLocalMasterAddr)
+		if err != nil {
+			_ = testLog.SetText(trf("Invalid server settings in eiproxy.json: %v", err))
+			return
+		}
+		testRunning = true
+		btnTest.SetEnabled(false)
+		btnBack.SetEnabled(false)
+		btnNext.SetEnabled(false)
+		_ = testLog.SetText("")
+		go func() {
+			failed := 0
+			client.Diagnose(context.Background(), clientCfg, client.DefaultSTUNServers, func(r client.DiagnosticResult) {
+				if r.Status == client.DiagnosticFailed {
+					failed++
+				}
+				log.Printf("Setup test: %s: %s: %s", r.Check, r.Status, r.Details)
+				line := fmt.Sprintf("[%s] %s: %s\r\n", tr(r.Status.String()), tr(r.Check), r.Details)
+				dlg.Synchronize(func() { testLog.AppendText(line) })
+			})
+			dlg.Synchronize(func() {
+				if failed == 0 {
+					testLog.AppendText(tr("Everything is ready, press Finish to start the proxy."))
+				} else {
+					testLog.AppendText(tr("Some checks failed, the proxy might not work. " +
+						"You can finish the setup anyway and check the log later."))
+				}
+				testRunning = false
+				btnTest.SetEnabled(true)
+				btnBack.SetEnabled(true)
+				btnNext.SetEnabled(true)
+			})
+		}()
+	}
+
+	next := func() {
+		switch page {
+		case 0:
+			key = keyEdit.Text()
+			if err := checkKey(key); err != nil {
+				if errors.Is(err, protocol.ErrInvalidKey) {
+					showErrorF("Invalid access key format! Please make sure you entered it correctly.")
+					return
+				}
+				showErrorF("Failed to check access key: %v", err)
+				return
+			}
+			_ = gameLabel.SetText(describeGameSettings())
+		case len(pages) - 2:
+			showPage(page + 1)
+			runTest()
+			return
+		case len(pages) - 1:
+			dlg.Accept()
+			return
+		}
+		showPage(page + 1)
+	}
+
+	keyText := tr("Please enter your access key. You can get it here: ") +
+		fmt.Sprintf(`<a id="this" href="%s">%s</a>`, webSite, webSite)
+
+	_ = dec.Dialog{
+		AssignTo:      &dlg,
+		Title:         tr("Setup"),
+		Icon:          walk.IconQuestion(),
+		Font:          dec.Font{PointSize: walk.IntFrom96DPI(10, 96)},
+		DefaultButton: &btnNext,
+		CancelButton:  &btnCancel,
+		MinSize:       dec.Size{Width: 450, Height: 300},
+		Layout:        dec.VBox{},
+		Children: []dec.Widget{
+			dec.Composite{
+				AssignTo: &pages[0],
+				Layout:   dec.VBox{MarginsZero: true},
+				Children: []dec.Widget{
+					dec.LinkLabel{
+						Text:            keyText,
+						OnLinkActivated: onLinkActivated,
+						MaxSize:         dec.Size{Width: 400},
+					},
+					dec.LineEdit{
+						AssignTo:      &keyEdit,
+						PasswordMode:  true,
+						OnTextChanged: func() { btnNext.SetEnabled(keyEdit.Text() != "") },
+					},
+					dec.VSpacer{},
+				},
+			},
+			dec.Composite{
+				AssignTo: &pages[1],
+				Visible:  false,
+				Layout:   dec.VBox{MarginsZero: true},
+				Children: []dec.Widget{
+					dec.Label{Text: tr("Game"), Font: dec.Font{PointSize: walk.IntFrom96DPI(10, 96), Bold: true}},
+					dec.Label{AssignTo: &gameLabel, MaxSize: dec.Size{Width: 400}},
+					dec.VSpacer{},
+				},
+			},
+			dec.Composite{
+				AssignTo: &pages[2],
+				Visible:  false,
+				Layout:   dec.VBox{MarginsZero: true},
+				Children: []dec.Widget{
+					dec.Label{Text: tr("Startup"), Font: dec.Font{PointSize: walk.IntFrom96DPI(10, 96), Bold: true}},
+					dec.CheckBox{
+						AssignTo: &autoStartCb,
+						Text:     tr("Start with Windows"),
+						Checked:  isAutoStartEnabled(),
+					},
+					dec.CheckBox{
+						AssignTo: &autoConnectCb,
+						Text:     tr("Start the proxy right after launch"),
+						Checked:  cfg.AutoConnect,
+					},
+					dec.VSpacer{},
+				},
+			},
+			dec.Composite{
+				AssignTo: &pages[3],
+				Visible:  false,
+				Layout:   dec.VBox{MarginsZero: true},
+				Children: []dec.Widget{
+					dec.Label{Text: tr("Connectivity test"), Font: dec.Font{PointSize: walk.IntFrom96DPI(10, 96), Bold: true}},
+					dec.TextEdit{
+						AssignTo: &testLog,
+						ReadOnly: true,
+						VScroll:  true,
+						Font:     dec.Font{PointSize: walk.IntFrom96DPI(9, 96)},
+					},
+				},
+			},
+			dec.Composite{
+				Layout: dec.HBox{MarginsZero: true},
+				Children: []dec.Widget{
+					dec.PushButton{
+						AssignTo:  &btnTest,
+						Text:      tr("Test again"),
+						Visible:   false,
+						OnClicked: runTest,
+					},
+					dec.HSpacer{},
+					dec.PushButton{
+						AssignTo:  &btnBack,
+						Text:      tr("Back"),
+						Enabled:   false,
+						OnClicked: func() { showPage(page - 1) },
+					},
+					dec.PushButton{
+						AssignTo:  &btnNext,
+						Text:      tr("Next"),
+						Enabled:   false,
+						OnClicked: next,
+					},
+					dec.PushButton{
+						AssignTo:  &btnCancel,
+						Text:      tr("Cancel"),
+						OnClicked: func() { dlg.Cancel() },
+					},
+				},
+			},
+		},
+	}.Create(getAndShowMainWindow())
+
+	// Test button belongs only to the last page.
+	pages[len(pages)-1].VisibleChanged().Attach(func() {
+		btnTest.SetVisible(pages[len(pages)-1].Visible())
+	})
+	dlg.Closing().Attach(func(canceled *bool, reason walk.CloseReason) {
+		// Results of the running test would arrive to the closed dialog.
+		if testRunning {
+			*canceled = true
+		}
+	})
+
+	applyTheme(dlg)
+	if dlg.Run() != walk.DlgCmdOK {
+		return false
+	}
+
+	cfg.UserKey = key
+	cfg.AutoConnect = autoConnectCb.Checked()
+	saveConfig()
+	if autoStartCb.Checked() != isAutoStartEnabled() {
+		toggleAutoStart(autoStartCb.Checked())
+	}
+	return true
+}
+
+// describeGameSettings tells whether the game has been found by its settings in the registry.
+func describeGameSettings() string {
+	found := registryKeyExists(HKCU, gameKeyPath) ||
+		(cfg.OverrideMachineRegistry && registryKeyExists(HKLM, gameKeyPath))
+	starter := registryKeyExists(HKCU, starterKeyPath)
+	switch {
+	case found && starter:
+		return tr("Evil Islands and EI Starter are found. The proxy points them to the local " +
+			"master server while it's running.")
+	case found:
+		return tr("Evil Islands is found. The proxy points it to the local master server while " +
+			"it's running.")
+	case starter:
+		return tr("EI Starter is found. The proxy points it to the local master server while " +
+			"it's running.")
+	default:
+		return tr("Evil Islands settings aren't found. Run the game once, so it creates them, " +
+			"otherwise the game won't see the proxy. You can continue the setup anyway.")
+	}
+}
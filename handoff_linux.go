@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+)
+
+// handoffFDEnv is the environment variable with the descriptor of the socket connected to the
+// proxy server, which is passed to the new binary on upgrade.
+const handoffFDEnv = "EIPROXY_HANDOFF_FD"
+
+// handoffRequests returns a channel receiving requests to hand the session over to a new
+// binary, sent with SIGUSR2.
+func handoffRequests() <-chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR2)
+	return ch
+}
+
+// inheritedProxyConn returns the connection to the proxy server passed by the previous process
+// on upgrade, or nil.
+func inheritedProxyConn() net.Conn {
+	v := os.Getenv(handoffFDEnv)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(handoffFDEnv)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid %s: %v", handoffFDEnv, err)
+		return nil
+	}
+	f := os.NewFile(uintptr(fd), "proxy-conn")
+	defer f.Close()
+	conn, err := net.FileConn(f)
+	if err != nil {
+		log.Printf("Failed to use inherited connection: %v", err)
+		return nil
+	}
+	return conn
+}
+
+// execHandoff replaces the process with the executable, which might be upgraded on disk, keeping
+// the same PID, so service managers don't notice. The socket f connected to the proxy server
+// is passed to it, if set. It returns only on failure.
+func execHandoff(f *os.File) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+	env := os.Environ()
+	if f != nil {
+		// Sockets are opened with close-on-exec, clear it for the socket passed on.
+		fd := f.Fd()
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0); errno != 0 {
+			return fmt.Errorf("failed to pass socket: %w", errno)
+		}
+		env = append(env, fmt.Sprintf("%s=%d", handoffFDEnv, fd))
+	}
+	return syscall.Exec(exe, os.Args, env)
+}
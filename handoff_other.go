@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+func handoffRequests() <-chan os.Signal {
+	return nil
+}
+
+func inheritedProxyConn() net.Conn {
+	return nil
+}
+
+func execHandoff(f *os.File) error {
+	return errors.New("handoff to a new binary is only supported on Linux")
+}
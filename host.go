@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"eiproxy/client"
+	"eiproxy/control"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// hostConfig is the config of the host mode, which turns a small always-on box into
+// a permanent game server behind NAT: it launches the game server, restarts it and the proxy
+// if they stop and reports their status via the control API.
+type hostConfig struct {
+	clientConfig
+	Game gameConfig
+}
+
+type gameConfig struct {
+	// Command line of the game server, e.g. ["wine", "game.exe"]. Game isn't launched if empty.
+	Command []string
+	Dir     string `json:",omitempty"`
+	// Seconds to wait before restarting the game server or the proxy. Defaults to 5.
+	RestartDelay int `json:",omitempty"`
+}
+
+const (
+	defaultHostControlAddr = "127.0.0.1:8090"
+	defaultRestartDelay    = 5 * time.Second
+	gameStopTimeout        = 10 * time.Second
+)
+
+func (c gameConfig) restartDelay() time.Duration {
+	if c.RestartDelay > 0 {
+		return time.Duration(c.RestartDelay) * time.Second
+	}
+	return defaultRestartDelay
+}
+
+// gameProcess keeps the game server running.
+type gameProcess struct {
+	cfg gameConfig
+
+	mut      sync.Mutex
+	pid      int
+	restarts int
+	lastExit string
+}
+
+func (g *gameProcess) run(ctx context.Context) {
+	for {
+		err := g.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Game server exited: %v, restarting in %v", err, g.cfg.restartDelay())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(g.cfg.restartDelay()):
+		}
+		g.mut.Lock()
+		g.restarts++
+		g.mut.Unlock()
+	}
+}
+
+func (g *gameProcess) runOnce(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, g.cfg.Command[0], g.cfg.Command[1:]...)
+	cmd.Dir = g.cfg.Dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Let the game shut down gracefully, it's killed if it doesn't exit in time.
+	cmd.Cancel = func() error {
+		if err := cmd.Process.Signal(os.Interrupt); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	cmd.WaitDelay = gameStopTimeout
+
+	if err := cmd.Start(); err != nil {
+		g.setExited(err)
+		return fmt.Errorf("failed to start: %w", err)
+	}
+	log.Printf("Game server started, pid %d", cmd.Process.Pid)
+	g.mut.Lock()
+	g.pid = cmd.Process.Pid
+	g.mut.Unlock()
+
+	err := cmd.Wait()
+	if err == nil {
+		err = errors.New("exited with status 0")
+	}
+	g.setExited(err)
+	return err
+}
+
+func (g *gameProcess) setExited(err error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.pid = 0
+	g.lastExit = err.Error()
+}
+
+func (g *gameProcess) status() *control.ProcessResponse {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return &control.ProcessResponse{
+		Running:  g.pid != 0,
+		PID:      g.pid,
+		Restarts: g.restarts,
+		LastExit: g.lastExit,
+	}
+}
+
+// runHost runs the game server and the proxy session until ctx is done.
+func runHost(ctx context.Context, cfg hostConfig) error {
+	if len(cfg.Games) > 0 {
+		return errors.New("host mode doesn't support several game servers")
+	}
+	if cfg.Control.Addr == "" {
+		cfg.Control.Addr = defaultHostControlAddr
+	}
+	if cfg.Control.RestartDelay == 0 {
+		cfg.Control.RestartDelay = int(cfg.Game.restartDelay().Seconds())
+	}
+
+	srv := control.NewServer(cfg.Control, func() client.Client { return client.New(cfg.Config) })
+	srv.SetReload(clientConfigReloader(*configPath))
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go watchConfig(ctx, *configPath, srv)
+	if len(cfg.Game.Command) > 0 {
+		game := &gameProcess{cfg: cfg.Game}
+		srv.SetGameStatus(game.status)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			game.run(ctx)
+		}()
+	} else {
+		log.Printf("Game server command isn't set, start the game server yourself")
+	}
+
+	if err := srv.StartSession(); err != nil {
+		return err
+	}
+	return srv.Run(ctx)
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"context"
 	"eiproxy/client"
+	"eiproxy/common"
+	"eiproxy/control"
+	"eiproxy/protocol"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -10,30 +13,103 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 )
 
 var (
-	mode       = flag.String("mode", "server", "Mode to run in (client or server)")
-	configPath = flag.String("config", "", "Path to config file. By default uses mode name + .json")
+	mode        = flag.String("mode", "server", "Mode to run in (client, host or server)")
+	configPath  = flag.String("config", "", "Path to config file. By default uses mode name + .json")
+	metricsAddr = flag.String("metrics-addr", "", "Address to serve Prometheus metrics on (client mode)")
+	controlAddr = flag.String("control-addr", "", "Address to serve control API on (client mode)")
+	supportMins = flag.Int("support-minutes", 0,
+		"Share logs with the relay operator for this many minutes to help debug issues (client mode)")
+	installSvc = flag.Bool("install-service", false,
+		"Install systemd service running the mode with the config and exit")
 )
 
+// clientConfig is the CLI client config file: client settings plus CLI-only ones.
+type clientConfig struct {
+	client.Config
+	Control control.Config
+
+	// Overrides user agent sent with API requests, see client.UserAgent.
+	UserAgent string `json:",omitempty"`
+}
+
 func main() {
 	flag.Parse()
 
 	if *configPath == "" {
-		*configPath = *mode + ".json"
+		*configPath = defaultConfigPath(*mode)
+	}
+
+	switch flag.Arg(0) {
+	case "status":
+		if err := runStatus(flag.Args()[1:]); err != nil {
+			log.Fatalf("Status: %v", err)
+		}
+		return
+	case "simulate":
+		if err := runSimulate(flag.Args()[1:]); err != nil {
+			log.Fatalf("Simulate: %v", err)
+		}
+		return
+	case "doctor":
+		if err := runDoctor(flag.Args()[1:]); err != nil {
+			log.Fatalf("Doctor: %v", err)
+		}
+		return
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Config (and default config on first run) is written next to the config path.
+	_ = os.MkdirAll(filepath.Dir(*configPath), 0755)
+	for _, warning := range common.SetupWarnings(filepath.Dir(*configPath)) {
+		log.Printf("Warning: %s", warning)
+	}
+
+	if *installSvc {
+		if err := installService(*mode, *configPath); err != nil {
+			log.Fatalf("Failed to install service: %v", err)
+		}
+		log.Printf("Service installed, run: systemctl enable --now eiproxy")
+		return
+	}
+
 	var err error
 	if *mode == "client" {
-		cfg := client.DefaultConfig
+		cfg := clientConfig{Config: client.DefaultConfig()}
+		readConfig(*configPath, &cfg)
+		applyClientOverrides(&cfg)
+		if *supportMins > 0 {
+			// Passing the flag is the user's consent.
+			duration := time.Duration(*supportMins) * time.Minute
+			defer client.StartSupportMode(cfg.ServerURL, cfg.UserKey, cfg.ServerFingerprint, duration)()
+		}
+		// Unlike GUI, CLI doesn't change game settings in the registry.
+		log.Printf("Point the game to the local master server 127.0.0.1 (see README)")
+		if cfg.Control.Addr != "" {
+			// Session can be stopped and started again via the API, so run until interrupted.
+			srv := control.NewServer(cfg.Control, func() client.Client { return client.New(cfg.Config) })
+			srv.SetReload(clientConfigReloader(*configPath))
+			go watchConfig(ctx, *configPath, srv)
+			if err = srv.StartSession(); err == nil {
+				err = srv.Run(ctx)
+			}
+		} else {
+			cfg.InheritedConn = inheritedProxyConn()
+			err = runWithConfigWatch(ctx, *configPath, cfg.Config)
+		}
+	} else if *mode == "host" {
+		cfg := hostConfig{clientConfig: clientConfig{Config: client.DefaultConfig()}}
 		readConfig(*configPath, &cfg)
-		err = client.New(cfg).Run(ctx)
+		applyClientOverrides(&cfg.clientConfig)
+		err = runHost(ctx, cfg)
 	} else if *mode == "server" {
 		log.Fatalf("Will be available soon")
 	} else {
@@ -50,28 +126,100 @@ func main() {
 	}
 }
 
+// applyClientOverrides applies command line flags and environment variables to the config.
+func applyClientOverrides(cfg *clientConfig) {
+	applyEnv(&cfg.Config)
+	common.UserAgent = client.UserAgent(*mode)
+	if cfg.UserAgent != "" {
+		common.UserAgent = cfg.UserAgent
+	}
+	if *metricsAddr != "" {
+		cfg.MetricsAddr = *metricsAddr
+	}
+	if *controlAddr != "" {
+		cfg.Control.Addr = *controlAddr
+	}
+	if v := os.Getenv("EIPROXY_CONTROL_TOKEN"); v != "" {
+		cfg.Control.Token = v
+	}
+}
+
+// applyEnv overrides config with EIPROXY_* environment variables, which is handy for
+// containers and systemd units.
+func applyEnv(cfg *client.Config) {
+	if v := os.Getenv("EIPROXY_MASTER_ADDR"); v != "" {
+		addr, err := client.ParseHostPort(v)
+		if err != nil {
+			log.Fatalf("Invalid EIPROXY_MASTER_ADDR: %v", err)
+		}
+		cfg.MasterAddr = addr
+	}
+	if v := os.Getenv("EIPROXY_SERVER_URL"); v != "" {
+		u, err := client.ParseURL(v)
+		if err != nil {
+			log.Fatalf("Invalid EIPROXY_SERVER_URL: %v", err)
+		}
+		cfg.ServerURL = u
+	}
+	if v := os.Getenv("EIPROXY_USER_KEY"); v != "" {
+		key, err := protocol.UserKeyFromString(v)
+		if err != nil {
+			log.Fatalf("Invalid EIPROXY_USER_KEY: %v", err)
+		}
+		cfg.UserKey = key
+	}
+}
+
 func readConfig(path string, cfg any) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			log.Printf("Config file not found, saving default config to %s", path)
+	err := parseConfig(path, cfg)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("Config file not found, saving default config to %s", path)
 
-			data, err = json.MarshalIndent(cfg, "", "  ")
-			if err != nil {
-				log.Fatalf("Failed to marshal default config: %v", err)
-			}
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal default config: %v", err)
+		}
 
-			err = os.WriteFile(path, data, 0644)
-			if err != nil {
-				log.Fatalf("Failed to write default config: %v", err)
-			}
-			return
+		err = os.WriteFile(path, data, 0644)
+		if err != nil {
+			log.Fatalf("Failed to write default config: %v", err)
 		}
-		log.Fatalf("Failed to read config: %v", err)
+		return
 	}
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+}
 
-	err = json.Unmarshal(data, cfg)
+func parseConfig(path string, cfg any) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Failed to parse config: %v", err)
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if err = json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	return nil
+}
+
+// loadClientConfig reads client settings of a single session from the config at path again.
+func loadClientConfig(path string) (client.Config, error) {
+	cfg := clientConfig{Config: client.DefaultConfig()}
+	if err := parseConfig(path, &cfg); err != nil {
+		return client.Config{}, err
+	}
+	applyClientOverrides(&cfg)
+	return cfg.Config, nil
+}
+
+// clientConfigReloader reads client settings from the config at path again for the control
+// API. Control API settings and the game server of host mode aren't reloaded.
+func clientConfigReloader(path string) control.ReloadFunc {
+	return func() (client.Config, func() client.Client, error) {
+		cfg, err := loadClientConfig(path)
+		if err != nil {
+			return client.Config{}, nil, err
+		}
+		return cfg, func() client.Client { return client.New(cfg) }, nil
 	}
 }
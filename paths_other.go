@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// defaultConfigPath returns config path used when -config flag is not set. Config in the
+// current directory is preferred for compatibility, otherwise XDG config dir is used
+// (e.g. ~/.config/eiproxy/client.json).
+func defaultConfigPath(mode string) string {
+	name := mode + ".json"
+	if _, err := os.Stat(name); err == nil || !errors.Is(err, os.ErrNotExist) {
+		return name
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(configDir, "eiproxy", name)
+}
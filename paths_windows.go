@@ -0,0 +1,6 @@
+package main
+
+// defaultConfigPath returns config path used when -config flag is not set.
+func defaultConfigPath(mode string) string {
+	return mode + ".json"
+}
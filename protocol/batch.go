@@ -0,0 +1,47 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Batches coalesce several data frames into one datagram to save per-datagram overhead:
+// type (1 byte) | (frame length (2 bytes, LE) | data frame)... Either side may send batches
+// once CapabilityBatch is enabled, which requires AddrFormatV2.
+const (
+	ProxyClientRequestTypeBatch  ProxyClientRequestType  = 'b'
+	ProxyServerResponseTypeBatch ProxyServerResponseType = 'B'
+)
+
+// BatchFrameOverhead is the number of bytes added to each frame in a batch.
+const BatchFrameOverhead = 2
+
+// MaxBatchSize keeps batches below the typical path MTU, so they aren't fragmented.
+const MaxBatchSize = 1200
+
+// AppendBatchFrame appends length-prefixed frame to the batch started with its type byte.
+func AppendBatchFrame(batch, frame []byte) []byte {
+	batch = binary.LittleEndian.AppendUint16(batch, uint16(len(frame)))
+	return append(batch, frame...)
+}
+
+// SplitBatch returns frames of the batch. They reference batch memory.
+func SplitBatch(batch []byte) ([][]byte, error) {
+	if len(batch) == 0 {
+		return nil, fmt.Errorf("%w: empty batch", ErrInvalidFrame)
+	}
+	var frames [][]byte
+	for data := batch[1:]; len(data) > 0; {
+		if len(data) < BatchFrameOverhead {
+			return nil, fmt.Errorf("%w: truncated batch", ErrInvalidFrame)
+		}
+		size := int(binary.LittleEndian.Uint16(data))
+		data = data[BatchFrameOverhead:]
+		if size == 0 || size > len(data) {
+			return nil, fmt.Errorf("%w: bad batch frame size %d", ErrInvalidFrame, size)
+		}
+		frames = append(frames, data[:size])
+		data = data[size:]
+	}
+	return frames, nil
+}
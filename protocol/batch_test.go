@@ -0,0 +1,40 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitBatch(t *testing.T) {
+	frames := [][]byte{{4, 1, 2, 3, 4, 5, 6, 7}, {6, 9}}
+	batch := []byte{byte(ProxyClientRequestTypeBatch)}
+	for _, frame := range frames {
+		batch = AppendBatchFrame(batch, frame)
+	}
+
+	tests := []struct {
+		name    string
+		batch   []byte
+		want    [][]byte
+		wantErr error
+	}{
+		{"valid", batch, frames, nil},
+		{"no frames", batch[:1], nil, nil},
+		{"empty", nil, nil, ErrInvalidFrame},
+		{"truncated length", batch[:len(batch)-3], nil, ErrInvalidFrame},
+		{"truncated frame", batch[:len(batch)-1], nil, ErrInvalidFrame},
+		{"zero length", []byte{'b', 0, 0}, nil, ErrInvalidFrame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitBatch(tt.batch)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SplitBatch() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitBatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package protocol
+
+import "strings"
+
+// Capability is an optional protocol feature negotiated at connect time. Client lists
+// capabilities it wants in the "caps" query parameter and server replies with the subset
+// enabled for the session.
+type Capability string
+
+const (
+	// Tunnel datagrams are obfuscated with a stream keyed from the session token.
+	CapabilityObfuscation Capability = "obfs"
+	// Data frames use AddrFormatV2, which supports IPv6 peers.
+	CapabilityAddrV2 Capability = "addr-v2"
+	// Tunnel datagrams, including the token exchange, are encrypted with the session key
+	// from ConnectionResponse.EncryptionKey.
+	CapabilityEncryption Capability = "enc"
+	// Frames carry a trailing CRC-32C, so datagrams corrupted on the way are detected and
+	// dropped instead of being delivered to the game.
+	CapabilityChecksum Capability = "crc"
+	// Client that lost connection can re-attach to its session with a resume request within
+	// ConnectionResponse.ResumeGrace, keeping the same port.
+	CapabilityResume Capability = "resume"
+	// TCP streams between the game and peers are tunneled via ConnectionResponse.TCPPort,
+	// see TCPStreamRequest.
+	CapabilityTCP Capability = "tcp"
+	// Server echoes ping requests, so the client can measure round trip time and packet loss.
+	CapabilityPing Capability = "ping"
+	// Tunnel is authenticated with expiring ConnectionResponse.SignedToken instead of Token,
+	// see SignedToken.
+	CapabilitySignedToken Capability = "signed-token"
+	// Frames are compressed before other codecs are applied, see AppendCompressed.
+	CapabilityCompression Capability = "deflate"
+	// Data frames may be coalesced into batches, see ProxyClientRequestTypeBatch.
+	CapabilityBatch Capability = "batch"
+	// Server announces scheduled maintenance in the tunnel, see Maintenance.
+	CapabilityMaintenance Capability = "maint"
+	// Server reports how the session was used when it's closed, see SessionSummary.
+	CapabilitySessionSummary Capability = "summary"
+	// Server tells why it closes the session, see DisconnectReason.
+	CapabilityDisconnectReason Capability = "reason"
+)
+
+func FormatCapabilities(caps []Capability) string {
+	parts := make([]string, len(caps))
+	for i, c := range caps {
+		parts[i] = string(c)
+	}
+	return strings.Join(parts, ",")
+}
+
+func ParseCapabilities(s string) []Capability {
+	var caps []Capability
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			caps = append(caps, Capability(part))
+		}
+	}
+	return caps
+}
+
+func (r *ConnectionResponse) HasCapability(c Capability) bool {
+	for _, rc := range r.Capabilities {
+		if rc == c {
+			return true
+		}
+	}
+	return false
+}
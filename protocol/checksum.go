@@ -0,0 +1,31 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var ErrChecksumMismatch = errors.New("frame checksum mismatch")
+
+const ChecksumSize = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// AppendChecksum appends frame followed by its CRC-32C (big endian) to buf.
+func AppendChecksum(buf, frame []byte) []byte {
+	buf = append(buf, frame...)
+	return binary.BigEndian.AppendUint32(buf, crc32.Checksum(frame, castagnoli))
+}
+
+// VerifyChecksum checks the trailing CRC-32C of data and returns the frame without it.
+func VerifyChecksum(data []byte) ([]byte, error) {
+	if len(data) < ChecksumSize {
+		return nil, ErrChecksumMismatch
+	}
+	frame, sum := data[:len(data)-ChecksumSize], data[len(data)-ChecksumSize:]
+	if crc32.Checksum(frame, castagnoli) != binary.BigEndian.Uint32(sum) {
+		return nil, ErrChecksumMismatch
+	}
+	return frame, nil
+}
@@ -0,0 +1,31 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	frame := []byte("some game data")
+	data := AppendChecksum(nil, frame)
+	if len(data) != len(frame)+ChecksumSize {
+		t.Fatalf("AppendChecksum() len = %d, want %d", len(data), len(frame)+ChecksumSize)
+	}
+
+	got, err := VerifyChecksum(data)
+	if err != nil || !bytes.Equal(got, frame) {
+		t.Fatalf("VerifyChecksum() = %q, %v, want %q", got, err, frame)
+	}
+
+	for i := range data {
+		corrupted := append([]byte(nil), data...)
+		corrupted[i] ^= 0x10
+		if _, err := VerifyChecksum(corrupted); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("VerifyChecksum() with byte %d flipped: error = %v", i, err)
+		}
+	}
+	if _, err := VerifyChecksum(data[:3]); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("VerifyChecksum() of short data: error = %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sync"
+)
+
+var ErrInvalidCompressedData = errors.New("invalid compressed data")
+
+// Frames shorter than this aren't worth compressing, deflate overhead eats the gain.
+const CompressionThreshold = 128
+
+// MaxDecompressedSize limits decompressed frames, so a small datagram can't expand without bound.
+const MaxDecompressedSize = 64 * 1024
+
+const (
+	compressionNone    = 0
+	compressionDeflate = 1
+)
+
+var flateWriters = sync.Pool{New: func() any {
+	w, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return w
+}}
+
+var flateReaders = sync.Pool{New: func() any {
+	return flate.NewReader(nil)
+}}
+
+// AppendCompressed appends compressed frame to buf: method (1 byte) | payload. Frames shorter
+// than CompressionThreshold or which don't shrink are sent as is with method 0, otherwise
+// payload is raw deflate (method 1).
+func AppendCompressed(buf, frame []byte) []byte {
+	start := len(buf)
+	buf = append(buf, compressionNone)
+	if len(frame) < CompressionThreshold {
+		return append(buf, frame...)
+	}
+
+	out := bytes.NewBuffer(buf)
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(out)
+	if _, err := w.Write(frame); err == nil && w.Close() == nil && out.Len()-start-1 < len(frame) {
+		compressed := out.Bytes()
+		compressed[start] = compressionDeflate
+		return compressed
+	}
+	return append(out.Bytes()[:start+1], frame...)
+}
+
+// Decompress returns the frame of data encoded by AppendCompressed, appending it to buf if it
+// was compressed.
+func Decompress(buf, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidCompressedData
+	}
+	switch data[0] {
+	case compressionNone:
+		return data[1:], nil
+	case compressionDeflate:
+	default:
+		return nil, ErrInvalidCompressedData
+	}
+
+	r := flateReaders.Get().(io.ReadCloser)
+	defer flateReaders.Put(r)
+	if err := r.(flate.Resetter).Reset(bytes.NewReader(data[1:]), nil); err != nil {
+		return nil, ErrInvalidCompressedData
+	}
+	out := bytes.NewBuffer(buf[:0])
+	n, err := out.ReadFrom(io.LimitReader(r, MaxDecompressedSize+1))
+	if err != nil || n > MaxDecompressedSize {
+		return nil, ErrInvalidCompressedData
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	repeated := bytes.Repeat([]byte("evil islands "), 50)
+	random := make([]byte, 300)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tests := []struct {
+		name           string
+		frame          []byte
+		wantCompressed bool
+	}{
+		{"short", []byte{1, 2, 3}, false},
+		{"repeated", repeated, true},
+		{"incompressible", random, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := AppendCompressed([]byte{0xff}, tt.frame)[1:]
+			if compressed := data[0] == compressionDeflate; compressed != tt.wantCompressed {
+				t.Errorf("compressed = %v, want %v", compressed, tt.wantCompressed)
+			}
+			if tt.wantCompressed && len(data) >= len(tt.frame) {
+				t.Errorf("compressed size = %d, frame size = %d", len(data), len(tt.frame))
+			}
+			got, err := Decompress(nil, data)
+			if err != nil {
+				t.Fatalf("Decompress() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.frame) {
+				t.Errorf("Decompress() = %x, want %x", got, tt.frame)
+			}
+		})
+	}
+}
+
+func TestDecompressInvalid(t *testing.T) {
+	bomb := AppendCompressed(nil, make([]byte, MaxDecompressedSize+1))
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"unknown method", []byte{7, 1, 2}},
+		{"garbage", []byte{compressionDeflate, 0xff, 0xff, 0xff}},
+		{"too large", bomb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decompress(nil, tt.data); !errors.Is(err, ErrInvalidCompressedData) {
+				t.Errorf("Decompress() error = %v, want %v", err, ErrInvalidCompressedData)
+			}
+		})
+	}
+}
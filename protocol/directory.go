@@ -0,0 +1,27 @@
+package protocol
+
+import "time"
+
+// RelayInfo describes a relay published in the community directory.
+//
+// Self-hosted relays register themselves with POST /api/relays (authorized by operator key)
+// and refresh the registration periodically. Clients list relays with GET /api/relays.
+type RelayInfo struct {
+	Name       string `json:"name"`
+	ServerURL  string `json:"server_url"`
+	MasterAddr string `json:"master_addr,omitempty"`
+	Region     string `json:"region,omitempty"`
+	Capacity   int    `json:"capacity,omitempty"`
+	Occupancy  int    `json:"occupancy,omitempty"`
+	Operator   string `json:"operator,omitempty"` // contact of the relay operator
+	Version    string `json:"version,omitempty"`  // protocol version supported by the relay
+	// Hex SHA-256 of the public key of the ServerURL certificate, pinned by clients if set.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Set by the directory.
+	LastSeen time.Time `json:"last_seen,omitempty"`
+}
+
+type RelayListResponse struct {
+	Relays []RelayInfo `json:"relays"`
+}
@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrInvalidEncryptedData = errors.New("invalid encrypted data")
+	ErrReplayedData         = fmt.Errorf("%w: replayed datagram", ErrInvalidEncryptedData)
+)
+
+// EncryptionKeySize is the size of the session key delivered in ConnectionResponse.
+const EncryptionKeySize = 32
+
+// ReplayWindow is how many datagrams a datagram may be late by and still be accepted.
+const ReplayWindow = 64
+
+// Cipher encrypts tunnel datagrams in one direction with AES-256-GCM. The session key is
+// delivered to the client over HTTPS, so unlike Obfuscator it protects the token and the game
+// traffic from eavesdropping and tampering.
+//
+// Datagram layout: nonce (12 bytes) | sealed frame | tag (16 bytes). Nonce is a big-endian
+// counter of sealed datagrams starting at zero, so it's never reused with the session key. The
+// receiving side rejects datagrams with a counter it has seen or which are more than
+// ReplayWindow datagrams older than the newest one.
+type Cipher struct {
+	aead cipher.AEAD
+	sent atomic.Uint64
+
+	mut      sync.Mutex
+	received uint64 // newest counter opened + 1, zero if none
+	window   uint64 // bit i is set if counter received-1-i has been opened
+}
+
+// NewSessionCiphers derives separate keys for each direction from the session key, so
+// datagrams can't be reflected back to the sender.
+func NewSessionCiphers(key []byte) (clientToServer, serverToClient *Cipher, err error) {
+	if len(key) != EncryptionKeySize {
+		return nil, nil, fmt.Errorf("invalid encryption key size %d", len(key))
+	}
+	clientToServer, err = newCipher(key, "eiproxy-c2s")
+	if err != nil {
+		return nil, nil, err
+	}
+	serverToClient, err = newCipher(key, "eiproxy-s2c")
+	if err != nil {
+		return nil, nil, err
+	}
+	return clientToServer, serverToClient, nil
+}
+
+func newCipher(key []byte, label string) (*Cipher, error) {
+	h := sha256.New()
+	h.Write([]byte(label))
+	h.Write(key)
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal encrypts frame with the next nonce. The first datagram sealed by a new Cipher is
+// reproducible for the same key and frame, which test vectors rely on.
+func (c *Cipher) Seal(buf, frame []byte) []byte {
+	var nonce [12]byte // standard GCM nonce size
+	binary.BigEndian.PutUint64(nonce[4:], c.sent.Add(1)-1)
+	buf = append(buf, nonce[:]...)
+	return c.aead.Seal(buf, buf[len(buf)-len(nonce):], frame, nil)
+}
+
+func (c *Cipher) Open(buf, data []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	if len(data) < nonceSize+c.aead.Overhead() {
+		return nil, ErrInvalidEncryptedData
+	}
+	nonce := data[:nonceSize]
+	if binary.BigEndian.Uint32(nonce) != 0 {
+		return nil, ErrInvalidEncryptedData
+	}
+	frame, err := c.aead.Open(buf, nonce, data[nonceSize:], nil)
+	if err != nil {
+		return nil, ErrInvalidEncryptedData
+	}
+	// Only authentic datagrams may move the window.
+	if !c.accept(binary.BigEndian.Uint64(nonce[4:])) {
+		return nil, ErrReplayedData
+	}
+	return frame, nil
+}
+
+// accept records counter n of an opened datagram and reports whether it's new.
+func (c *Cipher) accept(n uint64) bool {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if n >= c.received {
+		if shift := n + 1 - c.received; shift < ReplayWindow {
+			c.window = c.window<<shift | 1
+		} else {
+			c.window = 1
+		}
+		c.received = n + 1
+		return true
+	}
+	age := c.received - 1 - n
+	if age >= ReplayWindow || c.window&(1<<age) != 0 {
+		return false
+	}
+	c.window |= 1 << age
+	return true
+}
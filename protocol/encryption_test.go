@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCipher(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, EncryptionKeySize)
+	c2s, s2c, err := NewSessionCiphers(key)
+	if err != nil {
+		t.Fatalf("NewSessionCiphers() error = %v", err)
+	}
+
+	frame := []byte("hello, world")
+	data := c2s.Seal(nil, frame)
+	if bytes.Contains(data, frame) {
+		t.Errorf("Seal() output contains plaintext")
+	}
+
+	got, err := c2s.Open(nil, data)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if !bytes.Equal(got, frame) {
+		t.Errorf("Open() = %q, want %q", got, frame)
+	}
+
+	// Datagram sealed for one direction can't be opened for another one.
+	if _, err := s2c.Open(nil, data); !errors.Is(err, ErrInvalidEncryptedData) {
+		t.Errorf("Open() with wrong direction error = %v, want %v", err, ErrInvalidEncryptedData)
+	}
+
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := c2s.Open(nil, tampered); !errors.Is(err, ErrInvalidEncryptedData) {
+		t.Errorf("Open() tampered error = %v, want %v", err, ErrInvalidEncryptedData)
+	}
+	if _, err := c2s.Open(nil, data[:5]); !errors.Is(err, ErrInvalidEncryptedData) {
+		t.Errorf("Open() short error = %v, want %v", err, ErrInvalidEncryptedData)
+	}
+}
+
+func TestCipherReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		open []int // indexes of sealed datagrams in the order they arrive
+		want []bool
+	}{
+		{"in order", []int{0, 1, 2}, []bool{true, true, true}},
+		{"replayed", []int{0, 1, 0, 1}, []bool{true, true, false, false}},
+		{"reordered", []int{2, 0, 1, 0}, []bool{true, true, true, false}},
+		{"within window", []int{ReplayWindow - 1, 0}, []bool{true, true}},
+		{"too old", []int{ReplayWindow, 0, 1}, []bool{true, false, true}},
+		{"jump", []int{0, 3 * ReplayWindow, 0}, []bool{true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seal, _, err := NewSessionCiphers(bytes.Repeat([]byte{7}, EncryptionKeySize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sealed [][]byte
+			for i := 0; i <= 3*ReplayWindow; i++ {
+				sealed = append(sealed, seal.Seal(nil, []byte{byte(i)}))
+			}
+			// Datagrams are opened by the peer with the same key.
+			open, _, err := NewSessionCiphers(bytes.Repeat([]byte{7}, EncryptionKeySize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, n := range tt.open {
+				_, err := open.Open(nil, sealed[n])
+				if got := err == nil; got != tt.want[i] {
+					t.Errorf("Open(#%d) error = %v, want accepted %v", n, err, tt.want[i])
+				}
+				if err != nil && !errors.Is(err, ErrReplayedData) {
+					t.Errorf("Open(#%d) error = %v, want %v", n, err, ErrReplayedData)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSessionCiphersInvalidKey(t *testing.T) {
+	if _, _, err := NewSessionCiphers([]byte{1, 2, 3}); err == nil {
+		t.Errorf("NewSessionCiphers() error = nil, want error")
+	}
+}
@@ -0,0 +1,46 @@
+package protocol
+
+// ErrorResponse is the body of API responses with an error status, so clients can show what
+// exactly went wrong instead of the bare status.
+type ErrorResponse struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message,omitempty"` // human readable details
+	// Seconds after which the request might succeed, e.g. when rate limited or under
+	// maintenance.
+	RetryAfter *int `json:"retry_after,omitempty"`
+}
+
+// ErrorCode is a machine readable reason of an API error. It's an error itself, so it can be
+// matched with errors.Is.
+type ErrorCode string
+
+const (
+	ErrorCodeUnauthorized ErrorCode = "unauthorized"
+	ErrorCodeKeyExpired   ErrorCode = "key_expired"
+	ErrorCodeMaintenance  ErrorCode = "maintenance"
+	ErrorCodeRateLimited  ErrorCode = "rate_limited"
+	ErrorCodeBadRequest   ErrorCode = "bad_request"
+	ErrorCodeNotFound     ErrorCode = "not_found"
+	ErrorCodeInternal     ErrorCode = "internal"
+)
+
+func (c ErrorCode) Error() string {
+	switch c {
+	case ErrorCodeUnauthorized:
+		return "access key is unauthorized"
+	case ErrorCodeKeyExpired:
+		return "access key has expired"
+	case ErrorCodeMaintenance:
+		return "server is under maintenance"
+	case ErrorCodeRateLimited:
+		return "too many requests"
+	case ErrorCodeBadRequest:
+		return "bad request"
+	case ErrorCodeNotFound:
+		return "not found"
+	case ErrorCodeInternal:
+		return "internal server error"
+	default:
+		return string(c)
+	}
+}
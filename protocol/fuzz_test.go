@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// Decoders get datagrams straight from the network, so they must reject any input with an
+// error instead of panicking. Run a fuzzer with e.g. go test -fuzz=FuzzAddrFormat ./protocol.
+
+func FuzzDecodeAddrData(f *testing.F) {
+	f.Add([]byte{127, 0, 0, 1, 57, 48, 1, 2, 3})
+	f.Add([]byte{127, 0, 0, 1, 57, 48})
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		addr, data, err := DecodeAddrData(frame)
+		if err != nil {
+			return
+		}
+		encoded, err := EncodeAddrData(nil, addr, data)
+		if err != nil || !bytes.Equal(encoded, frame) {
+			t.Errorf("EncodeAddrData(DecodeAddrData(%x)) = %x, %v", frame, encoded, err)
+		}
+	})
+}
+
+func FuzzAddrFormat(f *testing.F) {
+	for _, format := range []AddrFormat{AddrFormatV1, AddrFormatV2} {
+		for _, addr := range []string{"127.0.0.1:12345", "[::1]:12345"} {
+			frame, err := format.EncodeAddrData(nil, netip.MustParseAddrPort(addr), []byte{1, 2})
+			if err == nil {
+				f.Add(byte(format), frame)
+			}
+		}
+	}
+	f.Fuzz(func(t *testing.T, format byte, frame []byte) {
+		f := AddrFormat(format % 2)
+		addr, data, err := f.DecodeAddrData(frame)
+		if err != nil {
+			return
+		}
+		// IPv4-mapped addresses are encoded as IPv4, so compare decoded values.
+		encoded, err := f.EncodeAddrData(nil, addr, data)
+		if err != nil {
+			t.Fatalf("EncodeAddrData(DecodeAddrData(%x)) error = %v", frame, err)
+		}
+		gotAddr, gotData, err := f.DecodeAddrData(encoded)
+		if err != nil || gotAddr != netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port()) ||
+			!bytes.Equal(gotData, data) {
+			t.Errorf("DecodeAddrData(EncodeAddrData(%v, %x)) = %v, %x, %v", addr, data, gotAddr, gotData, err)
+		}
+	})
+}
+
+func FuzzDecodeControl(f *testing.F) {
+	f.Add(EncodePing(1))
+	f.Add(EncodePong(1))
+	f.Add(EncodeNewToken(make([]byte, SignedTokenSize)))
+	if frame, err := EncodeTCPIncoming(TCPIncoming{StreamID: 1, Port: 8888,
+		Peer: netip.MustParseAddrPort("10.0.0.1:12345")}); err == nil {
+		f.Add(frame)
+	}
+	f.Add(AppendBatchFrame([]byte{byte(ProxyServerResponseTypeBatch)}, []byte{4, 1, 2, 3, 4, 5, 6, 7}))
+	if frame, err := EncodeMaintenance(Maintenance{Start: time.Unix(1700000000, 0), Duration: time.Hour,
+		Message: "upgrade"}); err == nil {
+		f.Add(frame)
+	}
+	f.Add(EncodeDisconnect(&SessionSummary{Duration: time.Hour, PeakPeers: 4, BytesRelayed: 1 << 20},
+		DisconnectReasonKicked))
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		_, _ = DecodePing(frame)
+		_, _ = DecodePong(frame)
+		_, _ = DecodeNewToken(frame)
+		_, _ = DecodeTCPIncoming(frame)
+		_, _ = SplitBatch(frame)
+		_, _ = DecodeMaintenance(frame)
+		_, _, _ = DecodeDisconnect(frame)
+		_, _ = ParseSignedToken(frame)
+		_, _ = VerifySignedToken(frame, []byte("secret"), time.Now())
+		_, _ = ReadTCPStreamRequest(bytes.NewReader(frame))
+	})
+}
+
+func FuzzCodecs(f *testing.F) {
+	obfs := NewObfuscator(Token{1, 2, 3, 4, 5, 6})
+	seal, _, err := NewSessionCiphers(make([]byte, EncryptionKeySize))
+	if err != nil {
+		f.Fatal(err)
+	}
+	open, _, _ := NewSessionCiphers(make([]byte, EncryptionKeySize))
+	frame := []byte{4, 127, 0, 0, 1, 57, 48, 1, 2, 3}
+	f.Add(obfs.Obfuscate(nil, frame))
+	f.Add(seal.Seal(nil, frame))
+	f.Add(AppendChecksum(nil, frame))
+	f.Add(AppendCompressed(nil, bytes.Repeat(frame, 20)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = obfs.Deobfuscate(nil, data)
+		_, _ = open.Open(nil, data)
+		_, _ = VerifyChecksum(data)
+		if frame, err := Decompress(nil, data); err == nil && len(frame) > MaxDecompressedSize {
+			t.Errorf("Decompress() returned %d bytes", len(frame))
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Server announces scheduled maintenance to connected clients, so users learn about the downtime
+// before their sessions drop. The announcement may be repeated, e.g. after the session is
+// resumed, and the latest one replaces the previous ones. Requires CapabilityMaintenance.
+const ProxyServerResponseTypeMaintenance ProxyServerResponseType = 'M'
+
+// MaxMaintenanceMessageSize limits the message of the announcement, so it fits into a datagram
+// with all codecs applied.
+const MaxMaintenanceMessageSize = 512
+
+const maintenanceHeaderSize = 1 + 8 + 4
+
+// Maintenance is a downtime of the server scheduled at Start for Duration. Zero Start cancels
+// the previously announced maintenance.
+type Maintenance struct {
+	Start    time.Time     // second precision
+	Duration time.Duration // second precision, zero if unknown
+	Message  string        // optional details for users
+}
+
+// Cancelled tells whether the announcement cancels the scheduled maintenance.
+func (m Maintenance) Cancelled() bool {
+	return m.Start.IsZero()
+}
+
+// EncodeMaintenance encodes the announcement: type (1 byte) | start (8 bytes, unix seconds, LE,
+// zero to cancel) | duration (4 bytes, seconds, LE) | message (UTF-8, up to
+// MaxMaintenanceMessageSize bytes).
+func EncodeMaintenance(m Maintenance) ([]byte, error) {
+	if len(m.Message) > MaxMaintenanceMessageSize {
+		return nil, fmt.Errorf("maintenance message is too long: %d bytes", len(m.Message))
+	}
+	var start int64
+	if !m.Cancelled() {
+		start = m.Start.Unix()
+	}
+	frame := make([]byte, 0, maintenanceHeaderSize+len(m.Message))
+	frame = append(frame, byte(ProxyServerResponseTypeMaintenance))
+	frame = binary.LittleEndian.AppendUint64(frame, uint64(start))
+	frame = binary.LittleEndian.AppendUint32(frame, uint32(m.Duration/time.Second))
+	return append(frame, m.Message...), nil
+}
+
+// DecodeMaintenance returns the announcement of the maintenance.
+func DecodeMaintenance(frame []byte) (Maintenance, error) {
+	if len(frame) < maintenanceHeaderSize ||
+		ProxyServerResponseType(frame[0]) != ProxyServerResponseTypeMaintenance {
+		return Maintenance{}, fmt.Errorf("%w: not a maintenance announcement", ErrInvalidFrame)
+	}
+	if len(frame) > maintenanceHeaderSize+MaxMaintenanceMessageSize {
+		return Maintenance{}, fmt.Errorf("%w: maintenance message is too long", ErrInvalidFrame)
+	}
+
+	var m Maintenance
+	if start := int64(binary.LittleEndian.Uint64(frame[1:])); start != 0 {
+		m.Start = time.Unix(start, 0)
+	}
+	m.Duration = time.Duration(binary.LittleEndian.Uint32(frame[9:])) * time.Second
+	m.Message = string(frame[maintenanceHeaderSize:])
+	return m, nil
+}
@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Maintenance
+	}{
+		{"scheduled", Maintenance{Start: time.Unix(1700000000, 0), Duration: 30 * time.Minute,
+			Message: "Server upgrade"}},
+		{"unknown duration", Maintenance{Start: time.Unix(1700000000, 0)}},
+		{"cancelled", Maintenance{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := EncodeMaintenance(tt.m)
+			if err != nil {
+				t.Fatalf("EncodeMaintenance() = %v", err)
+			}
+			got, err := DecodeMaintenance(frame)
+			if err != nil {
+				t.Fatalf("DecodeMaintenance() = %v", err)
+			}
+			if !got.Start.Equal(tt.m.Start) || got.Duration != tt.m.Duration || got.Message != tt.m.Message {
+				t.Errorf("DecodeMaintenance() = %+v, want %+v", got, tt.m)
+			}
+			if got.Cancelled() != tt.m.Start.IsZero() {
+				t.Errorf("Cancelled() = %v", got.Cancelled())
+			}
+		})
+	}
+
+	long := Maintenance{Start: time.Unix(1700000000, 0), Message: strings.Repeat("x", MaxMaintenanceMessageSize+1)}
+	if _, err := EncodeMaintenance(long); err == nil {
+		t.Errorf("EncodeMaintenance() with a long message succeeded")
+	}
+
+	valid, _ := EncodeMaintenance(Maintenance{Start: time.Unix(1700000000, 0)})
+	for _, frame := range [][]byte{nil, valid[:maintenanceHeaderSize-1], EncodePong(1),
+		append(valid, make([]byte, MaxMaintenanceMessageSize+1)...)} {
+		if _, err := DecodeMaintenance(frame); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("DecodeMaintenance(%x) error = %v, want %v", frame, err, ErrInvalidFrame)
+		}
+	}
+}
@@ -4,11 +4,68 @@ import "time"
 
 const Version = "1.0"
 
+// ConnectSlotParam is the connect query parameter selecting one of several simultaneous sessions
+// of the same key, so a user can host several game servers. Each slot gets its own port and
+// token. Missing parameter means slot 0. Server replies with ConnectionCodeAlreadyConnected if
+// the slot is already in use.
+const ConnectSlotParam = "slot"
+
 type ConnectionResponse struct {
 	Token        *Token          `json:"token,omitempty"`
 	Port         *int            `json:"port,omitempty"`
 	ErrorCode    *ConnectionCode `json:"error_code,omitempty"`
 	ErrorMessage *string         `json:"error_message,omitempty"`
+	Capabilities []Capability    `json:"capabilities,omitempty"`
+	// Session key, set when CapabilityEncryption is enabled.
+	EncryptionKey []byte `json:"encryption_key,omitempty"`
+	// Liveness settings in seconds chosen by the server. Defaults are used when not set.
+	KeepAliveInterval *int `json:"keepalive_interval,omitempty"`
+	SessionTimeout    *int `json:"session_timeout,omitempty"`
+	// How long in seconds the server keeps session of a silent client for resumption.
+	ResumeGrace *int `json:"resume_grace,omitempty"`
+	// Server port accepting TCP stream connections, set when CapabilityTCP is enabled.
+	TCPPort *int `json:"tcp_port,omitempty"`
+	// Encoded SignedToken, set when CapabilitySignedToken is enabled.
+	SignedToken []byte `json:"signed_token,omitempty"`
+	// Human readable warnings about deprecated protocol features the client relies on,
+	// e.g. "protocol 1.0 support ends 2025-09-01".
+	Deprecations []string `json:"deprecations,omitempty"`
+
+	// Relay load, filled when ErrorCode is ConnectionCodeServerFull.
+	Occupancy  *int `json:"occupancy,omitempty"`
+	Capacity   *int `json:"capacity,omitempty"`
+	RetryAfter *int `json:"retry_after,omitempty"` // estimated wait in seconds
+}
+
+const (
+	DefaultKeepAliveInterval = 3 * time.Second
+	DefaultSessionTimeout    = 30 * time.Second
+)
+
+// Liveness returns how often the client should send keep alives and after how long without
+// any response from the server the session is considered dead.
+func (r *ConnectionResponse) Liveness() (keepAlive, timeout time.Duration) {
+	keepAlive, timeout = DefaultKeepAliveInterval, DefaultSessionTimeout
+	if r.KeepAliveInterval != nil && *r.KeepAliveInterval > 0 {
+		keepAlive = time.Duration(*r.KeepAliveInterval) * time.Second
+	}
+	if r.SessionTimeout != nil && *r.SessionTimeout > 0 {
+		timeout = time.Duration(*r.SessionTimeout) * time.Second
+	}
+	// Few keep alives must fit into the timeout, otherwise a single lost packet kills the session.
+	if timeout < 3*keepAlive {
+		timeout = 3 * keepAlive
+	}
+	return keepAlive, timeout
+}
+
+// ResumeGracePeriod returns how long a client can try to resume the session after losing
+// connection.
+func (r *ConnectionResponse) ResumeGracePeriod() time.Duration {
+	if r.ResumeGrace != nil && *r.ResumeGrace > 0 {
+		return time.Duration(*r.ResumeGrace) * time.Second
+	}
+	return DefaultSessionTimeout
 }
 
 type ConnectionCode byte
@@ -48,4 +105,21 @@ type UserResponse struct {
 	Port         int       `json:"port"`
 	CreationTime time.Time `json:"creation_time"`
 	LastUsedTime time.Time `json:"last_used_time"`
+	// Nil if the key never expires.
+	ExpirationTime *time.Time `json:"expiration_time,omitempty"`
+}
+
+// ServerConfig is returned by /api/config, so operators can change client settings centrally
+// instead of users editing their configs. Clients fetch it on connect, if they opt in. Fields
+// which aren't set leave client's own settings intact.
+type ServerConfig struct {
+	// Master server the game is relayed to, "host:port". It takes precedence over the client's.
+	MasterAddr *string `json:"master_addr,omitempty"`
+	// Keep alive interval in seconds used unless ConnectionResponse sets one.
+	KeepAliveInterval *int `json:"keepalive_interval,omitempty"`
+	// Optional features worth enabling on this server, e.g. CapabilityCompression on relays with
+	// a slow uplink. Clients request them in addition to the ones enabled by the user.
+	RecommendedCapabilities []Capability `json:"recommended_capabilities,omitempty"`
+	// Packet batch window in milliseconds used unless the user has set one.
+	BatchWindowMs *int `json:"batch_window_ms,omitempty"`
 }
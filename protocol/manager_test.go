@@ -0,0 +1,33 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectionResponse_Liveness(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	tests := []struct {
+		name          string
+		resp          ConnectionResponse
+		wantKeepAlive time.Duration
+		wantTimeout   time.Duration
+	}{
+		{"defaults", ConnectionResponse{}, DefaultKeepAliveInterval, DefaultSessionTimeout},
+		{"negotiated", ConnectionResponse{KeepAliveInterval: intPtr(5), SessionTimeout: intPtr(60)},
+			5 * time.Second, 60 * time.Second},
+		{"invalid ignored", ConnectionResponse{KeepAliveInterval: intPtr(0), SessionTimeout: intPtr(-1)},
+			DefaultKeepAliveInterval, DefaultSessionTimeout},
+		{"timeout too short", ConnectionResponse{KeepAliveInterval: intPtr(10), SessionTimeout: intPtr(15)},
+			10 * time.Second, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keepAlive, timeout := tt.resp.Liveness()
+			if keepAlive != tt.wantKeepAlive || timeout != tt.wantTimeout {
+				t.Errorf("Liveness() = %v, %v, want %v, %v",
+					keepAlive, timeout, tt.wantKeepAlive, tt.wantTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	mrand "math/rand"
+)
+
+var ErrInvalidObfuscatedData = errors.New("invalid obfuscated data")
+
+const (
+	obfsNonceSize  = 4
+	obfsMaxPadding = 16
+)
+
+// Obfuscator hides recognizable patterns of the tunnel traffic from naive DPI. It's NOT
+// an encryption: the key is derived from the session token, which is sent over the tunnel.
+//
+// Datagram layout: nonce (4 bytes) | xor(frame | padding | padding size (1 byte)).
+type Obfuscator struct {
+	key [sha256.Size]byte
+}
+
+func NewObfuscator(token Token) *Obfuscator {
+	o := &Obfuscator{}
+	h := sha256.New()
+	h.Write([]byte("eiproxy-obfs"))
+	h.Write(token[:])
+	h.Sum(o.key[:0])
+	return o
+}
+
+func (o *Obfuscator) Obfuscate(buf, frame []byte) []byte {
+	var nonce [obfsNonceSize]byte
+	_, _ = rand.Read(nonce[:])
+	var padding [obfsMaxPadding - 1]byte
+	n := mrand.Intn(obfsMaxPadding)
+	for i := 0; i < n; i++ {
+		padding[i] = byte(mrand.Intn(256))
+	}
+	return o.ObfuscateWith(buf, frame, nonce, padding[:n])
+}
+
+// ObfuscateWith is Obfuscate with the given nonce and padding (up to 15 bytes), so the
+// result is reproducible, e.g. in test vectors.
+func (o *Obfuscator) ObfuscateWith(buf, frame []byte, nonce [obfsNonceSize]byte, padding []byte) []byte {
+	if len(padding) >= obfsMaxPadding {
+		panic("padding is too long")
+	}
+	buf = append(buf, nonce[:]...)
+	start := len(buf)
+	buf = append(buf, frame...)
+	buf = append(buf, padding...)
+	buf = append(buf, byte(len(padding)))
+	o.xor(nonce, buf[start:])
+	return buf
+}
+
+func (o *Obfuscator) Deobfuscate(buf, data []byte) ([]byte, error) {
+	if len(data) < obfsNonceSize+1 {
+		return nil, ErrInvalidObfuscatedData
+	}
+	var nonce [obfsNonceSize]byte
+	copy(nonce[:], data)
+
+	start := len(buf)
+	buf = append(buf, data[obfsNonceSize:]...)
+	o.xor(nonce, buf[start:])
+
+	padding := int(buf[len(buf)-1])
+	if padding >= obfsMaxPadding || padding > len(buf)-start-1 {
+		return nil, ErrInvalidObfuscatedData
+	}
+	return buf[:len(buf)-padding-1], nil
+}
+
+func (o *Obfuscator) xor(nonce [obfsNonceSize]byte, data []byte) {
+	var block [sha256.Size + obfsNonceSize + 4]byte
+	copy(block[:], o.key[:])
+	copy(block[sha256.Size:], nonce[:])
+
+	for counter := uint32(0); len(data) > 0; counter++ {
+		binary.LittleEndian.PutUint32(block[sha256.Size+obfsNonceSize:], counter)
+		stream := sha256.Sum256(block[:])
+		n := len(stream)
+		if len(data) < n {
+			n = len(data)
+		}
+		for i := 0; i < n; i++ {
+			data[i] ^= stream[i]
+		}
+		data = data[n:]
+	}
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestObfuscator(t *testing.T) {
+	token := Token{1, 2, 3, 4, 5, 6}
+	o := NewObfuscator(token)
+
+	frames := [][]byte{
+		{},
+		{'k'},
+		token[:],
+		bytes.Repeat([]byte{0xAB}, 100),
+	}
+	for _, frame := range frames {
+		data := o.Obfuscate(nil, frame)
+		if len(frame) > 4 && bytes.Contains(data, frame) {
+			t.Errorf("Obfuscated data contains original frame: %v", data)
+		}
+
+		got, err := NewObfuscator(token).Deobfuscate(nil, data)
+		if err != nil {
+			t.Fatalf("Deobfuscate() error = %v", err)
+		}
+		if !bytes.Equal(got, frame) {
+			t.Errorf("Deobfuscate() = %v, want %v", got, frame)
+		}
+	}
+}
+
+func TestObfuscatorInvalidData(t *testing.T) {
+	o := NewObfuscator(Token{})
+	if _, err := o.Deobfuscate(nil, []byte{1, 2, 3}); !errors.Is(err, ErrInvalidObfuscatedData) {
+		t.Errorf("Deobfuscate() error = %v, want %v", err, ErrInvalidObfuscatedData)
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	caps := []Capability{CapabilityObfuscation, "foo"}
+	s := FormatCapabilities(caps)
+	if s != "obfs,foo" {
+		t.Errorf("FormatCapabilities() = %q", s)
+	}
+	got := ParseCapabilities(s + ", ")
+	if len(got) != 2 || got[0] != caps[0] || got[1] != caps[1] {
+		t.Errorf("ParseCapabilities() = %v, want %v", got, caps)
+	}
+}
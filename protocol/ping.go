@@ -0,0 +1,44 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Ping requests measure round trip time and packet loss between the client and the server.
+// Client sends a ping with a sequence number and server echoes it back in a pong right away,
+// without any other processing. Requires CapabilityPing.
+const (
+	ProxyClientRequestTypePing  ProxyClientRequestType  = 'p'
+	ProxyServerResponseTypePong ProxyServerResponseType = 'P'
+)
+
+const pingSize = 1 + 4
+
+// EncodePing encodes ping request: type (1 byte) | sequence number (4 bytes, LE).
+func EncodePing(seq uint32) []byte {
+	return binary.LittleEndian.AppendUint32([]byte{byte(ProxyClientRequestTypePing)}, seq)
+}
+
+// DecodePing returns sequence number of the ping request.
+func DecodePing(frame []byte) (uint32, error) {
+	return decodePingFrame(frame, byte(ProxyClientRequestTypePing))
+}
+
+// EncodePong encodes reply to the ping with the same sequence number: type (1 byte) |
+// sequence number (4 bytes, LE).
+func EncodePong(seq uint32) []byte {
+	return binary.LittleEndian.AppendUint32([]byte{byte(ProxyServerResponseTypePong)}, seq)
+}
+
+// DecodePong returns sequence number of the echoed ping.
+func DecodePong(frame []byte) (uint32, error) {
+	return decodePingFrame(frame, byte(ProxyServerResponseTypePong))
+}
+
+func decodePingFrame(frame []byte, typ byte) (uint32, error) {
+	if len(frame) != pingSize || frame[0] != typ {
+		return 0, fmt.Errorf("%w: not a ping or pong", ErrInvalidFrame)
+	}
+	return binary.LittleEndian.Uint32(frame[1:]), nil
+}
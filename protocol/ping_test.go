@@ -0,0 +1,34 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	seq, err := DecodePing(EncodePing(0x01020304))
+	if err != nil || seq != 0x01020304 {
+		t.Errorf("DecodePing(EncodePing()) = %x, %v", seq, err)
+	}
+	seq, err = DecodePong(EncodePong(0x01020304))
+	if err != nil || seq != 0x01020304 {
+		t.Errorf("DecodePong(EncodePong()) = %x, %v", seq, err)
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"empty", nil},
+		{"ping", EncodePing(1)},
+		{"short", EncodePong(1)[:4]},
+		{"long", append(EncodePong(1), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodePong(tt.frame); !errors.Is(err, ErrInvalidFrame) {
+				t.Errorf("DecodePong() error = %v, want %v", err, ErrInvalidFrame)
+			}
+		})
+	}
+}
@@ -4,13 +4,18 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"net"
+	"net/netip"
 )
 
 var ErrInvalidToken = errors.New("invalid token")
 
 const AddrSize = 4 /*ipv4*/ + 2 /*port*/
 
+// MaxAddrSize is the maximum size of encoded address in any AddrFormat.
+const MaxAddrSize = 1 /*family*/ + 16 /*ipv6*/ + 2 /*port*/
+
 // Temporary token to auth in UDP proxy.
 type Token [AddrSize]byte
 
@@ -20,31 +25,39 @@ func NewToken() (Token, error) {
 	return token, err
 }
 
-func EncodeAddr(buf []byte, addr *net.UDPAddr) []byte {
+func EncodeAddr(buf []byte, addr *net.UDPAddr) ([]byte, error) {
 	ipv4 := addr.IP.To4()
 	if ipv4 == nil {
-		panic("only ipv4 is supported")
+		return buf, fmt.Errorf("%w: %v", ErrUnsupportedAddress, addr)
 	}
 
 	buf = append(buf, ipv4...)
 	buf = binary.LittleEndian.AppendUint16(buf, uint16(addr.Port))
-	return buf
+	return buf, nil
 }
 
-func EncodeAddrData(buf []byte, addr *net.UDPAddr, data []byte) []byte {
-	buf = EncodeAddr(buf, addr)
-	buf = append(buf, data...)
-	return buf
+// EncodeAddrData encodes data frame in AddrFormatV1. Empty data isn't allowed, as such frame
+// can't be told apart from the token.
+func EncodeAddrData(buf []byte, addr *net.UDPAddr, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return buf, fmt.Errorf("%w: empty data", ErrInvalidFrame)
+	}
+	buf, err := EncodeAddr(buf, addr)
+	if err != nil {
+		return buf, err
+	}
+	return append(buf, data...), nil
 }
 
-func DecodeAddrData(data []byte) (*net.UDPAddr, []byte) {
-	if len(data) < AddrSize {
-		panic("data is too short")
+// DecodeAddrData decodes data frame in AddrFormatV1.
+func DecodeAddrData(data []byte) (*net.UDPAddr, []byte, error) {
+	if len(data) <= AddrSize {
+		return nil, nil, fmt.Errorf("%w: too short", ErrInvalidFrame)
 	}
 	return &net.UDPAddr{
 		IP:   net.IPv4(data[0], data[1], data[2], data[3]),
 		Port: int(binary.LittleEndian.Uint16(data[4:6])),
-	}, data[6:]
+	}, data[6:], nil
 }
 
 type ProxyClientRequestType byte
@@ -52,11 +65,95 @@ type ProxyClientRequestType byte
 const (
 	ProxyClientRequestTypeKeepAlive  ProxyClientRequestType = 'k'
 	ProxyClientRequestTypeDisconnect ProxyClientRequestType = 'd'
+	// Resume request re-attaches a client that lost connection to its session, see
+	// EncodeResumeRequest. Requires CapabilityResume.
+	ProxyClientRequestTypeResume ProxyClientRequestType = 'r'
 )
 
+// EncodeResumeRequest encodes resume request: type (1 byte) | session token. Server replies
+// with ProxyServerResponseTypeResumed or ProxyServerResponseTypeSessionExpired.
+func EncodeResumeRequest(token Token) []byte {
+	return append([]byte{byte(ProxyClientRequestTypeResume)}, token[:]...)
+}
+
 type ProxyServerResponseType byte
 
 const (
 	ProxyServerResponseTypeKeepAlive  ProxyServerResponseType = 'K'
 	ProxyServerResponseTypeDisconnect ProxyServerResponseType = 'D'
+	// Replies to resume request.
+	ProxyServerResponseTypeResumed        ProxyServerResponseType = 'R'
+	ProxyServerResponseTypeSessionExpired ProxyServerResponseType = 'E'
+)
+
+var (
+	ErrInvalidFrame       = errors.New("invalid frame")
+	ErrUnsupportedAddress = errors.New("unsupported address")
+)
+
+// AddrFormat defines how peer address is encoded in data frames.
+type AddrFormat byte
+
+const (
+	// AddrFormatV1 is the original format: ipv4 (4 bytes) | port (2 bytes, LE) | data.
+	AddrFormatV1 AddrFormat = iota
+	// AddrFormatV2 supports IPv6 peers: family (4 or 6) | ip (4 or 16 bytes) | port (2 bytes, LE) | data.
+	// It's enabled by CapabilityAddrV2.
+	AddrFormatV2
+)
+
+const (
+	addrFamilyIPv4 = 4
+	addrFamilyIPv6 = 6
 )
+
+// IsDataFrame reports whether frame carries peer data rather than a control message.
+func (f AddrFormat) IsDataFrame(frame []byte) bool {
+	if f == AddrFormatV2 {
+		return len(frame) > 0 && (frame[0] == addrFamilyIPv4 || frame[0] == addrFamilyIPv6)
+	}
+	return len(frame) > AddrSize
+}
+
+func (f AddrFormat) EncodeAddrData(buf []byte, addr netip.AddrPort, data []byte) ([]byte, error) {
+	ip := addr.Addr().Unmap()
+	switch {
+	case f == AddrFormatV2 && ip.Is4():
+		buf = append(buf, addrFamilyIPv4)
+	case f == AddrFormatV2 && ip.Is6():
+		buf = append(buf, addrFamilyIPv6)
+	case f == AddrFormatV1 && ip.Is4():
+	default:
+		return buf, fmt.Errorf("%w: %v", ErrUnsupportedAddress, addr)
+	}
+
+	buf = append(buf, ip.AsSlice()...)
+	buf = binary.LittleEndian.AppendUint16(buf, addr.Port())
+	buf = append(buf, data...)
+	return buf, nil
+}
+
+func (f AddrFormat) DecodeAddrData(frame []byte) (netip.AddrPort, []byte, error) {
+	ipLen := net.IPv4len
+	if f == AddrFormatV2 {
+		if len(frame) == 0 {
+			return netip.AddrPort{}, nil, ErrInvalidFrame
+		}
+		switch frame[0] {
+		case addrFamilyIPv4:
+		case addrFamilyIPv6:
+			ipLen = net.IPv6len
+		default:
+			return netip.AddrPort{}, nil, fmt.Errorf("%w: unknown address family %d",
+				ErrInvalidFrame, frame[0])
+		}
+		frame = frame[1:]
+	}
+
+	if len(frame) < ipLen+2 {
+		return netip.AddrPort{}, nil, fmt.Errorf("%w: too short", ErrInvalidFrame)
+	}
+	ip, _ := netip.AddrFromSlice(frame[:ipLen])
+	port := binary.LittleEndian.Uint16(frame[ipLen:])
+	return netip.AddrPortFrom(ip, port), frame[ipLen+2:], nil
+}
@@ -2,7 +2,9 @@ package protocol
 
 import (
 	"bytes"
+	"errors"
 	"net"
+	"net/netip"
 	"testing"
 )
 
@@ -15,42 +17,37 @@ func TestEncodeAddrData(t *testing.T) {
 		data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
 		expected := []byte{127, 0, 0, 1, 57, 48, 1, 2, 3, 4, 5, 6, 7, 8}
 
-		actual := EncodeAddrData(nil, addr, data)
+		actual, err := EncodeAddrData(nil, addr, data)
+		if err != nil {
+			t.Fatal(err)
+		}
 		if !bytes.Equal(expected, actual) {
 			t.Errorf("Expected %v, got %v", expected, actual)
 		}
 	})
 
-	t.Run("EncodeAddrDataPanicIPv4", func(t *testing.T) {
-		defer func() {
-			if r := recover(); r == nil {
-				t.Fatalf("Expected panic")
-			}
-		}()
-
+	t.Run("EncodeAddrDataIPv6", func(t *testing.T) {
 		addr := &net.UDPAddr{
 			IP:   net.IPv6loopback,
 			Port: 12345,
 		}
 		data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
 
-		EncodeAddrData(nil, addr, data)
+		if _, err := EncodeAddrData(nil, addr, data); !errors.Is(err, ErrUnsupportedAddress) {
+			t.Errorf("Expected %v, got %v", ErrUnsupportedAddress, err)
+		}
 	})
 
-	t.Run("EncodeAddrDataPanicEmptyData", func(t *testing.T) {
-		defer func() {
-			if r := recover(); r == nil {
-				t.Fatalf("Expected panic")
-			}
-		}()
-
+	t.Run("EncodeAddrDataEmptyData", func(t *testing.T) {
 		addr := &net.UDPAddr{
 			IP:   net.IPv4(127, 0, 0, 1),
 			Port: 12345,
 		}
 		data := []byte{}
 
-		EncodeAddrData(nil, addr, data)
+		if _, err := EncodeAddrData(nil, addr, data); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("Expected %v, got %v", ErrInvalidFrame, err)
+		}
 	})
 }
 
@@ -63,7 +60,10 @@ func TestDecodeAddrData(t *testing.T) {
 		}
 		expectedData := []byte{1, 2, 3, 4, 5, 6, 7, 8}
 
-		actualAddr, actualData := DecodeAddrData(data)
+		actualAddr, actualData, err := DecodeAddrData(data)
+		if err != nil {
+			t.Fatal(err)
+		}
 		if !actualAddr.IP.Equal(expectedAddr.IP) || actualAddr.Port != expectedAddr.Port {
 			t.Errorf("Expected %v, got %v", expectedAddr, actualAddr)
 		}
@@ -72,15 +72,78 @@ func TestDecodeAddrData(t *testing.T) {
 		}
 	})
 
-	t.Run("DecodeAddrDataPanicShortData", func(t *testing.T) {
-		defer func() {
-			if r := recover(); r == nil {
-				t.Fatalf("Expected panic")
-			}
-		}()
-
+	t.Run("DecodeAddrDataShortData", func(t *testing.T) {
 		data := []byte{127, 0, 0, 1, 57, 48}
 
-		DecodeAddrData(data)
+		if _, _, err := DecodeAddrData(data); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("Expected %v, got %v", ErrInvalidFrame, err)
+		}
 	})
 }
+
+func TestAddrFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  AddrFormat
+		addr    netip.AddrPort
+		encoded []byte
+		wantErr error
+	}{
+		{"v1-ipv4", AddrFormatV1, netip.MustParseAddrPort("127.0.0.1:12345"),
+			[]byte{127, 0, 0, 1, 57, 48, 1, 2}, nil},
+		{"v1-ipv6", AddrFormatV1, netip.MustParseAddrPort("[::1]:12345"),
+			nil, ErrUnsupportedAddress},
+		{"v2-ipv4", AddrFormatV2, netip.MustParseAddrPort("127.0.0.1:12345"),
+			[]byte{4, 127, 0, 0, 1, 57, 48, 1, 2}, nil},
+		{"v2-ipv4-mapped", AddrFormatV2, netip.MustParseAddrPort("[::ffff:127.0.0.1]:12345"),
+			[]byte{4, 127, 0, 0, 1, 57, 48, 1, 2}, nil},
+		{"v2-ipv6", AddrFormatV2, netip.MustParseAddrPort("[2001:db8::1]:12345"),
+			[]byte{6, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 57, 48, 1, 2}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := []byte{1, 2}
+			encoded, err := tt.format.EncodeAddrData(nil, tt.addr, data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("EncodeAddrData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !bytes.Equal(encoded, tt.encoded) {
+				t.Errorf("EncodeAddrData() = %v, want %v", encoded, tt.encoded)
+			}
+			if !tt.format.IsDataFrame(encoded) {
+				t.Errorf("IsDataFrame() = false, want true")
+			}
+
+			addr, decodedData, err := tt.format.DecodeAddrData(encoded)
+			if err != nil {
+				t.Fatalf("DecodeAddrData() error = %v", err)
+			}
+			if addr != netip.AddrPortFrom(tt.addr.Addr().Unmap(), tt.addr.Port()) {
+				t.Errorf("DecodeAddrData() addr = %v, want %v", addr, tt.addr)
+			}
+			if !bytes.Equal(decodedData, data) {
+				t.Errorf("DecodeAddrData() data = %v, want %v", decodedData, data)
+			}
+		})
+	}
+}
+
+func TestAddrFormatDecodeInvalid(t *testing.T) {
+	frames := [][]byte{
+		{},
+		{4, 127, 0, 0, 1},
+		{6, 127, 0, 0, 1, 57, 48},
+		{5, 127, 0, 0, 1, 57, 48},
+	}
+	for _, frame := range frames {
+		if _, _, err := AddrFormatV2.DecodeAddrData(frame); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("DecodeAddrData(%v) error = %v, want %v", frame, err, ErrInvalidFrame)
+		}
+	}
+	if AddrFormatV2.IsDataFrame([]byte{byte(ProxyServerResponseTypeKeepAlive)}) {
+		t.Errorf("IsDataFrame() = true for keep alive")
+	}
+}
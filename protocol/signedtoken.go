@@ -0,0 +1,105 @@
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Token is valid for the whole session and could be guessed. With CapabilitySignedToken the
+// tunnel is authenticated with signed tokens instead, which expire and can't be forged without
+// the server secret. The client asks for a new token before the current one expires and uses
+// the latest one to resume the session. Signed tokens are still sent in plaintext and aren't
+// bound to the client address, so whoever sniffs one can use and refresh it as well; only
+// CapabilityEncryption keeps them from eavesdroppers.
+const (
+	// Authenticates the tunnel: type (1 byte) | signed token. Server replies with
+	// ProxyServerResponseTypeKeepAlive as for Token.
+	ProxyClientRequestTypeSignedToken ProxyClientRequestType = 's'
+	// Asks for a new signed token: type (1 byte). Server replies with
+	// ProxyServerResponseTypeNewToken.
+	ProxyClientRequestTypeRefreshToken ProxyClientRequestType = 'f'
+	// New signed token: type (1 byte) | signed token.
+	ProxyServerResponseTypeNewToken ProxyServerResponseType = 'N'
+)
+
+// SignedTokenSize is the size of encoded SignedToken.
+const SignedTokenSize = 2 + 8 + 8 + sha256.Size
+
+var ErrTokenExpired = errors.New("token expired")
+
+// SignedToken authenticates the session of the user on the port until Expiry.
+type SignedToken struct {
+	Port   uint16
+	UserID int64
+	Expiry time.Time // second precision
+}
+
+// Sign encodes the token: port (2 bytes, LE) | user id (8 bytes, LE) | expiry (8 bytes, unix
+// seconds, LE) | HMAC-SHA256 of the previous fields with the server secret.
+func (t SignedToken) Sign(secret []byte) []byte {
+	buf := binary.LittleEndian.AppendUint16(make([]byte, 0, SignedTokenSize), t.Port)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(t.UserID))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(t.Expiry.Unix()))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(buf)
+	return mac.Sum(buf)
+}
+
+// ParseSignedToken decodes the token without checking its signature, e.g. for the client to
+// know when to refresh it.
+func ParseSignedToken(data []byte) (SignedToken, error) {
+	if len(data) != SignedTokenSize {
+		return SignedToken{}, fmt.Errorf("%w: signed token is %d bytes", ErrInvalidToken, len(data))
+	}
+	return SignedToken{
+		Port:   binary.LittleEndian.Uint16(data),
+		UserID: int64(binary.LittleEndian.Uint64(data[2:])),
+		Expiry: time.Unix(int64(binary.LittleEndian.Uint64(data[10:])), 0),
+	}, nil
+}
+
+// VerifySignedToken decodes the token and checks its signature and expiry.
+func VerifySignedToken(data, secret []byte, now time.Time) (SignedToken, error) {
+	t, err := ParseSignedToken(data)
+	if err != nil {
+		return SignedToken{}, err
+	}
+	fields := data[:SignedTokenSize-sha256.Size]
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(fields)
+	if !hmac.Equal(mac.Sum(nil), data[len(fields):]) {
+		return SignedToken{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+	if !now.Before(t.Expiry) {
+		return SignedToken{}, ErrTokenExpired
+	}
+	return t, nil
+}
+
+// EncodeSignedTokenRequest encodes the request authenticating the tunnel with token.
+func EncodeSignedTokenRequest(token []byte) []byte {
+	return append([]byte{byte(ProxyClientRequestTypeSignedToken)}, token...)
+}
+
+// EncodeSignedResumeRequest encodes resume request with signed token: type (1 byte) | signed
+// token. It replaces EncodeResumeRequest with CapabilitySignedToken.
+func EncodeSignedResumeRequest(token []byte) []byte {
+	return append([]byte{byte(ProxyClientRequestTypeResume)}, token...)
+}
+
+// EncodeNewToken encodes response with a refreshed token.
+func EncodeNewToken(token []byte) []byte {
+	return append([]byte{byte(ProxyServerResponseTypeNewToken)}, token...)
+}
+
+// DecodeNewToken returns the token of the response with a refreshed token.
+func DecodeNewToken(frame []byte) ([]byte, error) {
+	if len(frame) != 1+SignedTokenSize || ProxyServerResponseType(frame[0]) != ProxyServerResponseTypeNewToken {
+		return nil, fmt.Errorf("%w: not a new token response", ErrInvalidFrame)
+	}
+	return frame[1:], nil
+}
@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignedToken(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	token := SignedToken{Port: 20001, UserID: 42, Expiry: now.Add(time.Hour)}
+	data := token.Sign(secret)
+	if len(data) != SignedTokenSize {
+		t.Fatalf("len(Sign()) = %d, want %d", len(data), SignedTokenSize)
+	}
+
+	tampered := bytes.Clone(data)
+	tampered[0]++ // another port
+
+	tests := []struct {
+		name    string
+		data    []byte
+		secret  []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", data, secret, now, nil},
+		{"expired", data, secret, now.Add(time.Hour), ErrTokenExpired},
+		{"other secret", data, []byte("other"), now, ErrInvalidToken},
+		{"tampered", tampered, secret, now, ErrInvalidToken},
+		{"short", data[:10], secret, now, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifySignedToken(tt.data, tt.secret, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifySignedToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != token {
+				t.Errorf("VerifySignedToken() = %+v, want %+v", got, token)
+			}
+		})
+	}
+
+	decoded, err := DecodeNewToken(EncodeNewToken(data))
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("DecodeNewToken(EncodeNewToken()) = %x, %v", decoded, err)
+	}
+}
@@ -0,0 +1,14 @@
+package protocol
+
+// ServerStatusResponse is public status of the relay served at GET /api/status without
+// authorization, so clients can show it before connecting.
+type ServerStatusResponse struct {
+	Version   string `json:"version"` // relay software version
+	Occupancy int    `json:"occupancy"`
+	Capacity  int    `json:"capacity,omitempty"` // zero if unlimited
+
+	// Set while the relay doesn't accept new sessions.
+	Maintenance bool `json:"maintenance,omitempty"`
+	// Announcement for users, e.g. planned maintenance window.
+	Notice string `json:"notice,omitempty"`
+}
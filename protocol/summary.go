@@ -0,0 +1,93 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const sessionSummarySize = 4 + 2 + 8
+
+// SessionSummary tells how the session was used, so hosts can see what happened during the
+// game. With CapabilitySessionSummary the server appends it to
+// ProxyServerResponseTypeDisconnect.
+type SessionSummary struct {
+	Duration     time.Duration // second precision
+	PeakPeers    int           // maximum number of peers connected at the same time
+	BytesRelayed uint64        // game data sent to and received from peers
+}
+
+// DisconnectReason tells why the server has closed the session. With
+// CapabilityDisconnectReason the server appends it to ProxyServerResponseTypeDisconnect.
+type DisconnectReason byte
+
+const (
+	DisconnectReasonUnknown     DisconnectReason = iota
+	DisconnectReasonKicked                       // closed by the relay operator
+	DisconnectReasonMaintenance                  // server goes down for maintenance
+	DisconnectReasonKeyRevoked                   // access key was revoked or has expired
+	DisconnectReasonReplaced                     // another client has connected with the same key
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case DisconnectReasonKicked:
+		return "kicked"
+	case DisconnectReasonMaintenance:
+		return "maintenance"
+	case DisconnectReasonKeyRevoked:
+		return "key revoked"
+	case DisconnectReasonReplaced:
+		return "replaced by another client"
+	default:
+		return "unknown"
+	}
+}
+
+// EncodeDisconnect encodes disconnect response: type (1 byte) | summary, if it's not nil:
+// duration (4 bytes, seconds, LE) | peak peers (2 bytes, LE) | bytes relayed (8 bytes, LE) |
+// reason (1 byte), if it's known.
+func EncodeDisconnect(summary *SessionSummary, reason DisconnectReason) []byte {
+	frame := []byte{byte(ProxyServerResponseTypeDisconnect)}
+	if summary != nil {
+		peers := summary.PeakPeers
+		if peers > 0xffff {
+			peers = 0xffff
+		}
+		frame = binary.LittleEndian.AppendUint32(frame, uint32(summary.Duration/time.Second))
+		frame = binary.LittleEndian.AppendUint16(frame, uint16(peers))
+		frame = binary.LittleEndian.AppendUint64(frame, summary.BytesRelayed)
+	}
+	if reason != DisconnectReasonUnknown {
+		frame = append(frame, byte(reason))
+	}
+	return frame
+}
+
+// DecodeDisconnect returns the summary of the disconnect response, nil if the server hasn't
+// sent it, and the reason, DisconnectReasonUnknown if the server hasn't sent it.
+func DecodeDisconnect(frame []byte) (*SessionSummary, DisconnectReason, error) {
+	if len(frame) == 0 || ProxyServerResponseType(frame[0]) != ProxyServerResponseTypeDisconnect {
+		return nil, DisconnectReasonUnknown, fmt.Errorf("%w: not a disconnect response", ErrInvalidFrame)
+	}
+	body := frame[1:]
+	reason := DisconnectReasonUnknown
+	// Sizes with and without the reason byte don't overlap.
+	if len(body) == 1 || len(body) == sessionSummarySize+1 {
+		reason = DisconnectReason(body[len(body)-1])
+		body = body[:len(body)-1]
+	}
+	switch len(body) {
+	case 0:
+		return nil, reason, nil
+	case sessionSummarySize:
+	default:
+		return nil, DisconnectReasonUnknown,
+			fmt.Errorf("%w: invalid session summary size %d", ErrInvalidFrame, len(body))
+	}
+	return &SessionSummary{
+		Duration:     time.Duration(binary.LittleEndian.Uint32(body)) * time.Second,
+		PeakPeers:    int(binary.LittleEndian.Uint16(body[4:])),
+		BytesRelayed: binary.LittleEndian.Uint64(body[6:]),
+	}, reason, nil
+}
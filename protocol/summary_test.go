@@ -0,0 +1,44 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDisconnect(t *testing.T) {
+	summary := &SessionSummary{Duration: 3*time.Hour + 15*time.Minute, PeakPeers: 7, BytesRelayed: 123456789}
+	for _, tt := range []struct {
+		summary *SessionSummary
+		reason  DisconnectReason
+	}{
+		{summary, DisconnectReasonUnknown},
+		{summary, DisconnectReasonKicked},
+		{nil, DisconnectReasonUnknown},
+		{nil, DisconnectReasonMaintenance},
+	} {
+		got, reason, err := DecodeDisconnect(EncodeDisconnect(tt.summary, tt.reason))
+		if err != nil || (got == nil) != (tt.summary == nil) || got != nil && *got != *tt.summary ||
+			reason != tt.reason {
+			t.Errorf("DecodeDisconnect(EncodeDisconnect(%+v, %v)) = %+v, %v, %v", tt.summary, tt.reason,
+				got, reason, err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"empty", nil},
+		{"keep alive", []byte{byte(ProxyServerResponseTypeKeepAlive)}},
+		{"short", EncodeDisconnect(summary, DisconnectReasonUnknown)[:sessionSummarySize]},
+		{"long", append(EncodeDisconnect(summary, DisconnectReasonKicked), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := DecodeDisconnect(tt.frame); !errors.Is(err, ErrInvalidFrame) {
+				t.Errorf("DecodeDisconnect() error = %v, want %v", err, ErrInvalidFrame)
+			}
+		})
+	}
+}
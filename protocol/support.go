@@ -0,0 +1,16 @@
+package protocol
+
+import "time"
+
+// SupportLogRequest is a batch of client log lines sent with POST /api/support/logs (authorized
+// by user key) while the user has support mode enabled.
+type SupportLogRequest struct {
+	ClientVersion string            `json:"client_version"`
+	OS            string            `json:"os"`
+	Entries       []SupportLogEntry `json:"entries"`
+}
+
+type SupportLogEntry struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+)
+
+// TCP streams are tunneled over separate TCP connections to ConnectionResponse.TCPPort, one
+// connection per stream. Connection starts with a stream request, server replies with a
+// TCPStreamStatus byte and then relays raw stream bytes. Streams aren't obfuscated or
+// encrypted by the session codecs, so clients don't use them when CapabilityEncryption is on.
+//
+// Streams opened by remote peers are announced over the datagram channel with
+// ProxyServerResponseTypeTCPIncoming, and the client accepts them with a stream request.
+// It requires CapabilityAddrV2, so announcements can't be mistaken for data frames.
+
+// TCPStreamRequestType defines what stream request asks for.
+type TCPStreamRequestType byte
+
+const (
+	// Open a new stream to the peer: token | type | peer (AddrFormatV2, no data).
+	TCPStreamRequestTypeOpen TCPStreamRequestType = 'o'
+	// Accept stream announced by the server: token | type | stream id (4 bytes, LE).
+	TCPStreamRequestTypeAccept TCPStreamRequestType = 'a'
+)
+
+type TCPStreamStatus byte
+
+const (
+	TCPStreamStatusOK     TCPStreamStatus = 'A'
+	TCPStreamStatusFailed TCPStreamStatus = 'F'
+)
+
+// Server announces incoming stream: type | stream id (4 bytes, LE) | game port (2 bytes, LE) |
+// peer (AddrFormatV2, no data).
+const ProxyServerResponseTypeTCPIncoming ProxyServerResponseType = 'T'
+
+type TCPStreamRequest struct {
+	Token    Token
+	Type     TCPStreamRequestType
+	Peer     netip.AddrPort // for TCPStreamRequestTypeOpen
+	StreamID uint32         // for TCPStreamRequestTypeAccept
+}
+
+func EncodeTCPOpenRequest(token Token, peer netip.AddrPort) ([]byte, error) {
+	buf := append(token[:], byte(TCPStreamRequestTypeOpen))
+	return AddrFormatV2.EncodeAddrData(buf, peer, nil)
+}
+
+func EncodeTCPAcceptRequest(token Token, streamID uint32) []byte {
+	buf := append(token[:], byte(TCPStreamRequestTypeAccept))
+	return binary.LittleEndian.AppendUint32(buf, streamID)
+}
+
+// ReadTCPStreamRequest reads stream request from the beginning of the stream connection.
+func ReadTCPStreamRequest(r io.Reader) (TCPStreamRequest, error) {
+	var req TCPStreamRequest
+	var head [len(Token{}) + 1]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return req, err
+	}
+	copy(req.Token[:], head[:])
+	req.Type = TCPStreamRequestType(head[len(head)-1])
+
+	switch req.Type {
+	case TCPStreamRequestTypeOpen:
+		var buf [MaxAddrSize]byte
+		if _, err := io.ReadFull(r, buf[:1]); err != nil {
+			return req, err
+		}
+		size := 1 + 4 + 2
+		if buf[0] == addrFamilyIPv6 {
+			size = 1 + 16 + 2
+		}
+		if _, err := io.ReadFull(r, buf[1:size]); err != nil {
+			return req, err
+		}
+		peer, _, err := AddrFormatV2.DecodeAddrData(buf[:size])
+		if err != nil {
+			return req, err
+		}
+		req.Peer = peer
+	case TCPStreamRequestTypeAccept:
+		var buf [4]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return req, err
+		}
+		req.StreamID = binary.LittleEndian.Uint32(buf[:])
+	default:
+		return req, fmt.Errorf("%w: unknown stream request %x", ErrInvalidFrame, req.Type)
+	}
+	return req, nil
+}
+
+// TCPIncoming is a stream opened by remote peer to the game port.
+type TCPIncoming struct {
+	StreamID uint32
+	Port     uint16
+	Peer     netip.AddrPort
+}
+
+func EncodeTCPIncoming(in TCPIncoming) ([]byte, error) {
+	buf := []byte{byte(ProxyServerResponseTypeTCPIncoming)}
+	buf = binary.LittleEndian.AppendUint32(buf, in.StreamID)
+	buf = binary.LittleEndian.AppendUint16(buf, in.Port)
+	return AddrFormatV2.EncodeAddrData(buf, in.Peer, nil)
+}
+
+func DecodeTCPIncoming(frame []byte) (TCPIncoming, error) {
+	var in TCPIncoming
+	if len(frame) < 1+4+2 || ProxyServerResponseType(frame[0]) != ProxyServerResponseTypeTCPIncoming {
+		return in, fmt.Errorf("%w: not a stream announcement", ErrInvalidFrame)
+	}
+	in.StreamID = binary.LittleEndian.Uint32(frame[1:])
+	in.Port = binary.LittleEndian.Uint16(frame[5:])
+	peer, rest, err := AddrFormatV2.DecodeAddrData(frame[7:])
+	if err != nil {
+		return in, err
+	}
+	if len(rest) != 0 {
+		return in, fmt.Errorf("%w: trailing data", ErrInvalidFrame)
+	}
+	in.Peer = peer
+	return in, nil
+}
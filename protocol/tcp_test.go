@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestTCPStreamRequest(t *testing.T) {
+	token := Token{1, 2, 3, 4, 5, 6}
+	open4, _ := EncodeTCPOpenRequest(token, netip.MustParseAddrPort("1.2.3.4:8889"))
+	open6, _ := EncodeTCPOpenRequest(token, netip.MustParseAddrPort("[2001:db8::1]:8889"))
+
+	tests := []struct {
+		name string
+		data []byte
+		want TCPStreamRequest
+	}{
+		{"open ipv4", open4, TCPStreamRequest{Token: token, Type: TCPStreamRequestTypeOpen,
+			Peer: netip.MustParseAddrPort("1.2.3.4:8889")}},
+		{"open ipv6", open6, TCPStreamRequest{Token: token, Type: TCPStreamRequestTypeOpen,
+			Peer: netip.MustParseAddrPort("[2001:db8::1]:8889")}},
+		{"accept", EncodeTCPAcceptRequest(token, 0x01020304), TCPStreamRequest{Token: token,
+			Type: TCPStreamRequestTypeAccept, StreamID: 0x01020304}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Stream data following the request must not be consumed.
+			r := bytes.NewReader(append(tt.data, "payload"...))
+			got, err := ReadTCPStreamRequest(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ReadTCPStreamRequest() = %+v, want %+v", got, tt.want)
+			}
+			if r.Len() != len("payload") {
+				t.Errorf("%d bytes left after request, want %d", r.Len(), len("payload"))
+			}
+		})
+	}
+
+	_, err := ReadTCPStreamRequest(bytes.NewReader(append(token[:], 'x')))
+	if !errors.Is(err, ErrInvalidFrame) {
+		t.Errorf("ReadTCPStreamRequest() of unknown request: error = %v", err)
+	}
+}
+
+func TestTCPIncoming(t *testing.T) {
+	in := TCPIncoming{StreamID: 7, Port: 8889, Peer: netip.MustParseAddrPort("1.2.3.4:5000")}
+	frame, err := EncodeTCPIncoming(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if AddrFormatV2.IsDataFrame(frame) {
+		t.Errorf("announcement is treated as a data frame")
+	}
+
+	got, err := DecodeTCPIncoming(frame)
+	if err != nil || got != in {
+		t.Errorf("DecodeTCPIncoming() = %+v, %v, want %+v", got, err, in)
+	}
+	if _, err := DecodeTCPIncoming(frame[:5]); !errors.Is(err, ErrInvalidFrame) {
+		t.Errorf("DecodeTCPIncoming() of short frame: error = %v", err)
+	}
+}
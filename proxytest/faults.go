@@ -0,0 +1,76 @@
+package proxytest
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Faults are network impairments applied to datagrams in both directions between clients and
+// the server. Probabilities are in [0, 1].
+type Faults struct {
+	Latency   time.Duration
+	Jitter    time.Duration // random extra delay up to this value
+	Loss      float64
+	Duplicate float64
+	// Share of datagrams held back by Latency+Jitter more, so they arrive after later ones.
+	Reorder float64
+}
+
+// link delivers datagrams with the current faults.
+type link struct {
+	mut    sync.Mutex
+	faults Faults
+	rnd    *rand.Rand
+}
+
+func newLink() *link {
+	return &link{rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+func (l *link) set(f Faults) {
+	l.mut.Lock()
+	l.faults = f
+	l.mut.Unlock()
+}
+
+// deliver passes datagram to send, possibly late, twice or never. send may be called from
+// another goroutine, so datagram is copied if needed.
+func (l *link) deliver(datagram []byte, send func([]byte)) {
+	l.mut.Lock()
+	f := l.faults
+	if f == (Faults{}) {
+		l.mut.Unlock()
+		send(datagram)
+		return
+	}
+	lost := l.rnd.Float64() < f.Loss
+	copies := 1
+	if l.rnd.Float64() < f.Duplicate {
+		copies = 2
+	}
+	delays := make([]time.Duration, copies)
+	for i := range delays {
+		delays[i] = f.Latency
+		if f.Jitter > 0 {
+			delays[i] += time.Duration(l.rnd.Int63n(int64(f.Jitter)))
+		}
+		if l.rnd.Float64() < f.Reorder {
+			delays[i] += f.Latency + f.Jitter
+		}
+	}
+	l.mut.Unlock()
+
+	if lost {
+		return
+	}
+	for _, delay := range delays {
+		datagram := bytes.Clone(datagram)
+		if delay == 0 {
+			send(datagram)
+		} else {
+			time.AfterFunc(delay, func() { send(datagram) })
+		}
+	}
+}
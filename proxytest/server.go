@@ -0,0 +1,522 @@
+// Package proxytest implements a minimal in-memory proxy server for end-to-end tests of the
+// client: connect API, UDP relay with token check, keep alives, session resumption, traffic
+// encryption and disconnects. Peers are simulated by the test with Send and Packets, network impairments with
+// SetFaults.
+package proxytest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"eiproxy/protocol"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Packet is a data frame sent by the client to a peer.
+type Packet struct {
+	Peer netip.AddrPort
+	Data []byte
+}
+
+// DefaultCapabilities are supported by the server unless Server.Capabilities is set.
+var DefaultCapabilities = []protocol.Capability{protocol.CapabilityAddrV2, protocol.CapabilityPing}
+
+type Server struct {
+	// Base URL of the connect API, used as client.Config.ServerURL.
+	URL string
+
+	// Settings read on connect, so set them before the client starts.
+	Key          string                // accepted user key, any key if empty
+	Capabilities []protocol.Capability // supported capabilities, DefaultCapabilities if nil
+	// Liveness settings in seconds sent to the client, defaults are used if zero.
+	KeepAliveInterval int
+	SessionTimeout    int
+	ResumeGrace       int
+	// Served by /api/config, which replies with 404 if it's nil.
+	Config *protocol.ServerConfig
+	// Served by /api/user.
+	User protocol.UserResponse
+	// Reject the accepted key with protocol.ErrorCodeKeyExpired.
+	KeyExpired bool
+
+	http       *httptest.Server
+	link       *link
+	packets    chan Packet
+	authorized chan struct{}
+	silent     atomic.Bool
+	disconnect atomic.Int64
+	replayed   atomic.Int64
+	requested  atomic.Pointer[[]protocol.Capability]
+
+	mut      sync.Mutex
+	sessions []*session // open sessions
+	conns    []*net.UDPConn
+}
+
+// NewServer starts the server. It must be closed with Close.
+func NewServer() *Server {
+	s := &Server{
+		packets:    make(chan Packet, 100),
+		authorized: make(chan struct{}, 100),
+		link:       newLink(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/connect", s.handleConnect)
+	mux.HandleFunc("/api/config", s.handleConfig)
+	mux.HandleFunc("/api/disconnect", s.handleDisconnect)
+	mux.HandleFunc("/api/user", s.handleUser)
+	s.http = httptest.NewServer(mux)
+	s.URL = s.http.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.http.Close()
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Packets returns data frames sent by clients to peers. Frames are dropped if nobody reads
+// them.
+func (s *Server) Packets() <-chan Packet {
+	return s.packets
+}
+
+// WaitForClient waits until a client authenticates its tunnel with the token.
+func (s *Server) WaitForClient(timeout time.Duration) error {
+	select {
+	case <-s.authorized:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("client hasn't connected")
+	}
+}
+
+// Send sends data to the last connected client as if it came from peer.
+func (s *Server) Send(peer netip.AddrPort, data []byte) error {
+	sess := s.lastSession()
+	if sess == nil {
+		return errors.New("no sessions")
+	}
+	frame, err := sess.format.EncodeAddrData(nil, peer, data)
+	if err != nil {
+		return err
+	}
+	sess.countData(peer, len(data))
+	return sess.write(frame)
+}
+
+// Disconnect closes all sessions, telling clients about it.
+func (s *Server) Disconnect() {
+	s.DisconnectWithReason(protocol.DisconnectReasonUnknown)
+}
+
+// DisconnectWithReason closes all sessions, telling clients why if they support
+// CapabilityDisconnectReason.
+func (s *Server) DisconnectWithReason(reason protocol.DisconnectReason) {
+	s.mut.Lock()
+	sessions := s.sessions
+	s.sessions = nil
+	s.mut.Unlock()
+	for _, sess := range sessions {
+		_ = sess.write(sess.disconnectResponse(reason))
+		sess.conn.Close()
+	}
+}
+
+// ExpireSessions closes all sessions without telling clients, as if their resume grace
+// period has run out. Clients resuming them get ProxyServerResponseTypeSessionExpired.
+func (s *Server) ExpireSessions() {
+	s.mut.Lock()
+	sessions := s.sessions
+	s.sessions = nil
+	s.mut.Unlock()
+	for _, sess := range sessions {
+		sess.mut.Lock()
+		sess.closed = true
+		sess.mut.Unlock()
+	}
+}
+
+// AnnounceMaintenance sends the maintenance announcement to the last connected client.
+func (s *Server) AnnounceMaintenance(m protocol.Maintenance) error {
+	sess := s.lastSession()
+	if sess == nil {
+		return errors.New("no sessions")
+	}
+	frame, err := protocol.EncodeMaintenance(m)
+	if err != nil {
+		return err
+	}
+	return sess.write(frame)
+}
+
+// SetFaults applies network impairments to all further datagrams between clients and the
+// server. Zero Faults restore the perfect network.
+func (s *Server) SetFaults(f Faults) {
+	s.link.set(f)
+}
+
+// SetSilent makes the server ignore everything clients send, as if the network went down.
+func (s *Server) SetSilent(silent bool) {
+	s.silent.Store(silent)
+}
+
+// Disconnects returns the number of sessions closed by clients.
+func (s *Server) Disconnects() int {
+	return int(s.disconnect.Load())
+}
+
+// Replayed returns the number of encrypted datagrams rejected because their nonce had already
+// been used with the session key.
+func (s *Server) Replayed() int {
+	return int(s.replayed.Load())
+}
+
+// RequestedCapabilities returns capabilities requested by the last connected client, including
+// the ones the server doesn't support.
+func (s *Server) RequestedCapabilities() []protocol.Capability {
+	if caps := s.requested.Load(); caps != nil {
+		return *caps
+	}
+	return nil
+}
+
+func (s *Server) lastSession() *session {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if len(s.sessions) == 0 {
+		return nil
+	}
+	return s.sessions[len(s.sessions)-1]
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if s.Key != "" && r.Header.Get("Authorization") != "Bearer "+s.Key {
+		writeError(w, http.StatusUnauthorized, protocol.ErrorCodeUnauthorized, "unknown access key")
+		return false
+	}
+	if s.KeyExpired {
+		writeError(w, http.StatusForbidden, protocol.ErrorCodeKeyExpired, "")
+		return false
+	}
+	return true
+}
+
+// writeError replies with protocol.ErrorResponse like the real server.
+func writeError(w http.ResponseWriter, status int, code protocol.ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(protocol.ErrorResponse{Code: code, Message: message})
+}
+
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, protocol.ErrorCodeBadRequest, "method not allowed")
+		return
+	}
+	if !s.authorize(w, r) {
+		return
+	}
+
+	supported := s.Capabilities
+	if supported == nil {
+		supported = DefaultCapabilities
+	}
+	requested := protocol.ParseCapabilities(r.URL.Query().Get("caps"))
+	s.requested.Store(&requested)
+	var caps []protocol.Capability
+	for _, c := range requested {
+		for _, sc := range supported {
+			if c == sc {
+				caps = append(caps, c)
+			}
+		}
+	}
+
+	sess, err := s.newSession(caps)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, protocol.ErrorCodeInternal, err.Error())
+		return
+	}
+	port := sess.conn.LocalAddr().(*net.UDPAddr).Port
+	resp := protocol.ConnectionResponse{Token: &sess.token, Port: &port, Capabilities: caps,
+		EncryptionKey: sess.key}
+	if s.KeepAliveInterval > 0 {
+		resp.KeepAliveInterval = &s.KeepAliveInterval
+	}
+	if s.SessionTimeout > 0 {
+		resp.SessionTimeout = &s.SessionTimeout
+	}
+	if s.ResumeGrace > 0 {
+		resp.ResumeGrace = &s.ResumeGrace
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// handleDisconnect closes all sessions, as the server doesn't track slots.
+func (s *Server) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, protocol.ErrorCodeBadRequest, "method not allowed")
+		return
+	}
+	if !s.authorize(w, r) {
+		return
+	}
+	s.Disconnect()
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.User)
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if s.Config == nil {
+		writeError(w, http.StatusNotFound, protocol.ErrorCodeNotFound, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Config)
+}
+
+// session relays frames of one client.
+type session struct {
+	srv    *Server
+	token  protocol.Token
+	conn   *net.UDPConn
+	format protocol.AddrFormat
+	ping   bool
+	resume bool
+
+	// Session key and ciphers, set with CapabilityEncryption.
+	key        []byte
+	seal, open *protocol.Cipher
+
+	// Usage of the session and the reason reported in the disconnect response.
+	summary bool
+	reason  bool
+	started time.Time
+
+	mut    sync.Mutex
+	client *net.UDPAddr // set once the client sends the token
+	closed bool
+
+	peers   map[netip.AddrPort]bool // peers the client has exchanged data with, guarded by mut
+	relayed uint64                  // data bytes sent to and received from peers, guarded by mut
+}
+
+func (s *Server) newSession(caps []protocol.Capability) (*session, error) {
+	token, err := protocol.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	resp := protocol.ConnectionResponse{Capabilities: caps}
+	sess := &session{srv: s, token: token, conn: conn, ping: resp.HasCapability(protocol.CapabilityPing)}
+	if resp.HasCapability(protocol.CapabilityAddrV2) {
+		sess.format = protocol.AddrFormatV2
+	}
+	sess.resume = resp.HasCapability(protocol.CapabilityResume)
+	sess.summary = resp.HasCapability(protocol.CapabilitySessionSummary)
+	sess.reason = resp.HasCapability(protocol.CapabilityDisconnectReason)
+	sess.started = time.Now()
+	sess.peers = make(map[netip.AddrPort]bool)
+	if resp.HasCapability(protocol.CapabilityEncryption) {
+		sess.key = make([]byte, protocol.EncryptionKeySize)
+		if _, err = rand.Read(sess.key); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// The server opens what the client seals and vice versa.
+		if sess.open, sess.seal, err = protocol.NewSessionCiphers(sess.key); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	s.mut.Lock()
+	s.sessions = append(s.sessions, sess)
+	s.conns = append(s.conns, conn)
+	s.mut.Unlock()
+	go sess.serve()
+	return sess, nil
+}
+
+func (sess *session) write(frame []byte) error {
+	sess.mut.Lock()
+	client := sess.client
+	sess.mut.Unlock()
+	if client == nil {
+		return errors.New("client hasn't connected")
+	}
+	sess.writeTo(frame, client)
+	return nil
+}
+
+func (sess *session) writeTo(frame []byte, addr *net.UDPAddr) {
+	if sess.seal != nil {
+		frame = sess.seal.Seal(nil, frame)
+	}
+	sess.srv.link.deliver(frame, func(datagram []byte) {
+		_, _ = sess.conn.WriteToUDP(datagram, addr)
+	})
+}
+
+func (sess *session) serve() {
+	defer sess.conn.Close()
+	var buf [2048]byte
+	for {
+		n, addr, err := sess.conn.ReadFromUDP(buf[:])
+		if err != nil {
+			return
+		}
+		if sess.srv.silent.Load() {
+			continue
+		}
+		sess.srv.link.deliver(buf[:n], func(frame []byte) {
+			if sess.open != nil {
+				var err error
+				if frame, err = sess.open.Open(nil, frame); err != nil {
+					if errors.Is(err, protocol.ErrReplayedData) {
+						sess.srv.replayed.Add(1)
+					}
+					return
+				}
+			}
+			sess.handle(frame, addr)
+		})
+	}
+}
+
+// handle processes a datagram from the client.
+func (sess *session) handle(frame []byte, addr *net.UDPAddr) {
+	if bytes.Equal(frame, sess.token[:]) {
+		// Client may resend the token from a new address after NAT rebinding.
+		sess.mut.Lock()
+		first := sess.client == nil
+		sess.client = addr
+		sess.mut.Unlock()
+		_ = sess.write([]byte{byte(protocol.ProxyServerResponseTypeKeepAlive)})
+		if first {
+			select {
+			case sess.srv.authorized <- struct{}{}:
+			default:
+			}
+		}
+		return
+	}
+	if sess.resume && bytes.Equal(frame, protocol.EncodeResumeRequest(sess.token)) {
+		sess.mut.Lock()
+		closed := sess.closed
+		if !closed {
+			sess.client = addr
+		}
+		sess.mut.Unlock()
+		resp := protocol.ProxyServerResponseTypeResumed
+		if closed {
+			resp = protocol.ProxyServerResponseTypeSessionExpired
+		}
+		sess.writeTo([]byte{byte(resp)}, addr)
+		return
+	}
+
+	sess.mut.Lock()
+	authorized := sess.client != nil && sess.client.String() == addr.String()
+	closed := sess.closed
+	sess.mut.Unlock()
+	if !authorized || len(frame) == 0 {
+		return
+	}
+	if closed {
+		// Client keeps asking until it hears that the session is closed.
+		if protocol.ProxyClientRequestType(frame[0]) == protocol.ProxyClientRequestTypeDisconnect {
+			_ = sess.write(sess.disconnectResponse(protocol.DisconnectReasonUnknown))
+		}
+		return
+	}
+
+	if sess.format.IsDataFrame(frame) {
+		peer, data, err := sess.format.DecodeAddrData(frame)
+		if err != nil {
+			return
+		}
+		sess.countData(peer, len(data))
+		select {
+		case sess.srv.packets <- Packet{Peer: peer, Data: bytes.Clone(data)}:
+		default:
+		}
+		return
+	}
+
+	switch protocol.ProxyClientRequestType(frame[0]) {
+	case protocol.ProxyClientRequestTypeKeepAlive:
+		_ = sess.write([]byte{byte(protocol.ProxyServerResponseTypeKeepAlive)})
+	case protocol.ProxyClientRequestTypePing:
+		if seq, err := protocol.DecodePing(frame); err == nil && sess.ping {
+			_ = sess.write(protocol.EncodePong(seq))
+		}
+	case protocol.ProxyClientRequestTypeDisconnect:
+		sess.mut.Lock()
+		sess.closed = true
+		sess.mut.Unlock()
+		sess.srv.disconnect.Add(1)
+		_ = sess.write(sess.disconnectResponse(protocol.DisconnectReasonUnknown))
+		sess.srv.removeSession(sess)
+	}
+}
+
+// countData accounts data exchanged with the peer for the session summary.
+func (sess *session) countData(peer netip.AddrPort, size int) {
+	sess.mut.Lock()
+	defer sess.mut.Unlock()
+	sess.peers[peer] = true
+	sess.relayed += uint64(size)
+}
+
+// disconnectResponse tells the client that the session is closed, with the summary and the
+// reason if the client supports them. All peers are counted as connected at the same time.
+func (sess *session) disconnectResponse(reason protocol.DisconnectReason) []byte {
+	if !sess.reason {
+		reason = protocol.DisconnectReasonUnknown
+	}
+	if !sess.summary {
+		return protocol.EncodeDisconnect(nil, reason)
+	}
+	sess.mut.Lock()
+	defer sess.mut.Unlock()
+	return protocol.EncodeDisconnect(&protocol.SessionSummary{
+		Duration:     time.Since(sess.started).Truncate(time.Second),
+		PeakPeers:    len(sess.peers),
+		BytesRelayed: sess.relayed,
+	}, reason)
+}
+
+func (s *Server) removeSession(sess *session) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for i, other := range s.sessions {
+		if other == sess {
+			s.sessions = append(s.sessions[:i], s.sessions[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"eiproxy/client"
+	"eiproxy/common"
+	"eiproxy/control"
+	"log"
+	"time"
+)
+
+// How often the config file is checked for changes.
+const configPollInterval = 2 * time.Second
+
+// watchConfig reloads the config of srv whenever the file at path changes, until ctx is done.
+func watchConfig(ctx context.Context, path string, srv *control.Server) {
+	common.WatchFile(ctx, path, configPollInterval, func() {
+		log.Printf("Config file changed, reloading")
+		if err := srv.Reload(); err != nil {
+			log.Printf("Failed to apply config changes: %v", err)
+		}
+	})
+}
+
+// runWithConfigWatch runs the client until ctx is done or it stops, applying changes of the
+// config file at path. The session is restarted if the changes can't be applied to it. On
+// handoff request the session is passed to the new binary, see execHandoff.
+func runWithConfigWatch(ctx context.Context, path string, cfg client.Config) error {
+	changed := make(chan struct{}, 1)
+	go common.WatchFile(ctx, path, configPollInterval, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	handoff := handoffRequests()
+
+	for {
+		c := client.New(cfg)
+		cfg.InheritedConn = nil // it's used by the first session only
+		sessionCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.Run(sessionCtx)
+			done <- err
+		}()
+		stop := func() {
+			cancel()
+			<-done
+		}
+
+	wait:
+		for {
+			select {
+			case err := <-done:
+				cancel()
+				return err
+			case <-changed:
+				if reloadClientConfig(path, c, &cfg) {
+					stop()
+					break wait
+				}
+			case <-handoff:
+				if handOver(c, cfg, stop) {
+					break wait
+				}
+			}
+		}
+	}
+}
+
+// reloadClientConfig applies changes of the config file at path to the running client c. It
+// returns true with the new config in cfg if the session has to be restarted for them.
+func reloadClientConfig(path string, c client.Client, cfg *client.Config) bool {
+	log.Printf("Config file changed, reloading")
+	newCfg, err := loadClientConfig(path)
+	if err != nil {
+		log.Printf("Failed to apply config changes: %v", err)
+		return false
+	}
+	if r, ok := c.(client.Reconfigurer); ok && r.Reconfigure(newCfg) {
+		return false
+	}
+	log.Printf("Restarting session to apply config changes")
+	*cfg = newCfg
+	return true
+}
+
+// handOver passes the session of c to the executable started in place of this process. The
+// session is stopped with stop, leaving it on the server, and resumed by the new binary, which
+// uses the same socket, so the game stays reachable. It returns true if the session was
+// stopped but the handoff has failed, so it has to be started again.
+func handOver(c client.Client, cfg client.Config, stop func()) bool {
+	if cfg.StateFile == "" {
+		log.Printf("Handoff requires StateFile to be set, ignoring")
+		return false
+	}
+	h, ok := c.(client.Handoffer)
+	if !ok {
+		log.Printf("Handoff isn't supported with multiple game servers, ignoring")
+		return false
+	}
+
+	log.Printf("Handing the session over to the new binary")
+	f, err := h.ProxyConnFile()
+	if err != nil {
+		log.Printf("Failed to get proxy connection, the new binary will reconnect: %v", err)
+	}
+	stop()
+	err = execHandoff(f)
+	log.Printf("Handoff failed: %v, resuming the session", err)
+	if f != nil {
+		f.Close()
+	}
+	return true
+}
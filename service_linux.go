@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const serviceUnitPath = "/etc/systemd/system/eiproxy.service"
+
+// installService writes systemd unit running eiproxy in the mode with the config, so it's
+// started on boot and restarted if it crashes.
+func installService(mode, configPath string) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	configPath, err = filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+
+	unit := strings.Join([]string{
+		"[Unit]",
+		"Description=EI Proxy",
+		"Wants=network-online.target",
+		"After=network-online.target",
+		"",
+		"[Service]",
+		fmt.Sprintf("ExecStart=%q -mode %s -config %q", exePath, mode, configPath),
+		"WorkingDirectory=" + filepath.Dir(configPath),
+		"Restart=always",
+		"RestartSec=5",
+		"",
+		"[Install]",
+		"WantedBy=multi-user.target",
+		"",
+	}, "\n")
+	if err := os.WriteFile(serviceUnitPath, []byte(unit), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", serviceUnitPath, err)
+	}
+	return nil
+}
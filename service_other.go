@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func installService(mode, configPath string) error {
+	return errors.New("service install is only supported on Linux with systemd")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// runSimulate implements the simulate command, which checks the path from the relay to the
+// game of a running instance with synthetic players before inviting real ones.
+func runSimulate(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	addr := fs.String("addr", "", "Control API address. By default taken from the config")
+	players := fs.Int("players", 3, "Number of simulated players")
+	duration := fs.Duration("duration", 10*time.Second, "How long players send packets")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	api := newControlClient(*addr)
+	ctx, cancel := context.WithTimeout(context.Background(), *duration+10*time.Second)
+	defer cancel()
+	result, err := api.Simulate(ctx, *players, *duration)
+	if err != nil {
+		return fmt.Errorf("failed to simulate players via %s: %w", api.Addr, err)
+	}
+
+	fmt.Printf("%d of %d players joined, %d packets sent, %d replies from the game\n",
+		result.Joined, result.Players, result.Sent, result.Replies)
+	if result.Joined < result.Players {
+		return errors.New("not all players reached the client, check the relay connection")
+	}
+	return nil
+}
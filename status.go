@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"eiproxy/control"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// runStatus implements the status command, which prints the status of a running instance
+// using its control API.
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	addr := fs.String("addr", "", "Control API address. By default taken from the config")
+	asJSON := fs.Bool("json", false, "Print status as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	api := newControlClient(*addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	status, err := api.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get status from %s, is the client running with control API? %w",
+			api.Addr, err)
+	}
+	stats, err := api.Stats(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get stats from %s: %w", api.Addr, err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Status control.StatusResponse `json:"status"`
+			Stats  control.StatsResponse  `json:"stats"`
+		}{status, stats})
+	}
+	printStatus(os.Stdout, status, stats)
+	return nil
+}
+
+// newControlClient returns client of the control API at addr or, if it's empty, at the address
+// from the config.
+func newControlClient(addr string) control.Client {
+	api := control.Client{Addr: addr, Token: os.Getenv("EIPROXY_CONTROL_TOKEN")}
+	var cfg clientConfig
+	if err := parseConfig(*configPath, &cfg); err == nil {
+		if api.Addr == "" {
+			api.Addr = cfg.Control.Addr
+		}
+		if api.Token == "" {
+			api.Token = cfg.Control.Token
+		}
+	}
+	if api.Addr == "" {
+		api.Addr = *controlAddr
+	}
+	if api.Addr == "" {
+		api.Addr = defaultHostControlAddr
+	}
+	return api
+}
+
+func printStatus(w io.Writer, status control.StatusResponse, stats control.StatsResponse) {
+	fmt.Fprintf(w, "State:      %s\n", status.State)
+	if status.ProxyAddr != "" {
+		fmt.Fprintf(w, "Proxy addr: %s\n", status.ProxyAddr)
+	}
+	if !status.StartedAt.IsZero() {
+		fmt.Fprintf(w, "Uptime:     %v\n", time.Since(status.StartedAt).Round(time.Second))
+	}
+	fmt.Fprintf(w, "Peers:      %d\n", len(status.Peers))
+	for _, p := range status.Peers {
+		if p.Name != "" {
+			fmt.Fprintf(w, "  %s (%s)\n", p.Addr, p.Name)
+		} else {
+			fmt.Fprintf(w, "  %s\n", p.Addr)
+		}
+	}
+	fmt.Fprintf(w, "Sent:       %s in %d packets\n", formatBytes(stats.BytesSent), stats.PacketsSent)
+	fmt.Fprintf(w, "Received:   %s in %d packets\n", formatBytes(stats.BytesReceived), stats.PacketsReceived)
+	fmt.Fprintf(w, "Dropped:    %d, corrupted %d, malformed %d\n", stats.Dropped, stats.Corrupted,
+		stats.Malformed)
+	fmt.Fprintf(w, "Usage:      up %s/s, down %s/s\n", formatBytes(uint64(stats.UploadRate)),
+		formatBytes(uint64(stats.DownloadRate)))
+	if stats.RateLimited > 0 {
+		fmt.Fprintf(w, "Limited:    %d packets over the rate limit\n", stats.RateLimited)
+	}
+	if stats.RTTMillis > 0 {
+		fmt.Fprintf(w, "Relay RTT:  %d ms, loss %.0f%%\n", stats.RTTMillis, 100*stats.PacketLoss)
+	}
+	if stats.Reconnects > 0 {
+		fmt.Fprintf(w, "Reconnects: %d\n", stats.Reconnects)
+	}
+	if status.Game != nil {
+		game := "stopped"
+		if status.Game.Running {
+			game = fmt.Sprintf("running, pid %d", status.Game.PID)
+		}
+		fmt.Fprintf(w, "Game:       %s, %d restarts\n", game, status.Game.Restarts)
+	}
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}